@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	pushURL     = flag.String("push", "", "Uploads the results and the best benchmarks of every package to the API of the rebench serve at this URL")
+	pullURL     = flag.String("pull", "", "Compares every package with its best benchmarks on the rebench serve at this URL rather than with those in its directory")
+	projectName = flag.String("project", "", "The project of the rebench serve that -push and -pull upload to and download from, the name of the directory of invocation by default")
+)
+
+// The most a record uploaded to the API may weigh
+const maxUpload = 32 << 20
+
+// The API of a rebench serve, which keeps the results, bests and history of every project in one place so a team has
+// a single source of truth. It authenticates with the bearer token in $REBENCH_STORE_TOKEN, like an HTTP -bestStore.
+type apiClient struct {
+	base, project, token string
+}
+
+func newAPIClient(rawURL, project string) (*apiClient, error) {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return nil, errors.New("-push and -pull must be http:// or https:// URLs, not " + rawURL)
+	}
+	if project == "" {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		project = filepath.Base(pwd)
+	}
+
+	return &apiClient{base: strings.TrimRight(rawURL, "/"), project: project, token: os.Getenv("REBENCH_STORE_TOKEN")}, nil
+}
+
+// The bests of the project, which are read and written like a -bestStore
+func (c *apiClient) bests() remoteStore {
+	return httpStore{base: c.base + "/api/bests/" + escapeKey(c.project), token: c.token}
+}
+
+// Uploads the results of a package's run, which the server adds to the project's history
+func (c *apiClient) pushResults(pkgPath string, results benchRecord) error {
+	raw, err := marshalRecord(results)
+	if err != nil {
+		return err
+	}
+
+	return httpStore{base: c.base + "/api/results/" + escapeKey(c.project), token: c.token}.put(pkgPath, raw)
+}
+
+// Whether the request may upload to the API, answering it if it may not. Without a token, nobody may, since anyone
+// who can reach the server could overwrite the bests otherwise.
+func (s *server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	switch {
+	case s.token == "":
+		http.Error(w, "uploads are disabled, start rebench serve with -token or $REBENCH_STORE_TOKEN to allow them", http.StatusForbidden)
+		return false
+	case r.Header.Get("Authorization") != "Bearer "+s.token:
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// Reads an uploaded record, which must be one rebench can read
+func readUpload(r *http.Request) ([]byte, benchRecord, error) {
+	raw, err := ioutil.ReadAll(io.LimitReader(r.Body, maxUpload))
+	if err != nil {
+		return nil, benchRecord{}, err
+	}
+	rec, err := unmarshalRecord(raw)
+
+	return raw, rec, err
+}
+
+// PUT /api/results/<project>/<package> stores the results of a package's run as its latest run, the one /status and
+// /metrics judge, and appends them to the project's history
+func (s *server) serveResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		http.Error(w, "results can only be PUT", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+	project, pkgPath := splitProject(strings.TrimPrefix(r.URL.Path, "/api/results/"))
+	if project == "" || pkgPath == "" {
+		http.Error(w, "results are PUT to /api/results/<project>/<package>", http.StatusBadRequest)
+		return
+	}
+	projectDir, err := s.dir(project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir, err := s.dir(path.Join(project, pkgPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	raw, rec, err := readUpload(r)
+	if err != nil {
+		http.Error(w, "invalid results: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := mkdirAll(dir); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The run was compared with the best as it is now, which /status judges it against
+	best := filepath.Join(dir, mainBestFile)
+	if _, err := os.Stat(best); err == nil {
+		if err := backupFile(best, best+".old"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := writeFile(filepath.Join(dir, ".bench_results.json"), raw); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var rev revision
+	if rec.revision != nil {
+		rev = *rec.revision
+	}
+	out := packageOutput{pkgPath: pkgPath, benches: rec.benches, metrics: rec.metrics, stats: rec.stats}
+	if err := appendHistory(filepath.Join(projectDir, historyFile), rev, out); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GET or PUT /api/bests/<project>/<package>/<file> reads or writes the best on record of a package, in
+// .bench_best.json or a branch's file with -perBranch
+func (s *server) serveBests(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(r.URL.Path, "/api/bests/")
+	project, pkgPath := splitProject(path.Dir(rel))
+	file := path.Base(rel)
+	if project == "" || pkgPath == "" || !isBestFile(file) {
+		http.Error(w, "bests are at /api/bests/<project>/<package>/.bench_best.json", http.StatusBadRequest)
+		return
+	}
+	dir, err := s.dir(path.Join(project, pkgPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		raw, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(raw)
+	case "PUT":
+		if !s.authorized(w, r) {
+			return
+		}
+		raw, _, err := readUpload(r)
+		if err != nil {
+			http.Error(w, "invalid bests: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := mkdirAll(dir); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := writeFile(filepath.Join(dir, file), raw); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	default:
+		http.Error(w, "bests can only be GET or PUT", http.StatusMethodNotAllowed)
+	}
+}
+
+// GET /api/history/<project> returns every run in the history of the project as a JSON array, oldest first, only
+// those of a package with ?package=<import path>
+func (s *server) serveHistory(w http.ResponseWriter, r *http.Request) {
+	dir, err := s.dir(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/history/"), "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries := []historyEntry{}
+	if f, err := os.Open(filepath.Join(dir, historyFile)); err == nil {
+		entries, err = readHistory(f)
+		f.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	pkgPath := r.URL.Query().Get("package")
+	kept := []historyEntry{}
+	for _, entry := range entries {
+		if pkgPath == "" || entry.Package == pkgPath {
+			kept = append(kept, entry)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(kept)
+}
+
+// Splits an API path into the project, its first element, and the import path of a package after it
+func splitProject(p string) (string, string) {
+	parts := strings.SplitN(strings.Trim(p, "/"), "/", 2)
+	if len(parts) < 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// Whether the file is .bench_best.json or the bests of a branch or environment, see branchBestFile and envBestFile
+func isBestFile(name string) bool {
+	return name == mainBestFile || (strings.HasPrefix(name, ".bench_best.") || strings.HasPrefix(name, ".bench_best@")) && strings.HasSuffix(name, ".json") && !strings.ContainsAny(name, `/\`)
+}
+
+// Uploads the results of a package to the API, then its bests unless they're left alone. The results go first, since
+// the server takes the bests it has when they arrive for those the run was compared with.
+func pushPackage(c *apiClient, pkgPath, bestFile string, results, best benchRecord, pushBests bool) {
+	if len(results.benches) > 0 {
+		if err := c.pushResults(pkgPath, results); err != nil {
+			logError("Couldn't push the results of", pkgPath, "to", c.base+":", err)
+		}
+	}
+	if pushBests && len(best.benches) > 0 {
+		if err := saveStoredRecord(c.bests(), pkgPath, bestFile, best); err != nil {
+			logError("Couldn't push the best benchmarks of", pkgPath, "to", c.base+":", err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How archived output is named, in UTC so archives from different machines sort together
+const archiveTimeFormat = "20060102T150405Z"
+
+// Creates a new file in dir named after the current time to save the raw output of go test in as it streams by.
+// Runs within the same second get a numbered suffix rather than overwriting each other.
+func createArchive(dir string) (*os.File, error) {
+	if err := mkdirAll(dir); err != nil {
+		return nil, err
+	}
+
+	name := "go_test_" + time.Now().UTC().Format(archiveTimeFormat)
+	path := filepath.Join(dir, name+".txt")
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+		if os.IsExist(err) {
+			path = filepath.Join(dir, fmt.Sprintf("%s_%d.txt", name, i))
+			continue
+		}
+
+		return f, err
+	}
+}
+
+// Closes an archive once all the output is in
+func finishArchive(f *os.File) error {
+	if err := writeAndClose(f, nil); err != nil {
+		return err
+	}
+	if err := applyPerm(f.Name(), filePerm); err != nil {
+		return err
+	}
+	if durable {
+		return syncDir(filepath.Dir(f.Name()))
+	}
+
+	return nil
+}
+
+// The lines of the latest results of a package as go test printed them, with -raw
+const rawFile = ".bench_raw.txt"
+
+// Writes the lines of the package's results in the current directory, backing up those of the previous run
+func storeRaw(lines []string) {
+	if _, err := os.Stat(rawFile); !os.IsNotExist(err) {
+		logDebug("Backing up", rawFile, "in", rawFile+".old")
+		if err := backupFile(rawFile, rawFile+".old"); err != nil {
+			logWarn("Could not back up the raw results, overwriting if possible")
+		}
+	}
+
+	if err := writeFile(rawFile, []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		logError("Couldn't write the raw results in current directory:", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "archive")
+	var names []string
+	for _, out := range []string{"first", "second"} {
+		f, err := createArchive(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(out)
+		if err := finishArchive(f); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, f.Name())
+	}
+
+	if names[0] == names[1] {
+		t.Fatalf("Expected two distinct archives, got %q twice", names[0])
+	}
+	if raw, err := ioutil.ReadFile(names[1]); err != nil || string(raw) != "second" {
+		t.Errorf("Archived the wrong output %q %v", raw, err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	top := cd(t)
+	defer cleanup(top)
+
+	opts := testOptions
+	opts.archive = dir
+	if code := rebench(opts); code != 0 {
+		t.Fatalf("Program returned non-zero exit code %d for valid invocation", code)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "go_test_*.txt"))
+	if len(files) != 1 {
+		t.Fatalf("Expected a single archive, got %v", files)
+	}
+
+	raw, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(raw), "BenchmarkSleep") {
+		t.Errorf("The archive doesn't look like go test output:\n%s", raw)
+	}
+}
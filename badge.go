@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+)
+
+var (
+	badgeFlags = flag.NewFlagSet("badge", flag.ExitOnError)
+	badgeOut   = badgeFlags.String("o", "", "The file the badge is written to, stdout when empty")
+	badgeFile  = badgeFlags.String("file", repoGeomeanFile, "The history of weighted performance indexes the latest run is read from, "+monorepoStoreDir+"/geomean.json with -monorepo")
+)
+
+// The colors of shields.io badges
+const (
+	badgeGreen  = "#4c1"
+	badgeYellow = "#dfb317"
+	badgeRed    = "#e05d44"
+)
+
+// Writes a shields-style SVG badge with the weighted performance index of the latest run against the fastest run on
+// record, for a README
+func badge(args []string, geomeanTol float64) int {
+	badgeFlags.Parse(args)
+	if badgeFlags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "rebench badge takes no arguments, e.g. rebench badge -o bench.svg")
+		return exitError
+	}
+
+	history := loadGeomeans(*badgeFile)
+	if lastIndex(history) == 0 {
+		logError("No performance index in", *badgeFile+", run rebench in this directory first")
+		return exitError
+	}
+	message, color := badgeMessage(lastIndex(history)/bestIndex(history), geomeanTol)
+
+	var buf bytes.Buffer
+	writeBadge(&buf, "bench", message, color)
+	if *badgeOut == "" {
+		os.Stdout.Write(buf.Bytes())
+		return exitOK
+	}
+	if err := writeFile(*badgeOut, buf.Bytes()); err != nil {
+		logError("Cannot write the badge:", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// The message and color of the badge for the factor between the latest index and the best, e.g. "+2.3% vs best", or
+// "OK" for a run as fast as the fastest on the whole. A factor beyond the tolerance (e.g. 1.05 for -geomeanTol=105) is
+// red, unless it's 0.
+func badgeMessage(factor, tol float64) (string, string) {
+	percent := math.Floor((factor-1)*1000+0.5) / 10
+	switch {
+	case percent <= 0:
+		return "OK", badgeGreen
+	case geomeanTooSlow(factor, tol):
+		return fmt.Sprintf("+%.1f%% vs best", percent), badgeRed
+	default:
+		return fmt.Sprintf("+%.1f%% vs best", percent), badgeYellow
+	}
+}
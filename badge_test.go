@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBadgeMessage(t *testing.T) {
+	tests := []struct {
+		geomean, tol   float64
+		message, color string
+	}{
+		{0.9, 0, "OK", badgeGreen},
+		{1.0004, 0, "OK", badgeGreen},
+		{1.023, 0, "+2.3% vs best", badgeYellow},
+		{1.023, 1.05, "+2.3% vs best", badgeYellow},
+		{1.08, 1.05, "+8.0% vs best", badgeRed},
+	}
+	for _, test := range tests {
+		if message, color := badgeMessage(test.geomean, test.tol); message != test.message || color != test.color {
+			t.Errorf("Badged a geomean of %v as %q in %s, expected %q in %s", test.geomean, message, color, test.message, test.color)
+		}
+	}
+}
+
+func TestBadge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	history, out := filepath.Join(dir, repoGeomeanFile), filepath.Join(dir, "bench.svg")
+	if code := badge([]string{"-file", history, "-o", out}, 0); code != exitError {
+		t.Errorf("rebench badge without a geomean returned %d", code)
+	}
+
+	// The latest run against the fastest one, whatever came before
+	storeGeomeans(history, appendIndex(appendIndex(appendIndex(nil, 1.5), 1), 1.023))
+	if code := badge([]string{"-file", history, "-o", out}, 0); code != 0 {
+		t.Fatalf("rebench badge returned %d", code)
+	}
+	svg, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(svg), "<svg") || !strings.Contains(string(svg), "+2.3% vs best") {
+		t.Errorf("Wrote the badge %s", svg)
+	}
+}
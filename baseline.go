@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Where named baselines are kept in a package's directory, one <name>.json per baseline
+const baselineDir = ".bench_baselines"
+
+// Baselines are named by users (e.g. after releases) and end up in file names
+func validBaselineName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.New("invalid baseline name " + name + ", it must not be empty or contain slashes")
+	}
+
+	return nil
+}
+
+// Saves the benchmarks as the named baseline of the package in dir, replacing any earlier baseline of that name
+func saveBaseline(dir, name string, benches map[string]uint64) error {
+	out, err := marshalRecord(benchRecord{benches: benches})
+	if err != nil {
+		return err
+	}
+
+	if err := mkdirAll(filepath.Join(dir, baselineDir)); err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(dir, baselineDir, name+".json"), out)
+}
+
+// Every package beneath root with either of the named baselines, keyed by its slash-separated path relative to the
+// root, with the benchmarks of each baseline (nil if it doesn't have that one). Packages in the monorepo store at the
+// root are keyed by import path.
+func loadBaselines(root string, names ...string) (map[string][]map[string]uint64, error) {
+	baselines := make(map[string][]map[string]uint64)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || info.Name() != baselineDir {
+			return nil
+		}
+
+		pkg, _ := filepath.Rel(root, filepath.Dir(path))
+		found := make([]map[string]uint64, len(names))
+		for i, name := range names {
+			found[i] = loadBaseline(filepath.Join(path, name+".json"))
+		}
+		if anyBaseline(found) {
+			baselines[filepath.ToSlash(pkg)] = found
+		}
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store := packageStore{root: filepath.Join(root, monorepoStoreDir)}
+	records, err := store.all()
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		found := make([]map[string]uint64, len(names))
+		for i, name := range names {
+			found[i] = rec.Baselines[name]
+		}
+		if anyBaseline(found) {
+			baselines[rec.Package] = found
+		}
+	}
+
+	return baselines, nil
+}
+
+// The benchmarks of a baseline, nil if there's no such baseline
+func loadBaseline(file string) map[string]uint64 {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	rec, err := unmarshalRecord(raw)
+	if err != nil {
+		return nil
+	}
+
+	return rec.benches
+}
+
+func anyBaseline(baselines []map[string]uint64) bool {
+	for _, benches := range baselines {
+		if benches != nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The commands moving records in and out of the Go benchmark format, as printed by go test -bench and read by
+// benchstat and the rest of golang.org/x/perf
+var (
+	importFlags   = flag.NewFlagSet("import", flag.ExitOnError)
+	importRoot    = importFlags.String("root", ".", "The directory beneath which packages go list doesn't know are kept, by import path")
+	importResults = importFlags.Bool("results", false, "Imports the benchmarks as the latest results rather than as the best on record")
+
+	exportFlags   = flag.NewFlagSet("export", flag.ExitOnError)
+	exportRoot    = exportFlags.String("root", ".", "The directory containing the packages to export")
+	exportResults = exportFlags.Bool("results", false, "Exports the latest results rather than the best on record")
+)
+
+// Reads benchmarks in the Go benchmark format from the files given, or stdin for -, and makes them the best on record
+// of their packages, or their latest results with -results
+func importBenchmarks(args []string) int {
+	importFlags.Parse(args)
+	if importFlags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "rebench import needs the files to import, e.g. rebench import bench.txt")
+		return exitError
+	}
+
+	outputs := make(map[string]packageOutput)
+	for _, file := range importFlags.Args() {
+		if err := readBenchFormat(file, outputs); err != nil {
+			logError("Cannot import", file+":", err)
+			return exitError
+		}
+	}
+	if len(outputs) == 0 {
+		fmt.Fprintln(os.Stderr, "No benchmark results in", strings.Join(importFlags.Args(), ", "))
+		return exitError
+	}
+
+	var patterns []string
+	for pkgPath := range outputs {
+		if pkgPath != unnamedPackage {
+			patterns = append(patterns, pkgPath)
+		}
+	}
+	var dirs map[string]string
+	if len(patterns) > 0 {
+		var err error
+		if dirs, err = discoverPackages(patterns); err != nil {
+			logWarn("Cannot list the directories of the packages with go list, keeping them all beneath", *importRoot+":", err)
+		}
+	}
+
+	file := mainBestFile
+	if *importResults {
+		file = ".bench_results.json"
+	}
+	for _, pkgPath := range sortedOutputs(outputs) {
+		dir, ok := dirs[pkgPath]
+		if !ok {
+			dir = recordsDir(*importRoot, pkgPath)
+		}
+		if err := importPackage(filepath.Join(dir, file), outputs[pkgPath], *importResults); err != nil {
+			logError("Cannot import the benchmarks of", pkgPath, "into", dir+":", err)
+			return exitError
+		}
+	}
+
+	return exitOK
+}
+
+// Parses a file in the Go benchmark format, adding the benchmarks of every package to those read before
+func readBenchFormat(file string, outputs map[string]packageOutput) error {
+	r, err := openInput(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return streamCommandOutput(r, func(out packageOutput) {
+		prev, ok := outputs[out.pkgPath]
+		if !ok {
+			outputs[out.pkgPath] = out
+			return
+		}
+		imported := benchRecord{benches: out.benches, metrics: out.metrics, stats: out.stats}
+		merged := acceptLatest(out.pkgPath, benchRecord{benches: prev.benches, metrics: prev.metrics, stats: prev.stats}, imported, func(string) bool { return true })
+		outputs[out.pkgPath] = packageOutput{pkgPath: out.pkgPath, benches: merged.benches, metrics: merged.metrics, stats: merged.stats}
+	}, nil)
+}
+
+// Writes the imported benchmarks to the record file, backing up what was there. The latest results are replaced, while
+// a best is only replaced for the benchmarks imported, like with rebench accept.
+func importPackage(file string, out packageOutput, results bool) error {
+	imported := benchRecord{benches: out.benches, metrics: out.metrics, stats: out.stats}
+	rec := imported
+	if !results {
+		rec = acceptLatest(out.pkgPath, loadRecord(file), imported, func(string) bool { return true })
+	}
+	raw, err := marshalRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := mkdirAll(filepath.Dir(file)); err != nil {
+		return err
+	}
+	if _, err := os.Stat(file); err == nil {
+		if err := backupFile(file, file+".old"); err != nil {
+			return err
+		}
+	}
+	logInfo("Importing", len(rec.benches), "benchmarks into", file)
+
+	return writeFile(file, raw)
+}
+
+func sortedOutputs(outputs map[string]packageOutput) []string {
+	pkgPaths := make([]string, 0, len(outputs))
+	for pkgPath := range outputs {
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
+
+	return pkgPaths
+}
+
+// Prints the best on record of every package beneath -root, including those in a -monorepo store at the root, in
+// the Go benchmark format, or their latest results with -results
+func exportBenchmarks(args []string) int {
+	exportFlags.Parse(args)
+	recDirs, err := recordDirs(*exportRoot)
+	if err != nil {
+		logError("Cannot look for records:", err)
+		return exitError
+	}
+
+	// Packages are named by import path where go list knows it, which is what benchstat and the like expect
+	importPaths := make(map[string]string)
+	pattern := filepath.ToSlash(filepath.Join(*exportRoot, "..."))
+	if !filepath.IsAbs(pattern) {
+		pattern = "./" + pattern
+	}
+	if dirs, err := discoverPackages([]string{pattern}); err == nil {
+		for pkgPath, dir := range dirs {
+			importPaths[realPath(dir)] = pkgPath
+		}
+	}
+	file := mainBestFile
+	if *exportResults {
+		file = ".bench_results.json"
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, pkg := range sortedKeys(recDirs) {
+		rec := loadRecord(filepath.Join(recDirs[pkg], file))
+		if abs, err := filepath.Abs(recDirs[pkg]); err == nil && importPaths[realPath(abs)] != "" {
+			pkg = importPaths[realPath(abs)]
+		}
+		writeBenchFormat(w, pkg, rec)
+	}
+
+	records, err := packageStore{root: filepath.Join(*exportRoot, monorepoStoreDir)}.all()
+	if err != nil {
+		logError("Cannot read the monorepo store:", err)
+		return exitError
+	}
+	sort.Slice(records, func(a, b int) bool { return records[a].Package < records[b].Package })
+	for _, rec := range records {
+		if *exportResults {
+			writeBenchFormat(w, rec.Package, benchRecord{benches: rec.Results, metrics: rec.Metrics, env: rec.Env})
+		} else {
+			writeBenchFormat(w, rec.Package, rec.best())
+		}
+	}
+
+	return exitOK
+}
+
+// Writes the benchmarks of a record as go test -bench prints them, after the configuration lines of the environment
+// they ran in and the package's pkg: line, e.g. "BenchmarkQuery	1	1200 ns/op	64 B/op". The iterations go test ran
+// aren't on record, so every benchmark is given 1.
+func writeBenchFormat(w io.Writer, pkg string, rec benchRecord) {
+	if len(rec.benches) == 0 {
+		return
+	}
+
+	if rec.env != nil {
+		for _, config := range [][2]string{{"goos", rec.env.GOOS}, {"goarch", rec.env.GOARCH}, {"cpu", rec.env.CPU}} {
+			if config[1] != "" {
+				fmt.Fprintf(w, "%s: %s\n", config[0], config[1])
+			}
+		}
+	}
+	if pkg != unnamedPackage {
+		fmt.Fprintf(w, "pkg: %s\n", pkg)
+	}
+	for _, name := range sortedNames(rec.benches) {
+		fmt.Fprintf(w, "%s\t1\t%d ns/op", name, rec.benches[name])
+		units := make([]string, 0, len(rec.metrics[name]))
+		for unit := range rec.metrics[name] {
+			units = append(units, unit)
+		}
+		sort.Strings(units)
+		for _, unit := range units {
+			fmt.Fprintf(w, "\t%s %s", strconv.FormatFloat(rec.metrics[name][unit], 'f', -1, 64), unit)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteBenchFormat(t *testing.T) {
+	rec := benchRecord{
+		benches: map[string]uint64{"BenchmarkB": 20, "BenchmarkA": 1200},
+		metrics: benchMetrics{"BenchmarkA": {"B/op": 64, "allocs/op": 2}},
+		env:     &environment{GOOS: "linux", GOARCH: "amd64"},
+	}
+	var buf bytes.Buffer
+	writeBenchFormat(&buf, "example.com/mod", rec)
+
+	expected := "goos: linux\ngoarch: amd64\npkg: example.com/mod\nBenchmarkA\t1\t1200 ns/op\t64 B/op\t2 allocs/op\nBenchmarkB\t1\t20 ns/op\n\n"
+	if buf.String() != expected {
+		t.Errorf("Wrote\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestImportBenchmarks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec := benchRecord{benches: map[string]uint64{"BenchmarkA": 1200, "BenchmarkB": 20}, metrics: benchMetrics{"BenchmarkA": {"B/op": 64}}}
+	var buf bytes.Buffer
+	writeBenchFormat(&buf, "example.com/fake", rec)
+	file := filepath.Join(dir, "bench.txt")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The benchmarks not imported keep their best
+	best := filepath.Join(dir, "example.com", "fake", mainBestFile)
+	writeRecord(t, best, map[string]uint64{"BenchmarkA": 1000, "BenchmarkC": 5})
+
+	if code := importBenchmarks([]string{"-root", dir, file}); code != 0 {
+		t.Fatalf("rebench import returned %d", code)
+	}
+	imported := loadRecord(best)
+	expected := map[string]uint64{"BenchmarkA": 1200, "BenchmarkB": 20, "BenchmarkC": 5}
+	if !reflect.DeepEqual(imported.benches, expected) {
+		t.Errorf("Imported the bests %v, expected %v", imported.benches, expected)
+	}
+	if !reflect.DeepEqual(imported.metrics["BenchmarkA"], rec.metrics["BenchmarkA"]) {
+		t.Errorf("Imported the metrics %v, expected %v", imported.metrics, rec.metrics)
+	}
+	if _, err := os.Stat(best + ".old"); err != nil {
+		t.Errorf("Didn't back up the best: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	bitbucket       = flag.Bool("bitbucket", false, "Reports the results to Bitbucket Cloud as a Code Insights report, and a pull request comment with -bitbucketPR")
+	bitbucketRepo   = flag.String("bitbucketRepo", os.Getenv("BITBUCKET_REPO_FULL_NAME"), "The Bitbucket repository to report to, as workspace/repo")
+	bitbucketCommit = flag.String("bitbucketCommit", os.Getenv("BITBUCKET_COMMIT"), "The commit to attach the Bitbucket Code Insights report to")
+	bitbucketPR     = flag.String("bitbucketPR", os.Getenv("BITBUCKET_PR_ID"), "The Bitbucket pull request to comment on, if any")
+	bitbucketAPI    = flag.String("bitbucketAPI", "https://api.bitbucket.org/2.0", "The base URL of the Bitbucket API")
+)
+
+// Bitbucket only keeps one report per id on a commit, so every run replaces the last one
+const bitbucketReportID = "rebench"
+
+// Reports to Bitbucket Cloud, authenticating with the access token in $BITBUCKET_TOKEN, or else the app password in
+// $BITBUCKET_USERNAME and $BITBUCKET_APP_PASSWORD
+type bitbucketReporter struct {
+	apiURL, repo, commit, pullRequest string
+}
+
+type bitbucketInsight struct {
+	Title      string                 `json:"title"`
+	Details    string                 `json:"details"`
+	ReportType string                 `json:"report_type"`
+	Reporter   string                 `json:"reporter"`
+	Result     string                 `json:"result"`
+	Data       []bitbucketInsightData `json:"data"`
+}
+
+type bitbucketInsightData struct {
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+type bitbucketAnnotation struct {
+	ExternalID     string `json:"external_id"`
+	AnnotationType string `json:"annotation_type"`
+	Summary        string `json:"summary"`
+	Severity       string `json:"severity"`
+	Result         string `json:"result"`
+}
+
+type bitbucketComment struct {
+	ID      int64 `json:"id,omitempty"`
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+}
+
+// Comments are listed a page at a time, at most 100 to a page
+const bitbucketPageSize = 100
+
+func (b bitbucketReporter) report(r runReport) error {
+	if b.repo == "" {
+		return errors.New("no repository to report to, set -bitbucketRepo or $BITBUCKET_REPO_FULL_NAME")
+	}
+	if b.commit == "" {
+		return errors.New("no commit to report on, set -bitbucketCommit or $BITBUCKET_COMMIT")
+	}
+
+	result := "PASSED"
+	if r.Failed() {
+		result = "FAILED"
+	}
+
+	repoURL := strings.TrimRight(b.apiURL, "/") + "/repositories/" + b.repo
+	reportURL := repoURL + "/commit/" + b.commit + "/reports/" + bitbucketReportID
+	insight := bitbucketInsight{
+		Title:      "rebench",
+		Details:    r.Summary(),
+		ReportType: "TEST",
+		Reporter:   "rebench",
+		Result:     result,
+		Data: []bitbucketInsightData{
+			{Title: "Too slow", Type: "NUMBER", Value: r.Count(statusSlow)},
+			{Title: "Missing", Type: "NUMBER", Value: r.Count(statusMissing)},
+			{Title: "New records", Type: "NUMBER", Value: r.Count(statusRecord)},
+		},
+	}
+	if err := b.send("PUT", reportURL, insight); err != nil {
+		return err
+	}
+
+	if annotations := bitbucketAnnotations(r); len(annotations) > 0 {
+		if err := b.send("POST", reportURL+"/annotations", annotations); err != nil {
+			return err
+		}
+	}
+
+	if b.pullRequest == "" {
+		return nil
+	}
+
+	auth, err := bitbucketAuthorization()
+	if err != nil {
+		return err
+	}
+	commentsURL := repoURL + "/pullrequests/" + b.pullRequest + "/comments"
+	return stickyComment{
+		commentsURL: commentsURL,
+		editURL:     func(id int64) string { return commentsURL + "/" + strconv.FormatInt(id, 10) },
+		editMethod:  "PUT",
+		sizeParam:   "pagelen",
+		pageSize:    bitbucketPageSize,
+		header:      func(h http.Header) { h.Set("Authorization", auth) },
+		encode: func(body string) interface{} {
+			var comment bitbucketComment
+			comment.Content.Raw = body
+			return comment
+		},
+		decode: bitbucketComments,
+	}.post(r.Markdown())
+}
+
+// Reads a page of the comments on a pull request, which Bitbucket wraps in an object
+func bitbucketComments(page json.RawMessage) ([]forgeComment, error) {
+	var values struct {
+		Values []bitbucketComment `json:"values"`
+	}
+	if err := json.Unmarshal(page, &values); err != nil {
+		return nil, err
+	}
+
+	comments := make([]forgeComment, len(values.Values))
+	for i, c := range values.Values {
+		comments[i] = forgeComment{ID: c.ID, Body: c.Content.Raw}
+	}
+
+	return comments, nil
+}
+
+// Annotates the report with every benchmark that was too slow or went missing, failing the run. Bitbucket caps a single request at 100 annotations.
+func bitbucketAnnotations(r runReport) []bitbucketAnnotation {
+	var annotations []bitbucketAnnotation
+	for _, run := range r.Runs {
+		for _, res := range run.Results {
+			if res.Tolerated {
+				continue
+			}
+			annotation := bitbucketAnnotation{ExternalID: run.Package + "." + res.Name, AnnotationType: "BUG", Result: "FAILED"}
+			switch res.Status {
+			case statusSlow:
+				annotation.Summary = run.Package + " " + res.Name + " is " + formatFactor(res.Factor) + " as slow as its best"
+				annotation.Severity = "HIGH"
+			case statusMissing:
+				annotation.Summary = run.Package + " " + res.Name + " is missing"
+				annotation.Severity = "MEDIUM"
+			default:
+				continue
+			}
+
+			if len(annotations) < 100 {
+				annotations = append(annotations, annotation)
+			}
+		}
+	}
+
+	return annotations
+}
+
+func (b bitbucketReporter) send(method, url string, body interface{}) error {
+	auth, err := bitbucketAuthorization()
+	if err != nil {
+		return err
+	}
+	req, err := jsonRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+
+	return send(req, nil)
+}
+
+// The Authorization header of every request, with the access token or else the app password
+func bitbucketAuthorization() (string, error) {
+	if token := os.Getenv("BITBUCKET_TOKEN"); token != "" {
+		return "Bearer " + token, nil
+	}
+	if user, password := os.Getenv("BITBUCKET_USERNAME"), os.Getenv("BITBUCKET_APP_PASSWORD"); user != "" && password != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)), nil
+	}
+
+	return "", errors.New("$BITBUCKET_TOKEN, or $BITBUCKET_USERNAME and $BITBUCKET_APP_PASSWORD, must be set to report to Bitbucket")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBitbucketReporter(t *testing.T) {
+	requests := make(map[string]string)
+	comments := []forgeComment{{ID: 1, Body: "LGTM"}}
+	forge := fakeForge{
+		header:       "Authorization",
+		auth:         "Bearer token",
+		commentsPath: "/repositories/ws/repo/pullrequests/7/comments",
+		editPath:     "/repositories/ws/repo/pullrequests/7/comments/",
+		editMethod:   "PUT",
+		bitbucket:    true,
+		other: func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests[r.Method+" "+r.URL.Path] = string(body)
+		},
+	}
+	srv := forge.serve(t, &comments)
+	defer srv.Close()
+
+	os.Setenv("BITBUCKET_TOKEN", "token")
+	defer os.Unsetenv("BITBUCKET_TOKEN")
+
+	b := bitbucketReporter{apiURL: srv.URL, repo: "ws/repo", commit: "abc123", pullRequest: "7"}
+	testStickyComment(t, b, &comments)
+
+	var insight bitbucketInsight
+	if err := json.Unmarshal([]byte(requests["PUT /repositories/ws/repo/commit/abc123/reports/rebench"]), &insight); err != nil {
+		t.Fatalf("Report wasn't sent properly %v %v", err, requests)
+	}
+	if insight.Result != "PASSED" || insight.Data[0].Value != 1 {
+		t.Errorf("Wrong report %+v", insight)
+	}
+
+	var annotations []bitbucketAnnotation
+	json.Unmarshal([]byte(requests["POST /repositories/ws/repo/commit/abc123/reports/rebench/annotations"]), &annotations)
+	if len(annotations) != 1 || !strings.Contains(annotations[0].Summary, "BenchmarkA is 3.00x") {
+		t.Errorf("Wrong annotations %+v", annotations)
+	}
+	if !strings.Contains(comments[1].Body, "BenchmarkB") {
+		t.Errorf("Pull request comment is missing the comparison: %s", comments[1].Body)
+	}
+}
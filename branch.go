@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The best on record of the main branch, and of every package when -perBranch isn't given
+const mainBestFile = ".bench_best.json"
+
+// The name escaped for a file name, every byte but letters, digits, '.', '_' and '-' becoming %XX, so no two names
+// share a file: feature/x is feature%2Fx, and feature-x stays as it is
+func escapeFileName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// The file keeping the best on record of the branch with -perBranch, e.g. .bench_best.feature%2Fx.json for
+// feature/x. The main branch, and a detached HEAD, keep theirs in .bench_best.json like without -perBranch.
+func branchBestFile(branch, mainBranch string) string {
+	if branch == "" || branch == mainBranch {
+		return mainBestFile
+	}
+
+	return ".bench_best." + escapeFileName(branch) + ".json"
+}
+
+// The file keeping the best on record of the environment with -env, e.g. .bench_best@ci%2Flinux.json for ci/linux,
+// or .bench_best.feature%2Fx@ci-linux.json for branch feature/x with -perBranch as well
+func envBestFile(file, key string) string {
+	if key == "" {
+		return file
+	}
+
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "@" + escapeFileName(key) + ext
+}
+
+// The main branch with -perBranch: the one given with -mainBranch, or else the default branch of origin, which
+// origin/HEAD points to
+func resolveMainBranch(given string) (string, error) {
+	if given != "" {
+		return given, nil
+	}
+
+	out, err := exec.Command("git", "symbolic-ref", "--short", "refs/remotes/origin/HEAD").Output()
+	if err != nil {
+		return "", errors.New("cannot tell the main branch, as origin/HEAD isn't set: give it with -mainBranch, or set origin/HEAD with git remote set-head origin --auto")
+	}
+
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/"), nil
+}
+
+// The best on record of the main branch in the environment of a branch's file, which never falls back on another's
+func mainBranchFile(file string) string {
+	if i := strings.LastIndex(file, "@"); i >= 0 {
+		return strings.TrimSuffix(mainBestFile, ".json") + file[i:]
+	}
+
+	return mainBestFile
+}
+
+// Loads the best on record of a branch, falling back on the main branch's until the branch has any. See readRecord
+// for the error.
+func loadBranchRecord(file string) (benchRecord, error) {
+	if main := mainBranchFile(file); file != main && isBestFile(file) {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			logInfo("No", file, "yet, comparing with the best of the main branch in", main)
+			return readRecord(main)
+		}
+	}
+
+	return readRecord(file)
+}
+
+// Reads the bests kept in the file of the directory, falling back on the main branch's like loadBranchRecord. See
+// readRecord for the error.
+func readBranchRecord(dir, file string) (benchRecord, error) {
+	path := filepath.Join(dir, file)
+	if main := mainBranchFile(file); file != main {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return readRecord(filepath.Join(dir, main))
+		}
+	}
+
+	return readRecord(path)
+}
+
+// Adds -perBranch, -mainBranch and -env to the flags of a command that changes the bests, returning what names the
+// file they're kept in with them, as a run given the same flags names it. See resolveMainBranch for the error.
+func bestFileFlags(flags *flag.FlagSet) func() (string, error) {
+	perBranch := flags.Bool("perBranch", false, "Changes the best benchmarks of the current git branch, as kept with -perBranch")
+	mainBranch := flags.String("mainBranch", "", "The branch whose best benchmarks are kept in .bench_best.json with -perBranch, the default branch of origin if empty")
+	key := flags.String("env", "", "Changes the best benchmarks of this environment, as kept with -env")
+
+	return func() (string, error) {
+		file := mainBestFile
+		if *perBranch {
+			main, err := resolveMainBranch(*mainBranch)
+			if err != nil {
+				return "", err
+			}
+			file = branchBestFile(currentRevision().Branch, main)
+		}
+
+		return envBestFile(file, *key), nil
+	}
+}
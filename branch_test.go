@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestBranchBestFile(t *testing.T) {
+	for _, c := range []struct{ branch, expected string }{
+		{"main", ".bench_best.json"},
+		{"", ".bench_best.json"},
+		{"feature/x", ".bench_best.feature%2Fx.json"},
+		{"feature-x", ".bench_best.feature-x.json"},
+		{"fix-1.2", ".bench_best.fix-1.2.json"},
+		{"a@b%c", ".bench_best.a%40b%25c.json"},
+	} {
+		if file := branchBestFile(c.branch, "main"); file != c.expected {
+			t.Errorf("Kept the bests of branch %q in %s, expected %s", c.branch, file, c.expected)
+		}
+	}
+}
+
+func TestEnvBestFile(t *testing.T) {
+	for _, c := range []struct{ file, key, expected string }{
+		{".bench_best.json", "", ".bench_best.json"},
+		{".bench_best.json", "ci/linux", ".bench_best@ci%2Flinux.json"},
+		{".bench_best.json", "ci-linux", ".bench_best@ci-linux.json"},
+		{".bench_best.feature-x.json", "laptop", ".bench_best.feature-x@laptop.json"},
+		{"bests.json", "laptop", "bests@laptop.json"},
+	} {
+		if file := envBestFile(c.file, c.key); file != c.expected {
+			t.Errorf("Kept the bests of %s in environment %q in %s, expected %s", c.file, c.key, file, c.expected)
+		}
+	}
+}
+
+func TestResolveMainBranch(t *testing.T) {
+	if main, err := resolveMainBranch("trunk"); err != nil || main != "trunk" {
+		t.Errorf("Resolved -mainBranch trunk to %q, %v", main, err)
+	}
+
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(pwd)
+
+	git := func(args ...string) {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	if _, err := resolveMainBranch(""); err == nil {
+		t.Errorf("Resolved the main branch without origin/HEAD")
+	}
+	git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/trunk")
+	if main, err := resolveMainBranch(""); err != nil || main != "trunk" {
+		t.Errorf("Resolved the main branch to %q from origin/HEAD, %v", main, err)
+	}
+}
+
+func TestLoadBranchRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(pwd)
+
+	writeRecord(t, mainBestFile, map[string]uint64{"BenchmarkA": 100})
+	if rec, _ := loadBranchRecord(".bench_best.feature-x.json"); rec.benches["BenchmarkA"] != 100 {
+		t.Errorf("Didn't fall back on the main branch's bests, got %v", rec.benches)
+	}
+
+	writeRecord(t, ".bench_best.feature-x.json", map[string]uint64{"BenchmarkA": 50})
+	if rec, _ := loadBranchRecord(".bench_best.feature-x.json"); rec.benches["BenchmarkA"] != 50 {
+		t.Errorf("Didn't load the branch's own bests, got %v", rec.benches)
+	}
+
+	// Only the main branch's bests in the same environment will do
+	if rec, _ := loadBranchRecord(".bench_best.feature-x@ci.json"); rec.benches != nil {
+		t.Errorf("Fell back on the bests of another environment, got %v", rec.benches)
+	}
+	writeRecord(t, ".bench_best@ci.json", map[string]uint64{"BenchmarkA": 200})
+	if rec, _ := loadBranchRecord(".bench_best.feature-x@ci.json"); rec.benches["BenchmarkA"] != 200 {
+		t.Errorf("Didn't fall back on the main branch's bests in the environment, got %v", rec.benches)
+	}
+}
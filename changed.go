@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var changedOnly = flag.Bool("changed", false, "Only benchmarks the packages covering code changed since the commit of their latest results, leaving every other package's records as they are")
+
+// Finds the packages matching the go test patterns (./... when empty) whose benchmarks cover code changed since the git ref.
+// Uncommitted changes count as changes too.
+func affectedPackages(ref string, patterns []string) (map[string]bool, error) {
+	top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := exec.Command("git", "diff", "--name-only", ref).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	args := append([]string{"list", "-deps", "-test", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{join .Deps \" \"}}"}, patterns...)
+	listing, err := exec.Command("go", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return coveringPackages(string(listing), changedDirs(realPath(strings.TrimSpace(string(top))), string(diff))), nil
+}
+
+// The packages matching the go test patterns (./... when empty) that need benchmarking again: those covering code
+// changed since the commit of their latest results, and those without any. The commit of a package's latest results
+// is looked up with lastCommit, which returns "" if there are none.
+func changedSinceRecords(patterns []string, lastCommit func(pkgPath, dir string) string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dirs, err := discoverPackages(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	// Packages usually share the commit of the run that recorded them all, so git and go list run once per commit
+	byCommit := make(map[string][]string)
+	for pkgPath, dir := range dirs {
+		if commit := lastCommit(pkgPath, dir); commit != "" {
+			byCommit[commit] = append(byCommit[commit], pkgPath)
+		} else {
+			changed = append(changed, pkgPath)
+		}
+	}
+	for commit, pkgPaths := range byCommit {
+		affected, err := affectedPackages(commit, patterns)
+		if err != nil {
+			logWarn("Cannot determine what changed since", commit+", benchmarking the", len(pkgPaths), "packages last run on it:", err)
+			changed = append(changed, pkgPaths...)
+			continue
+		}
+		for _, pkgPath := range pkgPaths {
+			if affected[pkgPath] {
+				changed = append(changed, pkgPath)
+			}
+		}
+	}
+	sort.Strings(changed)
+
+	return changed, nil
+}
+
+// The commit of the latest results in the package's directory, if there are any
+func resultsCommit(pkgPath, dir string) string {
+	file := filepath.Join(dir, ".bench_results.json")
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+	if rev := loadRecord(file).revision; rev != nil {
+		return rev.Commit
+	}
+
+	return ""
+}
+
+// Maps the output of git diff --name-only, which is relative to the top of the repository, to the set of directories with changes.
+func changedDirs(top, diff string) map[string]bool {
+	dirs := make(map[string]bool)
+	for _, file := range strings.Split(diff, "\n") {
+		if file = strings.TrimSpace(file); file != "" {
+			dirs[filepath.Dir(filepath.Join(top, filepath.FromSlash(file)))] = true
+		}
+	}
+
+	return dirs
+}
+
+// Works out which packages are covered by changed code from the output of go list -deps -test. A package with benchmarks
+// is covered by itself and by every dependency of its test binary (listed as <importpath>.test), which includes everything
+// imported by its tests.
+func coveringPackages(listing string, changedDirs map[string]bool) map[string]bool {
+	changed := make(map[string]bool)
+	testDeps := make(map[string][]string)
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+
+		// Test variants are listed as "pkg [pkg.test]", but it's the same code as pkg
+		importPath := strings.SplitN(fields[0], " ", 2)[0]
+		if changedDirs[fields[1]] || changedDirs[realPath(fields[1])] {
+			changed[importPath] = true
+		}
+
+		if strings.HasSuffix(fields[0], ".test") && !strings.Contains(fields[0], " ") {
+			testDeps[strings.TrimSuffix(fields[0], ".test")] = strings.Fields(fields[2])
+		}
+	}
+
+	affected := make(map[string]bool)
+	for pkg, deps := range testDeps {
+		if changed[pkg] {
+			affected[pkg] = true
+			continue
+		}
+
+		// Splitting the deps on spaces also splits test variants, leaving their plain import paths
+		for _, dep := range deps {
+			if changed[dep] {
+				affected[pkg] = true
+				break
+			}
+		}
+	}
+
+	return affected
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCoveringPackages(t *testing.T) {
+	// Trimmed down go list -deps -test output for a module where app depends on lib, and app's tests import fixtures
+	listing := "lib\t/src/lib\tstrings\n" +
+		"fixtures\t/src/fixtures\t\n" +
+		"app\t/src/app\tlib strings\n" +
+		"app [app.test]\t/src/app\tfixtures lib strings\n" +
+		"app.test\t/src/app\tapp [app.test] fixtures lib strings testing\n" +
+		"lib.test\t/src/lib\tlib strings testing\n" +
+		"other.test\t/src/other\tother strings testing\n"
+
+	cases := []struct {
+		dirs     map[string]bool
+		expected map[string]bool
+	}{
+		{map[string]bool{"/src/lib": true}, map[string]bool{"lib": true, "app": true}},
+		{map[string]bool{"/src/fixtures": true}, map[string]bool{"app": true}},
+		{map[string]bool{"/src/app": true}, map[string]bool{"app": true}},
+		{map[string]bool{"/src/docs": true}, map[string]bool{}},
+	}
+
+	for _, c := range cases {
+		if affected := coveringPackages(listing, c.dirs); !reflect.DeepEqual(affected, c.expected) {
+			t.Errorf("Changes in %v should affect %v, got %v", c.dirs, c.expected, affected)
+		}
+	}
+}
+
+func TestCoveringPackagesSymlinked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target, link := filepath.Join(dir, "target"), filepath.Join(dir, "link")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("Cannot create symbolic links:", err)
+	}
+
+	// git prints resolved paths, while go list keeps the link of the working directory
+	listing := "lib\t" + link + "\tstrings\n" + "lib.test\t" + link + "\tlib strings testing\n"
+	if affected := coveringPackages(listing, map[string]bool{realPath(target): true}); !affected["lib"] {
+		t.Errorf("Changes in %s should affect lib, listed in %s, got %v", target, link, affected)
+	}
+}
+
+func TestChangedDirs(t *testing.T) {
+	dirs := changedDirs(reform("", "repo"), "a/b.go\nc.go\n\n")
+
+	expected := map[string]bool{reform("", "repo", "a"): true, reform("", "repo"): true}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Expected changed dirs %v, got %v", expected, dirs)
+	}
+}
+
+func TestChangedSinceRecords(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	all, err := changedSinceRecords(nil, func(pkgPath, dir string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("Found no packages without results to benchmark")
+	}
+
+	// A commit that can't be diffed against tells nothing about what changed
+	changed, err := changedSinceRecords(nil, func(pkgPath, dir string) string { return "0000000000000000000000000000000000000000" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, all) {
+		t.Errorf("Benchmarks %v when changes are unknown, expected every package %v", changed, all)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The places GitHub, GitLab and friends look for a CODEOWNERS file, relative to the top of the repository, in order
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// The rules of a CODEOWNERS file in the order they appear. As with .gitignore, the last rule matching a path wins.
+type codeowners []codeownersRule
+
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// Loads the CODEOWNERS file of the repository containing the working directory, returning the rules and the top of the repository
+func loadCodeowners() (codeowners, string, error) {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, "", err
+	}
+	top := realPath(strings.TrimSpace(string(out)))
+
+	for _, location := range codeownersLocations {
+		f, err := os.Open(filepath.Join(top, filepath.FromSlash(location)))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		rules, err := parseCodeowners(f)
+		return rules, top, err
+	}
+
+	return nil, top, errors.New("no CODEOWNERS file in " + top)
+}
+
+func parseCodeowners(r io.Reader) (codeowners, error) {
+	var rules codeowners
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// GitLab's [Section] headers don't affect ownership on their own
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+
+		pattern, err := regexp.Compile(codeownersPattern(fields[0]))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+
+	return rules, scanner.Err()
+}
+
+// Translates a gitignore-style pattern into a regular expression matching slash-separated paths relative to the top
+// of the repository. A pattern matching a directory matches everything beneath it.
+func codeownersPattern(glob string) string {
+	// A slash anywhere but at the end anchors the pattern to the top of the repository
+	anchored := strings.Contains(strings.TrimSuffix(glob, "/"), "/")
+	dirOnly := strings.HasSuffix(glob, "/")
+	glob = strings.Trim(glob, "/")
+
+	expr := "^"
+	if !anchored {
+		expr += "(.*/)?"
+	}
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr += ".*"
+			i++
+		case glob[i] == '*':
+			expr += "[^/]*"
+		case glob[i] == '?':
+			expr += "[^/]"
+		default:
+			expr += regexp.QuoteMeta(glob[i : i+1])
+		}
+	}
+
+	switch {
+	case dirOnly:
+		return expr + "/.*$"
+	case strings.HasSuffix(glob, "/*"):
+		// Unlike .gitignore, CODEOWNERS doesn't let dir/* reach into subdirectories
+		return expr + "$"
+	}
+
+	return expr + "(/.*)?$"
+}
+
+// The owners of a single slash-separated path relative to the top of the repository. A rule without owners
+// means the path has none.
+func (rules codeowners) ownersOf(path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.MatchString(path) {
+			return rules[i].owners
+		}
+	}
+
+	return nil
+}
+
+// Everybody owning one of the Go files in the package directory, sorted
+func (rules codeowners) packageOwners(top, pkgDir string) []string {
+	files, _ := filepath.Glob(filepath.Join(realPath(pkgDir), "*.go"))
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		rel, err := filepath.Rel(top, file)
+		if err != nil {
+			continue
+		}
+
+		for _, owner := range rules.ownersOf(filepath.ToSlash(rel)) {
+			seen[owner] = true
+		}
+	}
+
+	owners := make([]string, 0, len(seen))
+	for owner := range seen {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	return owners
+}
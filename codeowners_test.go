@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodeowners(t *testing.T) {
+	file := `# Everything defaults to the core team
+*       @org/core
+
+*.md    @org/docs
+/pkg/parser/  @org/parser @alice # inline comment
+apps/   @org/apps
+docs/*  @org/docs-top
+**/internal/** @org/internals
+/vendor/
+
+[Section]
+/cmd/tool @bob
+`
+	rules, err := parseCodeowners(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Cannot parse CODEOWNERS %v", err)
+	}
+
+	cases := map[string][]string{
+		"main.go":                    {"@org/core"},
+		"README.md":                  {"@org/docs"},
+		"pkg/parser/parse.go":        {"@org/parser", "@alice"},
+		"pkg/parser/sub/x.go":        {"@org/parser", "@alice"},
+		"other/pkg/parser/parse.go":  {"@org/core"},
+		"deep/apps/server/main.go":   {"@org/apps"},
+		"docs/index.go":              {"@org/docs-top"},
+		"docs/nested/index.go":       {"@org/core"},
+		"lib/internal/cache/lru.go":  {"@org/internals"},
+		"vendor/github.com/x/y/y.go": nil,
+		"cmd/tool/main.go":           {"@bob"},
+		"cmd/toolbox/main.go":        {"@org/core"},
+	}
+
+	for path, expected := range cases {
+		if owners := rules.ownersOf(path); !reflect.DeepEqual(owners, expected) && !(len(owners) == 0 && len(expected) == 0) {
+			t.Errorf("Expected %s to be owned by %v, got %v", path, expected, owners)
+		}
+	}
+}
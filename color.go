@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+var noColor = flag.Bool("noColor", false, "Never colors the comparisons printed on a terminal")
+
+// Whether the comparisons printed on stdout are colored, which they are on a terminal unless -noColor or $NO_COLOR
+// says otherwise
+var colorOutput bool
+
+// The ANSI escape codes of the statuses worth noticing in a wall of numbers
+var statusColors = map[benchStatus]string{
+	statusSlow:    "\x1b[31m", // Red
+	statusRecord:  "\x1b[32m", // Green
+	statusMissing: "\x1b[33m", // Yellow
+	statusNew:     "\x1b[33m",
+}
+
+const colorReset = "\x1b[0m"
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Colors every row of a comparison led by a status worth noticing, if comparisons are colored at all
+func colorize(table string) string {
+	if !colorOutput {
+		return table
+	}
+
+	lines := strings.SplitAfter(table, "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if color, ok := statusColors[benchStatus(fields[0])]; ok {
+			body := strings.TrimSuffix(line, "\n")
+			lines[i] = color + body + colorReset + line[len(body):]
+		}
+	}
+
+	return strings.Join(lines, "")
+}
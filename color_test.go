@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	table := "Status    Benchmark Name\nSLOW      BenchmarkA\nOK        BenchmarkB\nRECORD    BenchmarkC\nGeomean 1.00x\n"
+	if out := colorize(table); out != table {
+		t.Errorf("Colored the comparison when comparisons aren't colored:\n%q", out)
+	}
+
+	colorOutput = true
+	defer func() { colorOutput = false }()
+	expected := "Status    Benchmark Name\n\x1b[31mSLOW      BenchmarkA\x1b[0m\nOK        BenchmarkB\n\x1b[32mRECORD    BenchmarkC\x1b[0m\nGeomean 1.00x\n"
+	if out := colorize(table); out != expected {
+		t.Errorf("Colored the comparison as\n%q\nexpected\n%q", out, expected)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os/exec"
+	"runtime"
+)
+
+var benchCommand = flag.String("cmd", "", "Runs this shell command rather than go test to benchmark, reading the Go benchmark format it prints, e.g. a bazel or make target")
+
+// Runs a -cmd the way the shell of the OS would, so it can be a whole pipeline or a make invocation
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// A comment on a pull or merge request, as GitHub, Gitea and GitLab lay it out
+type forgeComment struct {
+	ID   int64  `json:"id,omitempty"`
+	Body string `json:"body"`
+}
+
+// The single comment rebench keeps on a pull or merge request, which every run updates rather than adding another.
+// Forges differ in little but where the comments are, how they're paged and how requests are authenticated.
+type stickyComment struct {
+	commentsURL string                // Where the comments are listed and posted
+	editURL     func(id int64) string // Where a comment is edited
+	editMethod  string                // PATCH or PUT
+	sizeParam   string                // The query parameter of the size of a page, next to its number in page
+	pageSize    int                   // How many comments are asked for a page at a time, a shorter page being the last
+	header      func(h http.Header)   // Authenticates a request
+
+	// How the forge lays out a comment and a page of comments, where it doesn't lay them out like GitHub
+	encode func(body string) interface{}
+	decode func(page json.RawMessage) ([]forgeComment, error)
+}
+
+// Posts the body as the comment, or replaces that of an earlier run with it
+func (c stickyComment) post(body string) error {
+	existing, err := c.find()
+	if err != nil {
+		return err
+	}
+
+	method, url := "POST", c.commentsURL
+	if existing != 0 {
+		method, url = c.editMethod, c.editURL(existing)
+	}
+
+	var comment interface{} = forgeComment{Body: commentMarker + "\n" + body}
+	if c.encode != nil {
+		comment = c.encode(commentMarker + "\n" + body)
+	}
+	req, err := jsonRequest(method, url, comment)
+	if err != nil {
+		return err
+	}
+	c.header(req.Header)
+
+	return send(req, nil)
+}
+
+// Finds the id of the comment left by an earlier run, or 0 if there's none
+func (c stickyComment) find() (int64, error) {
+	for page := 1; ; page++ {
+		req, err := jsonRequest("GET", fmt.Sprintf("%s?page=%d&%s=%d", c.commentsURL, page, c.sizeParam, c.pageSize), nil)
+		if err != nil {
+			return 0, err
+		}
+		c.header(req.Header)
+
+		var raw json.RawMessage
+		if err := send(req, &raw); err != nil {
+			return 0, err
+		}
+		comments, err := c.comments(raw)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, comment := range comments {
+			if strings.HasPrefix(comment.Body, commentMarker) {
+				return comment.ID, nil
+			}
+		}
+
+		if len(comments) < c.pageSize {
+			return 0, nil
+		}
+	}
+}
+
+func (c stickyComment) comments(page json.RawMessage) ([]forgeComment, error) {
+	if c.decode != nil {
+		return c.decode(page)
+	}
+
+	var comments []forgeComment
+	err := json.Unmarshal(page, &comments)
+	return comments, err
+}
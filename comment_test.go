@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// A fake forge with a single pull request, keeping its comments in memory. Requests must have the header set to auth,
+// comments are listed and posted at commentsPath, and edited with editMethod at editPath followed by their id. Any
+// other request goes to other if it's set.
+type fakeForge struct {
+	header, auth           string
+	commentsPath, editPath string
+	editMethod             string
+	bitbucket              bool // Comments are laid out like Bitbucket's
+	other                  http.HandlerFunc
+}
+
+func (f fakeForge) decode(r *http.Request) forgeComment {
+	if !f.bitbucket {
+		var comment forgeComment
+		json.NewDecoder(r.Body).Decode(&comment)
+		return comment
+	}
+
+	var comment bitbucketComment
+	json.NewDecoder(r.Body).Decode(&comment)
+	return forgeComment{Body: comment.Content.Raw}
+}
+
+func (f fakeForge) encode(w http.ResponseWriter, comments []forgeComment) {
+	if !f.bitbucket {
+		json.NewEncoder(w).Encode(comments)
+		return
+	}
+
+	page := struct {
+		Values []bitbucketComment `json:"values"`
+	}{Values: []bitbucketComment{}}
+	for _, c := range comments {
+		var comment bitbucketComment
+		comment.ID, comment.Content.Raw = c.ID, c.Body
+		page.Values = append(page.Values, comment)
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func (f fakeForge) serve(t *testing.T, comments *[]forgeComment) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(f.header) != f.auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch path := r.URL.EscapedPath(); {
+		case r.Method == "GET" && path == f.commentsPath:
+			if r.URL.Query().Get("page") != "1" {
+				f.encode(w, nil)
+				return
+			}
+			f.encode(w, *comments)
+		case r.Method == "POST" && path == f.commentsPath:
+			comment := f.decode(r)
+			comment.ID = int64(len(*comments) + 1)
+			*comments = append(*comments, comment)
+		case r.Method == f.editMethod && strings.HasPrefix(path, f.editPath):
+			comment := f.decode(r)
+			for i := range *comments {
+				if path == fmt.Sprintf("%s%d", f.editPath, (*comments)[i].ID) {
+					(*comments)[i].Body = comment.Body
+				}
+			}
+		case f.other != nil:
+			f.other(w, r)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// Reports a failing run and then a passing one through the reporter, which must leave a single comment behind it
+func testStickyComment(t *testing.T, r reporter, comments *[]forgeComment) {
+	if err := r.report(testReport()); err != nil {
+		t.Fatalf("Cannot comment %v", err)
+	}
+	if len(*comments) != 2 || !strings.Contains((*comments)[1].Body, "rebench failing") {
+		t.Fatalf("Comment wasn't added %+v", *comments)
+	}
+
+	report := testReport()
+	report.TooSlow = false
+	if err := r.report(report); err != nil {
+		t.Fatalf("Cannot update comment %v", err)
+	}
+	if len(*comments) != 2 || !strings.Contains((*comments)[1].Body, "rebench passing") || (*comments)[0].Body != "LGTM" {
+		t.Errorf("Comment wasn't updated in place %+v", *comments)
+	}
+}
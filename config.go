@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+)
+
+var configFile = flag.String("config", "", "The project's JSON config file, .rebench.json in the directory of invocation if there is one")
+
+// The config file looked for when -config isn't given
+const defaultConfigFile = ".rebench.json"
+
+// What a project can configure in its config file
+type config struct {
+	// The default -speedTol and -recordTol, for when they aren't given on the command line
+	benchTolerances
+	// The tolerances of benchmarks and packages, overriding those of groups
+	toleranceConfig
+	// How each unit of the metrics benchmarks report besides ns/op is judged, keyed by unit (e.g. "B/op")
+	Units map[string]unitConfig `json:"units,omitempty"`
+	// Groups of benchmarks with policies of their own. A benchmark is in the first group matching it.
+	Groups []benchGroup `json:"groups,omitempty"`
+	// How much each package weighs in the weighted geomean, keyed by import path or a pattern ending in /...
+	Weights map[string]float64 `json:"weights,omitempty"`
+	// The default -acceptOnly
+	AcceptOnly bool `json:"acceptOnly,omitempty"`
+	// The default -cmd
+	Cmd string `json:"cmd,omitempty"`
+	// The new names of renamed benchmarks, keyed by their old names, whose records they take over
+	Renames map[string]string `json:"renames,omitempty"`
+	// The benchmarks that never fail the run, by exact name or regular expression
+	Ignore []string `json:"ignore,omitempty"`
+
+	ignore ignoreList
+}
+
+// Loads the config file, or the default one if the file is empty. There's nothing to configure without a default
+// config file, but a config file given explicitly has to exist.
+func loadConfig(file string) (config, error) {
+	var cfg config
+	explicit := file != ""
+	if !explicit {
+		file = defaultConfigFile
+	}
+
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, errors.New("cannot unmarshall config file " + file + ": " + err.Error())
+	}
+
+	for unit, u := range cfg.Units {
+		if u.Better != betterLower && u.Better != betterHigher {
+			return cfg, errors.New("config file " + file + ": unit " + unit + " must say whether \"lower\" or \"higher\" is better")
+		}
+		if u.Tolerance < 0 || u.RecordTolerance < 0 {
+			return cfg, errors.New("config file " + file + ": the tolerances of unit " + unit + " must not be negative")
+		}
+	}
+
+	if err := cfg.benchTolerances.validate(); err != nil {
+		return cfg, errors.New("config file " + file + ": " + err.Error())
+	}
+	if err := cfg.toleranceConfig.validate(); err != nil {
+		return cfg, errors.New("config file " + file + ": " + err.Error())
+	}
+
+	if cfg.ignore, err = compileIgnores(cfg.Ignore); err != nil {
+		return cfg, errors.New("config file " + file + ": " + err.Error())
+	}
+
+	if err := validateRenames(cfg.Renames); err != nil {
+		return cfg, errors.New("config file " + file + ": " + err.Error())
+	}
+
+	if err := compileGroups(cfg.Groups); err != nil {
+		return cfg, errors.New("config file " + file + ": " + err.Error())
+	}
+
+	return cfg, nil
+}
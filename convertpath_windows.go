@@ -6,14 +6,6 @@ import (
 	"strings"
 )
 
-func convertPath(pathFromTest string) string {
-	return strings.Replace(pathFromTest, "/", "\\", -1)
-}
-
-func getPieces(path string) []string {
-	return strings.Split(path, "\\")
-}
-
 func reform(pieces ...string) string {
 	return strings.Join(pieces, "\\")
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The projects served, linking to their dashboards
+type dashboardIndex struct {
+	Projects []projectStatus
+}
+
+// Everything the dashboard of a project shows
+type dashboardPage struct {
+	Status      projectStatus
+	Regressions []dashboardRow // Every SLOW and MISSING benchmark of the latest runs, worst first
+	Packages    []htmlPackage
+}
+
+type dashboardRow struct {
+	Package string
+	htmlRow
+	factor float64 // How much slower it got, infinitely for a missing benchmark
+}
+
+// Like the -html report, the dashboard is a single page with everything inline, so it's served without any assets
+const dashboardStyle = `<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 0.3em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+td.num { text-align: right; font-family: monospace; }
+.SLOW, .MISSING, .failing { color: #c0392b; font-weight: bold; }
+.RECORD, .passing { color: #27ae60; font-weight: bold; }
+.NEW, .unknown { color: #2980b9; }
+</style>`
+
+var dashboardIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rebench</title>
+` + dashboardStyle + `
+</head>
+<body>
+<h1>rebench</h1>
+<table>
+<tr><th>Project</th><th>Verdict</th><th>Packages</th><th>Worst Regression</th></tr>
+{{range .Projects}}<tr><td><a href="/dashboard/{{.Project}}">{{.Project}}</a></td><td class="{{.Verdict}}">{{.Verdict}}</td><td class="num">{{.Packages}}</td><td>{{with .WorstRegression}}{{.Benchmark}} in {{.Package}} ({{printf "%.2fx" .Factor}}){{end}}</td></tr>
+{{else}}<tr><td colspan="4">No projects yet</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rebench: {{.Status.Project}}</title>
+` + dashboardStyle + `
+</head>
+<body>
+<p><a href="/">All projects</a></p>
+<h1>{{.Status.Project}}: <span class="{{.Status.Verdict}}">{{.Status.Verdict}}</span></h1>
+<h2>Regressions</h2>
+{{if .Regressions}}<table>
+<tr><th>Status</th><th>Package</th><th>Benchmark Name</th><th>New Speed</th><th>Best Speed</th><th>Factor (New/Old)</th><th>History</th></tr>
+{{range .Regressions}}<tr><td class="{{.Status}}">{{.Status}}</td><td>{{.Package}}</td><td>{{.Name}}</td><td class="num">{{.Speed}}</td><td class="num">{{.Best}}</td><td class="num">{{.Factor}}</td><td>{{.Chart}}</td></tr>
+{{end}}</table>
+{{else}}<p>None in the latest runs</p>
+{{end}}
+{{range .Packages}}
+<h2>{{.Package}}</h2>
+<table>
+<tr><th>Status</th><th>Benchmark Name</th><th>New Speed</th><th>Best Speed</th><th>Factor (New/Old)</th><th>History</th></tr>
+{{range .Rows}}<tr><td class="{{.Status}}">{{.Status}}</td><td>{{.Name}}</td><td class="num">{{.Speed}}</td><td class="num">{{.Best}}</td><td class="num">{{.Factor}}</td><td>{{.Chart}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// Lists every project beneath the root, i.e. every directory directly inside it
+func (s *server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	infos, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var index dashboardIndex
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		status, err := s.projectStatus(info.Name())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		index.Projects = append(index.Projects, status)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardIndexTemplate.Execute(w, index)
+}
+
+// Shows the latest run of every package of a project, with the trend of each benchmark in the project's history
+// (see -push) and the regressions of the latest runs first
+func (s *server) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	project := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dashboard/"), "/")
+	status, err := s.projectStatus(project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	runs, err := s.latestRuns(project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var entries []historyEntry
+	if dir, err := s.dir(project); err == nil {
+		if f, err := os.Open(filepath.Join(dir, historyFile)); err == nil {
+			entries, _ = readHistory(f)
+			f.Close()
+		}
+	}
+
+	page := dashboardPage{Status: status}
+	for _, run := range runs {
+		// The history is kept by import path, which is where the package lies in the project
+		pkgPath := strings.TrimPrefix(run.Package, status.Project+"/")
+		pkg := htmlPackage{Package: pkgPath}
+		for _, res := range run.Results {
+			row := newHTMLRow(res, benchmarkHistory(entries, pkgPath, res.Name))
+			pkg.Rows = append(pkg.Rows, row)
+			if res.Status == statusSlow || res.Status == statusMissing {
+				factor := res.Factor
+				if res.Status == statusMissing {
+					factor = math.Inf(1)
+				}
+				page.Regressions = append(page.Regressions, dashboardRow{Package: pkgPath, htmlRow: row, factor: factor})
+			}
+		}
+		page.Packages = append(page.Packages, pkg)
+	}
+	sort.SliceStable(page.Regressions, func(i, j int) bool {
+		return page.Regressions[i].factor > page.Regressions[j].factor
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, page)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	diffFlags     = flag.NewFlagSet("diff", flag.ExitOnError)
+	diffRoot      = diffFlags.String("root", ".", "The directory containing the packages to compare")
+	diffMarkdown  = diffFlags.Bool("markdown", false, "Prints the comparison as Markdown, e.g. for release notes")
+	diffGit       = diffFlags.Bool("git", false, "Compares two git refs, benchmarking each in a temporary worktree, rather than two baselines")
+	diffBench     = diffFlags.String("bench", ".", "Only runs the benchmarks matching this regular expression with -git")
+	diffBenchtime = diffFlags.String("benchtime", "", "Passed to go test -benchtime with -git when set")
+	diffCount     = diffFlags.Int("count", 5, "Runs every benchmark this many times at each ref with -git, so changes can be told from noise")
+	diffAlpha     = diffFlags.Float64("alpha", 0.05, "The p-value below which a change is significant with -git")
+)
+
+// Compares two named baselines of every package beneath -root without running anything
+func diff(args []string, speedTolPercent, recordTolPercent int) int {
+	diffFlags.Parse(args)
+	if diffFlags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "rebench diff needs exactly two baselines to compare, e.g. rebench diff v1.3.0 v1.4.0, or two git refs with -git")
+		return exitError
+	}
+	oldName, newName := diffFlags.Arg(0), diffFlags.Arg(1)
+	speedTol, recordTol := float64(speedTolPercent)/100, float64(recordTolPercent)/100
+
+	var report runReport
+	var err error
+	if *diffGit {
+		opts := runOptions{bench: *diffBench, benchtime: *diffBenchtime, count: *diffCount, readOnly: true}
+		report, err = diffRefs(oldName, newName, opts, speedTol, recordTol, *diffAlpha)
+		if err != nil {
+			logError("Cannot compare the refs:", err)
+			return exitError
+		}
+		if len(report.Runs) == 0 {
+			fmt.Fprintln(os.Stderr, "No benchmarks at", oldName, "or", newName)
+			return exitError
+		}
+	} else {
+		report, err = diffBaselines(*diffRoot, oldName, newName, speedTol, recordTol)
+		if err != nil {
+			logError("Cannot compare the baselines:", err)
+			return exitError
+		}
+		if len(report.Runs) == 0 {
+			fmt.Fprintln(os.Stderr, "No package beneath", *diffRoot, "has baseline", oldName, "or", newName)
+			return exitError
+		}
+	}
+
+	if *diffMarkdown {
+		fmt.Print(report.Markdown())
+		return exitOK
+	}
+
+	fmt.Println(report.Summary())
+	for _, run := range report.Runs {
+		fmt.Printf("\n%s\n%s", run.Package, colorize(run.Table))
+	}
+
+	return exitOK
+}
+
+// Compares the newer baseline with the older one in every package that has either, treating the older one as
+// the best on record
+func diffBaselines(root, oldName, newName string, speedTol, recordTol float64) (runReport, error) {
+	var report runReport
+	baselines, err := loadBaselines(root, oldName, newName)
+	if err != nil {
+		return report, err
+	}
+
+	pkgs := make([]string, 0, len(baselines))
+	for pkg := range baselines {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		oldBenches, benches := baselines[pkg][0], baselines[pkg][1]
+		results := classify(oldBenches, benches, speedTol, recordTol)
+		run := packageRun{Package: pkg, Results: results, Table: deltaTable(results, oldBenches != nil).String()}
+		report.Runs = append(report.Runs, run)
+		report.Missing = report.Missing || countStatus(results, statusMissing) > 0
+		report.TooSlow = report.TooSlow || countStatus(results, statusSlow) > 0
+	}
+
+	return report, nil
+}
+
+// Benchmarks the packages beneath the directory of invocation at both refs and compares the newer with the older,
+// treating the older one as the best on record. With several runs of each benchmark, only significant changes count.
+func diffRefs(oldRef, newRef string, opts runOptions, speedTol, recordTol, alpha float64) (runReport, error) {
+	var report runReport
+	if err := requireModule(); err != nil {
+		return report, err
+	}
+	oldOutputs, err := benchmarkRef(oldRef, opts)
+	if err != nil {
+		return report, err
+	}
+	newOutputs, err := benchmarkRef(newRef, opts)
+	if err != nil {
+		return report, err
+	}
+
+	seen := make(map[string]bool)
+	var pkgs []string
+	for _, outputs := range []map[string]packageOutput{oldOutputs, newOutputs} {
+		for pkg := range outputs {
+			if !seen[pkg] {
+				seen[pkg] = true
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		oldOut, newOut := oldOutputs[pkg], newOutputs[pkg]
+		results := classify(oldOut.benches, newOut.benches, speedTol, recordTol)
+		stats := statsComparison{old: oldOut.stats, new: newOut.stats, alpha: alpha}
+		stats.filterNoise(results)
+		run := packageRun{Package: pkg, Results: results, Table: refsTable(oldRef, newRef, results, stats).String()}
+		report.Runs = append(report.Runs, run)
+		report.Missing = report.Missing || countStatus(results, statusMissing) > 0
+		report.TooSlow = report.TooSlow || countStatus(results, statusSlow) > 0
+	}
+
+	return report, nil
+}
+
+// Fails outside a module: the worktrees are checked out outside GOPATH, where a GOPATH project wouldn't build as it
+// does in place, nor its packages have the same import paths at both refs
+func requireModule() error {
+	out, err := exec.Command("go", "env", "GOMOD").Output()
+	if err != nil {
+		return fmt.Errorf("cannot tell whether this is a module: %v", err)
+	}
+	if gomod := strings.TrimSpace(string(out)); gomod == "" || gomod == os.DevNull {
+		return errors.New("diff -git only compares the refs of a Go module, outside GOPATH; save a baseline with -baseline at each ref and compare those instead")
+	}
+
+	return nil
+}
+
+// Runs the benchmarks at the ref in a temporary git worktree, in the same directory of the repository as the
+// directory of invocation, leaving the working tree alone. Packages are keyed by their import path.
+func benchmarkRef(ref string, opts runOptions) (map[string]packageOutput, error) {
+	top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, err
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(realPath(strings.TrimSpace(string(top))), realPath(pwd))
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	worktree := filepath.Join(tmp, "worktree")
+	if out, err := exec.Command("git", "worktree", "add", "--detach", worktree, ref).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cannot check out %s: %v: %s", ref, err, strings.TrimSpace(string(out)))
+	}
+	defer exec.Command("git", "worktree", "remove", "--force", worktree).Run()
+
+	if err := os.Chdir(filepath.Join(worktree, rel)); err != nil {
+		return nil, err
+	}
+	defer os.Chdir(pwd)
+
+	logInfo("Benchmarking", ref, "in", worktree)
+	outputs, err := runAndStoreBenches(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+// Lays the comparison out like benchstat: each benchmark's speed at both refs, with the variation of its runs, and
+// the change between them, or ~ when it's not significant
+func refsTable(oldRef, newRef string, results []benchResult, stats statsComparison) *table {
+	tbl := newTable("Benchmark Name", oldRef, newRef, "Delta")
+	tbl.align = []alignment{alignLeft, alignRight, alignRight, alignLeft}
+	for _, res := range results {
+		old, new := refSpeed(res.BestSpeed, stats.old[res.Name]), refSpeed(res.Speed, stats.new[res.Name])
+		delta := fmt.Sprintf("%+.2f%%", (res.Factor-1)*100)
+		switch res.Status {
+		case statusNew:
+			old, delta = "", "NEW"
+		case statusMissing:
+			new, delta = "", "MISSING"
+		}
+		if noise, p := stats.noise(res.Name); p > 0 {
+			if noise {
+				delta = "~"
+			}
+			delta += fmt.Sprintf(" (p=%.3f n=%d+%d)", p, stats.old[res.Name].N, stats.new[res.Name].N)
+		}
+		tbl.addRow(res.Name, old, new, delta)
+	}
+
+	return tbl
+}
+
+// A speed with the variation of its runs, e.g. 1234 ns/op ±3%
+func refSpeed(ns uint64, s benchStats) string {
+	speed := numbers.speedPerOp(ns)
+	if s.N > 1 && s.Mean > 0 {
+		speed += fmt.Sprintf(" ±%.0f%%", math.Abs(s.Stddev/s.Mean)*100)
+	}
+
+	return speed
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffBaselines(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	saveBaseline(filepath.Join(root, "a"), "v1", map[string]uint64{"BenchmarkA": 100, "BenchmarkGone": 10})
+	saveBaseline(filepath.Join(root, "a"), "v2", map[string]uint64{"BenchmarkA": 300})
+	saveBaseline(filepath.Join(root, "b", "c"), "v2", map[string]uint64{"BenchmarkNew": 5})
+	saveBaseline(filepath.Join(root, "d"), "v0", map[string]uint64{"BenchmarkOld": 5})
+	packageStore{root: filepath.Join(root, monorepoStoreDir)}.save(packageRecord{
+		Package:   "example.com/mono",
+		Baselines: map[string]map[string]uint64{"v1": {"BenchmarkM": 100}, "v2": {"BenchmarkM": 50}},
+	})
+
+	report, err := diffBaselines(root, "v1", "v2", 1.5, 0.7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]benchStatus{
+		"a":                {statusMissing, statusSlow},
+		"b/c":              {statusNew},
+		"example.com/mono": {statusRecord},
+	}
+	if len(report.Runs) != len(expected) {
+		t.Fatalf("Compared the wrong packages %v", report.Runs)
+	}
+	for _, run := range report.Runs {
+		statuses := expected[run.Package]
+		if len(statuses) != len(run.Results) {
+			t.Errorf("Compared %s wrong: %v", run.Package, run.Results)
+			continue
+		}
+		for i, res := range run.Results {
+			if res.Status != statuses[i] {
+				t.Errorf("Compared %s %s as %s, expected %s", run.Package, res.Name, res.Status, statuses[i])
+			}
+		}
+	}
+
+	if !report.Missing || !report.TooSlow {
+		t.Errorf("The diff should be failing %+v", report)
+	}
+}
+
+func TestValidBaselineName(t *testing.T) {
+	for _, name := range []string{"v1.4.0", "release-2016.01", "main"} {
+		if err := validBaselineName(name); err != nil {
+			t.Errorf("Rejected baseline name %s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "..", "a/b", `a\b`} {
+		if err := validBaselineName(name); err == nil {
+			t.Errorf("Accepted baseline name %q", name)
+		}
+	}
+}
+
+func TestBaselineRun(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	defer os.RemoveAll(baselineDir)
+
+	opts := testOptions
+	opts.baseline = "v1"
+	if code := rebench(opts); code != 0 {
+		t.Fatalf("Program returned non-zero exit code %d for valid invocation", code)
+	}
+
+	if benches := loadBaseline(filepath.Join(baselineDir, "v1.json")); len(benches) != 2 {
+		t.Errorf("Saved the wrong baseline %v", benches)
+	}
+}
+
+func TestRefsTable(t *testing.T) {
+	results := []benchResult{
+		{Name: "BenchmarkA", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+		{Name: "BenchmarkB", Speed: 105, BestSpeed: 100, Factor: 1.05, Status: statusOK},
+		{Name: "BenchmarkC", Speed: 50, Status: statusNew},
+	}
+	stats := statsComparison{
+		old:   map[string]benchStats{"BenchmarkB": {N: 5, Mean: 100, Median: 100, Stddev: 10}},
+		new:   map[string]benchStats{"BenchmarkB": {N: 5, Mean: 105, Median: 105, Stddev: 10}},
+		alpha: 0.05,
+	}
+	out := refsTable("main", "HEAD", results, stats).String()
+
+	for _, want := range []string{"main", "HEAD", "+200.00%", "±10%", "~ (p=", "n=5+5", "NEW"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the comparison:\n%s", want, out)
+		}
+	}
+}
+
+func TestRequireModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(pwd)
+	if err := requireModule(); err == nil {
+		t.Errorf("Accepted a directory outside any module")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	driftTolPercent = flag.Int("driftTol", 0, "Fails the run when a benchmark got slower by more than this percentage over its latest -driftRuns runs in the -history file, 0 to never fail on it")
+	driftRuns       = flag.Int("driftRuns", 10, "How many of a benchmark's latest runs, the run itself included, -driftTol looks back over")
+)
+
+// The speeds of every benchmark of a package across its latest runs in the history, oldest first
+type speedHistory map[string][]uint64
+
+// The speed histories of every package in the history file, by import path, keeping the latest runs of each benchmark.
+// None without a history.
+func loadSpeedHistories(file string, runs int) map[string]speedHistory {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		logInfo("No history in", file+", not looking for benchmarks drifting slower")
+		return nil
+	}
+	if err != nil {
+		logWarn("Cannot open the history, not looking for benchmarks drifting slower:", err)
+		return nil
+	}
+	defer f.Close()
+
+	entries, err := readHistory(f)
+	if err != nil {
+		logWarn("Cannot read the history, not looking for benchmarks drifting slower:", err)
+		return nil
+	}
+
+	return speedHistories(entries, runs)
+}
+
+func speedHistories(entries []historyEntry, runs int) map[string]speedHistory {
+	histories := make(map[string]speedHistory)
+	for _, entry := range entries {
+		if histories[entry.Package] == nil {
+			histories[entry.Package] = make(speedHistory)
+		}
+		benches, _ := entry.Benchmarks.split()
+		for name, speed := range benches {
+			speeds := append(histories[entry.Package][name], speed)
+			if len(speeds) > runs {
+				speeds = speeds[len(speeds)-runs:]
+			}
+			histories[entry.Package][name] = speeds
+		}
+	}
+
+	return histories
+}
+
+// A benchmark that got slower over its latest runs, from the speed of the earliest of them to that of the run
+type drift struct {
+	name     string
+	from, to uint64
+	runs     int // Including the run
+}
+
+func (d drift) factor() float64 {
+	return float64(d.to) / float64(d.from)
+}
+
+// The benchmarks of the run that got slower than the tolerance allows over the window of runs ending with it, i.e. since
+// the earliest of their latest window-1 runs in the history, sorted by name. Every run in between may well have been
+// within -speedTol of the one before, but the best on record goes stale as they add up.
+func (h speedHistory) drifted(benches map[string]uint64, tol float64, window int) []drift {
+	var drifts []drift
+	for name, speed := range benches {
+		speeds := h[name]
+		if len(speeds) > window-1 {
+			speeds = speeds[len(speeds)-(window-1):]
+		}
+		if len(speeds) == 0 || speeds[0] == 0 {
+			continue
+		}
+		d := drift{name: name, from: speeds[0], to: speed, runs: len(speeds) + 1}
+		if d.factor() > 1+tol {
+			drifts = append(drifts, d)
+		}
+	}
+	sort.Slice(drifts, func(a, b int) bool { return drifts[a].name < drifts[b].name })
+
+	return drifts
+}
+
+// E.g. "BenchmarkQuery drifted 1.32x slower over its latest 10 runs, from 1000 ns/op to 1320 ns/op"
+func formatDrift(d drift) string {
+	return fmt.Sprintf("%s drifted %s slower over its latest %d runs, from %s ns/op to %s ns/op", d.name, formatFactor(d.factor()), d.runs, numbers.speed(d.from), numbers.speed(d.to))
+}
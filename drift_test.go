@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDrifted(t *testing.T) {
+	var entries []historyEntry
+	for _, speed := range []uint64{50, 100, 104, 108, 112, 116} {
+		entries = append(entries, historyEntry{Package: "example.com/mod", Benchmarks: canonicalize(map[string]uint64{"BenchmarkCreeping": speed, "BenchmarkSteady": 100}, nil)})
+	}
+	entries = append(entries, historyEntry{Package: "example.com/other", Benchmarks: canonicalize(map[string]uint64{"BenchmarkSteady": 10}, nil)})
+
+	// The earliest run is out of the window, so BenchmarkCreeping drifted from 100 over the last 5 runs and this one
+	histories := speedHistories(entries, 5)
+	benches := map[string]uint64{"BenchmarkCreeping": 120, "BenchmarkSteady": 102, "BenchmarkNew": 1000}
+	drifts := histories["example.com/mod"].drifted(benches, 0.1, 6)
+	expected := []drift{{name: "BenchmarkCreeping", from: 100, to: 120, runs: 6}}
+	if !reflect.DeepEqual(drifts, expected) {
+		t.Errorf("Found the drifts %+v, expected %+v", drifts, expected)
+	}
+
+	// A shorter window starts later
+	if drifts := histories["example.com/mod"].drifted(benches, 0.1, 3); len(drifts) > 0 {
+		t.Errorf("Found the drifts %+v within 3 runs", drifts)
+	}
+	if drifts := histories["example.com/missing"].drifted(benches, 0.1, 6); len(drifts) > 0 {
+		t.Errorf("Found the drifts %+v without a history", drifts)
+	}
+}
+
+func TestFormatDrift(t *testing.T) {
+	expected := "BenchmarkQuery drifted 1.32x slower over its latest 10 runs, from 1000 ns/op to 1320 ns/op"
+	if out := formatDrift(drift{name: "BenchmarkQuery", from: 1000, to: 1320, runs: 10}); out != expected {
+		t.Errorf("Formatted %q, expected %q", out, expected)
+	}
+}
+
+// Drifting only fails the run for benchmarks that gate it
+func TestDriftGates(t *testing.T) {
+	ignore, err := compileIgnores([]string{"BenchmarkFlaky"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := newJudge(runOptions{speedTolPercent: 150, recordTolPercent: 70, bench: ".", driftTolPercent: 10, driftRuns: 6, readOnly: true, ignore: ignore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.drift = map[string]speedHistory{"example.com/mod": {"BenchmarkFlaky": {100, 110}, "BenchmarkSteady": {100, 101}}}
+	out := packageOutput{pkgPath: "example.com/mod", benches: map[string]uint64{"BenchmarkFlaky": 130, "BenchmarkSteady": 102}}
+	old := benchRecord{benches: map[string]uint64{"BenchmarkFlaky": 120, "BenchmarkSteady": 102}}
+
+	if v := j.judgePackage(out, "", old, packageHistory{}, nil); v.tooSlow {
+		t.Errorf("Failed the run because of an ignored benchmark drifting")
+	}
+	out.benches["BenchmarkSteady"] = 130
+	old.benches["BenchmarkSteady"] = 120
+	if v := j.judgePackage(out, "", old, packageHistory{}, nil); !v.tooSlow {
+		t.Errorf("Didn't fail the run because of a benchmark drifting")
+	}
+}
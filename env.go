@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var (
+	strictEnv = flag.Bool("strictEnv", false, "Fails the run when the machine differs from the one the best benchmarks were recorded on, rather than only warning")
+	envKey    = flag.String("env", "", "Keeps the best benchmarks of this environment apart from every other's, e.g. ci-linux-amd64, so runs on different machines are never compared")
+)
+
+// The machine and toolchain benchmarks ran on, since speeds from different ones can't be compared
+type environment struct {
+	GoVersion  string `json:"goVersion,omitempty"`
+	GOOS       string `json:"goos,omitempty"`
+	GOARCH     string `json:"goarch,omitempty"`
+	CPU        string `json:"cpu,omitempty"` // The model, if it could be found out
+	Cores      int    `json:"cores,omitempty"`
+	GOMAXPROCS int    `json:"gomaxprocs,omitempty"`
+
+	// The go test settings of the run
+	Benchtime  string   `json:"benchtime,omitempty"`
+	CPUList    string   `json:"cpuList,omitempty"` // go test -cpu
+	Count      int      `json:"count,omitempty"`
+	Tags       string   `json:"tags,omitempty"`
+	GoTestArgs []string `json:"goTestArgs,omitempty"` // Whatever followed --
+}
+
+// The environment go test benchmarks in, asking the go command for the toolchain and its target so GOOS and GOARCH
+// in the environment are taken into account
+func currentEnvironment() environment {
+	env := environment{GoVersion: runtime.Version(), GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, CPU: cpuModel(), Cores: runtime.NumCPU()}
+	if out, err := exec.Command("go", "env", "GOVERSION", "GOOS", "GOARCH").Output(); err == nil {
+		if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); len(lines) == 3 {
+			// Toolchains from before GOVERSION print an empty line for it
+			if lines[0] != "" {
+				env.GoVersion = lines[0]
+			}
+			env.GOOS, env.GOARCH = lines[1], lines[2]
+		}
+	}
+
+	env.GOMAXPROCS = env.Cores
+	if n, err := strconv.Atoi(os.Getenv("GOMAXPROCS")); err == nil && n > 0 {
+		env.GOMAXPROCS = n
+	}
+
+	return env
+}
+
+// The environment with the go test settings of the run, which change speeds as much as the machine does. -timeout
+// doesn't, so it's left out.
+func (e environment) withSettings(opts runOptions) environment {
+	e.Benchtime, e.CPUList, e.Tags, e.GoTestArgs = opts.benchtime, opts.cpu, opts.tags, opts.goTestArgs
+	if opts.count > 1 {
+		e.Count = opts.count
+	}
+
+	return e
+}
+
+// The model of the CPU on Linux and macOS, empty elsewhere
+func cpuModel() string {
+	switch runtime.GOOS {
+	case "linux":
+		f, err := os.Open("/proc/cpuinfo")
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			fields := strings.SplitN(s.Text(), ":", 2)
+			if len(fields) == 2 && strings.TrimSpace(fields[0]) == "model name" {
+				return strings.TrimSpace(fields[1])
+			}
+		}
+	case "darwin":
+		out, err := exec.Command("sysctl", "-n", "machdep.cpu.brand_string").Output()
+		if err == nil {
+			return strings.TrimSpace(string(out))
+		}
+	}
+
+	return ""
+}
+
+// How the environment differs from the other, e.g. "GOARCH amd64 != arm64", empty if it doesn't. Fields either
+// doesn't know are left out.
+func (e environment) differences(other environment) []string {
+	var diffs []string
+	diff := func(name, a, b string) {
+		if a != "" && b != "" && a != b {
+			diffs = append(diffs, name+" "+a+" != "+b)
+		}
+	}
+	count := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+
+	diff("Go", e.GoVersion, other.GoVersion)
+	diff("GOOS", e.GOOS, other.GOOS)
+	diff("GOARCH", e.GOARCH, other.GOARCH)
+	diff("CPU", e.CPU, other.CPU)
+	diff("cores", count(e.Cores), count(other.Cores))
+	diff("GOMAXPROCS", count(e.GOMAXPROCS), count(other.GOMAXPROCS))
+	// Unlike the machine, an empty setting is the default rather than unknown
+	setting := func(name, a, b string) {
+		if a != b {
+			diffs = append(diffs, name+" "+quoteSetting(a)+" != "+quoteSetting(b))
+		}
+	}
+	setting("-benchtime", e.Benchtime, other.Benchtime)
+	setting("-cpu", e.CPUList, other.CPUList)
+	setting("-count", count(e.Count), count(other.Count))
+	setting("-tags", e.Tags, other.Tags)
+	setting("go test flags", strings.Join(e.GoTestArgs, " "), strings.Join(other.GoTestArgs, " "))
+
+	return diffs
+}
+
+func quoteSetting(s string) string {
+	if s == "" {
+		return "default"
+	}
+
+	return s
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentDifferences(t *testing.T) {
+	a := environment{GoVersion: "go1.22.1", GOOS: "linux", GOARCH: "amd64", CPU: "AMD EPYC 7B13", Cores: 8, GOMAXPROCS: 8}
+	b := environment{GoVersion: "go1.22.1", GOOS: "linux", GOARCH: "arm64", Cores: 4, GOMAXPROCS: 4}
+
+	expected := []string{"GOARCH amd64 != arm64", "cores 8 != 4", "GOMAXPROCS 8 != 4"}
+	if diffs := a.differences(b); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Found the differences %v, expected %v", diffs, expected)
+	}
+	if diffs := a.differences(a); len(diffs) != 0 {
+		t.Errorf("Found differences %v between an environment and itself", diffs)
+	}
+}
+
+func TestSettingsDifferences(t *testing.T) {
+	a := environment{GOOS: "linux"}.withSettings(runOptions{benchtime: "3s", cpu: "1,4", count: 1, goTestArgs: []string{"-short"}})
+	b := environment{GOOS: "linux"}.withSettings(runOptions{count: 5})
+
+	expected := []string{"-benchtime 3s != default", "-cpu 1,4 != default", "-count default != 5", "go test flags -short != default"}
+	if diffs := a.differences(b); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Found the differences %v, expected %v", diffs, expected)
+	}
+}
+
+func TestStrictEnv(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	env := currentEnvironment()
+	env.GOARCH = "elsewhere"
+	raw, err := marshalRecord(benchRecord{benches: map[string]uint64{"BenchmarkSleep": 1e12, "BenchmarkSleep2": 1e12}, env: &env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(".bench_best.json", raw, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions
+	opts.readOnly = true
+	if code := rebench(opts); code != 0 {
+		t.Errorf("Program returned bad exit code %d when only warning about the environment", code)
+	}
+
+	opts.strictEnv = true
+	if code := rebench(opts); code == 0 {
+		t.Errorf("Program returned good exit code with -strictEnv when the bests were set elsewhere")
+	}
+}
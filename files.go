@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// The mode bits of every file rebench writes. Unless they're set exactly with -fileMode, the umask applies as usual.
+var (
+	filePerm  os.FileMode = 0666
+	exactPerm bool
+)
+
+// Whether files are flushed to disk before moving on (-durable)
+var durable bool
+
+// Writes a record, comparison or other file rebench owns with the configured mode bits. When durable, the file is
+// replaced atomically, so it's either entirely old or entirely new no matter when rebench is killed.
+func writeFile(name string, data []byte) error {
+	path := name
+	if durable {
+		path = name + ".tmp"
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	if err := writeAndClose(f, data); err != nil {
+		return err
+	}
+	if err := applyPerm(path, filePerm); err != nil {
+		return err
+	}
+
+	if !durable {
+		return nil
+	}
+	if err := os.Rename(path, name); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return syncDir(filepath.Dir(name))
+}
+
+// Appends the data to a file rebench owns, creating it with the configured mode bits if need be. When durable, the
+// data is flushed to disk before moving on.
+func appendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerm)
+	if err != nil {
+		return err
+	}
+	if err := writeAndClose(f, data); err != nil {
+		return err
+	}
+
+	return applyPerm(name, filePerm)
+}
+
+// Writes the data to a newly created file and closes it, flushing it to disk first when durable
+func writeAndClose(f *os.File, data []byte) error {
+	_, err := f.Write(data)
+	if err == nil && durable {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Moves the file to its backup, replacing any earlier backup. When durable, the file is copied instead and left in
+// place for writeFile to replace atomically, so there's never a moment without it.
+func backupFile(name, backup string) error {
+	if !durable {
+		os.Remove(backup)
+		return os.Rename(name, backup)
+	}
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(backup, data)
+}
+
+// Flushes the entries of the directory to disk, so files created or renamed in it survive a crash
+func syncDir(dir string) error {
+	// Directories can't be opened for syncing on Windows, where NTFS journals renames anyway
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Creates a directory rebench owns (and any parents) with the configured mode bits, searchable wherever they're readable
+func mkdirAll(dir string) error {
+	perm := filePerm | (filePerm&0444)>>2
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+
+	return applyPerm(dir, perm)
+}
+
+// The umask only ever takes bits away, so exact mode bits have to be set after the fact.
+// Also fixes up files that already existed, which keep their old bits otherwise.
+func applyPerm(name string, perm os.FileMode) error {
+	if !exactPerm {
+		return nil
+	}
+
+	return os.Chmod(name, perm)
+}
+
+// The directory with every symbolic link in it resolved, or as it is if it can't be, e.g. because it doesn't exist.
+// git resolves them in the paths it prints while go list and the working directory keep them, as in macOS's /tmp,
+// which is /private/tmp, so directories from either are only compared once resolved.
+func realPath(dir string) string {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		return resolved
+	}
+
+	return dir
+}
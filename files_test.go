@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilePerm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(perm os.FileMode, exact bool) { filePerm, exactPerm = perm, exact }(filePerm, exactPerm)
+	filePerm, exactPerm = 0664, true
+
+	sub := filepath.Join(dir, "sub")
+	if err := mkdirAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(sub); err != nil || info.Mode().Perm() != 0775 {
+		t.Errorf("Created directory with the wrong mode %v %v", info.Mode(), err)
+	}
+
+	name := filepath.Join(sub, "file")
+	if err := writeFile(name, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0664 {
+		t.Errorf("Wrote file with the wrong mode %v %v", info.Mode(), err)
+	}
+}
+
+func TestDurable(t *testing.T) {
+	defer func(d bool) { durable = d }(durable)
+	durable = true
+
+	top := cd(t)
+	defer cleanup(top)
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+
+	if code := rebench(testOptions); code == 0 {
+		t.Errorf("Program returned good exit code when best benchmark is obviously faster")
+	}
+
+	best := unmarshallAndStoreBench(".bench_best.json")
+	old := unmarshallAndStoreBench(".bench_best.json.old")
+	if best["BenchmarkSleep"] != 500 || old["BenchmarkSleep"] != 500 {
+		t.Errorf("Either read or wrote best benchmarks incorrectly %v %v", best, old)
+	}
+
+	if tmp, _ := filepath.Glob("*.tmp"); len(tmp) > 0 {
+		t.Errorf("Left temporary files behind %v", tmp)
+	}
+}
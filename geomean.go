@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+// Every run's performance index for the package, oldest first
+const geomeanFile = ".bench_geomean.json"
+
+// Every run's weighted performance index across packages, oldest first, in the directory of invocation (or the
+// monorepo store)
+const repoGeomeanFile = ".bench_geomean_repo.json"
+
+var geomeanTolPercent = flag.Int("geomeanTol", 0, "Sets the percentage tolerance for the geomean of a package, or the weighted geomean across packages, before returning a non-zero error status, 0 to never fail on it")
+
+// The performance index of one run. Points written before there was an index have none, and are left out.
+type geomeanPoint struct {
+	Time  time.Time `json:"time"`
+	Index float64   `json:"index,omitempty"`
+}
+
+// The geometric mean of the factors between the benchmarks of a package that may fail the run and their best, so 1 is
+// every benchmark matching its best and 1.1 is being 10% slower on average. Unlike a mean of speeds, it doesn't change
+// when benchmarks come and go. Zero if no benchmark was compared with a best.
+func packageGeomean(results []benchResult, groups []benchGroup, ignore ignoreList) float64 {
+	sum, n := 0.0, 0
+	for _, res := range results {
+		if res.Factor > 0 && gating(groups, ignore, res.Name) {
+			sum += math.Log(res.Factor)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+
+	return math.Exp(sum / float64(n))
+}
+
+// The performance index of a package: the geomean of the speeds of its benchmarks that may fail the run against those
+// of its first run on record, so 0.9 is 10% faster than back then. It's chained run to run, the index of the run
+// before times the geomean of the factors between the benchmarks both runs have, so benchmarks coming and going
+// don't move it and new bests don't reset it. The first run is 1, and zero is a run without any benchmark.
+func packageIndex(results []benchResult, last map[string]uint64, previous float64, groups []benchGroup, ignore ignoreList) float64 {
+	sum, n, ran := 0.0, 0, false
+	for _, res := range results {
+		if res.Speed == 0 || !gating(groups, ignore, res.Name) {
+			continue
+		}
+		ran = true
+		if lastSpeed := last[res.Name]; lastSpeed > 0 {
+			sum += math.Log(float64(res.Speed) / float64(lastSpeed))
+			n++
+		}
+	}
+	switch {
+	case !ran:
+		return 0
+	case previous == 0:
+		return 1
+	case n == 0:
+		return previous
+	}
+
+	return previous * math.Exp(sum/float64(n))
+}
+
+// The weight of a package, as set in the config file by import path or by a pattern ending in /... The longest
+// match wins, and packages without any weigh 1.
+func packageWeight(weights map[string]float64, pkgPath string) float64 {
+	weight, longest := 1.0, -1
+	for pattern, w := range weights {
+		if matchesPackage(pattern, pkgPath) && len(pattern) > longest {
+			weight, longest = w, len(pattern)
+		}
+	}
+
+	return weight
+}
+
+// The geometric mean of the geomeans of every package, each weighing as much as the config file says. Zero if no
+// package has a geomean.
+func weightedGeomean(runs []packageRun, weights map[string]float64) float64 {
+	sum, total := 0.0, 0.0
+	for _, run := range runs {
+		w := packageWeight(weights, run.Package)
+		if run.Geomean > 0 && w > 0 {
+			sum += w * math.Log(run.Geomean)
+			total += w
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return math.Exp(sum / total)
+}
+
+// The performance index across packages, chained like that of a package: the index of the run before times the
+// geometric mean of how much each package's index moved since its run before, weighted as the config file says. The
+// first run is 1, and zero is a run without any index.
+func weightedIndex(runs []packageRun, weights map[string]float64, previous float64) float64 {
+	sum, total, indexed := 0.0, 0.0, false
+	for _, run := range runs {
+		w := packageWeight(weights, run.Package)
+		if run.Index == 0 || w == 0 {
+			continue
+		}
+		indexed = true
+		if run.PreviousIndex > 0 {
+			sum += w * math.Log(run.Index/run.PreviousIndex)
+			total += w
+		}
+	}
+	switch {
+	case !indexed:
+		return 0
+	case previous == 0:
+		return 1
+	case total == 0:
+		return previous
+	}
+
+	return previous * math.Exp(sum/total)
+}
+
+// The latest index in the history, zero if there's none
+func lastIndex(history []geomeanPoint) float64 {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Index > 0 {
+			return history[i].Index
+		}
+	}
+
+	return 0
+}
+
+// The lowest index in the history, that of its fastest run, zero if there's none
+func bestIndex(history []geomeanPoint) float64 {
+	best := 0.0
+	for _, point := range history {
+		if point.Index > 0 && (best == 0 || point.Index < best) {
+			best = point.Index
+		}
+	}
+
+	return best
+}
+
+// The line below a comparison, or below the summary, giving the geomean
+func formatGeomean(label string, geomean float64) string {
+	return fmt.Sprintf("%s of New/Best %s", label, formatFactor(geomean))
+}
+
+// E.g. "Performance index 0.93x of the first run on record (previously 0.95x)"
+func formatIndex(label string, index, previous float64) string {
+	if previous == 0 {
+		return fmt.Sprintf("%s %s of the first run on record", label, formatFactor(index))
+	}
+
+	return fmt.Sprintf("%s %s of the first run on record (previously %s)", label, formatFactor(index), formatFactor(previous))
+}
+
+// Whether the geomean fails the run, being further above 1x than the tolerance (e.g. 1.05 for -geomeanTol=105) allows
+func geomeanTooSlow(geomean, tol float64) bool {
+	return tol > 0 && geomean > tol
+}
+
+// E.g. "Geomean of New/Best 1.08x is beyond -geomeanTol 1.05x"
+func formatGeomeanTooSlow(label string, geomean, tol float64) string {
+	return fmt.Sprintf("%s of New/Best %s is beyond -geomeanTol %s", label, formatFactor(geomean), formatFactor(tol))
+}
+
+func appendIndex(history []geomeanPoint, index float64) []geomeanPoint {
+	return append(history, geomeanPoint{Time: time.Now().UTC(), Index: index})
+}
+
+func loadGeomeans(fileName string) []geomeanPoint {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logWarn("cannot open", fileName)
+		}
+		return nil
+	}
+
+	var history []geomeanPoint
+	if err := json.Unmarshal(raw, &history); err != nil {
+		logWarn(fmt.Sprintf("cannot unmarshall json for file %s because: %v", fileName, err))
+		return nil
+	}
+
+	return history
+}
+
+func storeGeomeans(fileName string, history []geomeanPoint) {
+	out, err := marshalFile(history)
+	if err != nil {
+		logError("Couldn't marshall geomeans as json")
+		return
+	}
+
+	if err := writeFile(fileName, out); err != nil {
+		logError("Couldn't write geomeans in", fileName)
+	}
+}
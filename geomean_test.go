@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGeomean(t *testing.T) {
+	results := []benchResult{
+		{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing},
+		{Name: "BenchmarkA", Speed: 200, BestSpeed: 100, Factor: 2, Status: statusSlow},
+		{Name: "BenchmarkB", Speed: 50, BestSpeed: 100, Factor: 0.5, Status: statusRecord},
+		{Name: "BenchmarkC", Speed: 400, BestSpeed: 100, Factor: 4, Status: statusSlow},
+		{Name: "BenchmarkNew", Speed: 7, Status: statusNew},
+		{Name: "BenchmarkFlaky", Speed: 900, BestSpeed: 100, Factor: 9, Status: statusSlow},
+		{Name: "BenchmarkReport", Speed: 900, BestSpeed: 100, Factor: 9, Status: statusSlow},
+	}
+	groups := []benchGroup{{Name: "report", Benchmarks: []string{"^BenchmarkReport$"}, ReportOnly: true}}
+	if err := compileGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+	ignore, err := compileIgnores([]string{"BenchmarkFlaky"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := packageGeomean(results, groups, ignore); math.Abs(g-math.Cbrt(4)) > 1e-9 {
+		t.Errorf("Computed the geomean %v, expected %v", g, math.Cbrt(4))
+	}
+	if g := packageGeomean(results[:1], nil, nil); g != 0 {
+		t.Errorf("Computed the geomean %v without anything compared, expected 0", g)
+	}
+
+	// Against the run before, BenchmarkA twice as slow and BenchmarkB as fast, whatever their bests
+	last := map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 50, "BenchmarkGone": 10, "BenchmarkFlaky": 1}
+	if index := packageIndex(results, last, 0.5, groups, ignore); math.Abs(index-0.5*math.Sqrt2) > 1e-9 {
+		t.Errorf("Computed the index %v, expected %v", index, 0.5*math.Sqrt2)
+	}
+	if index := packageIndex(results, last, 0, groups, ignore); index != 1 {
+		t.Errorf("Computed the index %v of the first run, expected 1", index)
+	}
+	if index := packageIndex(results, nil, 0.5, groups, ignore); index != 0.5 {
+		t.Errorf("Computed the index %v without any benchmark in common, expected 0.5", index)
+	}
+	if index := packageIndex(results[:1], last, 0.5, groups, ignore); index != 0 {
+		t.Errorf("Computed the index %v without any benchmark run, expected 0", index)
+	}
+
+	weights := map[string]float64{"example.com/mod/...": 3, "example.com/mod/experimental": 0}
+	runs := []packageRun{
+		{Package: "example.com/mod/core", Geomean: 2},
+		{Package: "example.com/other", Geomean: 0.5},
+		{Package: "example.com/mod/experimental", Geomean: 100},
+		{Package: "example.com/mod/new"},
+	}
+	// (3*ln 2 + ln 0.5)/4 = ln 2/2
+	if g := weightedGeomean(runs, weights); math.Abs(g-math.Sqrt2) > 1e-9 {
+		t.Errorf("Computed the weighted geomean %v, expected %v", g, math.Sqrt2)
+	}
+
+	runs = []packageRun{
+		{Package: "example.com/mod/core", Index: 2, PreviousIndex: 1},
+		{Package: "example.com/other", Index: 0.25, PreviousIndex: 0.5},
+		{Package: "example.com/mod/new", Index: 1},
+	}
+	if index := weightedIndex(runs, weights, 0.5); math.Abs(index-0.5*math.Sqrt2) > 1e-9 {
+		t.Errorf("Computed the weighted index %v, expected %v", index, 0.5*math.Sqrt2)
+	}
+	if index := weightedIndex(runs[2:], weights, 0.5); index != 0.5 {
+		t.Errorf("Computed the weighted index %v without any package indexed before, expected 0.5", index)
+	}
+
+	if w := packageWeight(weights, "example.com/module"); w != 1 {
+		t.Errorf("Weighed a package outside the pattern %v", w)
+	}
+
+	if geomeanTooSlow(1.04, 1.05) || !geomeanTooSlow(1.06, 1.05) || geomeanTooSlow(100, 0) {
+		t.Errorf("Misjudged a geomean against -geomeanTol")
+	}
+}
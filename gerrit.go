@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	gerritURL      = flag.String("gerrit", "", "Posts the comparison and a label vote to a change on this Gerrit server, e.g. https://review.example.com")
+	gerritChange   = flag.String("gerritChange", os.Getenv("GERRIT_CHANGE_NUMBER"), "The Gerrit change to review")
+	gerritRevision = flag.String("gerritRevision", envOr("GERRIT_PATCHSET_REVISION", "current"), "The revision of the Gerrit change to review")
+	gerritLabel    = flag.String("gerritLabel", "Verified", "The Gerrit label to vote on, +1 when the run passes and -1 when it fails")
+)
+
+// Reviews a Gerrit change through the REST API, authenticating with the HTTP credentials in $GERRIT_USERNAME and $GERRIT_PASSWORD
+type gerritReporter struct {
+	baseURL, change, revision, label string
+}
+
+// The body of a set-review request
+type gerritReview struct {
+	Message string         `json:"message"`
+	Labels  map[string]int `json:"labels,omitempty"`
+	// Tags starting with autogenerated: mark the message as coming from a bot, which Gerrit lets users filter out
+	Tag string `json:"tag"`
+}
+
+func (g gerritReporter) report(r runReport) error {
+	if g.change == "" {
+		return errors.New("no Gerrit change to review, set -gerritChange or $GERRIT_CHANGE_NUMBER")
+	}
+
+	user, password := os.Getenv("GERRIT_USERNAME"), os.Getenv("GERRIT_PASSWORD")
+	if user == "" || password == "" {
+		return errors.New("$GERRIT_USERNAME and $GERRIT_PASSWORD must be set to review Gerrit changes")
+	}
+
+	vote := 1
+	if r.Failed() {
+		vote = -1
+	}
+
+	review := gerritReview{Message: gerritMessage(r), Labels: map[string]int{g.label: vote}, Tag: "autogenerated:rebench"}
+	endpoint := strings.TrimRight(g.baseURL, "/") + "/a/changes/" + url.PathEscape(g.change) + "/revisions/" + url.PathEscape(g.revision) + "/review"
+	req, err := jsonRequest("POST", endpoint, review)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(user, password)
+
+	// The response is prefixed with )]}' to prevent XSSI, so it isn't decoded. Nothing in it is needed anyway.
+	return send(req, nil)
+}
+
+// Gerrit renders lines indented by a space as preformatted text, which keeps the tables aligned
+func gerritMessage(r runReport) string {
+	msg := r.Summary() + "\n"
+	for _, run := range r.Runs {
+		msg += "\n" + run.Package + "\n"
+		for _, line := range strings.Split(strings.TrimRight(run.Table, "\n"), "\n") {
+			msg += "  " + line + "\n"
+		}
+	}
+
+	return msg
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testReport() runReport {
+	results := []benchResult{
+		{Name: "BenchmarkA", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+		{Name: "BenchmarkB", Speed: 100, BestSpeed: 100, Factor: 1, Status: statusOK},
+	}
+
+	return runReport{
+		Runs:    []packageRun{{Package: "example.com/pkg", Results: results, Table: deltaTable(results, true).String()}},
+		TooSlow: true,
+	}
+}
+
+func TestGerritReporter(t *testing.T) {
+	var review gerritReview
+	var path, user string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		user, _, _ = r.BasicAuth()
+		json.NewDecoder(r.Body).Decode(&review)
+		w.Write([]byte(")]}'\n{}"))
+	}))
+	defer srv.Close()
+
+	os.Setenv("GERRIT_USERNAME", "ci")
+	os.Setenv("GERRIT_PASSWORD", "secret")
+	defer os.Unsetenv("GERRIT_USERNAME")
+	defer os.Unsetenv("GERRIT_PASSWORD")
+
+	g := gerritReporter{baseURL: srv.URL + "/", change: "1234", revision: "current", label: "Code-Review"}
+	if err := g.report(testReport()); err != nil {
+		t.Fatalf("Cannot post review %v", err)
+	}
+
+	if path != "/a/changes/1234/revisions/current/review" || user != "ci" {
+		t.Errorf("Review posted to the wrong place %s as %s", path, user)
+	}
+	if review.Labels["Code-Review"] != -1 {
+		t.Errorf("Failed run should vote -1, got %v", review.Labels)
+	}
+	if !strings.HasPrefix(review.Message, "rebench failing: 1 benchmarks too slow") || !strings.Contains(review.Message, "  BenchmarkA") {
+		t.Errorf("Wrong review message %q", review.Message)
+	}
+}
+
+func TestGerritReporterNeedsChange(t *testing.T) {
+	if err := (gerritReporter{baseURL: "http://localhost"}).report(testReport()); err == nil {
+		t.Errorf("Reported without a change to review")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	giteaURL  = flag.String("gitea", "", "Comments the comparison on a pull request on this Gitea or Forgejo server, e.g. https://git.example.com")
+	giteaRepo = flag.String("giteaRepo", "", "The Gitea repository of the pull request, as owner/repo")
+	giteaPR   = flag.Int("giteaPR", 0, "The number of the Gitea pull request to comment on")
+)
+
+// Keeps a single comment on a Gitea (or Forgejo, which has the same API) pull request up to date with the latest run,
+// authenticating with the access token in $GITEA_TOKEN
+type giteaReporter struct {
+	baseURL, repo string
+	pullRequest   int
+}
+
+// Comments are listed a page at a time
+const giteaPageSize = 50
+
+func (g giteaReporter) report(r runReport) error {
+	if g.repo == "" || g.pullRequest == 0 {
+		return errors.New("-giteaRepo and -giteaPR must be set to comment on Gitea")
+	}
+
+	token := os.Getenv("GITEA_TOKEN")
+	if token == "" {
+		return errors.New("$GITEA_TOKEN must be set to comment on Gitea")
+	}
+
+	repoURL := strings.TrimRight(g.baseURL, "/") + "/api/v1/repos/" + g.repo
+	// Pull requests are issues as far as comments are concerned
+	return stickyComment{
+		commentsURL: fmt.Sprintf("%s/issues/%d/comments", repoURL, g.pullRequest),
+		editURL:     func(id int64) string { return fmt.Sprintf("%s/issues/comments/%d", repoURL, id) },
+		editMethod:  "PATCH",
+		sizeParam:   "limit",
+		pageSize:    giteaPageSize,
+		header:      func(h http.Header) { h.Set("Authorization", "token "+token) },
+	}.post(r.Markdown())
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGiteaReporter(t *testing.T) {
+	comments := []forgeComment{{ID: 1, Body: "LGTM"}}
+	forge := fakeForge{header: "Authorization", auth: "token secret", commentsPath: "/api/v1/repos/o/r/issues/3/comments", editPath: "/api/v1/repos/o/r/issues/comments/", editMethod: "PATCH"}
+	srv := forge.serve(t, &comments)
+	defer srv.Close()
+
+	os.Setenv("GITEA_TOKEN", "secret")
+	defer os.Unsetenv("GITEA_TOKEN")
+
+	testStickyComment(t, giteaReporter{baseURL: srv.URL, repo: "o/r", pullRequest: 3}, &comments)
+}
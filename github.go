@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	githubPR  = flag.String("github-pr", "", "Comments the comparison on this GitHub pull request, as owner/repo#123")
+	githubAPI = flag.String("github-api", "https://api.github.com", "The GitHub API -github-pr comments through, e.g. https://github.example.com/api/v3 for GitHub Enterprise Server")
+)
+
+// Keeps a single comment on a GitHub pull request up to date with the latest run, authenticating with the token in
+// $GITHUB_TOKEN
+type githubReporter struct {
+	apiURL, repo string
+	pullRequest  int
+}
+
+// Comments are listed a page at a time, at most 100 to a page
+const githubPageSize = 100
+
+// Parses the pull request of -github-pr, e.g. owner/repo#123
+func newGitHubReporter(apiURL, pr string) (githubReporter, error) {
+	hash := strings.LastIndexByte(pr, '#')
+	if hash < 0 || strings.Count(pr[:hash], "/") != 1 {
+		return githubReporter{}, errors.New("-github-pr must be a pull request as owner/repo#123, not " + pr)
+	}
+	number, err := strconv.Atoi(pr[hash+1:])
+	if err != nil || number <= 0 {
+		return githubReporter{}, errors.New("-github-pr must be a pull request as owner/repo#123, not " + pr)
+	}
+
+	return githubReporter{apiURL: apiURL, repo: pr[:hash], pullRequest: number}, nil
+}
+
+func (g githubReporter) report(r runReport) error {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return errors.New("$GITHUB_TOKEN must be set to comment on GitHub")
+	}
+
+	repoURL := strings.TrimRight(g.apiURL, "/") + "/repos/" + g.repo
+	// Pull requests are issues as far as comments are concerned
+	return stickyComment{
+		commentsURL: fmt.Sprintf("%s/issues/%d/comments", repoURL, g.pullRequest),
+		editURL:     func(id int64) string { return fmt.Sprintf("%s/issues/comments/%d", repoURL, id) },
+		editMethod:  "PATCH",
+		sizeParam:   "per_page",
+		pageSize:    githubPageSize,
+		header:      func(h http.Header) { githubHeaders(h, token) },
+	}.post(r.Markdown())
+}
+
+func githubHeaders(h http.Header, token string) {
+	h.Set("Authorization", "Bearer "+token)
+	h.Set("Accept", "application/vnd.github+json")
+}
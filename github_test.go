@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGitHubReporter(t *testing.T) {
+	comments := []forgeComment{{ID: 1, Body: "LGTM"}}
+	forge := fakeForge{header: "Authorization", auth: "Bearer secret", commentsPath: "/repos/o/r/issues/3/comments", editPath: "/repos/o/r/issues/comments/", editMethod: "PATCH"}
+	srv := forge.serve(t, &comments)
+	defer srv.Close()
+
+	os.Setenv("GITHUB_TOKEN", "secret")
+	defer os.Unsetenv("GITHUB_TOKEN")
+
+	g, err := newGitHubReporter(srv.URL, "o/r#3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStickyComment(t, g, &comments)
+
+	for _, pr := range []string{"o/r", "r#3", "o/r#x", "o/r/x#3"} {
+		if _, err := newGitHubReporter(srv.URL, pr); err == nil {
+			t.Errorf("Accepted the pull request %q", pr)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	gitlabMR          = flag.String("gitlab-mr", "", "Comments the comparison on this GitLab merge request, as group/project!123")
+	gitlabAPI         = flag.String("gitlab-api", "https://gitlab.com/api/v4", "The GitLab API -gitlab-mr comments through, e.g. https://gitlab.example.com/api/v4 for a self-managed instance")
+	gitlabMetrics     = flag.String("gitlab-metrics", "", "Writes the speed and factor of every benchmark to this file as a GitLab metrics report, e.g. metrics.txt")
+	gitlabCodeQuality = flag.String("gitlab-codequality", "", "Writes every slow or missing benchmark to this file as a GitLab code quality report, e.g. gl-code-quality-report.json")
+)
+
+// Keeps a single note on a GitLab merge request up to date with the latest run, authenticating with the access token
+// in $GITLAB_TOKEN
+type gitlabReporter struct {
+	apiURL, project string
+	mergeRequest    int
+}
+
+// Notes are listed a page at a time, at most 100 to a page
+const gitlabPageSize = 100
+
+// Parses the merge request of -gitlab-mr, e.g. group/subgroup/project!123
+func newGitLabReporter(apiURL, mr string) (gitlabReporter, error) {
+	bang := strings.LastIndexByte(mr, '!')
+	if bang < 0 || !strings.Contains(mr[:bang], "/") {
+		return gitlabReporter{}, errors.New("-gitlab-mr must be a merge request as group/project!123, not " + mr)
+	}
+	number, err := strconv.Atoi(mr[bang+1:])
+	if err != nil || number <= 0 {
+		return gitlabReporter{}, errors.New("-gitlab-mr must be a merge request as group/project!123, not " + mr)
+	}
+
+	return gitlabReporter{apiURL: apiURL, project: mr[:bang], mergeRequest: number}, nil
+}
+
+func (g gitlabReporter) report(r runReport) error {
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return errors.New("$GITLAB_TOKEN must be set to comment on GitLab")
+	}
+
+	// Projects are named by their whole path as a single, escaped, segment
+	notesURL := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes", strings.TrimRight(g.apiURL, "/"), url.PathEscape(g.project), g.mergeRequest)
+	return stickyComment{
+		commentsURL: notesURL,
+		editURL:     func(id int64) string { return fmt.Sprintf("%s/%d", notesURL, id) },
+		editMethod:  "PUT",
+		sizeParam:   "per_page",
+		pageSize:    gitlabPageSize,
+		header:      func(h http.Header) { h.Set("PRIVATE-TOKEN", token) },
+	}.post(r.Markdown())
+}
+
+// Writes the artifacts GitLab shows in the merge request widget: a metrics report, whose values it compares with those
+// of the target branch, and a code quality report of the regressions
+type gitlabArtifactsReporter struct {
+	metrics, codeQuality string
+}
+
+// The files are made absolute up front, since packages are benchmarked in their own directories
+func newGitLabArtifactsReporter(metrics, codeQuality string) (gitlabArtifactsReporter, error) {
+	var err error
+	if metrics != "" {
+		if metrics, err = filepath.Abs(metrics); err != nil {
+			return gitlabArtifactsReporter{}, err
+		}
+	}
+	if codeQuality != "" {
+		if codeQuality, err = filepath.Abs(codeQuality); err != nil {
+			return gitlabArtifactsReporter{}, err
+		}
+	}
+
+	return gitlabArtifactsReporter{metrics: metrics, codeQuality: codeQuality}, nil
+}
+
+func (g gitlabArtifactsReporter) report(r runReport) error {
+	if g.metrics != "" {
+		if err := writeFile(g.metrics, gitlabMetricsReport(r)); err != nil {
+			return err
+		}
+	}
+	if g.codeQuality != "" {
+		raw, err := json.MarshalIndent(gitlabCodeQualityReport(r), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFile(g.codeQuality, append(raw, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A sample per line, without the HELP and TYPE comments of Prometheus, which GitLab would take for metrics
+func gitlabMetricsReport(r runReport) []byte {
+	var buf bytes.Buffer
+	for _, run := range r.Runs {
+		for _, res := range run.Results {
+			if res.Status != statusMissing {
+				writeSample(&buf, "rebench_ns_per_op", run.Package, res.Name, float64(res.Speed))
+			}
+			if res.Factor > 0 {
+				writeSample(&buf, "rebench_factor", run.Package, res.Name, res.Factor)
+			}
+		}
+	}
+	if r.Geomean > 0 {
+		fmt.Fprintf(&buf, "rebench_geomean %v\n", r.Geomean)
+	}
+
+	return buf.Bytes()
+}
+
+// An issue of a code quality report, in the subset of the Code Climate format GitLab reads
+type codeQualityIssue struct {
+	Description string              `json:"description"`
+	CheckName   string              `json:"check_name"`
+	Fingerprint string              `json:"fingerprint"` // Tells the same issue apart across runs, so only new ones show as new
+	Severity    string              `json:"severity"`
+	Location    codeQualityLocation `json:"location"`
+}
+
+type codeQualityLocation struct {
+	Path  string `json:"path"` // The import path of the package, which has no single file the benchmark is in
+	Lines struct {
+		Begin int `json:"begin"`
+	} `json:"lines"`
+}
+
+// An issue for every slow or missing benchmark failing the run, never null so GitLab reads an empty report as no issues
+func gitlabCodeQualityReport(r runReport) []codeQualityIssue {
+	issues := []codeQualityIssue{}
+	for _, run := range r.Runs {
+		for _, res := range run.Results {
+			if res.Tolerated {
+				continue
+			}
+			issue := codeQualityIssue{CheckName: "rebench-" + strings.ToLower(string(res.Status)), Severity: "major"}
+			switch res.Status {
+			case statusSlow:
+				issue.Description = fmt.Sprintf("%s is %s its best, %s against %s", res.Name, formatFactor(res.Factor), numbers.speed(res.Speed), numbers.speed(res.BestSpeed))
+			case statusMissing:
+				issue.Description, issue.Severity = res.Name+" has a best on record but didn't run", "minor"
+			default:
+				continue
+			}
+			sum := sha256.Sum256([]byte(issue.CheckName + "\x00" + run.Package + "\x00" + res.Name))
+			issue.Fingerprint = hex.EncodeToString(sum[:])
+			issue.Location.Path = run.Package
+			issue.Location.Lines.Begin = 1
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGitLabReporter(t *testing.T) {
+	notes := []forgeComment{{ID: 1, Body: "LGTM"}}
+	const notesPath = "/api/v4/projects/group%2Fproject/merge_requests/3/notes"
+	forge := fakeForge{header: "PRIVATE-TOKEN", auth: "secret", commentsPath: notesPath, editPath: notesPath + "/", editMethod: "PUT"}
+	srv := forge.serve(t, &notes)
+	defer srv.Close()
+
+	os.Setenv("GITLAB_TOKEN", "secret")
+	defer os.Unsetenv("GITLAB_TOKEN")
+
+	g, err := newGitLabReporter(srv.URL+"/api/v4", "group/project!3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStickyComment(t, g, &notes)
+
+	for _, mr := range []string{"group/project", "project!3", "group/project!x"} {
+		if _, err := newGitLabReporter(srv.URL, mr); err == nil {
+			t.Errorf("Accepted the merge request %q", mr)
+		}
+	}
+}
+
+func TestGitLabArtifacts(t *testing.T) {
+	r := testReport()
+	r.Runs[0].Results = append(r.Runs[0].Results, benchResult{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing})
+
+	expected := `rebench_ns_per_op{package="example.com/pkg",benchmark="BenchmarkA"} 300
+rebench_factor{package="example.com/pkg",benchmark="BenchmarkA"} 3
+rebench_ns_per_op{package="example.com/pkg",benchmark="BenchmarkB"} 100
+rebench_factor{package="example.com/pkg",benchmark="BenchmarkB"} 1
+`
+	if out := string(gitlabMetricsReport(r)); out != expected {
+		t.Errorf("Wrote the metrics\n%s\nexpected\n%s", out, expected)
+	}
+
+	issues := gitlabCodeQualityReport(r)
+	if len(issues) != 2 || issues[0].CheckName != "rebench-slow" || issues[1].CheckName != "rebench-missing" {
+		t.Fatalf("Reported the issues %+v", issues)
+	}
+	if issues[0].Location.Path != "example.com/pkg" || issues[0].Fingerprint == issues[1].Fingerprint {
+		t.Errorf("Reported the issues %+v", issues)
+	}
+	if again := gitlabCodeQualityReport(r); again[0].Fingerprint != issues[0].Fingerprint {
+		t.Errorf("Fingerprinted the same issue differently")
+	}
+
+	r.Runs[0].Results[0].Tolerated = true
+	if issues := gitlabCodeQualityReport(r); len(issues) != 1 || issues[0].CheckName != "rebench-missing" {
+		t.Errorf("Reported the issues %+v with the slow benchmark not failing the run", issues)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+// A group of benchmarks sharing a policy regardless of the package they're in, e.g. "hotpath" or "experimental", as
+// set in the config file
+type benchGroup struct {
+	Name string `json:"name"`
+	// Regular expressions matching the full names of the benchmarks in the group, sub-benchmarks included
+	Benchmarks []string `json:"benchmarks"`
+	SpeedTol   int      `json:"speedTol,omitempty"`  // Overrides -speedTol for the group unless 0
+	RecordTol  int      `json:"recordTol,omitempty"` // Overrides -recordTol for the group unless 0
+	// Reports the group's benchmarks as usual, but never fails the run because of them
+	ReportOnly bool `json:"reportOnly,omitempty"`
+
+	patterns []*regexp.Regexp
+}
+
+// Compiles the patterns of every group, making sure each has a name of its own
+func compileGroups(groups []benchGroup) error {
+	names := make(map[string]bool)
+	for i := range groups {
+		g := &groups[i]
+		if g.Name == "" || names[g.Name] {
+			return errors.New("group " + strconv.Itoa(i+1) + " must have a name of its own")
+		}
+		names[g.Name] = true
+
+		g.patterns = make([]*regexp.Regexp, len(g.Benchmarks))
+		for j, pattern := range g.Benchmarks {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return errors.New("group " + g.Name + " has an invalid regular expression: " + err.Error())
+			}
+			g.patterns[j] = re
+		}
+	}
+
+	return nil
+}
+
+// The first group the benchmark is in, nil if it's in none
+func groupOf(groups []benchGroup, name string) *benchGroup {
+	for i := range groups {
+		for _, re := range groups[i].patterns {
+			if re.MatchString(name) {
+				return &groups[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// The tolerances of the group, or the ones given where it doesn't override them
+func (g *benchGroup) tolerances(speedTol, recordTol float64) (float64, float64) {
+	if g == nil {
+		return speedTol, recordTol
+	}
+	if g.SpeedTol > 0 {
+		speedTol = float64(g.SpeedTol) / 100
+	}
+	if g.RecordTol > 0 {
+		recordTol = float64(g.RecordTol) / 100
+	}
+
+	return speedTol, recordTol
+}
+
+// Whether a slow or missing benchmark may fail the run
+func (g *benchGroup) gates() bool {
+	return g == nil || !g.ReportOnly
+}
+
+// Lays out the results as a comparison per section: the benchmarks outside any group first, then each group in the
+// order of the config file under a heading of its own. Without groups, it's the plain comparison.
+func groupedDelta(results []benchResult, hasBest bool, groups []benchGroup) *table {
+	var ungrouped []benchResult
+	sections := make(map[string][]benchResult)
+	for _, res := range results {
+		if res.Group == "" {
+			ungrouped = append(ungrouped, res)
+		} else {
+			sections[res.Group] = append(sections[res.Group], res)
+		}
+	}
+	if len(sections) == 0 {
+		return deltaTable(results, hasBest)
+	}
+
+	delta := newTable()
+	if len(ungrouped) > 0 {
+		delta.addSection(deltaTable(ungrouped, hasBest))
+	}
+	for _, g := range groups {
+		if len(sections[g.Name]) == 0 {
+			continue
+		}
+
+		heading := "Group " + g.Name
+		if g.SpeedTol > 0 {
+			heading += ", speedTol " + strconv.Itoa(g.SpeedTol) + "%"
+		}
+		if g.RecordTol > 0 {
+			heading += ", recordTol " + strconv.Itoa(g.RecordTol) + "%"
+		}
+		if g.ReportOnly {
+			heading += ", report only"
+		}
+		section := deltaTable(sections[g.Name], hasBest)
+		section.addTitle(heading)
+		delta.addSection(section)
+	}
+
+	return delta
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	groups := []benchGroup{
+		{Name: "hotpath", Benchmarks: []string{"^BenchmarkHot"}, SpeedTol: 110, RecordTol: 90},
+		{Name: "experimental", Benchmarks: []string{"^BenchmarkExp", "^BenchmarkHot/exp"}, ReportOnly: true},
+	}
+	if err := compileGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	oldBenches := map[string]uint64{"BenchmarkHot": 100, "BenchmarkExp": 100, "BenchmarkCold": 100, "BenchmarkExpGone": 10}
+	benches := map[string]uint64{"BenchmarkHot": 120, "BenchmarkExp": 300, "BenchmarkCold": 120}
+	results, _, missing, tooSlow := compare(oldBenches, benches, "example.com/mod", 1.5, 0.7, 0, groups, nil, nil, statsComparison{}, rerunner{})
+	if missing || !tooSlow {
+		t.Errorf("Reported missing %v and too slow %v, expected only the hot path to fail the run", missing, tooSlow)
+	}
+
+	expected := map[string]benchStatus{"BenchmarkHot": statusSlow, "BenchmarkExp": statusSlow, "BenchmarkCold": statusOK, "BenchmarkExpGone": statusMissing}
+	for _, res := range results {
+		if res.Status != expected[res.Name] {
+			t.Errorf("Classified %s as %s, expected %s", res.Name, res.Status, expected[res.Name])
+		}
+		if tolerated := strings.HasPrefix(res.Name, "BenchmarkExp"); res.Tolerated != tolerated {
+			t.Errorf("Marked %s as tolerated %v, expected %v", res.Name, res.Tolerated, tolerated)
+		}
+	}
+
+	delta := "" +
+		"Status    Benchmark Name    New Speed    Best Speed    Factor (New/Old)\n" +
+		"OK        BenchmarkCold     120          100           1.200000\n" +
+		"\n" +
+		"Group hotpath, speedTol 110%, recordTol 90%\n" +
+		"Status    Benchmark Name    New Speed    Best Speed    Factor (New/Old)\n" +
+		"SLOW      BenchmarkHot      120          100           1.200000\n" +
+		"\n" +
+		"Group experimental, report only\n" +
+		"Status     Benchmark Name      New Speed    Best Speed    Factor (New/Old)\n" +
+		"MISSING    BenchmarkExpGone    MISSING      10            N/A\n" +
+		"SLOW       BenchmarkExp        300          100           3.000000\n"
+	if out := groupedDelta(results, true, groups).String(); out != delta {
+		t.Errorf("Rendered\n%s\nexpected\n%s", out, delta)
+	}
+
+	if err := compileGroups([]benchGroup{{Name: "a"}, {Name: "a"}}); err == nil {
+		t.Errorf("Compiled two groups of the same name without complaint")
+	}
+}
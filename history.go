@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Every run of every package with -history, one JSON object per line, in the directory of invocation
+const historyFile = ".rebench_history.jsonl"
+
+var (
+	historyFlags   = flag.NewFlagSet("history", flag.ExitOnError)
+	historyPath    = historyFlags.String("file", historyFile, "The history file to read")
+	historyPackage = historyFlags.String("package", "", "Only prints the runs of the package with this import path")
+)
+
+// The results of one package in one run, as a line of the history file
+type historyEntry struct {
+	Revision   revision               `json:"revision"`
+	Package    string                 `json:"package"`
+	Benchmarks canonicalBenchmarks    `json:"benchmarks"`
+	Stats      map[string]storedStats `json:"stats,omitempty"`
+	Raw        []string               `json:"raw,omitempty"` // The lines of the results as go test printed them, with -raw
+}
+
+// Appends the results of the package to the history file, so earlier runs are never rewritten
+func appendHistory(file string, rev revision, out packageOutput) error {
+	raw, err := json.Marshal(historyEntry{Revision: rev, Package: out.pkgPath, Benchmarks: canonicalize(out.benches, out.metrics), Stats: canonicalStats(out.stats), Raw: out.raw})
+	if err != nil {
+		return err
+	}
+
+	return appendFile(file, append(raw, '\n'))
+}
+
+// Reads every entry of the history file, oldest first. A line cut short by an interrupted run is skipped.
+func readHistory(r io.Reader) ([]historyEntry, error) {
+	var entries []historyEntry
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry historyEntry
+			if jerr := json.Unmarshal(line, &entry); jerr != nil {
+				logWarn("Skipping a broken line of the history:", jerr)
+			} else {
+				entries = append(entries, entry)
+			}
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+	}
+}
+
+// Lays out the time series of the benchmark, one row per run of a package that has it
+func historyTable(entries []historyEntry, name, pkgPath string) *table {
+	tbl := newTable("Time", "Revision", "Package", "Speed")
+	for _, entry := range entries {
+		if pkgPath != "" && entry.Package != pkgPath {
+			continue
+		}
+		benches, _ := canonicalBenchmarks{name: entry.Benchmarks[name]}.split()
+		speed, ok := benches[name]
+		if !ok {
+			continue
+		}
+
+		commit := entry.Revision.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if entry.Revision.Dirty {
+			commit += " (dirty)"
+		}
+		if commit == "" {
+			commit = "-"
+		}
+		tbl.addRow(entry.Revision.Time.Format("2006-01-02 15:04:05"), commit, entry.Package, numbers.speed(speed))
+	}
+
+	return tbl
+}
+
+// Prints every run of a benchmark kept in the history file
+func history(args []string) int {
+	historyFlags.Parse(args)
+	if historyFlags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "rebench history needs the full name of a benchmark, e.g. rebench history BenchmarkParse/large")
+		return exitError
+	}
+
+	f, err := os.Open(*historyPath)
+	if err != nil {
+		logError("Cannot open the history:", err)
+		return exitError
+	}
+	defer f.Close()
+
+	entries, err := readHistory(f)
+	if err != nil {
+		logError("Cannot read the history:", err)
+		return exitError
+	}
+
+	fmt.Print(historyTable(entries, historyFlags.Arg(0), *historyPackage).String())
+	return exitOK
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, historyFile)
+	first := revision{Commit: "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39", Time: time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)}
+	second := revision{Commit: "4e3d2c1b0a9f8e7d6c5b4a393f2a9c1d8e7b6a5f", Dirty: true, Time: time.Date(2016, 1, 3, 15, 4, 5, 0, time.UTC)}
+	if err := appendHistory(file, first, packageOutput{pkgPath: "example.com/a", benches: map[string]uint64{"BenchmarkA": 100}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendHistory(file, first, packageOutput{pkgPath: "example.com/b", benches: map[string]uint64{"BenchmarkB": 5}}); err != nil {
+		t.Fatal(err)
+	}
+	// As left behind by an interrupted run
+	if err := appendFile(file, []byte(`{"revision": {"commit": "`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendFile(file, []byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendHistory(file, second, packageOutput{pkgPath: "example.com/a", benches: map[string]uint64{"BenchmarkA": 120}}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := readHistory(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Read %d entries, expected 3", len(entries))
+	}
+
+	expected := "" +
+		"Time                   Revision                Package          Speed\n" +
+		"2016-01-02 15:04:05    3f2a9c1d8e7b            example.com/a    100\n" +
+		"2016-01-03 15:04:05    4e3d2c1b0a9f (dirty)    example.com/a    120\n"
+	if tbl := historyTable(entries, "BenchmarkA", "").String(); tbl != expected {
+		t.Errorf("Laid out the history as\n%s\nexpected\n%s", tbl, expected)
+	}
+}
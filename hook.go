@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	hookFlags     = flag.NewFlagSet("install-hook", flag.ExitOnError)
+	hookBench     = hookFlags.String("bench", ".", "The benchmarks the hook runs, as in go test -bench")
+	hookBenchtime = hookFlags.String("benchtime", "100ms", "The -benchtime the hook runs benchmarks with")
+	hookGate      = hookFlags.Bool("gateChanged", false, "Only blocks on benchmarks covering code changed since the upstream of the pushed branch")
+	hookForce     = hookFlags.Bool("force", false, "Replaces an existing hook even if rebench didn't install it")
+)
+
+// Marks hooks written by rebench so they can be replaced without -force
+const hookMarker = "# Installed by rebench install-hook."
+
+const prePushHook = `#!/bin/sh
+%s Runs a fast subset of the benchmarks and blocks the push on regressions.
+# Set REBENCH_SKIP=1 (or use git push --no-verify) to push without benchmarking.
+if [ -n "$REBENCH_SKIP" ]; then
+	exit 0
+fi
+
+rebench -speedTol=%d -recordTol=%d -bench=%s -benchtime=%s%s || {
+	echo "rebench: benchmarks regressed or went missing, push blocked. Set REBENCH_SKIP=1 to push anyway." >&2
+	exit 1
+}
+`
+
+func installHook(args []string, speedTolPercent, recordTolPercent int) int {
+	hookFlags.Parse(args)
+	if hookFlags.NArg() != 1 || hookFlags.Arg(0) != "pre-push" {
+		fmt.Fprintln(os.Stderr, "Usage: rebench install-hook [-bench regexp -benchtime duration -gateChanged -force] pre-push")
+		return exitError
+	}
+
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks/pre-push").Output()
+	if err != nil {
+		logError("Cannot find the git hooks directory, is this a git repository?", err)
+		return exitError
+	}
+	path := strings.TrimSpace(string(out))
+
+	var gate string
+	if *hookGate {
+		gate = " -gateChanged='@{upstream}'"
+	}
+
+	script := fmt.Sprintf(prePushHook, hookMarker, speedTolPercent, recordTolPercent, shellQuote(*hookBench), shellQuote(*hookBenchtime), gate)
+	if err := writeHook(path, script, *hookForce); err != nil {
+		logError(err)
+		return exitError
+	}
+
+	logInfo("Installed pre-push hook in", path)
+	return exitOK
+}
+
+// Writes the hook script, refusing to clobber a hook someone else wrote unless forced.
+func writeHook(path, script string, force bool) error {
+	if existing, err := ioutil.ReadFile(path); err == nil && !force && !bytes.Contains(existing, []byte(hookMarker)) {
+		return errors.New("A hook not installed by rebench already exists at " + path + ", use -force to replace it")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		return err
+	}
+
+	// WriteFile leaves the mode of an existing file alone
+	return os.Chmod(path, 0755)
+}
+
+// Single-quotes a string for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
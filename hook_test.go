@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hooks", "pre-push")
+
+	script := fmt.Sprintf(prePushHook, hookMarker, 150, 70, shellQuote("Parse|Lex"), shellQuote("100ms"), "")
+	if err := writeHook(path, script, false); err != nil {
+		t.Fatalf("Cannot write fresh hook %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&0100 == 0 {
+		t.Fatalf("Hook wasn't written as an executable %v", err)
+	}
+
+	// Our own hook can be replaced freely
+	if err := writeHook(path, script, false); err != nil {
+		t.Errorf("Cannot replace hook installed by rebench %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeHook(path, script, false); err == nil {
+		t.Errorf("Replaced a foreign hook without -force")
+	}
+	if err := writeHook(path, script, true); err != nil {
+		t.Errorf("Cannot replace a foreign hook with -force %v", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if quoted := shellQuote("it's"); quoted != `'it'\''s'` {
+		t.Errorf("Wrong quoting %s", quoted)
+	}
+	if !strings.HasPrefix(shellQuote("a b"), "'a b") {
+		t.Errorf("Spaces weren't quoted")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var htmlOut = flag.String("html", "", "Writes the comparison of every package to this file as a single HTML page, with a chart of each benchmark's runs kept with -history")
+
+// The size of the chart of a benchmark's history, in pixels
+const (
+	chartWidth  = 160
+	chartHeight = 32
+)
+
+// Renders the run as a self-contained HTML page, for CI systems that keep a build's artifacts
+type htmlReporter struct {
+	out     string
+	history string // The history file the charts are drawn from, if there is one
+}
+
+// The paths are made absolute up front, since packages are benchmarked in their own directories
+func newHTMLReporter(out string) (htmlReporter, error) {
+	out, err := filepath.Abs(out)
+	if err != nil {
+		return htmlReporter{}, err
+	}
+	history, err := filepath.Abs(historyFile)
+	if err != nil {
+		return htmlReporter{}, err
+	}
+
+	return htmlReporter{out: out, history: history}, nil
+}
+
+type htmlPage struct {
+	Report   runReport
+	Packages []htmlPackage
+}
+
+type htmlPackage struct {
+	Package string
+	Heading string // The counts of its benchmarks and their geomean
+	Rows    []htmlRow
+	Table   string // The comparison as written to bench_comparison.txt, with the wall time, geomean, metrics and so on
+}
+
+type htmlRow struct {
+	Status, Name, Speed, Best, Factor string
+	Chart                             template.HTML
+}
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Report.Summary}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 0.3em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+td.num { text-align: right; font-family: monospace; }
+.SLOW, .MISSING, .failing { color: #c0392b; font-weight: bold; }
+.RECORD, .passing { color: #27ae60; font-weight: bold; }
+.NEW { color: #2980b9; }
+pre { color: #555; }
+</style>
+</head>
+<body>
+<h1 class="{{.Report.Verdict}}">{{.Report.Summary}}</h1>
+<p>{{.Report.Overview}}</p>
+{{if .Report.Geomean}}<p>Weighted geomean of New/Best {{printf "%.2fx" .Report.Geomean}}</p>{{end}}
+{{range .Packages}}
+<h2>{{.Package}}</h2>
+<p>{{.Heading}}</p>
+<table>
+<tr><th>Status</th><th>Benchmark Name</th><th>New Speed</th><th>Best Speed</th><th>Factor (New/Old)</th><th>History</th></tr>
+{{range .Rows}}<tr><td class="{{.Status}}">{{.Status}}</td><td>{{.Name}}</td><td class="num">{{.Speed}}</td><td class="num">{{.Best}}</td><td class="num">{{.Factor}}</td><td>{{.Chart}}</td></tr>
+{{end}}</table>
+<details><summary>Comparison</summary><pre>{{.Table}}</pre></details>
+{{end}}
+</body>
+</html>
+`))
+
+func (h htmlReporter) report(r runReport) error {
+	var entries []historyEntry
+	if f, err := os.Open(h.history); err == nil {
+		entries, err = readHistory(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	page := htmlPage{Report: r}
+	for _, run := range r.Runs {
+		pkg := htmlPackage{Package: run.Package, Heading: run.Heading(), Table: run.Table}
+		for _, res := range sortedResults(run.Results, *resultOrder) {
+			row := newHTMLRow(res, benchmarkHistory(entries, run.Package, res.Name))
+			pkg.Rows = append(pkg.Rows, row)
+		}
+		page.Packages = append(page.Packages, pkg)
+	}
+
+	f, err := os.OpenFile(h.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	if err := htmlTemplate.Execute(f, page); err != nil {
+		f.Close()
+		return err
+	}
+	if err := writeAndClose(f, nil); err != nil {
+		return err
+	}
+
+	return applyPerm(h.out, filePerm)
+}
+
+// The row of a benchmark, with a chart of its history
+func newHTMLRow(res benchResult, history []float64) htmlRow {
+	row := htmlRow{Status: string(res.Status), Name: res.Name, Speed: numbers.speed(res.Speed), Best: numbers.speed(res.BestSpeed), Factor: numbers.factor(res.Factor)}
+	switch res.Status {
+	case statusMissing:
+		row.Speed, row.Factor = "MISSING", "N/A"
+	case statusNew:
+		row.Best, row.Factor = "NONE", "N/A"
+	}
+	row.Chart = sparkline(history)
+
+	return row
+}
+
+// The ns/op of every run of the benchmark in the history, oldest first
+func benchmarkHistory(entries []historyEntry, pkgPath, name string) []float64 {
+	var speeds []float64
+	for _, entry := range entries {
+		if entry.Package != pkgPath {
+			continue
+		}
+		if sec, ok := entry.Benchmarks[name]["sec/op"]; ok {
+			speeds = append(speeds, canonicalUnits["ns/op"].from(sec))
+		}
+	}
+
+	return speeds
+}
+
+// A line chart of the values as inline SVG, scaled to fill it, with the latest value marked. Nothing for fewer
+// than two values.
+func sparkline(values []float64) template.HTML {
+	if len(values) < 2 {
+		return ""
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	points := make([]string, len(values))
+	var x, y float64
+	for i, v := range values {
+		x = float64(i) * (chartWidth - 4) / float64(len(values)-1)
+		y = chartHeight / 2
+		if max > min {
+			// Slower runs are drawn higher up
+			y = (chartHeight - 4) * (max - v) / (max - min)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x+2, y+2)
+	}
+
+	return template.HTML(fmt.Sprintf(`<svg width="%d" height="%d"><polyline fill="none" stroke="#2980b9" stroke-width="1.5" points="%s"/><circle cx="%.1f" cy="%.1f" r="2" fill="#2980b9"/></svg>`,
+		chartWidth, chartHeight, strings.Join(points, " "), x+2, y+2))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	history := filepath.Join(dir, historyFile)
+	for _, speed := range []uint64{100, 150, 300} {
+		if err := appendHistory(history, revision{Time: time.Now()}, packageOutput{pkgPath: "example.com/pkg", benches: map[string]uint64{"BenchmarkA": speed, "BenchmarkB": 100}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(dir, "report.html")
+	if err := (htmlReporter{out: out, history: history}).report(testReport()); err != nil {
+		t.Fatalf("Cannot render report %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(raw)
+	for _, expected := range []string{
+		"<title>rebench failing: 1 benchmarks too slow, 0 missing</title>",
+		`<td class="SLOW">SLOW</td><td>BenchmarkA</td><td class="num">300</td><td class="num">100</td><td class="num">3.000000</td>`,
+		`<polyline fill="none" stroke="#2980b9" stroke-width="1.5" points="2.0,30.0 80.0,23.0 158.0,2.0"/>`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("The report lacks %s:\n%s", expected, page)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if chart := sparkline([]float64{100}); chart != "" {
+		t.Errorf("Drew a chart of a single run %s", chart)
+	}
+	if chart := sparkline([]float64{100, 100}); !strings.Contains(string(chart), `points="2.0,18.0 158.0,18.0"`) {
+		t.Errorf("Didn't draw a flat history through the middle %s", chart)
+	}
+}
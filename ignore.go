@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+// The benchmarks the config file says to ignore: run, compared and recorded like any other, but never failing the run,
+// e.g. because they're flaky or depend on the environment. Each is an exact name, covering the benchmarks it runs
+// too, or a regular expression matching full names.
+type ignoreList []*regexp.Regexp
+
+func compileIgnores(entries []string) (ignoreList, error) {
+	ignores := make(ignoreList, 0, len(entries))
+	for _, entry := range entries {
+		pattern := entry
+		// A plain name is only that benchmark and its sub-benchmarks, not every benchmark it's a prefix of
+		if regexp.QuoteMeta(entry) == entry {
+			pattern = "^" + entry + "(/|$)"
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil || entry == "" {
+			return nil, errors.New("invalid benchmark to ignore " + entry)
+		}
+		ignores = append(ignores, re)
+	}
+
+	return ignores, nil
+}
+
+func (l ignoreList) matches(name string) bool {
+	for _, re := range l {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether a slow or missing benchmark may fail the run, which it may unless its group is report only or it's ignored
+func gates(groups []benchGroup, ignore ignoreList, name string) bool {
+	if ignore.matches(name) {
+		logInfo("Not failing because of", name+", which the config file ignores")
+		return false
+	}
+	if g := groupOf(groups, name); !g.gates() {
+		logInfo("Not failing because of", name+", its group", g.Name, "is report only")
+		return false
+	}
+
+	return true
+}
+
+// Whether a benchmark may fail the run, like gates but without logging why not
+func gating(groups []benchGroup, ignore ignoreList, name string) bool {
+	return !ignore.matches(name) && groupOf(groups, name).gates()
+}
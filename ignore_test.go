@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestCompileIgnores(t *testing.T) {
+	ignore, err := compileIgnores([]string{"BenchmarkFlaky", "^BenchmarkNet/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"BenchmarkFlaky":        true,
+		"BenchmarkFlaky/small":  true,
+		"BenchmarkFlakyToo":     false,
+		"BenchmarkNet/dial":     true,
+		"BenchmarkNet":          false,
+		"BenchmarkEncode/large": false,
+	} {
+		if ignore.matches(name) != expected {
+			t.Errorf("Matching %s gave %v, expected %v", name, !expected, expected)
+		}
+	}
+
+	for _, entries := range [][]string{{""}, {"Benchmark("}} {
+		if _, err := compileIgnores(entries); err == nil {
+			t.Errorf("Accepted the ignores %q", entries)
+		}
+	}
+}
+
+func TestCompareIgnores(t *testing.T) {
+	ignore, err := compileIgnores([]string{"BenchmarkFlaky", "BenchmarkGone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBenches := map[string]uint64{"BenchmarkFlaky": 100, "BenchmarkGone": 100, "BenchmarkSteady": 100}
+	benches := map[string]uint64{"BenchmarkFlaky": 300, "BenchmarkSteady": 100}
+
+	results, _, missing, tooSlow := compare(oldBenches, benches, "example.com/mod", 1.5, 0.7, 0, nil, ignore, nil, statsComparison{}, rerunner{})
+	if missing || tooSlow {
+		t.Errorf("Failed the run because of ignored benchmarks: missing %v, too slow %v", missing, tooSlow)
+	}
+	statuses := make(map[string]benchStatus)
+	for _, res := range results {
+		statuses[res.Name] = res.Status
+	}
+	if statuses["BenchmarkFlaky"] != statusSlow || statuses["BenchmarkGone"] != statusMissing {
+		t.Errorf("Didn't report the ignored benchmarks: %v", statuses)
+	}
+
+	benches["BenchmarkSteady"] = 300
+	if _, _, _, tooSlow := compare(oldBenches, benches, "example.com/mod", 1.5, 0.7, 0, nil, ignore, nil, statsComparison{}, rerunner{}); !tooSlow {
+		t.Errorf("Ignored a benchmark that isn't in the ignore list")
+	}
+}
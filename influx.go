@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var influxOut = flag.String("influx", "", "Writes every benchmark of the run as InfluxDB line protocol, appended to this file or POSTed to this http(s) write URL")
+
+// Writes the results of the run as InfluxDB line protocol, one point per benchmark tagged with its package, name,
+// commit and host. The Authorization header is "Token $INFLUX_TOKEN" when that's set.
+type influxReporter struct {
+	out string // A file, or an http(s) URL to POST to
+}
+
+// A file is made absolute up front, since packages are benchmarked in their own directories
+func newInfluxReporter(out string) (influxReporter, error) {
+	if isURL(out) {
+		return influxReporter{out: out}, nil
+	}
+
+	out, err := filepath.Abs(out)
+	return influxReporter{out: out}, err
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+var (
+	influxTagEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+func (x influxReporter) report(r runReport) error {
+	host, _ := os.Hostname()
+	commit := r.Revision.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	timestamp := r.Revision.Time.UnixNano()
+
+	var buf bytes.Buffer
+	for _, run := range r.Runs {
+		for _, res := range run.Results {
+			// A missing benchmark has no speed to speak of
+			if res.Status == statusMissing {
+				continue
+			}
+			fmt.Fprintf(&buf, "rebench,package=%s,benchmark=%s,commit=%s", influxTagEscaper.Replace(run.Package), influxTagEscaper.Replace(res.Name), influxTagEscaper.Replace(commit))
+			if host != "" {
+				buf.WriteString(",host=" + influxTagEscaper.Replace(host))
+			}
+			buf.WriteString(" ns_per_op=" + strconv.FormatUint(res.Speed, 10) + "i")
+			if res.Status != statusNew {
+				buf.WriteString(",best_ns_per_op=" + strconv.FormatUint(res.BestSpeed, 10) + "i,factor=" + strconv.FormatFloat(res.Factor, 'g', -1, 64))
+			}
+			fmt.Fprintf(&buf, `,status="%s" %d`+"\n", influxStringEscaper.Replace(string(res.Status)), timestamp)
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	if !isURL(x.out) {
+		return appendFile(x.out, buf.Bytes())
+	}
+
+	req, err := http.NewRequest("POST", x.out, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token := os.Getenv("INFLUX_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	return send(req, nil)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInfluxReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := testReport()
+	r.Runs[0].Results = append(r.Runs[0].Results, benchResult{Name: "BenchmarkNew/a b", Speed: 50, Status: statusNew}, benchResult{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing})
+	r.Revision = revision{Commit: "abc", Time: time.Unix(1452697445, 0)}
+	host, _ := os.Hostname()
+	expected := `rebench,package=example.com/pkg,benchmark=BenchmarkA,commit=abc,host=` + host + ` ns_per_op=300i,best_ns_per_op=100i,factor=3,status="SLOW" 1452697445000000000
+rebench,package=example.com/pkg,benchmark=BenchmarkB,commit=abc,host=` + host + ` ns_per_op=100i,best_ns_per_op=100i,factor=1,status="OK" 1452697445000000000
+rebench,package=example.com/pkg,benchmark=BenchmarkNew/a\ b,commit=abc,host=` + host + ` ns_per_op=50i,status="NEW" 1452697445000000000
+`
+
+	file := filepath.Join(dir, "bench.lp")
+	for i := 0; i < 2; i++ {
+		if err := (influxReporter{out: file}).report(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if written, err := ioutil.ReadFile(file); err != nil || string(written) != expected+expected {
+		t.Errorf("Appended (%v):\n%s\nexpected every run:\n%s", err, written, expected)
+	}
+
+	var posted, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		raw, _ := ioutil.ReadAll(req.Body)
+		posted, auth = string(raw), req.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	os.Setenv("INFLUX_TOKEN", "secret")
+	defer os.Unsetenv("INFLUX_TOKEN")
+
+	if err := (influxReporter{out: srv.URL + "/api/v2/write?bucket=b"}).report(r); err != nil {
+		t.Fatal(err)
+	}
+	if posted != expected || auth != "Token secret" {
+		t.Errorf("POSTed with %q:\n%s\nexpected:\n%s", auth, posted, expected)
+	}
+}
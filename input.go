@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var inputFile = flag.String("input", "", "Reads the output of a go test -bench run captured earlier from this file, or stdin for -, rather than running go test")
+
+// Opens a file given on the command line, or stdin for -
+func openInput(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(file)
+}
+
+// Hands over each package of the captured output of -input, which is parsed like that of a -cmd since it needn't
+// come from go test -json, or from go test at all
+func readInputBenches(file string, onPackage packageFunc) error {
+	in, err := openInput(file)
+	if err != nil {
+		logError("Couldn't read the output of go test:", err)
+		return err
+	}
+	defer in.Close()
+
+	logInfo("Parsing the results of go test in", file)
+	return streamCommandOutput(in, onPackage, nil)
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Everything needed to judge the packages of a run, worked out once up front so packages can be judged one at a
+// time wherever their records are kept
+type judge struct {
+	opts                         runOptions
+	benchMatcher                 benchMatcher
+	speedTol, recordTol, wallTol float64
+	geomeanTol                   float64
+
+	gated  map[string]bool // The packages allowed to fail the run, nil if they all are
+	owners codeowners
+	top    string // The top of the repository the CODEOWNERS paths are relative to
+
+	revision revision    // What the run benchmarks
+	env      environment // Where the run benchmarks
+
+	noise map[string]noiseModel // The noise of every package's benchmarks across the history, with -noise
+	// The latest speeds of every package's benchmarks in the history, with -driftTol
+	drift    map[string]speedHistory
+	driftTol float64
+}
+
+// The exit codes of a run, so CI can tell a broken build from a slow benchmark
+const (
+	exitOK      = 0
+	exitError   = 1 // rebench couldn't run, e.g. because of invalid flags or a broken config file
+	exitGoTest  = 2 // go test (or go list) failed, e.g. because the code doesn't compile or a benchmark panicked
+	exitMissing = 3 // Benchmarks on record were missing from the run
+	exitSlow    = 4 // Benchmarks regressed, i.e. got slower than -speedTol allows
+	exitEnv     = 5 // The bests were set in a different environment, with -strictEnv
+	exitTooLong = 6 // Packages took longer to benchmark than -wallTol allows
+)
+
+// What -against compares the run with
+const (
+	againstBest = "best"
+	againstLast = "last"
+	againstBoth = "both"
+)
+
+// What's on record about the previous runs of a package
+type packageHistory struct {
+	wallTimes []wallTime
+	geomeans  []geomeanPoint
+	last      benchRecord // The results of the previous run, for -against and the performance index
+}
+
+// The judgement on a single package and the records to keep for it
+type packageVerdict struct {
+	run                       packageRun
+	best                      benchRecord // The best benchmarks to store, including any -bench didn't run
+	hasBest                   bool        // Whether there were best benchmarks on record at all
+	missing, tooSlow, tooLong bool        // Only set if the package is allowed to fail the run
+	mismatched                bool        // Whether the run fails because the bests were set on another machine
+}
+
+func newJudge(opts runOptions) (*judge, error) {
+	benchMatcher, err := compileBenchMatcher(opts.bench)
+	if err != nil {
+		return nil, errors.New("Invalid -bench regular expression: " + err.Error())
+	}
+
+	j := &judge{
+		opts:         opts,
+		benchMatcher: benchMatcher,
+		speedTol:     float64(opts.speedTolPercent) / 100,
+		recordTol:    float64(opts.recordTolPercent) / 100,
+		wallTol:      float64(opts.wallTolPercent) / 100,
+		driftTol:     float64(opts.driftTolPercent) / 100,
+		geomeanTol:   float64(opts.geomeanTolPercent) / 100,
+		revision:     currentRevision(),
+		env:          currentEnvironment().withSettings(opts),
+	}
+	// The machine that ran the benchmarks of -input is unknown, and left out of comparisons like anything unknown
+	if opts.input != "" {
+		j.env = environment{}.withSettings(opts)
+	}
+
+	if opts.gateChanged != "" {
+		j.gated, err = affectedPackages(opts.gateChanged, opts.packages)
+		if err != nil {
+			logWarn("Cannot determine the packages changed since", opts.gateChanged+", gating on every package:", err)
+		}
+	}
+
+	if len(opts.unstable) > 0 {
+		logWarn(formatMachineWarnings(opts.unstable))
+		if opts.stableOnly {
+			logWarn("Leaving the best benchmarks alone because of -stableOnly")
+		}
+	}
+	if opts.noise {
+		j.noise = loadNoise(historyFile)
+	}
+	if opts.driftTolPercent > 0 {
+		j.drift = loadSpeedHistories(historyFile, opts.driftRuns)
+	}
+	if opts.codeowners {
+		j.owners, j.top, err = loadCodeowners()
+		if err != nil {
+			logWarn("Cannot load CODEOWNERS, not naming owners:", err)
+		}
+	}
+
+	return j, nil
+}
+
+// Compares what go test printed about a package with the best on record (whose benchmarks are nil if there are
+// none) and its wall time and geomean with their history, and lays out the benchmarks against the references for
+// -matrix. The directory is only needed to look up its owners.
+func (j *judge) judgePackage(out packageOutput, dir string, old benchRecord, history packageHistory, refs []reference) packageVerdict {
+	pkgPath, benches, wall := out.pkgPath, out.benches, out.wall
+	v := packageVerdict{hasBest: old.benches != nil}
+	old, history.last = renameRecord(old, j.opts.renames, benches, pkgPath), renameRecord(history.last, j.opts.renames, benches, pkgPath)
+
+	unrun := splitUnrun(old.benches, j.benchMatcher)
+	stats := statsComparison{old: old.stats, new: out.stats, alpha: j.opts.alpha, history: j.noise[pkgPath]}
+	speedTol, recordTol, tols := j.opts.tolerances.forPackage(pkgPath, j.speedTol, j.recordTol)
+	minNs := j.opts.tolerances.minNsFor(pkgPath, j.opts.minNs)
+	results, best, m, ts := compare(old.benches, benches, pkgPath, speedTol, recordTol, minNs, j.opts.groups, j.opts.ignore, tols, stats, j.reruns(pkgPath, dir))
+	if !j.opts.record {
+		v.best.pending = confirmPending(results, best, old.pending, j.opts.confirmRecords)
+	}
+	metrics := classifyMetrics(old.metrics, out.metrics, j.opts.units, speedTol, recordTol)
+	ts = metricsRegressed(metrics, j.opts.groups, j.opts.ignore) || ts
+	v.best.metrics = bestMetrics(old.metrics, metrics)
+	v.best.stats = bestStats(old.stats, out.stats, results)
+	delta := groupedDelta(results, v.hasBest, j.opts.groups)
+	reported := results
+	if j.opts.against == againstLast || j.opts.against == againstBoth {
+		lastResults, lm, lts := j.compareLast(out, dir, history.last, speedTol, recordTol, minNs, tols)
+		lastDelta := groupedDelta(lastResults, history.last.benches != nil, j.opts.groups)
+		if j.opts.against == againstLast {
+			reported, delta, m, ts = lastResults, lastDelta, lm, lts
+		} else {
+			delta.addFooter("")
+			delta.addFooter("Compared with the last run")
+			delta.addFooter(strings.TrimSuffix(lastDelta.String(), "\n"))
+			m, ts = m || lm, ts || lts
+		}
+	}
+	previous, tl := compareWallTime(history.wallTimes, wall, j.wallTol)
+	if out.crashed != "" {
+		delta.addFooter(out.crashed + " failed, so the benchmarks after it didn't run")
+	}
+	if wall > 0 {
+		delta.addFooter(formatWallTime(wall, previous))
+	}
+	geomean := packageGeomean(results, j.opts.groups, j.opts.ignore)
+	previousIndex := lastIndex(history.geomeans)
+	index := packageIndex(results, history.last.benches, previousIndex, j.opts.groups, j.opts.ignore)
+	delta.addTitle(formatHeading(countResults(reported), geomean))
+	if top := topLines(reported); len(top) > 0 {
+		delta.addTitle("")
+		for _, line := range top {
+			delta.addTitle(line)
+		}
+	}
+	if geomean > 0 {
+		delta.addFooter(formatGeomean("Geomean", geomean))
+	}
+	if index > 0 {
+		delta.addFooter(formatIndex("Performance index", index, previousIndex))
+	}
+	if geomeanTooSlow(geomean, j.geomeanTol) {
+		logWarn(pkgPath+":", formatGeomeanTooSlow("Geomean", geomean, j.geomeanTol))
+		delta.addFooter(formatGeomeanTooSlow("Geomean", geomean, j.geomeanTol))
+		ts = true
+	}
+
+	// Dry runs write no file at all, profiles included
+	if !j.opts.record && !j.opts.readOnly {
+		profiles := j.profiles(pkgPath, dir).capture(results)
+		for _, res := range results {
+			if dir, ok := profiles[res.Name]; ok {
+				delta.addFooter("Profiles of " + res.Name + " in " + dir)
+			}
+		}
+	}
+	for _, res := range results {
+		if res.Noise > 0 && noiseTolerance(res.Noise) > speedTol {
+			delta.addFooter(formatNoise(res))
+		}
+	}
+	if j.drift != nil {
+		for _, d := range j.drift[pkgPath].drifted(benches, j.driftTol, j.opts.driftRuns) {
+			logWarn(pkgPath+":", formatDrift(d))
+			delta.addFooter(formatDrift(d))
+			ts = gates(j.opts.groups, j.opts.ignore, d.name) || ts
+		}
+	}
+	for _, name := range sortedPending(v.best.pending) {
+		delta.addFooter(formatPending(name, v.best.pending[name], j.opts.confirmRecords))
+	}
+	if j.revision.Commit != "" {
+		delta.addFooter("Run on " + j.revision.String())
+	}
+	for _, res := range results {
+		if r, ok := old.revisions[res.Name]; ok && res.Status == statusSlow && j.opts.against != againstLast {
+			delta.addFooter("Best of " + res.Name + " set on " + r.String())
+		}
+	}
+
+	if old.env != nil && len(old.benches) > 0 {
+		if diffs := old.env.differences(j.env); len(diffs) > 0 {
+			msg := "The best on record was set in a different environment (" + strings.Join(diffs, ", ") + "), so the comparison may be meaningless"
+			logWarn(pkgPath+":", msg)
+			delta.addFooter("Warning: " + msg)
+			v.mismatched = j.opts.strictEnv
+		}
+	}
+
+	if len(j.opts.unstable) > 0 {
+		delta.addFooter("Warning: " + formatMachineWarnings(j.opts.unstable))
+	}
+
+	var pkgOwners []string
+	if j.owners != nil && (m || ts || tl) {
+		pkgOwners = j.owners.packageOwners(j.top, dir)
+		if len(pkgOwners) > 0 {
+			logInfo("Package", pkgPath, "is owned by", strings.Join(pkgOwners, " "))
+			delta.addFooter("Owned by " + strings.Join(pkgOwners, " "))
+		}
+	}
+
+	if j.opts.record {
+		// The run is the best, however it compared, but the benchmarks -bench didn't run keep theirs
+		v.best = filterRecord(old, func(name string) bool {
+			_, ok := unrun[name]
+			return ok
+		})
+		best = v.best.benches
+		for name, speed := range benches {
+			best[name] = speed
+		}
+		for name, units := range out.metrics {
+			if v.best.metrics == nil {
+				v.best.metrics = make(benchMetrics)
+			}
+			v.best.metrics[name] = units
+		}
+		for name, s := range out.stats {
+			if v.best.stats == nil {
+				v.best.stats = make(map[string]benchStats)
+			}
+			v.best.stats[name] = s
+		}
+		if m || ts || tl {
+			logInfo("Recording", pkgPath, "as the best regardless of how it compared")
+		}
+		m, ts, tl = false, false, false
+	}
+
+	for name, speed := range unrun {
+		best[name] = speed
+		if p, ok := old.pending[name]; ok && !j.opts.record {
+			if v.best.pending == nil {
+				v.best.pending = make(map[string]pendingRecord)
+			}
+			v.best.pending[name] = p
+		}
+	}
+	v.best.benches = best
+	v.best.revision = &j.revision
+	// The bests stay those of the machine they were first set on, unless they're all recorded anew
+	v.best.env = old.env
+	if v.best.env == nil || j.opts.record {
+		v.best.env = &j.env
+	}
+	v.best.revisions = bestRevisions(old.revisions, j.revision, results, best)
+	if j.opts.record {
+		for name := range benches {
+			if v.best.revisions == nil {
+				v.best.revisions = make(map[string]revision)
+			}
+			v.best.revisions[name] = j.revision
+		}
+	}
+
+	if j.keepsBests() && countStatus(results, statusNew)+countStatus(results, statusRecord) > 0 {
+		logInfo("Leaving the best of", pkgPath, "as it is, rebench accept makes this run the best")
+	}
+
+	if j.gated == nil || j.gated[pkgPath] {
+		v.missing, v.tooSlow, v.tooLong = m, ts, tl
+	} else if m || ts || tl {
+		logInfo("Nothing covered by", pkgPath, "changed since", j.opts.gateChanged+", not failing because of it")
+	}
+	if j.opts.record || j.gated != nil && !j.gated[pkgPath] {
+		reported = tolerateAll(reported)
+	}
+
+	v.run = packageRun{Package: pkgPath, Results: reported, Metrics: metrics, Table: delta.String(), Owners: pkgOwners, Crashed: out.crashed, WallTime: wall, PreviousWallTime: previous}
+	v.run.Geomean, v.run.Index, v.run.PreviousIndex = geomean, index, previousIndex
+	if len(metrics) > 0 {
+		v.run.Table += "\n" + metricsTable(metrics).String()
+	}
+	if len(refs) > 0 && len(benches) > 0 {
+		v.run.Matrix = matrixTable(benches, refs).String()
+		v.run.Table += "\n" + v.run.Matrix
+	}
+
+	return v
+}
+
+// A copy of the results where no benchmark fails the run, for packages whose verdict doesn't count
+func tolerateAll(results []benchResult) []benchResult {
+	tolerated := make([]benchResult, len(results))
+	for i, res := range results {
+		res.Tolerated = res.Status == statusSlow || res.Status == statusMissing
+		tolerated[i] = res
+	}
+
+	return tolerated
+}
+
+// Whether runs leave the best on record as it is, see -acceptOnly and -stableOnly
+func (j *judge) keepsBests() bool {
+	return j.opts.acceptOnly && !j.opts.record || j.opts.stableOnly && len(j.opts.unstable) > 0
+}
+
+// What re-runs the slow benchmarks of the package for -rerun
+func (j *judge) reruns(pkgPath, dir string) rerunner {
+	return rerunner{pkgPath: pkgPath, dir: dir, times: j.opts.rerun, flags: goTestFlags(j.opts)}
+}
+
+// What profiles the slow benchmarks of the package for -profile
+func (j *judge) profiles(pkgPath, dir string) profiler {
+	return profiler{pkgPath: pkgPath, pkgDir: dir, dir: j.opts.profile, rev: j.revision, flags: goTestFlags(j.opts)}
+}
+
+// Compares the run with the previous one for -against, returning whether benchmarks went missing or got slower since
+func (j *judge) compareLast(out packageOutput, dir string, last benchRecord, speedTol, recordTol float64, minNs int, tols map[string]benchTolerances) ([]benchResult, bool, bool) {
+	if last.benches == nil {
+		return classifyGroups(nil, out.benches, speedTol, recordTol, j.opts.groups, tols), false, false
+	}
+
+	logDebug("Comparing with the last run")
+	splitUnrun(last.benches, j.benchMatcher)
+	stats := statsComparison{old: last.stats, new: out.stats, alpha: j.opts.alpha, history: j.noise[out.pkgPath]}
+	results, _, missing, tooSlow := compare(last.benches, out.benches, out.pkgPath, speedTol, recordTol, minNs, j.opts.groups, j.opts.ignore, tols, stats, j.reruns(out.pkgPath, dir))
+	return results, missing, tooSlow
+}
+
+// Adds a judged package to the report
+func (r *runReport) add(v packageVerdict) {
+	r.Missing = r.Missing || v.missing
+	r.TooSlow = r.TooSlow || v.tooSlow
+	r.TooLong = r.TooLong || v.tooLong
+	r.Mismatched = r.Mismatched || v.mismatched
+	if len(v.run.Results) > 0 {
+		r.Runs = append(r.Runs, v.run)
+	}
+}
+
+// Sends the report to every reporter, then works out the exit status of the run. The weighted performance index of
+// the run is added to the history in geomeanPath.
+func (j *judge) finish(report runReport, geomeanPath string) int {
+	history := loadGeomeans(geomeanPath)
+	report.Geomean = weightedGeomean(report.Runs, j.opts.weights)
+	report.PreviousIndex = lastIndex(history)
+	report.Index = weightedIndex(report.Runs, j.opts.weights, report.PreviousIndex)
+	report.Revision = j.revision
+	if len(report.Runs) > 0 {
+		logInfo(report.Overview())
+	}
+	if report.Geomean > 0 {
+		logInfo(formatGeomean("Weighted geomean across packages", report.Geomean))
+	}
+	if report.Index > 0 {
+		logInfo(formatIndex("Weighted performance index across packages", report.Index, report.PreviousIndex))
+		if !j.opts.readOnly {
+			storeGeomeans(geomeanPath, appendIndex(history, report.Index))
+		}
+	}
+	if geomeanTooSlow(report.Geomean, j.geomeanTol) && !j.opts.record {
+		logWarn(formatGeomeanTooSlow("Weighted geomean across packages", report.Geomean, j.geomeanTol))
+		report.TooSlow = true
+	}
+
+	for _, r := range j.opts.reporters {
+		if err := r.report(report); err != nil {
+			logError("Could not report the results:", err)
+		}
+	}
+
+	// When the run fails for several reasons, the first one found here gives the exit code
+	exitCode := exitOK
+	fail := func(code int) {
+		if exitCode == exitOK {
+			exitCode = code
+		}
+	}
+	if report.Missing {
+		logWarn("Old benchmarks were missing, flagging with non-zero return")
+		fail(exitMissing)
+	}
+
+	if report.TooSlow {
+		logWarn("New benchmarks are too slow, flagging with non-zero return")
+		fail(exitSlow)
+	}
+
+	if report.Mismatched {
+		logWarn("Best benchmarks were set in a different environment, flagging with non-zero return because of -strictEnv")
+		fail(exitEnv)
+	}
+
+	if report.TooLong {
+		logWarn("Packages took too long to benchmark, flagging with non-zero return")
+		fail(exitTooLong)
+	}
+
+	if exitCode != 0 && j.opts.reportOnly {
+		logInfo("Only reporting, returning zero anyway")
+		exitCode = exitOK
+	}
+
+	return exitCode
+}
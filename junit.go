@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+var junitOut = flag.String("junit", "", "Writes every benchmark comparison to this file as a JUnit XML test case, failing on regressions, for CI systems that show JUnit results")
+
+// Writes the run as a JUnit XML report, a test suite per package and a test case per benchmark
+type junitReporter struct {
+	out string
+}
+
+// The path is made absolute up front, since packages are benchmarked in their own directories
+func newJUnitReporter(out string) (junitReporter, error) {
+	out, err := filepath.Abs(out)
+	return junitReporter{out: out}, err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// A test case for the benchmark, failed if it's slower than allowed or missing and that fails the run
+func junitTestCase(pkgPath string, res benchResult) junitCase {
+	c := junitCase{Name: res.Name, Classname: pkgPath}
+	switch {
+	case res.Tolerated:
+		c.SystemOut = fmt.Sprintf("%s, not failing the run: %s against %s (%s)", res.Status, numbers.speed(res.Speed), numbers.speed(res.BestSpeed), formatFactor(res.Factor))
+		if res.Status == statusMissing {
+			c.SystemOut = fmt.Sprintf("%s, not failing the run", res.Status)
+		}
+	case res.Status == statusSlow:
+		msg := fmt.Sprintf("%s is %s its best", res.Name, formatFactor(res.Factor))
+		c.Failure = &junitFailure{Message: msg, Type: string(res.Status), Text: fmt.Sprintf("New speed %s, best speed %s", numbers.speed(res.Speed), numbers.speed(res.BestSpeed))}
+	case res.Status == statusMissing:
+		c.Failure = &junitFailure{Message: res.Name + " has a best on record but didn't run", Type: string(res.Status)}
+	case res.Status == statusNew:
+		c.SystemOut = fmt.Sprintf("%s: %s", res.Status, numbers.speed(res.Speed))
+	default:
+		c.SystemOut = fmt.Sprintf("%s: %s against %s (%s)", res.Status, numbers.speed(res.Speed), numbers.speed(res.BestSpeed), formatFactor(res.Factor))
+	}
+
+	return c
+}
+
+func junitReport(r runReport) junitSuites {
+	suites := junitSuites{Name: "rebench"}
+	for _, run := range r.Runs {
+		suite := junitSuite{Name: run.Package, Time: run.WallTime.Seconds()}
+		for _, res := range run.Results {
+			c := junitTestCase(run.Package, res)
+			if c.Failure != nil {
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return suites
+}
+
+func (j junitReporter) report(r runReport) error {
+	out, err := xml.MarshalIndent(junitReport(r), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(j.out, append([]byte(xml.Header), append(out, '\n')...))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJUnitReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := testReport()
+	r.Runs[0].Results = append(r.Runs[0].Results, benchResult{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing},
+		benchResult{Name: "BenchmarkExp", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow, Tolerated: true})
+	out := filepath.Join(dir, "junit.xml")
+	if err := (junitReporter{out: out}).report(r); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(raw, &suites); err != nil {
+		t.Fatalf("Wrote invalid XML %v:\n%s", err, raw)
+	}
+
+	if suites.Tests != 4 || suites.Failures != 2 || len(suites.Suites) != 1 || suites.Suites[0].Name != "example.com/pkg" {
+		t.Fatalf("Wrote the wrong suites:\n%s", raw)
+	}
+	cases := suites.Suites[0].Cases
+	if cases[0].Failure == nil || cases[0].Failure.Message != "BenchmarkA is 3.00x its best" || cases[0].Classname != "example.com/pkg" {
+		t.Errorf("Wrote the slow benchmark as %+v", cases[0])
+	}
+	if cases[1].Failure != nil || cases[2].Failure == nil || cases[2].Failure.Type != "MISSING" {
+		t.Errorf("Wrote the wrong failures %+v", cases)
+	}
+	if cases[3].Failure != nil || cases[3].SystemOut != "SLOW, not failing the run: 300 against 100 (3.00x)" {
+		t.Errorf("Failed the benchmark that doesn't fail the run %+v", cases[3])
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"time"
+)
+
+var (
+	lockWait = flag.Duration("wait", 0, "How long to wait for another rebench run keeping its records in the same place to finish, rather than failing right away")
+	noLock   = flag.Bool("noLock", false, "Runs without locking the records against other rebench runs")
+)
+
+// The lock of a run, in the directory of invocation or -outDir, so overlapping runs (e.g. two CI jobs on the same
+// runner) can't interleave reading and writing the records and corrupt them
+const lockFile = ".rebench.lock"
+
+// How often a run waiting for the lock checks on it
+const lockPoll = 100 * time.Millisecond
+
+var errLocked = errors.New("another rebench run holds the lock")
+
+// Takes the lock in the directory, waiting up to wait for another run to release it
+func acquireLock(dir string, wait time.Duration) (*runLock, error) {
+	name := filepath.Join(dir, lockFile)
+	deadline := time.Now().Add(wait)
+	logged := false
+	for {
+		l, err := tryLock(name)
+		if err != errLocked {
+			return l, err
+		}
+		if !time.Now().Before(deadline) {
+			if wait > 0 {
+				return nil, errors.New("gave up waiting " + wait.String() + " for another rebench run to release " + name)
+			}
+			return nil, errors.New("another rebench run holds " + name + ", wait for it with -wait or skip locking with -noLock")
+		}
+		if !logged {
+			logInfo("Waiting for another rebench run to release", name)
+			logged = true
+		}
+		time.Sleep(lockPoll)
+	}
+}
@@ -0,0 +1,46 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// An flock on the lock file, which the system releases should the run die without releasing it
+type runLock struct {
+	f *os.File
+}
+
+func tryLock(name string) (*runLock, error) {
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, errLocked
+			}
+			return nil, err
+		}
+
+		// The run that held it may have removed the file in the meantime, in which case the lock is on a new one
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(name); err == nil && os.SameFile(locked, current) {
+			return &runLock{f: f}, nil
+		}
+		f.Close()
+	}
+}
+
+// Removes the lock file before unlocking it, so it's never left behind
+func (l *runLock) release() {
+	os.Remove(l.f.Name())
+	l.f.Close()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lock, err := acquireLock(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireLock(dir, 0); err == nil {
+		t.Fatal("Took the lock twice")
+	}
+
+	go func() {
+		time.Sleep(3 * lockPoll)
+		lock.release()
+	}()
+	second, err := acquireLock(dir, time.Minute)
+	if err != nil {
+		t.Fatal("Couldn't take the lock once it was released:", err)
+	}
+	second.release()
+
+	if _, err := os.Stat(filepath.Join(dir, lockFile)); !os.IsNotExist(err) {
+		t.Errorf("Left %s behind", lockFile)
+	}
+}
@@ -0,0 +1,29 @@
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// A lock file only one run can create, which must be removed by hand should the run die without releasing it
+type runLock struct {
+	name string
+}
+
+func tryLock(name string) (*runLock, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if os.IsExist(err) {
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return &runLock{name: name}, nil
+}
+
+func (l *runLock) release() {
+	os.Remove(l.name)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// How much a log line matters, from the lines logged even with -q to those only logged with -vv
+type logLevel int
+
+const (
+	levelError logLevel = iota // rebench or go test couldn't do something it was asked to
+	levelWarn                  // Something fails the run, or makes its results doubtful
+	levelInfo                  // What the run is up to, logged by default
+	levelDebug                 // The details of every file read and written, with -v
+	levelTrace                 // How every benchmark compares as it's judged, with -vv
+)
+
+var levelNames = [...]string{"error", "warn", "info", "debug", "trace"}
+
+func (l logLevel) String() string {
+	return levelNames[l]
+}
+
+const (
+	logText = "text"
+	logJSON = "json"
+)
+
+var (
+	verbose     = flag.Bool("v", false, "Also logs the details of every file rebench reads and writes")
+	veryVerbose = flag.Bool("vv", false, "Also logs what -v does and how every benchmark compares as it's judged")
+	logFormat   = flag.String("log-format", logText, "How the log is written: text, or json with a line per object holding its time, level and message")
+)
+
+// Set from the command line. Lines above the threshold aren't logged.
+var (
+	logThreshold = levelInfo
+	jsonLog      bool
+)
+
+// A line of the log with -log-format json, e.g. {"time":"2016-01-02T15:04:05Z","level":"warn","msg":"..."}
+type logLine struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Msg   string    `json:"msg"`
+}
+
+// Logs the operands like log.Println at the level, with the level in front of anything but info in text, e.g.
+// "WARN: Benchmarks were missing"
+func logAt(level logLevel, v ...interface{}) {
+	if level > logThreshold {
+		return
+	}
+
+	msg := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	// Blank lines only space out the text
+	if jsonLog && msg == "" {
+		return
+	}
+	if jsonLog {
+		raw, err := json.Marshal(logLine{Time: time.Now().UTC(), Level: level.String(), Msg: msg})
+		if err == nil {
+			log.Writer().Write(append(raw, '\n'))
+		}
+		return
+	}
+	if level != levelInfo {
+		msg = strings.ToUpper(level.String()) + ": " + msg
+	}
+	log.Output(3, msg)
+}
+
+func logError(v ...interface{}) { logAt(levelError, v...) }
+func logWarn(v ...interface{})  { logAt(levelWarn, v...) }
+func logInfo(v ...interface{})  { logAt(levelInfo, v...) }
+func logDebug(v ...interface{}) { logAt(levelDebug, v...) }
+func logTrace(v ...interface{}) { logAt(levelTrace, v...) }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+		logThreshold, jsonLog = levelInfo, false
+	}()
+
+	logWarn("Benchmark", "BenchmarkA", "is slow")
+	logInfo("Working in package", "example.com/mod")
+	logDebug("Backing up .bench_best.json")
+	expected := "WARN: Benchmark BenchmarkA is slow\nWorking in package example.com/mod\n"
+	if buf.String() != expected {
+		t.Errorf("Logged %q, expected %q", buf.String(), expected)
+	}
+
+	buf.Reset()
+	logThreshold = levelError
+	logWarn("Benchmark", "BenchmarkA", "is slow")
+	logError("Couldn't run go test")
+	if buf.String() != "ERROR: Couldn't run go test\n" {
+		t.Errorf("Logged %q with -q, expected only the error", buf.String())
+	}
+
+	buf.Reset()
+	logThreshold, jsonLog = levelTrace, true
+	logTrace("Benchmark", "BenchmarkA", "is within its noise")
+	logInfo()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Logged %q as JSON, expected a single line", buf.String())
+	}
+	var line logLine
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Level != "trace" || line.Msg != "Benchmark BenchmarkA is within its noise" || line.Time.IsZero() {
+		t.Errorf("Logged %+v as JSON", line)
+	}
+}
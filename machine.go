@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var stableOnly = flag.Bool("stableOnly", false, "Leaves the best benchmarks alone when the machine is in a state known to make speeds unstable, e.g. throttled or busy")
+
+// The hottest a thermal zone may be, in millidegrees Celsius, before the CPU is likely to be throttled
+const maxTemp = 85000
+
+// What about the machine is known to make speeds unstable on Linux: a CPU frequency scaling governor other than
+// performance, turbo boost, a hot thermal zone or a load average above half the cores. root is / but for tests.
+// Anything that can't be read is taken to be fine, so elsewhere there's nothing to warn about.
+func machineWarnings(root string, cores int) []string {
+	var warnings []string
+
+	governors, _ := filepath.Glob(filepath.Join(root, "sys/devices/system/cpu/cpu*/cpufreq/scaling_governor"))
+	slow := make(map[string]bool)
+	for _, file := range governors {
+		if governor := readSysValue(file); governor != "" && governor != "performance" && !slow[governor] {
+			slow[governor] = true
+			warnings = append(warnings, "the CPU frequency scaling governor is "+governor+" rather than performance")
+		}
+	}
+
+	if readSysValue(filepath.Join(root, "sys/devices/system/cpu/intel_pstate/no_turbo")) == "0" || readSysValue(filepath.Join(root, "sys/devices/system/cpu/cpufreq/boost")) == "1" {
+		warnings = append(warnings, "turbo boost is on")
+	}
+
+	zones, _ := filepath.Glob(filepath.Join(root, "sys/class/thermal/thermal_zone*/temp"))
+	hottest := 0
+	for _, file := range zones {
+		if temp, err := strconv.Atoi(readSysValue(file)); err == nil && temp > hottest {
+			hottest = temp
+		}
+	}
+	if hottest > maxTemp {
+		warnings = append(warnings, fmt.Sprintf("the CPU is at %d°C and may be throttled", hottest/1000))
+	}
+
+	if fields := strings.Fields(readSysValue(filepath.Join(root, "proc/loadavg"))); len(fields) > 0 {
+		if load, err := strconv.ParseFloat(fields[0], 64); err == nil && cores > 0 && load > float64(cores)/2 {
+			warnings = append(warnings, fmt.Sprintf("the load average is %s on %d cores", fields[0], cores))
+		}
+	}
+
+	return warnings
+}
+
+// The contents of a file of /sys or /proc without the trailing newline, empty if it can't be read
+func readSysValue(file string) string {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(raw))
+}
+
+// E.g. "The machine may make speeds unstable: turbo boost is on, the load average is 6.20 on 8 cores"
+func formatMachineWarnings(warnings []string) string {
+	return "The machine may make speeds unstable: " + strings.Join(warnings, ", ")
+}
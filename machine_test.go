@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMachineWarnings(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench-machine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"sys/devices/system/cpu/cpu0/cpufreq/scaling_governor": "performance\n",
+		"sys/devices/system/cpu/cpu1/cpufreq/scaling_governor": "performance\n",
+		"sys/devices/system/cpu/intel_pstate/no_turbo":         "1\n",
+		"sys/class/thermal/thermal_zone0/temp":                 "45000\n",
+		"proc/loadavg":                                         "0.52 0.40 0.31 1/200 1234\n",
+	}
+	write := func() {
+		for name, content := range files {
+			if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	write()
+	if warnings := machineWarnings(root, 4); len(warnings) > 0 {
+		t.Errorf("Warned about a stable machine: %v", warnings)
+	}
+
+	files["sys/devices/system/cpu/cpu0/cpufreq/scaling_governor"] = "powersave\n"
+	files["sys/devices/system/cpu/cpu1/cpufreq/scaling_governor"] = "powersave\n"
+	files["sys/devices/system/cpu/intel_pstate/no_turbo"] = "0\n"
+	files["sys/class/thermal/thermal_zone1/temp"] = "92000\n"
+	files["proc/loadavg"] = "3.10 2.00 1.00 5/200 1234\n"
+	write()
+	expected := []string{
+		"the CPU frequency scaling governor is powersave rather than performance",
+		"turbo boost is on",
+		"the CPU is at 92°C and may be throttled",
+		"the load average is 3.10 on 4 cores",
+	}
+	if warnings := machineWarnings(root, 4); !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Warned %q, expected %q", warnings, expected)
+	}
+
+	if warnings := machineWarnings(filepath.Join(root, "nothing"), 4); len(warnings) > 0 {
+		t.Errorf("Warned about a machine with nothing to read: %v", warnings)
+	}
+}
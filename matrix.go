@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// The references -matrix knows besides named baselines
+const (
+	referenceBest = "best"
+	referenceLast = "last"
+)
+
+// A set of benchmarks to compare a run with in the matrix, nil if the package has nothing for it
+type reference struct {
+	name    string
+	benches map[string]uint64
+}
+
+// Splits the comma-separated references given to -matrix
+func parseReferences(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := validBaselineName(name); err != nil {
+			return nil, errors.New("invalid -matrix reference " + name)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// The references of the package in the working directory, as on record before the run is stored, with the best in
+// the given file
+func dirReferences(names []string, bestFile string) []reference {
+	refs := make([]reference, len(names))
+	for i, name := range names {
+		refs[i].name = name
+		switch name {
+		case referenceBest:
+			// A best that can't be trusted fails the run when it's judged
+			best, _ := loadBranchRecord(bestFile)
+			refs[i].benches = best.benches
+		case referenceLast:
+			refs[i].benches = loadBaseline(".bench_results.json")
+		default:
+			refs[i].benches = loadBaseline(filepath.Join(baselineDir, name+".json"))
+		}
+	}
+
+	return refs
+}
+
+// The references of a package in the monorepo store, as on record before the run is stored
+func recordReferences(names []string, rec packageRecord) []reference {
+	refs := make([]reference, len(names))
+	for i, name := range names {
+		refs[i].name = name
+		switch name {
+		case referenceBest:
+			refs[i].benches = copyBenches(rec.Best)
+		case referenceLast:
+			refs[i].benches = rec.Results
+		default:
+			refs[i].benches = rec.Baselines[name]
+		}
+	}
+
+	return refs
+}
+
+// Best benchmarks get updated in place as records are broken
+func copyBenches(benches map[string]uint64) map[string]uint64 {
+	if benches == nil {
+		return nil
+	}
+
+	out := make(map[string]uint64, len(benches))
+	for name, speed := range benches {
+		out[name] = speed
+	}
+
+	return out
+}
+
+// Lays out every benchmark of the run against each reference, with a column per reference showing its speed and
+// the factor between the new speed and it
+func matrixTable(benches map[string]uint64, refs []reference) *table {
+	header := []string{"Benchmark Name", "New Speed"}
+	for _, ref := range refs {
+		header = append(header, "vs "+ref.name)
+	}
+
+	matrix := newTable(header...)
+	for _, name := range sortedNames(benches) {
+		row := []string{name, numbers.speed(benches[name])}
+		for _, ref := range refs {
+			old, ok := ref.benches[name]
+			if !ok || old == 0 {
+				row = append(row, "N/A")
+				continue
+			}
+			row = append(row, numbers.speed(old)+" ("+formatFactor(float64(benches[name])/float64(old))+")")
+		}
+		matrix.addRow(row...)
+	}
+
+	return matrix
+}
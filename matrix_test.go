@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReferences(t *testing.T) {
+	names, err := parseReferences("best, last,,v1.4.0")
+	if err != nil || !reflect.DeepEqual(names, []string{"best", "last", "v1.4.0"}) {
+		t.Errorf("Parsed %v %v", names, err)
+	}
+
+	if _, err := parseReferences("best,../v1"); err == nil {
+		t.Errorf("Accepted a reference with a slash")
+	}
+}
+
+func TestMatrixTable(t *testing.T) {
+	benches := map[string]uint64{"BenchmarkA": 300, "BenchmarkB": 100}
+	refs := []reference{
+		{name: "best", benches: map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 100}},
+		{name: "last", benches: map[string]uint64{"BenchmarkA": 200}},
+		{name: "v1.4.0"},
+	}
+
+	expected := "" +
+		"Benchmark Name    New Speed    vs best        vs last        vs v1.4.0\n" +
+		"BenchmarkA        300          100 (3.00x)    200 (1.50x)    N/A\n" +
+		"BenchmarkB        100          100 (1.00x)    N/A            N/A\n"
+	if out := matrixTable(benches, refs).String(); out != expected {
+		t.Errorf("Rendered\n%s\nexpected\n%s", out, expected)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+
+	opts := testOptions
+	opts.matrix = []string{"best", "last"}
+	rebench(opts)
+
+	raw := unmarshallAndStoreBench(".bench_best.json")
+	if raw["BenchmarkSleep"] != 500 {
+		t.Errorf("The matrix changed the best benchmarks %v", raw)
+	}
+
+	out, err := ioutil.ReadFile("bench_comparison.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comparison := string(out)
+	if !strings.Contains(comparison, "vs best") || !strings.Contains(comparison, "500 (") || !strings.Contains(comparison, "vs last") {
+		t.Errorf("The comparison has no matrix:\n%s", comparison)
+	}
+}
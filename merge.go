@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// How a benchmark in several of the records merged is resolved, see -resolve
+const (
+	resolveMin  = "min"
+	resolveMean = "mean"
+	resolveHost = "host"
+)
+
+var (
+	mergeFlags   = flag.NewFlagSet("merge", flag.ExitOnError)
+	mergeOut     = mergeFlags.String("o", "", "The file the merged record is written to, stdout when empty")
+	mergeResolve = mergeFlags.String("resolve", resolveMin, "What a benchmark in several records becomes: min (the fastest), mean (the mean of each value) or host (one per record, tagged with its file name or the tag given as tag=file)")
+)
+
+// Merges record files, e.g. those of CI shards that each ran part of the suite, into a single record
+func merge(args []string) int {
+	mergeFlags.Parse(args)
+	if mergeFlags.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "rebench merge needs at least two record files, e.g. rebench merge -o merged.json a.json b.json")
+		return exitError
+	}
+	if *mergeResolve != resolveMin && *mergeResolve != resolveMean && *mergeResolve != resolveHost {
+		fmt.Fprintln(os.Stderr, "-resolve must be min, mean or host")
+		return exitError
+	}
+
+	recs := make([]benchRecord, mergeFlags.NArg())
+	tags := make([]string, mergeFlags.NArg())
+	tagged := make(map[string]string)
+	for i, arg := range mergeFlags.Args() {
+		tag, file := mergeTag(arg)
+		if other, ok := tagged[tag]; ok && *mergeResolve == resolveHost {
+			fmt.Fprintln(os.Stderr, other, "and", file, "are both tagged", tag+", give them tags of their own as tag=file, e.g. rebench merge -resolve host ci-1=shard1/a.json ci-2=shard2/a.json")
+			return exitError
+		}
+		tags[i], tagged[tag] = tag, file
+
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			logError("Cannot read", file+":", err)
+			return exitError
+		}
+		if recs[i], err = unmarshalRecord(raw); err != nil {
+			logError("Cannot unmarshall", file+":", err)
+			return exitError
+		}
+	}
+
+	raw, err := marshalRecord(mergeRecords(recs, tags, *mergeResolve))
+	if err != nil {
+		logError("Cannot marshall the merged record:", err)
+		return exitError
+	}
+	if *mergeOut == "" {
+		os.Stdout.Write(raw)
+		return exitOK
+	}
+	if err := writeFile(*mergeOut, raw); err != nil {
+		logError("Cannot write the merged record:", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// The tag and file of a record to merge given as tag=file, or as a file tagged with its name without extension
+func mergeTag(arg string) (string, string) {
+	if tag, file, ok := strings.Cut(arg, "="); ok && tag != "" && !strings.ContainsAny(tag, `/\`) {
+		return tag, file
+	}
+
+	return strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg)), arg
+}
+
+// Merges the records, resolving benchmarks in several of them as resolve says. With resolveHost, every benchmark is
+// kept apart as a sub-benchmark of its record's tag, e.g. BenchmarkA/host=ci-2. The revision and environment of the
+// records are kept if they all agree, and left unknown otherwise.
+func mergeRecords(recs []benchRecord, tags []string, resolve string) benchRecord {
+	merged := benchRecord{benches: make(map[string]uint64)}
+	sources := make(map[string][]int)
+	for i, rec := range recs {
+		for name := range rec.benches {
+			sources[name] = append(sources[name], i)
+		}
+	}
+
+	// Copies everything about a benchmark from a record, under a name of its own
+	copyBench := func(name, from string, rec benchRecord) {
+		merged.benches[name] = rec.benches[from]
+		if units, ok := rec.metrics[from]; ok {
+			if merged.metrics == nil {
+				merged.metrics = make(benchMetrics)
+			}
+			merged.metrics[name] = units
+		}
+		if s, ok := rec.stats[from]; ok {
+			if merged.stats == nil {
+				merged.stats = make(map[string]benchStats)
+			}
+			merged.stats[name] = s
+		}
+		if rev, ok := rec.revisions[from]; ok {
+			if merged.revisions == nil {
+				merged.revisions = make(map[string]revision)
+			}
+			merged.revisions[name] = rev
+		}
+	}
+
+	for name, in := range sources {
+		switch {
+		case resolve == resolveHost:
+			for _, i := range in {
+				copyBench(name+"/host="+tags[i], name, recs[i])
+			}
+		case len(in) == 1:
+			copyBench(name, name, recs[in[0]])
+		case resolve == resolveMin:
+			fastest := in[0]
+			for _, i := range in[1:] {
+				if recs[i].benches[name] < recs[fastest].benches[name] {
+					fastest = i
+				}
+			}
+			copyBench(name, name, recs[fastest])
+		default:
+			// The distributions of several records can't be told apart any more, so they're left out
+			var sum float64
+			sums, counts := make(map[string]float64), make(map[string]int)
+			for _, i := range in {
+				sum += float64(recs[i].benches[name])
+				for unit, value := range recs[i].metrics[name] {
+					sums[unit] += value
+					counts[unit]++
+				}
+			}
+			merged.benches[name] = uint64(math.Floor(sum/float64(len(in)) + 0.5))
+			for unit, total := range sums {
+				if merged.metrics == nil {
+					merged.metrics = make(benchMetrics)
+				}
+				if merged.metrics[name] == nil {
+					merged.metrics[name] = make(map[string]float64)
+				}
+				merged.metrics[name][unit] = total / float64(counts[unit])
+			}
+		}
+	}
+
+	merged.revision, merged.env = recs[0].revision, recs[0].env
+	for _, rec := range recs[1:] {
+		if merged.revision != nil && (rec.revision == nil || rec.revision.Commit != merged.revision.Commit) {
+			logWarn("The records were written at different revisions, leaving the revision of the merged record out")
+			merged.revision = nil
+		}
+		if merged.env != nil && (rec.env == nil || len(merged.env.differences(*rec.env)) > 0) {
+			logWarn("The records were written in different environments, leaving the environment of the merged record out")
+			merged.env = nil
+		}
+	}
+
+	return merged
+}
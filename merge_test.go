@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRecords(t *testing.T) {
+	a := benchRecord{benches: map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 20}, metrics: benchMetrics{"BenchmarkA": {"B/op": 64}}, env: &environment{GOOS: "linux"}}
+	b := benchRecord{benches: map[string]uint64{"BenchmarkA": 200, "BenchmarkC": 5}, metrics: benchMetrics{"BenchmarkA": {"B/op": 32}}, env: &environment{GOOS: "darwin"}}
+
+	tests := []struct {
+		resolve string
+		benches map[string]uint64
+		metrics benchMetrics
+	}{
+		{resolveMin, map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 20, "BenchmarkC": 5}, benchMetrics{"BenchmarkA": {"B/op": 64}}},
+		{resolveMean, map[string]uint64{"BenchmarkA": 150, "BenchmarkB": 20, "BenchmarkC": 5}, benchMetrics{"BenchmarkA": {"B/op": 48}}},
+		{resolveHost,
+			map[string]uint64{"BenchmarkA/host=a": 100, "BenchmarkB/host=a": 20, "BenchmarkA/host=b": 200, "BenchmarkC/host=b": 5},
+			benchMetrics{"BenchmarkA/host=a": {"B/op": 64}, "BenchmarkA/host=b": {"B/op": 32}}},
+	}
+	for _, test := range tests {
+		merged := mergeRecords([]benchRecord{a, b}, []string{"a", "b"}, test.resolve)
+		if !reflect.DeepEqual(merged.benches, test.benches) {
+			t.Errorf("Merged the benchmarks %v with -resolve %s, expected %v", merged.benches, test.resolve, test.benches)
+		}
+		if !reflect.DeepEqual(merged.metrics, test.metrics) {
+			t.Errorf("Merged the metrics %v with -resolve %s, expected %v", merged.metrics, test.resolve, test.metrics)
+		}
+		if merged.env != nil {
+			t.Errorf("Kept the environment %+v of records from different machines", merged.env)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b, out := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"), filepath.Join(dir, "merged.json")
+	writeRecord(t, a, map[string]uint64{"BenchmarkA": 100})
+	writeRecord(t, b, map[string]uint64{"BenchmarkB": 20})
+	if code := merge([]string{"-o", out, a, b}); code != 0 {
+		t.Fatalf("rebench merge returned %d", code)
+	}
+	if merged := loadRecord(out).benches; !reflect.DeepEqual(merged, map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 20}) {
+		t.Errorf("Merged %v", merged)
+	}
+
+	if code := merge([]string{"-resolve", "max", a, b}); code != exitError {
+		t.Errorf("rebench merge with an unknown -resolve returned %d", code)
+	}
+
+	// Records of the same name are only told apart by the tags they're given
+	other := filepath.Join(dir, "other", "a.json")
+	writeRecord(t, other, map[string]uint64{"BenchmarkA": 200})
+	defer mergeFlags.Set("resolve", resolveMin)
+	if code := merge([]string{"-o", out, "-resolve", "host", a, other}); code != exitError {
+		t.Errorf("rebench merge of two records tagged a returned %d", code)
+	}
+	if code := merge([]string{"-o", out, "-resolve", "host", "ci-1=" + a, "ci-2=" + other}); code != 0 {
+		t.Fatalf("rebench merge of tagged records returned %d", code)
+	}
+	if merged := loadRecord(out).benches; !reflect.DeepEqual(merged, map[string]uint64{"BenchmarkA/host=ci-1": 100, "BenchmarkA/host=ci-2": 200}) {
+		t.Errorf("Merged %v", merged)
+	}
+}
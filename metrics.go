@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	promFile    = flag.String("promFile", "", "Writes the results of the run to this file as Prometheus metrics, for the textfile collector of the node exporter")
+	pushgateway = flag.String("pushgateway", "", "Pushes the results of the run as Prometheus metrics to the Pushgateway at this URL, under the job rebench")
+)
+
+// Exports the results of the run as the same gauges the server's /metrics has, by writing them to a file for the
+// textfile collector and/or pushing them to a Pushgateway
+type prometheusReporter struct {
+	file        string
+	pushgateway string
+}
+
+// The file is made absolute up front, since packages are benchmarked in their own directories
+func newPrometheusReporter(file, pushgateway string) (prometheusReporter, error) {
+	if file != "" {
+		var err error
+		if file, err = filepath.Abs(file); err != nil {
+			return prometheusReporter{}, err
+		}
+	}
+
+	return prometheusReporter{file: file, pushgateway: strings.TrimRight(pushgateway, "/")}, nil
+}
+
+func (p prometheusReporter) report(r runReport) error {
+	var buf bytes.Buffer
+	writeMetrics(&buf, r.Runs)
+
+	if p.file != "" {
+		// The collector may read the file at any time, so it's replaced in one go rather than written in place
+		if err := writeFile(p.file+".tmp", buf.Bytes()); err != nil {
+			return err
+		}
+		if err := os.Rename(p.file+".tmp", p.file); err != nil {
+			return err
+		}
+	}
+
+	if p.pushgateway != "" {
+		// PUT replaces every metric the previous run pushed, so benchmarks that are gone don't linger
+		req, err := http.NewRequest("PUT", p.pushgateway+"/metrics/job/rebench", &buf)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		if err := send(req, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Writes the latest runs in the Prometheus text exposition format. Everything is a gauge, since every value
+// is simply the state of the latest run rather than something accumulated over time.
+func writeMetrics(w io.Writer, runs []packageRun) {
+	writeFamily(w, "rebench_ns_per_op", "The ns/op of each benchmark in the latest run of its package.")
+	for _, run := range runs {
+		for _, res := range run.Results {
+			if res.Status != statusMissing {
+				writeSample(w, "rebench_ns_per_op", run.Package, res.Name, float64(res.Speed))
+			}
+		}
+	}
+
+	writeFamily(w, "rebench_best_ns_per_op", "The best ns/op on record for each benchmark when the latest run of its package was compared.")
+	for _, run := range runs {
+		for _, res := range run.Results {
+			if res.Status != statusNew {
+				writeSample(w, "rebench_best_ns_per_op", run.Package, res.Name, float64(res.BestSpeed))
+			}
+		}
+	}
+
+	writeFamily(w, "rebench_regressions", "The number of benchmarks slower than speedTol in the latest run of each package.")
+	for _, run := range runs {
+		writeSample(w, "rebench_regressions", run.Package, "", float64(countStatus(run.Results, statusSlow)))
+	}
+
+	writeFamily(w, "rebench_missing_benchmarks", "The number of benchmarks on record that were missing from the latest run of each package.")
+	for _, run := range runs {
+		writeSample(w, "rebench_missing_benchmarks", run.Package, "", float64(countStatus(run.Results, statusMissing)))
+	}
+}
+
+func writeFamily(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// Writes a single sample, leaving out the benchmark label when it's empty
+func writeSample(w io.Writer, name, pkg, bench string, value float64) {
+	labels := fmt.Sprintf(`package="%s"`, labelEscaper.Replace(pkg))
+	if bench != "" {
+		labels += fmt.Sprintf(`,benchmark="%s"`, labelEscaper.Replace(bench))
+	}
+
+	fmt.Fprintf(w, "%s{%s} %v\n", name, labels, value)
+}
+
+func countStatus(results []benchResult, status benchStatus) int {
+	count := 0
+	for _, res := range results {
+		if res.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var method, path, pushed string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		raw, _ := ioutil.ReadAll(r.Body)
+		pushed = string(raw)
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(dir, "rebench.prom")
+	if err := (prometheusReporter{file: file, pushgateway: srv.URL}).report(testReport()); err != nil {
+		t.Fatalf("Cannot export the metrics %v", err)
+	}
+
+	written, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`rebench_ns_per_op{package="example.com/pkg",benchmark="BenchmarkA"} 300`,
+		`rebench_regressions{package="example.com/pkg"} 1`,
+	} {
+		if !strings.Contains(string(written), expected) {
+			t.Errorf("The textfile lacks %s:\n%s", expected, written)
+		}
+	}
+	if method != "PUT" || path != "/metrics/job/rebench" || pushed != string(written) {
+		t.Errorf("Pushed %s %s to the Pushgateway:\n%s", method, path, pushed)
+	}
+}
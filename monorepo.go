@@ -0,0 +1,413 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Where -monorepo keeps every record, relative to the directory of invocation
+const monorepoStoreDir = ".rebench"
+
+// Everything on record for a package in the monorepo store
+type packageRecord struct {
+	Package              string
+	Results, Best        map[string]uint64
+	Metrics, BestMetrics benchMetrics             // Every other unit of the results and the best, see the config file's units
+	Stats, BestStats     map[string]benchStats    // The distributions of the results and the best with -count
+	Revision             *revision                // The revision of the latest results
+	BestRevisions        map[string]revision      // The revision each best benchmark was set on
+	Env, BestEnv         *environment             // The machine of the latest results, and the one the bests were set on
+	Pending              map[string]pendingRecord // New bests waiting for more runs to confirm them
+	WallTimes            []wallTime
+	Geomeans             []geomeanPoint
+	Raw                  []string // The lines of the latest results as go test printed them, see -raw
+	// Named baselines, see -baseline
+	Baselines map[string]map[string]uint64
+}
+
+// How a packageRecord is stored, with the results, the best and the baselines in the record schema
+type storedPackageRecord struct {
+	Version       int                            `json:"version,omitempty"`
+	Package       string                         `json:"package"`
+	Results       canonicalBenchmarks            `json:"results,omitempty"`
+	Best          canonicalBenchmarks            `json:"best,omitempty"`
+	Stats         map[string]storedStats         `json:"stats,omitempty"`
+	BestStats     map[string]storedStats         `json:"bestStats,omitempty"`
+	Revision      *revision                      `json:"revision,omitempty"`
+	BestRevisions map[string]revision            `json:"bestRevisions,omitempty"`
+	Env           *environment                   `json:"environment,omitempty"`
+	BestEnv       *environment                   `json:"bestEnvironment,omitempty"`
+	Pending       map[string]pendingRecord       `json:"pending,omitempty"`
+	WallTimes     []wallTime                     `json:"wallTimes,omitempty"`
+	Geomeans      []geomeanPoint                 `json:"geomeans,omitempty"`
+	Raw           []string                       `json:"raw,omitempty"`
+	Baselines     map[string]canonicalBenchmarks `json:"baselines,omitempty"`
+	Procs         []int                          `json:"procs,omitempty"`    // As in a record file
+	Checksum      string                         `json:"checksum,omitempty"` // As in a record file
+}
+
+func (rec packageRecord) MarshalJSON() ([]byte, error) {
+	stored := storedPackageRecord{Version: recordVersion, Package: rec.Package, WallTimes: rec.WallTimes, Geomeans: rec.Geomeans, Raw: rec.Raw}
+	stored.Revision, stored.BestRevisions = rec.Revision, rec.BestRevisions
+	stored.Env, stored.BestEnv = rec.Env, rec.BestEnv
+	stored.Pending, stored.Procs = rec.Pending, keptProcs()
+	stored.Stats, stored.BestStats = canonicalStats(rec.Stats), canonicalStats(rec.BestStats)
+	if len(rec.Results) > 0 {
+		stored.Results = canonicalize(rec.Results, rec.Metrics)
+	}
+	if len(rec.Best) > 0 {
+		stored.Best = canonicalize(rec.Best, rec.BestMetrics)
+	}
+	if len(rec.Baselines) > 0 {
+		stored.Baselines = make(map[string]canonicalBenchmarks, len(rec.Baselines))
+		for name, benches := range rec.Baselines {
+			stored.Baselines[name] = canonicalize(benches, nil)
+		}
+	}
+	var err error
+	if stored.Checksum, err = checksum(stored, checksumKey()); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(stored)
+}
+
+// The best on record, as judged against
+func (rec packageRecord) best() benchRecord {
+	return benchRecord{benches: rec.Best, metrics: rec.BestMetrics, stats: rec.BestStats, revisions: rec.BestRevisions, env: rec.BestEnv, pending: rec.Pending}
+}
+
+// Reads records in either schema, as benchmarks from before the record schema are bare ns/op
+func (rec *packageRecord) UnmarshalJSON(raw []byte) error {
+	var stored storedPackageRecord
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return err
+	}
+	if stored.Version > recordVersion {
+		return errors.New("the record is version " + strconv.Itoa(stored.Version) + ", newer than this rebench knows")
+	}
+	sum := stored.Checksum
+	stored.Checksum = ""
+	if err := verifyChecksum(sum, stored, checksumKey()); err != nil {
+		return err
+	}
+
+	*rec = packageRecord{Package: stored.Package, WallTimes: stored.WallTimes, Geomeans: stored.Geomeans, Raw: stored.Raw}
+	rec.Revision, rec.BestRevisions = stored.Revision, stored.BestRevisions
+	rec.Env, rec.BestEnv = stored.Env, stored.BestEnv
+	rec.Pending = stored.Pending
+	rec.Stats, rec.BestStats = splitStats(stored.Stats), splitStats(stored.BestStats)
+	if stored.Results != nil {
+		rec.Results, rec.Metrics = stored.Results.split()
+	}
+	if stored.Best != nil {
+		rec.Best, rec.BestMetrics = stored.Best.split()
+	}
+	if stored.Baselines != nil {
+		rec.Baselines = make(map[string]map[string]uint64, len(stored.Baselines))
+		for name, benches := range stored.Baselines {
+			rec.Baselines[name], _ = benches.split()
+		}
+	}
+	*rec = rec.withoutProcs(recordProcs(stored.Version, stored.Procs, stored.Env, stored.BestEnv))
+
+	return nil
+}
+
+// Keeps one file per package, spread over 256 shard directories by the hash of the import path, so no directory
+// gets unwieldy and saving a package never rewrites anybody else's records
+type packageStore struct {
+	root string
+}
+
+func (s packageStore) path(pkgPath string) string {
+	sum := sha1.Sum([]byte(pkgPath))
+	return filepath.Join(s.root, "packages", hex.EncodeToString(sum[:1]), url.PathEscape(pkgPath)+".json")
+}
+
+// The record of the package, empty if there's none or it can't be read. A record that doesn't match its checksum is
+// an error, since saving the run over it would lose the bests on record.
+func (s packageStore) load(pkgPath string) (packageRecord, error) {
+	rec := packageRecord{Package: pkgPath}
+	raw, err := ioutil.ReadFile(s.path(pkgPath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logWarn("cannot open the record of", pkgPath+":", err)
+		}
+		return rec, nil
+	}
+
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		if isChecksumError(err) {
+			return packageRecord{Package: pkgPath}, err
+		}
+		logWarn("cannot unmarshall the record of", pkgPath, "because:", err)
+		return packageRecord{Package: pkgPath}, nil
+	}
+
+	return rec, nil
+}
+
+func (s packageStore) save(rec packageRecord) error {
+	path := s.path(rec.Package)
+	if err := mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	out, err := marshalFile(rec)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, out)
+}
+
+// Every record in the store, none if there's no store
+func (s packageStore) all() ([]packageRecord, error) {
+	var records []packageRecord
+	err := s.walk(func(path string, raw []byte) error {
+		var rec packageRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return fmt.Errorf("cannot unmarshall %s: %v", path, err)
+		}
+		records = append(records, rec)
+
+		return nil
+	})
+
+	return records, err
+}
+
+// Checksums every record in the store again, with the key if there's one, however it was checksummed before
+func (s packageStore) resign(key []byte) error {
+	return s.walk(func(path string, raw []byte) error {
+		var stored storedPackageRecord
+		if err := json.Unmarshal(raw, &stored); err != nil {
+			return fmt.Errorf("cannot unmarshall %s: %v", path, err)
+		}
+		if stored.Version > recordVersion {
+			return errors.New(path + " is version " + strconv.Itoa(stored.Version) + ", newer than this rebench knows")
+		}
+
+		// Benchmarks from before the record schema are read as canonical ones, and names as they would be trimmed
+		stored.Procs = recordProcs(stored.Version, stored.Procs, stored.Env, stored.BestEnv)
+		stored.Version, stored.Checksum = recordVersion, ""
+		var err error
+		if stored.Checksum, err = checksum(stored, key); err != nil {
+			return err
+		}
+		out, err := marshalFile(stored)
+		if err != nil {
+			return err
+		}
+
+		logInfo("Signing", path)
+		return writeFile(path, out)
+	})
+}
+
+// Calls fn with every record file in the store, none if there's no store
+func (s packageStore) walk(fn func(path string, raw []byte) error) error {
+	return filepath.Walk(filepath.Join(s.root, "packages"), func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return fn(path, raw)
+	})
+}
+
+// Lists the directory of every package matching the patterns that has tests (and so might have benchmarks), keyed by
+// import path. Each pattern is listed concurrently.
+func discoverPackages(patterns []string) (map[string]string, error) {
+	type listing struct {
+		out []byte
+		err error
+	}
+	listings := make([]listing, len(patterns))
+
+	var wg sync.WaitGroup
+	for i, pattern := range patterns {
+		wg.Add(1)
+		go func(i int, pattern string) {
+			defer wg.Done()
+			listings[i].out, listings[i].err = exec.Command("go", "list", "-e", "-f", "{{if or .TestGoFiles .XTestGoFiles}}{{.ImportPath}}\t{{.Dir}}{{end}}", pattern).Output()
+		}(i, pattern)
+	}
+	wg.Wait()
+
+	dirs := make(map[string]string)
+	for _, l := range listings {
+		if l.err != nil {
+			return nil, l.err
+		}
+
+		for _, line := range strings.Split(string(l.out), "\n") {
+			fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+			if len(fields) == 2 {
+				dirs[fields[0]] = fields[1]
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+// Benchmarks a huge repository: packages are discovered while go test gets going, and each one is judged and saved
+// in the monorepo store as soon as go test is done with it, without ever entering its directory or keeping its
+// benchmarks around for longer than that. The comparisons of every package end up in a single file in the store.
+func rebenchMonorepo(j *judge) int {
+	patterns := j.opts.packages
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	store := packageStore{root: monorepoStoreDir}
+
+	type discovery struct {
+		dirs map[string]string
+		err  error
+	}
+	discovered := make(chan discovery, 1)
+	go func() {
+		dirs, err := discoverPackages(patterns)
+		discovered <- discovery{dirs, err}
+	}()
+
+	var dirs map[string]string
+	var report runReport
+	done, untrusted := 0, false
+	err := runBenches(j.opts, func(out packageOutput) {
+		pkgPath, benches, wall := out.pkgPath, out.benches, out.wall
+		// Discovery is usually over long before the first package is
+		if done == 0 {
+			d := <-discovered
+			if d.err != nil {
+				logWarn("Cannot list the packages, not reporting progress or naming owners:", d.err)
+			}
+			dirs = d.dirs
+		}
+		done++
+
+		progress := fmt.Sprintf("[%d/%d]", done, len(dirs))
+		if dirs == nil {
+			progress = fmt.Sprintf("[%d]", done)
+		}
+		logInfo(progress, pkgPath)
+
+		rec, loadErr := store.load(pkgPath)
+		if loadErr != nil {
+			logError("The record of", pkgPath, "can't be trusted, leaving it as it is:", loadErr)
+			untrusted = true
+			return
+		}
+		refs := recordReferences(j.opts.matrix, rec)
+		v := j.judgePackage(out, dirs[pkgPath], rec.best(), packageHistory{rec.WallTimes, rec.Geomeans, benchRecord{benches: rec.Results, metrics: rec.Metrics, stats: rec.Stats}}, refs)
+		report.add(v)
+		// As in every other mode, packages without benchmarks are left alone
+		if len(benches) == 0 && !v.hasBest {
+			return
+		}
+
+		if j.opts.readOnly {
+			fmt.Printf("%s\n%s\n", pkgPath, colorize(v.run.Table))
+			return
+		}
+
+		if len(benches) > 0 {
+			rec.Results, rec.Metrics, rec.Stats, rec.Revision, rec.Env = benches, out.metrics, out.stats, &j.revision, &j.env
+			rec.Raw = out.raw
+		}
+		if !j.keepsBests() {
+			rec.Best, rec.BestMetrics, rec.BestStats, rec.BestRevisions, rec.BestEnv = v.best.benches, v.best.metrics, v.best.stats, v.best.revisions, v.best.env
+			rec.Pending = v.best.pending
+		}
+		if wall > 0 {
+			rec.WallTimes = appendWallTime(rec.WallTimes, wall)
+		}
+		if v.run.Index > 0 {
+			rec.Geomeans = appendIndex(rec.Geomeans, v.run.Index)
+		}
+		if j.opts.history && len(benches) > 0 {
+			if err := appendHistory(historyFile, j.revision, out); err != nil {
+				logError("Couldn't append the results of", pkgPath, "to the history:", err)
+			}
+		}
+		if j.opts.baseline != "" && len(benches) > 0 {
+			if rec.Baselines == nil {
+				rec.Baselines = make(map[string]map[string]uint64)
+			}
+			rec.Baselines[j.opts.baseline] = benches
+		}
+		if err := store.save(rec); err != nil {
+			logError("Couldn't save the record of", pkgPath+":", err)
+		}
+	})
+
+	if len(report.Runs) == 0 && err == nil && !untrusted {
+		logInfo("Nothing to do! No benchmarks!")
+		return 0
+	}
+
+	sort.Slice(report.Runs, func(a, b int) bool { return report.Runs[a].Package < report.Runs[b].Package })
+	if !j.opts.readOnly {
+		comparison := report.Overview() + "\n\n"
+		for _, run := range report.Runs {
+			comparison += run.Package + "\n" + run.Table + "\n"
+		}
+		comparisonFile := j.opts.comparisonFile
+		if comparisonFile == "" {
+			comparisonFile = defaultComparisonFile
+		}
+		if comparisonFile == "-" {
+			fmt.Print(colorize(comparison))
+		} else if err := writeFile(filepath.Join(monorepoStoreDir, comparisonFile), []byte(comparison)); err != nil {
+			logError("Could not write benchmark comparisons file")
+		}
+	}
+
+	// Every package go test finished is judged and saved by now, but the run as a whole can't pass
+	if untrusted {
+		j.finish(report, filepath.Join(monorepoStoreDir, "geomean.json"))
+		logError("Some records don't match their checksums, they weren't judged nor overwritten, flagging with non-zero return")
+		return exitError
+	}
+	if err == errRunStopped {
+		j.finish(report, filepath.Join(monorepoStoreDir, "geomean.json"))
+		logWarn("go test was stopped, only", len(report.Runs), "packages were judged, flagging with non-zero return")
+		return exitGoTest
+	}
+	if err == errPackagesFailed {
+		j.finish(report, filepath.Join(monorepoStoreDir, "geomean.json"))
+		logWarn("go test failed in some of the packages, only", len(report.Runs), "packages were judged, flagging with non-zero return")
+		return exitGoTest
+	}
+	if err != nil {
+		logError(err, "aborting!")
+		return exitGoTest
+	}
+
+	return j.finish(report, filepath.Join(monorepoStoreDir, "geomean.json"))
+}
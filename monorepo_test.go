@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackageStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := packageStore{root: dir}
+	if rec, _ := store.load("example.com/mod/pkg"); rec.Best != nil || rec.Package != "example.com/mod/pkg" {
+		t.Errorf("Loaded a record for a package without one %v", rec)
+	}
+
+	rec := packageRecord{
+		Package:   "example.com/mod/pkg",
+		Results:   map[string]uint64{"BenchmarkA": 100},
+		Best:      map[string]uint64{"BenchmarkA": 90},
+		WallTimes: []wallTime{{Time: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), Seconds: 1.5}},
+	}
+	if err := store.save(rec); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := store.load(rec.Package); !reflect.DeepEqual(loaded, rec) {
+		t.Errorf("Loaded %v, saved %v", loaded, rec)
+	}
+
+	if rel, _ := filepath.Rel(dir, store.path(rec.Package)); filepath.Dir(filepath.Dir(rel)) != "packages" || filepath.Base(rel) != "example.com%2Fmod%2Fpkg.json" {
+		t.Errorf("Saved the record in the wrong place %s", rel)
+	}
+}
+
+func TestDiscoverPackages(t *testing.T) {
+	dirs, err := discoverPackages([]string{"./...", "./testpackage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pwd, _ := os.Getwd()
+	if dir := dirs["github.com/Jragonmiris/rebench/testpackage"]; dir != reform(pwd, "testpackage") {
+		t.Errorf("Discovered the test package in %q, expected it in %q (all of %v)", dir, reform(pwd, "testpackage"), dirs)
+	}
+}
+
+func TestMonorepo(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	defer os.RemoveAll(monorepoStoreDir)
+
+	opts := testOptions
+	opts.monorepo = true
+	for i := 0; i < 2; i++ {
+		if code := rebench(opts); code != 0 {
+			t.Fatalf("Program returned non-zero exit code %d for valid invocation", code)
+		}
+	}
+
+	rec, err := packageStore{root: monorepoStoreDir}.load("github.com/Jragonmiris/rebench/testpackage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Results) != 2 || len(rec.Best) != 2 || len(rec.WallTimes) != 2 {
+		t.Errorf("Stored the wrong record %v", rec)
+	}
+
+	if _, err := os.Stat(".bench_best.json"); !os.IsNotExist(err) {
+		t.Errorf("Wrote records in the package directory")
+	}
+	if _, err := os.Stat(filepath.Join(monorepoStoreDir, "bench_comparison.txt")); err != nil {
+		t.Errorf("Didn't write the comparisons: %v", err)
+	}
+
+	rec.Best = map[string]uint64{"BenchmarkSleep": 500, "BenchmarkSleep2": 10000}
+	packageStore{root: monorepoStoreDir}.save(rec)
+	if code := rebench(opts); code == 0 {
+		t.Errorf("Program returned good exit code when best benchmark is obviously faster")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+var noiseModelling = flag.Bool("noise", false, "Widens the tolerances of every benchmark by its noise, how much its speed varied across its runs in the -history file")
+
+const (
+	// The fewest runs of a benchmark in the history its noise is worked out from
+	minNoiseRuns = 5
+	// Only the latest runs count, so a benchmark that got steadier isn't held to its noisy past
+	noiseWindow = 30
+	// How many standard deviations a change takes to be more than noise
+	noiseSigmas = 3
+)
+
+// The noise of every benchmark of a package that ran often enough: the coefficient of variation of its speed (its
+// standard deviation over its mean) across its latest runs in the history
+type noiseModel map[string]float64
+
+// The noise models of every package in the history file, by import path, none without a history
+func loadNoise(file string) map[string]noiseModel {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		logInfo("No history in", file+", not widening any tolerance by noise")
+		return nil
+	}
+	if err != nil {
+		logWarn("Cannot open the history, not widening any tolerance by noise:", err)
+		return nil
+	}
+	defer f.Close()
+
+	entries, err := readHistory(f)
+	if err != nil {
+		logWarn("Cannot read the history, not widening any tolerance by noise:", err)
+		return nil
+	}
+
+	return noiseModels(entries)
+}
+
+func noiseModels(entries []historyEntry) map[string]noiseModel {
+	speeds := make(map[string]map[string][]float64)
+	for _, entry := range entries {
+		if speeds[entry.Package] == nil {
+			speeds[entry.Package] = make(map[string][]float64)
+		}
+		benches, _ := entry.Benchmarks.split()
+		for name, speed := range benches {
+			speeds[entry.Package][name] = append(speeds[entry.Package][name], float64(speed))
+		}
+	}
+
+	models := make(map[string]noiseModel, len(speeds))
+	for pkgPath, byName := range speeds {
+		model := make(noiseModel)
+		for name, samples := range byName {
+			if len(samples) < minNoiseRuns {
+				continue
+			}
+			if len(samples) > noiseWindow {
+				samples = samples[len(samples)-noiseWindow:]
+			}
+			if s := summarize(samples); s.Mean > 0 {
+				model[name] = s.Stddev / s.Mean
+			}
+		}
+		models[pkgPath] = model
+	}
+
+	return models
+}
+
+// The factor a benchmark may change by and still be within its noise
+func noiseTolerance(noise float64) float64 {
+	return 1 + noiseSigmas*noise
+}
+
+// Notes the noise of every benchmark that has any in its result, and turns slow benchmarks and records that changed
+// by less than their noise into OK ones, so a benchmark's tolerance is never tighter than its noise
+func (n noiseModel) filter(results []benchResult) {
+	for i, res := range results {
+		noise, ok := n[res.Name]
+		if !ok {
+			continue
+		}
+		results[i].Noise = noise
+
+		tol := noiseTolerance(noise)
+		if res.Status == statusSlow && res.Factor <= tol || res.Status == statusRecord && res.Factor >= 1/tol {
+			logTrace(fmt.Sprintf("Benchmark %s changed by %s, within its noise of ±%.1f%%, treating it as OK", res.Name, formatFactor(res.Factor), noise*100))
+			results[i].Status = statusOK
+		}
+	}
+}
+
+// E.g. "Noise of BenchmarkQuery: ±12.5% across the history, tolerating up to 1.38x"
+func formatNoise(res benchResult) string {
+	return fmt.Sprintf("Noise of %s: ±%.1f%% across the history, tolerating up to %s", res.Name, res.Noise*100, formatFactor(noiseTolerance(res.Noise)))
+}
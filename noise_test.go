@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNoiseModels(t *testing.T) {
+	var entries []historyEntry
+	for _, speed := range []uint64{60, 140, 60, 140, 60, 140} {
+		entries = append(entries, historyEntry{Package: "example.com/mod", Benchmarks: canonicalize(map[string]uint64{"BenchmarkNoisy": speed, "BenchmarkSteady": 100}, nil)})
+	}
+	entries = append(entries, historyEntry{Package: "example.com/mod", Benchmarks: canonicalize(map[string]uint64{"BenchmarkRare": 100}, nil)})
+	entries = append(entries, historyEntry{Package: "example.com/other", Benchmarks: canonicalize(map[string]uint64{"BenchmarkNoisy": 100}, nil)})
+
+	models := noiseModels(entries)
+	model := models["example.com/mod"]
+	if noise := model["BenchmarkNoisy"]; math.Abs(noise-0.438) > 0.001 {
+		t.Errorf("Worked out a noise of %v for BenchmarkNoisy, expected about 0.438", noise)
+	}
+	if noise, ok := model["BenchmarkSteady"]; !ok || noise != 0 {
+		t.Errorf("Worked out a noise of %v for BenchmarkSteady, expected 0", noise)
+	}
+	if _, ok := model["BenchmarkRare"]; ok {
+		t.Errorf("Worked out the noise of a benchmark with a single run")
+	}
+	if _, ok := models["example.com/other"]["BenchmarkNoisy"]; ok {
+		t.Errorf("Mixed up the benchmarks of different packages")
+	}
+}
+
+func TestNoiseFilter(t *testing.T) {
+	model := noiseModel{"BenchmarkNoisy": 0.2, "BenchmarkQuiet": 0.01}
+	results := []benchResult{
+		{Name: "BenchmarkNoisy", Factor: 1.5, Status: statusSlow},
+		{Name: "BenchmarkQuiet", Factor: 1.5, Status: statusSlow},
+		{Name: "BenchmarkNoisy/large", Factor: 1.5, Status: statusSlow},
+	}
+	model.filter(results)
+
+	if results[0].Status != statusOK || results[0].Noise != 0.2 {
+		t.Errorf("Failed a benchmark within its noise: %+v", results[0])
+	}
+	if results[1].Status != statusSlow || results[1].Noise != 0.01 {
+		t.Errorf("Let a benchmark beyond its noise pass: %+v", results[1])
+	}
+	if results[2].Status != statusSlow || results[2].Noise != 0 {
+		t.Errorf("Applied the noise of a benchmark to another: %+v", results[2])
+	}
+
+	records := []benchResult{{Name: "BenchmarkNoisy", Factor: 0.7, Status: statusRecord}, {Name: "BenchmarkNoisy", Factor: 0.5, Status: statusRecord}}
+	model.filter(records)
+	if records[0].Status != statusOK || records[1].Status != statusRecord {
+		t.Errorf("Expected only the record beyond the noise to stand: %+v", records)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+var (
+	notifyURL    = flag.String("notify", "", "POSTs a JSON notification to this URL when the run fails, e.g. because of regressions or missing benchmarks")
+	notifyFormat = flag.String("notifyFormat", notifyJSON, "The format of -notify: json (the -json summary) or slack (a message for a Slack incoming webhook)")
+)
+
+const (
+	notifyJSON  = "json"
+	notifySlack = "slack"
+)
+
+// Notifies a webhook when the run fails, so a performance channel gets pinged without a CI script of its own. Passing
+// runs are left quiet.
+type notifyReporter struct {
+	url, format string
+}
+
+func newNotifyReporter(url, format string) (notifyReporter, error) {
+	if format != notifyJSON && format != notifySlack {
+		return notifyReporter{}, errors.New("-notifyFormat must be json or slack")
+	}
+
+	return notifyReporter{url: url, format: format}, nil
+}
+
+// A Slack message, which Slack-compatible webhooks (e.g. Mattermost and Rocket.Chat) take too
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (n notifyReporter) report(r runReport) error {
+	if !r.Failed() {
+		return nil
+	}
+
+	var body interface{} = summarizeRun(r)
+	if n.format == notifySlack {
+		body = slackMessage{Text: slackText(r)}
+	}
+	req, err := jsonRequest("POST", n.url, body)
+	if err != nil {
+		return err
+	}
+
+	return send(req, nil)
+}
+
+// The summary in bold, followed by a line for every regression and missing benchmark
+func slackText(r runReport) string {
+	text := "*" + r.Summary() + "*"
+	for _, run := range r.Runs {
+		for _, res := range run.Results {
+			switch res.Status {
+			case statusSlow:
+				text += fmt.Sprintf("\n• `%s` %s: %s → %s ns/op (%s)", run.Package, res.Name, numbers.speed(res.BestSpeed), numbers.speed(res.Speed), formatFactor(res.Factor))
+			case statusMissing:
+				text += fmt.Sprintf("\n• `%s` %s: missing", run.Package, res.Name)
+			}
+		}
+	}
+
+	return text
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotifyReporter(t *testing.T) {
+	var posted []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		posted = append(posted, body)
+	}))
+	defer srv.Close()
+
+	failing := testReport()
+	failing.Runs[0].Results = append(failing.Runs[0].Results, benchResult{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing})
+	passing := testReport()
+	passing.TooSlow = false
+
+	for _, format := range []string{notifyJSON, notifySlack} {
+		n, err := newNotifyReporter(srv.URL, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range []runReport{failing, passing} {
+			if err := n.report(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if len(posted) != 2 {
+		t.Fatalf("Notified %d times, expected once per format for the failing run", len(posted))
+	}
+	if posted[0]["verdict"] != verdictFailing {
+		t.Errorf("Notified %v, expected the JSON summary", posted[0])
+	}
+	expected := "*rebench failing: 1 benchmarks too slow, 1 missing*\n• `example.com/pkg` BenchmarkA: 100 → 300 ns/op (3.00x)\n• `example.com/pkg` BenchmarkGone: missing"
+	if posted[1]["text"] != expected {
+		t.Errorf("Notified Slack with %q, expected %q", posted[1]["text"], expected)
+	}
+
+	if _, err := newNotifyReporter(srv.URL, "xml"); err == nil {
+		t.Error("Accepted an unknown -notifyFormat")
+	}
+}
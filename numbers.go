@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// How numbers are written in comparisons and reports. The zero value writes them exactly as they are.
+type numberFormat struct {
+	sigDigits int    // Rounds to this many significant digits unless 0
+	thousands string // Separates every three digits of the integer part unless empty
+	scale     bool   // Writes speeds in whichever of ns, µs, ms and s reads best, rather than always in ns
+}
+
+// Set from the command line
+var numbers numberFormat
+
+var speedUnits = []struct {
+	unit string
+	ns   float64
+}{{"s", 1e9}, {"ms", 1e6}, {"µs", 1e3}, {"ns", 1}}
+
+// Formats a speed in ns/op, with its unit when scaling
+func (f numberFormat) speed(ns uint64) string {
+	if !f.scale {
+		return f.format(float64(ns), 0)
+	}
+
+	for _, u := range speedUnits {
+		if float64(ns) >= u.ns || u.ns == 1 {
+			return f.format(float64(ns)/u.ns, -1) + u.unit
+		}
+	}
+
+	return ""
+}
+
+// Formats a speed with its unit, e.g. 1234 ns/op, or 1.234µs/op when scaling
+func (f numberFormat) speedPerOp(ns uint64) string {
+	if f.scale {
+		return f.speed(ns) + "/op"
+	}
+
+	return f.speed(ns) + " ns/op"
+}
+
+// Formats a factor between speeds
+func (f numberFormat) factor(factor float64) string {
+	return f.format(factor, 6)
+}
+
+// Formats the number with the given number of decimals (-1 for as many as it takes), unless the format asks for
+// significant digits
+func (f numberFormat) format(v float64, decimals int) string {
+	if f.sigDigits > 0 && v != 0 {
+		magnitude := int(math.Floor(math.Log10(math.Abs(v)))) + 1
+		decimals = f.sigDigits - magnitude
+		if decimals < 0 {
+			scale := math.Pow(10, float64(-decimals))
+			v = math.Floor(v/scale+0.5) * scale
+			decimals = 0
+		}
+	}
+
+	out := strconv.FormatFloat(v, 'f', decimals, 64)
+	if f.thousands == "" {
+		return out
+	}
+
+	integer, fraction := out, ""
+	if dot := strings.IndexByte(out, '.'); dot >= 0 {
+		integer, fraction = out[:dot], out[dot:]
+	}
+	sign := ""
+	if strings.HasPrefix(integer, "-") {
+		sign, integer = "-", integer[1:]
+	}
+
+	for i := len(integer) - 3; i > 0; i -= 3 {
+		integer = integer[:i] + f.thousands + integer[i:]
+	}
+
+	return sign + integer + fraction
+}
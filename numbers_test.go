@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNumberFormat(t *testing.T) {
+	cases := []struct {
+		format   numberFormat
+		speed    uint64
+		expected string
+	}{
+		{numberFormat{}, 1234567, "1234567"},
+		{numberFormat{thousands: ","}, 1234567, "1,234,567"},
+		{numberFormat{thousands: ","}, 123, "123"},
+		{numberFormat{sigDigits: 3}, 1234567, "1230000"},
+		{numberFormat{sigDigits: 3, thousands: "_"}, 1234567, "1_230_000"},
+		{numberFormat{scale: true}, 1234567, "1.234567ms"},
+		{numberFormat{scale: true}, 999, "999ns"},
+		{numberFormat{scale: true}, 0, "0ns"},
+		{numberFormat{scale: true}, 1500, "1.5µs"},
+		{numberFormat{scale: true, sigDigits: 3}, 1234567, "1.23ms"},
+		{numberFormat{scale: true, sigDigits: 2}, 12345678901, "12s"},
+		{numberFormat{scale: true, thousands: ","}, 1234567890123, "1,234.567890123s"},
+	}
+
+	for _, c := range cases {
+		if out := c.format.speed(c.speed); out != c.expected {
+			t.Errorf("Formatted %d as %q with %+v, expected %q", c.speed, out, c.format, c.expected)
+		}
+	}
+}
+
+func TestNumberFormatFactor(t *testing.T) {
+	if out := (numberFormat{}).factor(1.5); out != "1.500000" {
+		t.Errorf("Formatted factor 1.5 as %q by default", out)
+	}
+	if out := (numberFormat{sigDigits: 3}).factor(1.23456); out != "1.23" {
+		t.Errorf("Formatted factor 1.23456 as %q with 3 significant digits", out)
+	}
+	if out := (numberFormat{sigDigits: 2}).factor(0.012345); out != "0.012" {
+		t.Errorf("Formatted factor 0.012345 as %q with 2 significant digits", out)
+	}
+}
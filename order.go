@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var resultOrder = flag.String("sort", orderName, "How the rows of every comparison are sorted: name, factor (the slowest against its best first) or delta (the largest change in ns/op first)")
+
+const (
+	orderName   = "name"
+	orderFactor = "factor"
+	orderDelta  = "delta"
+)
+
+// How many of the largest regressions and improvements lead a comparison with more benchmarks than that
+const topCount = 10
+
+// The results in the order, missing and new benchmarks (which have no factor) last and ties by name. The results of
+// orderName are left as compare sorted them.
+func sortedResults(results []benchResult, order string) []benchResult {
+	if order == orderName {
+		return results
+	}
+
+	sorted := append([]benchResult(nil), results...)
+	key := func(res benchResult) float64 {
+		if order == orderDelta {
+			return math.Abs(float64(res.Speed) - float64(res.BestSpeed))
+		}
+		return res.Factor
+	}
+	sort.SliceStable(sorted, func(a, b int) bool {
+		ra, rb := sorted[a], sorted[b]
+		if compared(ra) != compared(rb) {
+			return compared(ra)
+		}
+		if ka, kb := key(ra), key(rb); compared(ra) && ka != kb {
+			return ka > kb
+		}
+		return ra.Name < rb.Name
+	})
+
+	return sorted
+}
+
+// Whether the benchmark was compared with a best, rather than missing or new
+func compared(res benchResult) bool {
+	return res.Factor > 0
+}
+
+// The lines leading a comparison of more than topCount benchmarks with the largest regressions and improvements against
+// their bests, e.g. "Top 3 regressions" followed by a row per benchmark, none for a smaller comparison
+func topLines(results []benchResult) []string {
+	if len(results) <= topCount {
+		return nil
+	}
+
+	// The slowest first, and the fastest last
+	sorted := sortedResults(results, orderFactor)
+	var regressions, improvements []benchResult
+	for i := range sorted {
+		if sorted[i].Factor > 1 {
+			regressions = append(regressions, sorted[i])
+		}
+		if res := sorted[len(sorted)-1-i]; compared(res) && res.Factor < 1 {
+			improvements = append(improvements, res)
+		}
+	}
+
+	var lines []string
+	for _, top := range []struct {
+		label   string
+		results []benchResult
+	}{{"regressions", regressions}, {"improvements", improvements}} {
+		if len(top.results) == 0 {
+			continue
+		}
+		if len(top.results) > topCount {
+			top.results = top.results[:topCount]
+		}
+		tbl := newTable()
+		tbl.align = []alignment{alignLeft, alignRight, alignRight, alignRight}
+		for _, res := range top.results {
+			tbl.addRow(res.Name, numbers.speed(res.Speed), numbers.speed(res.BestSpeed), formatFactor(res.Factor))
+		}
+		lines = append(lines, "Top "+strconv.Itoa(len(top.results))+" "+top.label)
+		lines = append(lines, strings.Split(strings.TrimSuffix(tbl.String(), "\n"), "\n")...)
+		lines = append(lines, "")
+	}
+
+	return lines
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSortedResults(t *testing.T) {
+	results := []benchResult{
+		{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing},
+		{Name: "BenchmarkNew", Speed: 7, Status: statusNew},
+		{Name: "BenchmarkA", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+		{Name: "BenchmarkB", Speed: 5000, BestSpeed: 4000, Factor: 1.25, Status: statusOK},
+		{Name: "BenchmarkC", Speed: 50, BestSpeed: 100, Factor: 0.5, Status: statusRecord},
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{orderName, []string{"BenchmarkGone", "BenchmarkNew", "BenchmarkA", "BenchmarkB", "BenchmarkC"}},
+		{orderFactor, []string{"BenchmarkA", "BenchmarkB", "BenchmarkC", "BenchmarkGone", "BenchmarkNew"}},
+		{orderDelta, []string{"BenchmarkB", "BenchmarkA", "BenchmarkC", "BenchmarkGone", "BenchmarkNew"}},
+	}
+	for _, test := range tests {
+		var names []string
+		for _, res := range sortedResults(results, test.order) {
+			names = append(names, res.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Sorted by %s into %v, expected %v", test.order, names, test.expected)
+		}
+	}
+	if results[0].Name != "BenchmarkGone" {
+		t.Errorf("Sorted the results in place")
+	}
+}
+
+func TestTopLines(t *testing.T) {
+	var results []benchResult
+	for i := 1; i <= topCount; i++ {
+		results = append(results, benchResult{Name: "BenchmarkSame" + strconv.Itoa(i), Speed: 100, BestSpeed: 100, Factor: 1, Status: statusOK})
+	}
+	if lines := topLines(results); len(lines) > 0 {
+		t.Errorf("Led a comparison of %d benchmarks with %q", len(results), lines)
+	}
+
+	results = append(results,
+		benchResult{Name: "BenchmarkSlower", Speed: 120, BestSpeed: 100, Factor: 1.2, Status: statusOK},
+		benchResult{Name: "BenchmarkSlowest", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+		benchResult{Name: "BenchmarkFaster", Speed: 50, BestSpeed: 100, Factor: 0.5, Status: statusRecord})
+	expected := "" +
+		"Top 2 regressions\n" +
+		"BenchmarkSlowest    300    100    3.00x\n" +
+		"BenchmarkSlower     120    100    1.20x\n" +
+		"\n" +
+		"Top 1 improvements\n" +
+		"BenchmarkFaster    50    100    0.50x\n" +
+		"\n"
+	if out := strings.Join(topLines(results), "\n") + "\n"; out != expected {
+		t.Errorf("Led the comparison with\n%s\nexpected\n%s", out, expected)
+	}
+}
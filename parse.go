@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parses the output of go test -bench into the ns/op of every benchmark and the time go test took to benchmark each
+// package, both keyed by import path.
+//
+// The output of every Go version since 1.0 on every OS is accepted: columns may be separated by tabs or any other
+// whitespace, lines may end in CRLF, and package paths are keyed with forward slashes even if they come with
+// backslashes. The header lines newer versions print (goos:, pkg:, cpu: and so on) are ignored, as is anything else
+// that isn't a benchmark result or the line ending a package's output.
+//
+// Benchmark names lose the -N GOMAXPROCS suffix go test adds, unless -keepProcs says otherwise.
+//
+// Records are whole nanoseconds, so fractional results (which Go prints for anything under 100 ns/op or so) are
+// rounded, and sub-nanosecond ones are rounded up to 1 ns/op rather than down to a meaningless 0.
+//
+// The events of go test -json are accepted as well, even mixed with plain text such as build errors. Benchmark results
+// are then taken from the output events of each package, and packages end with their pass event rather than with a
+// line of output.
+func parseBenchOutput(out string) (map[string]map[string]uint64, map[string]time.Duration, error) {
+	return parseBenchStream(strings.NewReader(out))
+}
+
+// Nothing worth parsing comes close to this long. Longer lines (say, a benchmark dumping its data) are cut short.
+const maxLineLength = 64 * 1024
+
+// Parses go test output a line at a time as it's read, so memory stays flat however much output there is
+func parseBenchStream(r io.Reader) (map[string]map[string]uint64, map[string]time.Duration, error) {
+	record := make(map[string]map[string]uint64)
+	wallTimes := make(map[string]time.Duration)
+	err := streamBenchResults(r, func(out packageOutput) {
+		record[out.pkgPath] = out.benches
+		if out.wall > 0 {
+			wallTimes[out.pkgPath] = out.wall
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return record, wallTimes, nil
+}
+
+// Everything go test printed about a single package
+type packageOutput struct {
+	pkgPath string
+	benches map[string]uint64     // The ns/op of every benchmark, the median of its runs with -count
+	metrics benchMetrics          // Every other unit a benchmark reported, if any
+	stats   map[string]benchStats // The distribution of every benchmark run several times
+	wall    time.Duration         // The time go test took, zero if unknown
+	raw     []string              // The lines of the benchmark results as go test printed them, see -raw
+	// The benchmark a failed package failed in, e.g. because it panicked, if it's known. The results are then those
+	// of the benchmarks that finished before it.
+	crashed string
+}
+
+// Called with each package as soon as go test is done with it
+type packageFunc func(out packageOutput)
+
+// Parses go test output as it's read like parseBenchStream, handing over each package as soon as it's done rather
+// than keeping anything
+func streamBenchResults(r io.Reader, onPackage packageFunc) error {
+	return streamBenchOutput(r, onPackage, nil)
+}
+
+// Like streamBenchResults, also handing over every line go test printed as soon as it's read, e.g. to show the
+// progress of a long run. The lines of go test -json are those of its output events, without the events around them.
+func streamBenchOutput(r io.Reader, onPackage packageFunc, onLine func(line string)) error {
+	p := newBenchParser(onPackage, onLine)
+	return p.stream(r)
+}
+
+// The package of plain text output without a pkg: header to name it, which is kept in the directory of invocation
+const unnamedPackage = "."
+
+// Like streamBenchOutput for the output of a -cmd, which needn't end each package with a line of its own like go
+// test does: a package also ends where the pkg: header of another begins, and the last one with the output itself.
+func streamCommandOutput(r io.Reader, onPackage packageFunc, onLine func(line string)) error {
+	p := newBenchParser(onPackage, onLine)
+	p.command = true
+	if err := p.stream(r); err != nil {
+		return err
+	}
+	p.endText()
+
+	return nil
+}
+
+func newBenchParser(onPackage packageFunc, onLine func(line string)) *benchParser {
+	p := &benchParser{onPackage: onPackage, onLine: onLine, events: make(map[string]*packageState)}
+	p.reset()
+
+	return p
+}
+
+func (p *benchParser) stream(r io.Reader) error {
+	reader := bufio.NewReaderSize(r, maxLineLength)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			if perr := p.parseLine(string(line)); perr != nil {
+				return perr
+			}
+		}
+		// Skips the rest of a line that didn't fit
+		for err == bufio.ErrBufferFull {
+			_, err = reader.ReadSlice('\n')
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type benchParser struct {
+	onPackage packageFunc
+	onLine    func(line string) // Gets every non-empty line of output unless nil
+	// The package whose plain text output is being read, whose results are only known once its "ok" line comes along
+	text packageState
+	// The import path in the pkg: header of the plain text output being read, if it had one
+	textPkg string
+	// Whether the plain text output comes from a -cmd, see streamCommandOutput
+	command bool
+	// Every package whose go test -json events are being read, keyed by import path
+	events map[string]*packageState
+	// Gets every package go test failed, e.g. because it didn't compile, with whatever results it had unless nil
+	onFail packageFunc
+}
+
+// The results of a package that go test isn't done with
+type packageState struct {
+	curr    map[string]uint64
+	metrics benchMetrics
+	samples map[string][]float64 // Every ns/op of each benchmark, which runs several times with -count
+	// Every value of each metric of each benchmark, by unit
+	metricSamples map[string]map[string][]float64
+	// A benchmark that prints to stdout has its name and its results split over separate lines
+	pending string
+	// The output events of a line that isn't finished yet, cut short like any other line
+	partial string
+	// The lines of the results read so far, as printed
+	raw []string
+	// The benchmark a --- FAIL line named, e.g. after b.Fatal
+	failed string
+}
+
+func newPackageState() *packageState {
+	return &packageState{curr: make(map[string]uint64), metrics: make(benchMetrics), samples: make(map[string][]float64), metricSamples: make(map[string]map[string][]float64)}
+}
+
+func (s *packageState) output(pkgPath string, wall time.Duration) packageOutput {
+	out := packageOutput{pkgPath: pkgPath, benches: s.curr, metrics: s.metrics, wall: wall, raw: s.raw}
+	for name, samples := range s.samples {
+		if len(samples) < 2 {
+			continue
+		}
+		if out.stats == nil {
+			out.stats = make(map[string]benchStats)
+		}
+		out.stats[name] = summarize(samples)
+		out.benches[name] = roundNs(out.stats[name].Median)
+	}
+	// Like ns/op, every other metric is the median of its runs
+	for name, units := range s.metricSamples {
+		for unit, samples := range units {
+			if len(samples) > 1 {
+				out.metrics[name][unit] = summarize(samples).Median
+			}
+		}
+	}
+
+	return out
+}
+
+func (p *benchParser) reset() {
+	p.text = *newPackageState()
+	p.textPkg = ""
+}
+
+// Hands over the results of the plain text output read so far, if there are any, for a -cmd
+func (p *benchParser) endText() {
+	if len(p.text.curr) == 0 {
+		return
+	}
+
+	pkgPath := p.textPkg
+	if pkgPath == "" {
+		pkgPath = unnamedPackage
+	}
+	p.onPackage(p.text.output(pkgPath, 0))
+	p.reset()
+}
+
+// A line of plain text output, or a go test -json event
+func (p *benchParser) parseLine(line string) error {
+	if strings.HasPrefix(line, "{") {
+		var e testEvent
+		if json.Unmarshal([]byte(line), &e) == nil {
+			return p.parseEvent(e)
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	if p.onLine != nil {
+		p.onLine(strings.TrimRight(line, "\r\n"))
+	}
+
+	switch {
+	case fields[0] == "ok" && len(fields) >= 2:
+		// e.g. ok  	github.com/user/pkg	12.345s
+		var wall time.Duration
+		if len(fields) >= 3 {
+			wall, _ = time.ParseDuration(fields[2])
+		}
+		p.onPackage(p.text.output(strings.Replace(fields[1], `\`, "/", -1), wall))
+		p.reset()
+	case fields[0] == "pkg:" && len(fields) == 2:
+		pkgPath := strings.Replace(fields[1], `\`, "/", -1)
+		if p.command && pkgPath != p.textPkg {
+			p.endText()
+		}
+		p.textPkg = pkgPath
+	case fields[0] == "FAIL" && len(fields) >= 2:
+		// e.g. FAIL	github.com/user/pkg [build failed], or FAIL	github.com/user/pkg	1.234s after a panic
+		p.fail(p.text.failure(strings.Replace(fields[1], `\`, "/", -1)))
+		p.reset()
+	default:
+		return p.text.parseResultLine(strings.TrimRight(line, "\r\n"), fields)
+	}
+
+	return nil
+}
+
+// An event of go test -json, as printed by test2json
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64 // Seconds
+	Output  string
+}
+
+// Benchmark results come in output events, and whether a package passed in the event ending it, rather than in any
+// particular line of output
+func (p *benchParser) parseEvent(e testEvent) error {
+	if e.Package == "" {
+		return nil
+	}
+	pkgPath := strings.Replace(e.Package, `\`, "/", -1)
+	s := p.events[pkgPath]
+	if s == nil {
+		s = newPackageState()
+		p.events[pkgPath] = s
+	}
+
+	switch {
+	case e.Action == "output":
+		return s.write(e.Output, p.onLine)
+	case e.Action == "pass" && e.Test == "":
+		if err := s.write("\n", p.onLine); err != nil {
+			return err
+		}
+		p.onPackage(s.output(pkgPath, time.Duration(e.Elapsed*float64(time.Second))))
+		delete(p.events, pkgPath)
+	case e.Action == "fail" && e.Test == "":
+		if err := s.write("\n", p.onLine); err != nil {
+			return err
+		}
+		p.fail(s.failure(pkgPath))
+		delete(p.events, pkgPath)
+	case e.Action == "skip" && e.Test == "":
+		// A skipped package has no results
+		delete(p.events, pkgPath)
+	}
+
+	return nil
+}
+
+func (p *benchParser) fail(out packageOutput) {
+	if p.onFail != nil {
+		p.onFail(out)
+	}
+}
+
+// The results of a package go test failed in, which are those of the benchmarks that finished before the one that
+// failed or panicked, if any
+func (s *packageState) failure(pkgPath string) packageOutput {
+	out := s.output(pkgPath, 0)
+	out.crashed = s.failed
+	// A benchmark that panics dies between its name and its results
+	if out.crashed == "" && s.pending != "" {
+		out.crashed = trimProcsSuffix(s.pending)
+	}
+
+	return out
+}
+
+// Parses the output of an event, which may be any part of a line or several of them, handing every non-empty line
+// over to onLine unless it's nil
+func (s *packageState) write(output string, onLine func(line string)) error {
+	for output != "" {
+		end := strings.IndexByte(output, '\n')
+		chunk := output
+		if end >= 0 {
+			chunk = output[:end]
+		}
+		if room := maxLineLength - len(s.partial); len(chunk) > room {
+			chunk = chunk[:room]
+		}
+		s.partial += chunk
+		if end < 0 {
+			return nil
+		}
+
+		line := s.partial
+		s.partial, output = "", output[end+1:]
+		fields := strings.Fields(line)
+		if onLine != nil && len(fields) > 0 {
+			onLine(strings.TrimRight(line, "\r"))
+		}
+		if err := s.parseResultLine(strings.TrimRight(line, "\r"), fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Records the benchmark results on the line, if it has any, and the line itself along with the name of a benchmark
+// whose results come later
+func (s *packageState) parseResultLine(line string, fields []string) error {
+	switch {
+	case len(fields) == 0:
+	case strings.HasPrefix(fields[0], "Benchmark"):
+		ok, err := s.parseResult(fields[0], fields[1:])
+		if err != nil {
+			return err
+		}
+		s.raw = append(s.raw, line)
+		if !ok {
+			s.pending = fields[0]
+			return nil
+		}
+		s.pending = ""
+	case fields[0] == "---" && len(fields) >= 3 && fields[1] == "FAIL:" && strings.HasPrefix(fields[2], "Benchmark"):
+		// e.g. --- FAIL: BenchmarkParse/large
+		// A failed sub-benchmark fails its parents too, which are named first
+		if name := trimProcsSuffix(fields[2]); s.failed == "" || strings.HasPrefix(name, s.failed+"/") {
+			s.failed = name
+		}
+	case s.pending != "" && isIterations(fields[0]):
+		ok, err := s.parseResult(s.pending, fields)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.raw = append(s.raw, line)
+			s.pending = ""
+		}
+	}
+
+	return nil
+}
+
+// Records the results in the columns after a benchmark's name. Reports false for a line without any, like the name
+// of a benchmark that goes on to print something.
+func (s *packageState) parseResult(name string, columns []string) (bool, error) {
+	name = trimProcsSuffix(name)
+	metrics, err := parseMetrics(columns)
+	if err != nil {
+		return false, errors.New("Couldn't parse the results of " + name + ": " + err.Error())
+	}
+
+	speed, ok := metrics["ns/op"]
+	if !ok {
+		return false, nil
+	}
+	delete(metrics, "ns/op")
+
+	s.curr[name] = roundNs(speed)
+	s.samples[name] = append(s.samples[name], speed)
+	if len(metrics) > 0 {
+		s.metrics[name] = metrics
+		if s.metricSamples[name] == nil {
+			s.metricSamples[name] = make(map[string][]float64)
+		}
+		for unit, value := range metrics {
+			s.metricSamples[name][unit] = append(s.metricSamples[name][unit], value)
+		}
+	}
+
+	return true, nil
+}
+
+// Records are whole nanoseconds
+func roundNs(speed float64) uint64 {
+	if speed < 1 {
+		return 1
+	}
+
+	return uint64(math.Floor(speed + 0.5))
+}
+
+// Finds every value followed by its unit in the columns after a benchmark's name, the first of which is the number
+// of iterations. Units are anything that isn't a number, e.g. ns/op, B/op with -benchmem, MB/s with b.SetBytes, or
+// whatever b.ReportMetric was given.
+func parseMetrics(columns []string) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	for i := 2; i < len(columns); i++ {
+		unit := columns[i]
+		if _, err := strconv.ParseFloat(unit, 64); err == nil {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(columns[i-1], 64)
+		if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+			if unit == "ns/op" {
+				return nil, errors.New("invalid ns/op " + columns[i-1])
+			}
+			continue
+		}
+		if unit == "ns/op" && value < 0 {
+			return nil, errors.New("invalid ns/op " + columns[i-1])
+		}
+		metrics[unit] = value
+	}
+
+	return metrics, nil
+}
+
+func isIterations(column string) bool {
+	_, err := strconv.ParseUint(column, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	// The outputs below were printed on machines with these GOMAXPROCS
+	runProcs = append(runProcs, 4, 8, 12, 16)
+}
+
+// Real go test -bench output from a spread of Go versions and OSes, trimmed down
+var parserCorpus = []struct {
+	name      string
+	out       string
+	record    map[string]map[string]uint64
+	wallTimes map[string]time.Duration
+}{
+	{
+		name: "go1.4 linux",
+		out: `PASS
+BenchmarkSleep	     100	  10091385 ns/op
+BenchmarkSleep2	     200	   5063012 ns/op
+ok  	github.com/Jragonmiris/rebench/testpackage	4.077s
+`,
+		record:    map[string]map[string]uint64{"github.com/Jragonmiris/rebench/testpackage": {"BenchmarkSleep": 10091385, "BenchmarkSleep2": 5063012}},
+		wallTimes: map[string]time.Duration{"github.com/Jragonmiris/rebench/testpackage": 4077 * time.Millisecond},
+	},
+	{
+		name: "go1.12 darwin with -benchmem and packages without benchmarks",
+		out: `?   	example.com/mod/cmd	[no test files]
+goos: darwin
+goarch: amd64
+pkg: example.com/mod/codec
+BenchmarkEncode-8   	 2000000	       612 ns/op	     128 B/op	       2 allocs/op
+BenchmarkDecode-8   	 1000000	      1043 ns/op	     256 B/op	       4 allocs/op
+PASS
+ok  	example.com/mod/codec	4.351s
+PASS
+ok  	example.com/mod/util	0.012s
+`,
+		record: map[string]map[string]uint64{
+			"example.com/mod/codec": {"BenchmarkEncode": 612, "BenchmarkDecode": 1043},
+			"example.com/mod/util":  {},
+		},
+		wallTimes: map[string]time.Duration{"example.com/mod/codec": 4351 * time.Millisecond, "example.com/mod/util": 12 * time.Millisecond},
+	},
+	{
+		name: "go1.21 linux with fractional results and sub-benchmarks",
+		out: `goos: linux
+goarch: amd64
+pkg: example.com/mod/hash
+cpu: AMD Ryzen 7 5800X 8-Core Processor
+BenchmarkSum/small-16         	1000000000	         0.2501 ns/op
+BenchmarkSum/large-16         	 4893012	       245.6 ns/op
+BenchmarkSum/huge-16          	   58941	     20314.5 ns/op
+PASS
+ok  	example.com/mod/hash	3.801s
+`,
+		record:    map[string]map[string]uint64{"example.com/mod/hash": {"BenchmarkSum/small": 1, "BenchmarkSum/large": 246, "BenchmarkSum/huge": 20315}},
+		wallTimes: map[string]time.Duration{"example.com/mod/hash": 3801 * time.Millisecond},
+	},
+	{
+		name: "go1.22 windows with CRLF line endings and backslashed paths",
+		out: "goos: windows\r\ngoarch: amd64\r\npkg: example.com/mod/fs\r\ncpu: Intel(R) Core(TM) i7-9750H CPU @ 2.60GHz\r\n" +
+			"BenchmarkWalk-12    \t    1234\t    981234 ns/op\r\n" +
+			"PASS\r\nok  \texample.com\\mod\\fs\t2.456s\r\n",
+		record:    map[string]map[string]uint64{"example.com/mod/fs": {"BenchmarkWalk": 981234}},
+		wallTimes: map[string]time.Duration{"example.com/mod/fs": 2456 * time.Millisecond},
+	},
+	{
+		name: "benchmark printing to stdout and logging",
+		out: `goos: linux
+goarch: arm64
+pkg: example.com/mod/noisy
+BenchmarkChatty-4   	starting up
+some more output
+    1000	   1200345 ns/op
+--- BENCH: BenchmarkChatty-4
+    noisy_test.go:12: b.N = 1
+    noisy_test.go:12: b.N = 1000
+BenchmarkQuiet-4    	 5000000	       301 ns/op
+PASS
+ok  	example.com/mod/noisy	3.2s
+`,
+		record:    map[string]map[string]uint64{"example.com/mod/noisy": {"BenchmarkChatty": 1200345, "BenchmarkQuiet": 301}},
+		wallTimes: map[string]time.Duration{"example.com/mod/noisy": 3200 * time.Millisecond},
+	},
+	{
+		name: "spaces instead of tabs and non-breaking spaces",
+		out: "BenchmarkSpaced      100      10000 ns/op\n" +
+			"BenchmarkNbsp\u00a0\u00a0200\u00a0\u00a05000 ns/op\n" +
+			"ok   example.com/mod/spaced   1.5s\n",
+		record:    map[string]map[string]uint64{"example.com/mod/spaced": {"BenchmarkSpaced": 10000, "BenchmarkNbsp": 5000}},
+		wallTimes: map[string]time.Duration{"example.com/mod/spaced": 1500 * time.Millisecond},
+	},
+	{
+		name: "failed package",
+		out: `BenchmarkBroken-8   	--- FAIL: BenchmarkBroken-8
+    broken_test.go:9: oops
+BenchmarkFine-8     	 1000000	      1000 ns/op
+FAIL
+FAIL	example.com/mod/broken	1.003s
+BenchmarkOther-8    	 1000000	      2000 ns/op
+PASS
+ok  	example.com/mod/other	1.1s
+FAIL
+`,
+		record:    map[string]map[string]uint64{"example.com/mod/other": {"BenchmarkOther": 2000}},
+		wallTimes: map[string]time.Duration{"example.com/mod/other": 1100 * time.Millisecond},
+	},
+	{
+		name: "no tests to run",
+		out: `testing: warning: no tests to run
+PASS
+ok  	example.com/mod/empty	0.002s [no tests to run]
+`,
+		record:    map[string]map[string]uint64{"example.com/mod/empty": {}},
+		wallTimes: map[string]time.Duration{"example.com/mod/empty": 2 * time.Millisecond},
+	},
+	{
+		name: "go1.27 linux with -json, a build failure and results split over events",
+		out: `# example.com/jt/broken
+broken/x.go:3:1: syntax error: non-declaration statement outside function body
+{"Time":"2026-10-15T04:30:15.871741994Z","Action":"start","Package":"example.com/jt"}
+{"Time":"2026-10-15T04:30:15.874750581Z","Action":"output","Package":"example.com/jt","Output":"goos: linux\n"}
+{"Time":"2026-10-15T04:30:15.875016151Z","Action":"output","Package":"example.com/jt","Output":"pkg: example.com/jt\n"}
+{"Time":"2026-10-15T04:30:15.875031906Z","Action":"run","Package":"example.com/jt","Test":"BenchmarkA"}
+{"Time":"2026-10-15T04:30:15.875035226Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkA","Output":"=== RUN   BenchmarkA\n","OutputType":"frame"}
+{"Time":"2026-10-15T04:30:15.875039863Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkA","Output":"BenchmarkA\n"}
+{"Time":"2026-10-15T04:30:15.875736488Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkA","Output":"BenchmarkA      \t"}
+{"Time":"2026-10-15T04:30:15.875806967Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkA","Output":"     100\t         2.310 ns/op\t       0 B/op\t       0 allocs/op\n"}
+{"Time":"2026-10-15T04:30:15.875818832Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkChatty","Output":"=== RUN   BenchmarkChatty\n","OutputType":"frame"}
+{"Time":"2026-10-15T04:30:15.875822587Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkChatty","Output":"BenchmarkChatty\n"}
+{"Time":"2026-10-15T04:30:15.876133741Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkChatty","Output":"hello\n"}
+{"Time":"2026-10-15T04:30:15.876551365Z","Action":"output","Package":"example.com/jt","Test":"BenchmarkChatty","Output":"BenchmarkChatty \t     100\t       109.1 ns/op\t         3.000 queries/op\n"}
+{"Time":"2026-10-15T04:30:15.87656593Z","Action":"output","Package":"example.com/jt","Output":"PASS\n","OutputType":"frame"}
+{"Time":"2026-10-15T04:30:15.876966065Z","Action":"output","Package":"example.com/jt","Output":"ok  \texample.com/jt\t0.005s\n"}
+{"Time":"2026-10-15T04:30:15.876983051Z","Action":"pass","Package":"example.com/jt","Elapsed":0.005}
+{"Time":"2026-10-15T04:30:15.877Z","Action":"output","Package":"example.com/jt/broken","Output":"BenchmarkStale \t     100\t       100 ns/op\n"}
+{"Time":"2026-10-15T04:30:15.877Z","Action":"output","Package":"example.com/jt/broken","Output":"FAIL\texample.com/jt/broken [build failed]\n"}
+{"Time":"2026-10-15T04:30:15.877Z","Action":"fail","Package":"example.com/jt/broken","Elapsed":0}
+`,
+		record:    map[string]map[string]uint64{"example.com/jt": {"BenchmarkA": 2, "BenchmarkChatty": 109}},
+		wallTimes: map[string]time.Duration{"example.com/jt": 5 * time.Millisecond},
+	},
+}
+
+func TestParseBenchOutput(t *testing.T) {
+	for _, c := range parserCorpus {
+		record, wallTimes, err := parseBenchOutput(c.out)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(record, c.record) {
+			t.Errorf("%s: parsed\n%v\nexpected\n%v", c.name, record, c.record)
+		}
+		if !reflect.DeepEqual(wallTimes, c.wallTimes) {
+			t.Errorf("%s: parsed wall times %v, expected %v", c.name, wallTimes, c.wallTimes)
+		}
+	}
+}
+
+func TestParseBenchOutputLineEndings(t *testing.T) {
+	for _, c := range parserCorpus {
+		crlf := strings.Replace(strings.Replace(c.out, "\r\n", "\n", -1), "\n", "\r\n", -1)
+		record, wallTimes, err := parseBenchOutput(crlf)
+		if err != nil || !reflect.DeepEqual(record, c.record) || !reflect.DeepEqual(wallTimes, c.wallTimes) {
+			t.Errorf("%s: parsed differently with CRLF line endings: %v %v %v", c.name, record, wallTimes, err)
+		}
+	}
+}
+
+func TestParseBenchOutputInvalid(t *testing.T) {
+	if _, _, err := parseBenchOutput("BenchmarkBad-8   \t 100\t abc ns/op\nok  \texample.com/mod\t1s\n"); err == nil {
+		t.Errorf("Parsed a nonsensical ns/op without complaint")
+	}
+}
+
+// Writes the output of a package with n benchmarks as it's read, without ever holding all of it
+type generatedOutput struct {
+	n, i int
+	buf  []byte
+}
+
+func (g *generatedOutput) Read(p []byte) (int, error) {
+	for len(g.buf) == 0 {
+		switch {
+		case g.i < g.n:
+			g.buf = []byte(fmt.Sprintf("BenchmarkGenerated%d-8   \t 1000000\t      %d ns/op\n", g.i, g.i+1))
+		case g.i == g.n:
+			g.buf = []byte("PASS\nok  \texample.com/mod/generated\t12.345s\n")
+		default:
+			return 0, io.EOF
+		}
+		g.i++
+	}
+
+	n := copy(p, g.buf)
+	g.buf = g.buf[n:]
+	return n, nil
+}
+
+func TestParseBenchStream(t *testing.T) {
+	record, wallTimes, err := parseBenchStream(&generatedOutput{n: 100000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	benches := record["example.com/mod/generated"]
+	if len(benches) != 100000 || benches["BenchmarkGenerated99999"] != 100000 {
+		t.Errorf("Parsed %d benchmarks from the stream, expected 100000", len(benches))
+	}
+	if wallTimes["example.com/mod/generated"] != 12345*time.Millisecond {
+		t.Errorf("Parsed the wrong wall time %v", wallTimes)
+	}
+}
+
+func TestParseBenchStreamLongLines(t *testing.T) {
+	out := "BenchmarkChatty-8   \t" + strings.Repeat("x", 3*maxLineLength) + "\n" +
+		"    1000\t   1200345 ns/op\n" +
+		"BenchmarkQuiet-8    \t 5000000\t       301 ns/op\n" +
+		"ok  \texample.com/mod/long\t1s\n"
+
+	record, _, err := parseBenchStream(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]uint64{"BenchmarkChatty": 1200345, "BenchmarkQuiet": 301}
+	if !reflect.DeepEqual(record["example.com/mod/long"], expected) {
+		t.Errorf("Parsed %v around a long line, expected %v", record, expected)
+	}
+}
+
+func TestParseBenchMetrics(t *testing.T) {
+	out := "BenchmarkQuery-8   \t 20000\t     61234 ns/op\t    4096 B/op\t      12 allocs/op\t       0.9500 hit-ratio\t    1834 queries/op\n" +
+		"BenchmarkCopy-8    \t 50000\t     24019 ns/op\t 681.98 MB/s\n" +
+		"BenchmarkPlain-8   \t 90000\t     12345 ns/op\n" +
+		"ok  \texample.com/mod/db\t3.2s\n"
+
+	var got packageOutput
+	err := streamBenchResults(strings.NewReader(out), func(out packageOutput) {
+		got = out
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := benchMetrics{
+		"BenchmarkQuery": {"B/op": 4096, "allocs/op": 12, "hit-ratio": 0.95, "queries/op": 1834},
+		"BenchmarkCopy":  {"MB/s": 681.98},
+	}
+	if !reflect.DeepEqual(got.metrics, expected) {
+		t.Errorf("Parsed the metrics %v, expected %v", got.metrics, expected)
+	}
+	if got.benches["BenchmarkQuery"] != 61234 || got.benches["BenchmarkPlain"] != 12345 {
+		t.Errorf("Parsed the wrong speeds %v alongside the metrics", got.benches)
+	}
+}
+
+func TestParseBenchMetricsCount(t *testing.T) {
+	out := "BenchmarkQuery-8   \t 20000\t     61234 ns/op\t       0.9000 hit-ratio\n" +
+		"BenchmarkQuery-8   \t 20000\t     61000 ns/op\t       0.5000 hit-ratio\n" +
+		"BenchmarkQuery-8   \t 20000\t     62000 ns/op\t       0.9500 hit-ratio\n" +
+		"ok  \texample.com/mod/db\t3.2s\n"
+
+	var got packageOutput
+	err := streamBenchResults(strings.NewReader(out), func(out packageOutput) {
+		got = out
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ratio := got.metrics["BenchmarkQuery"]["hit-ratio"]; ratio != 0.9 {
+		t.Errorf("Took %v for the hit-ratio of the runs, expected their median 0.9", ratio)
+	}
+}
+
+func TestStreamBenchOutputLines(t *testing.T) {
+	out := "goos: linux\n" +
+		`{"Action":"output","Package":"example.com/mod/db","Output":"BenchmarkQuery-8 \t 20000\t"}` + "\n" +
+		`{"Action":"output","Package":"example.com/mod/db","Output":" 61234 ns/op\n\n"}` + "\n" +
+		`{"Action":"pass","Package":"example.com/mod/db","Elapsed":3.2}` + "\n" +
+		"ok  \texample.com/mod/text\t1.5s\n"
+
+	var lines []string
+	err := streamBenchOutput(strings.NewReader(out), func(packageOutput) {
+		lines = append(lines, "(done)")
+	}, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"goos: linux", "BenchmarkQuery-8 \t 20000\t 61234 ns/op", "(done)", "ok  \texample.com/mod/text\t1.5s", "(done)"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Streamed the lines %q, expected %q", lines, expected)
+	}
+}
+
+func TestStreamCommandOutput(t *testing.T) {
+	out := `BenchmarkUnnamed 100 50 ns/op
+pkg: example.com/a
+BenchmarkA 1000 1200 ns/op
+pkg: example.com/b
+BenchmarkB-8 1000 300 ns/op
+BenchmarkB-8 1000 310 ns/op
+PASS
+`
+	got := make(map[string]map[string]uint64)
+	err := streamCommandOutput(strings.NewReader(out), func(out packageOutput) {
+		got[out.pkgPath] = out.benches
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]uint64{
+		".":             {"BenchmarkUnnamed": 50},
+		"example.com/a": {"BenchmarkA": 1200},
+		"example.com/b": {"BenchmarkB": 305},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Parsed %v, expected %v", got, expected)
+	}
+
+	// go test ends every package itself, and an unfinished one can't be trusted
+	got = make(map[string]map[string]uint64)
+	streamBenchResults(strings.NewReader(out), func(out packageOutput) { got[out.pkgPath] = out.benches })
+	if len(got) > 0 {
+		t.Errorf("Parsed %v from go test output without an ok line", got)
+	}
+}
+
+func TestStreamRawLines(t *testing.T) {
+	out := "goos: linux\n" +
+		"BenchmarkA-8 \t 1000\t 1200 ns/op\t 64 B/op\n" +
+		"BenchmarkPrinting-8\n" +
+		"some output\n" +
+		"     500\t 3000 ns/op\n" +
+		"PASS\n" +
+		"ok  \texample.com/mod\t1.5s\n" +
+		`{"Action":"output","Package":"example.com/mod/db","Output":"BenchmarkQuery-8 \t 20000\t 61234 ns/op\r\n"}` + "\n" +
+		`{"Action":"pass","Package":"example.com/mod/db","Elapsed":3.2}` + "\n"
+
+	raw := make(map[string][]string)
+	if err := streamBenchResults(strings.NewReader(out), func(out packageOutput) { raw[out.pkgPath] = out.raw }); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"example.com/mod":    {"BenchmarkA-8 \t 1000\t 1200 ns/op\t 64 B/op", "BenchmarkPrinting-8", "     500\t 3000 ns/op"},
+		"example.com/mod/db": {"BenchmarkQuery-8 \t 20000\t 61234 ns/op"},
+	}
+	if !reflect.DeepEqual(raw, expected) {
+		t.Errorf("Kept the raw lines %q, expected %q", raw, expected)
+	}
+}
+
+func TestStreamFailedPackages(t *testing.T) {
+	out := "BenchmarkA-8 \t 1000\t 1200 ns/op\n" +
+		"BenchmarkB-8 \tpanic: boom\n" +
+		"\n" +
+		"goroutine 7 [running]:\n" +
+		"exit status 2\n" +
+		"FAIL\texample.com/mod\t0.5s\n" +
+		`{"Action":"output","Package":"example.com/mod/db","Output":"BenchmarkQuery-8 \t 20000\t 61234 ns/op\n"}` + "\n" +
+		`{"Action":"output","Package":"example.com/mod/db","Output":"--- FAIL: BenchmarkScan\n"}` + "\n" +
+		`{"Action":"output","Package":"example.com/mod/db","Output":"    --- FAIL: BenchmarkScan/large-8\n"}` + "\n" +
+		`{"Action":"fail","Package":"example.com/mod/db","Elapsed":3.2}` + "\n" +
+		"FAIL\texample.com/mod/broken [build failed]\n"
+
+	var passed []string
+	failed := make(map[string]packageOutput)
+	p := newBenchParser(func(out packageOutput) { passed = append(passed, out.pkgPath) }, nil)
+	p.onFail = func(out packageOutput) { failed[out.pkgPath] = out }
+	if err := p.stream(strings.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(passed) > 0 || len(failed) != 3 {
+		t.Fatalf("Passed %v and failed %v", passed, failed)
+	}
+	tests := []struct {
+		pkgPath, crashed string
+		benches          map[string]uint64
+	}{
+		{"example.com/mod", "BenchmarkB", map[string]uint64{"BenchmarkA": 1200}},
+		{"example.com/mod/db", "BenchmarkScan/large", map[string]uint64{"BenchmarkQuery": 61234}},
+		{"example.com/mod/broken", "", map[string]uint64{}},
+	}
+	for _, test := range tests {
+		out := failed[test.pkgPath]
+		if out.crashed != test.crashed || !reflect.DeepEqual(out.benches, test.benches) {
+			t.Errorf("Failed %s in %q with %v, expected %q with %v", test.pkgPath, out.crashed, out.benches, test.crashed, test.benches)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+)
+
+var confirmRecords = flag.Int("confirmRecords", 1, "Only sets a new best once a benchmark was faster than -recordTol allows in this many consecutive runs, so a single lucky run can't lower the bar")
+
+// A new best that hasn't been confirmed by enough consecutive runs yet, see -confirmRecords
+type pendingRecord struct {
+	Speed uint64 `json:"speed"` // The slowest of its runs so far, which becomes the best once confirmed
+	Runs  int    `json:"runs"`
+}
+
+// Holds back the new records of the run that haven't been faster than -recordTol allows in enough consecutive runs
+// yet: their best stays what it was, and they're reported as OK. A record confirmed by enough runs gets the slowest
+// speed of those runs as its best, rather than the luckiest. Returns the records still pending, which are forgotten
+// as soon as a run of theirs isn't a record.
+func confirmPending(results []benchResult, best map[string]uint64, pending map[string]pendingRecord, runs int) map[string]pendingRecord {
+	if runs <= 1 {
+		return nil
+	}
+
+	var stillPending map[string]pendingRecord
+	for i, res := range results {
+		if res.Status != statusRecord {
+			continue
+		}
+		p := pending[res.Name]
+		p.Runs++
+		if res.Speed > p.Speed {
+			p.Speed = res.Speed
+		}
+		if p.Runs >= runs {
+			logInfo("Benchmark", res.Name, "was a new record in", p.Runs, "consecutive runs, setting its best to the slowest of them,", p.Speed)
+			best[res.Name] = p.Speed
+			continue
+		}
+
+		logTrace("Benchmark", res.Name, "is a new record in", p.Runs, "of the", runs, "consecutive runs needed to set a new best")
+		best[res.Name] = res.BestSpeed
+		results[i].Status = statusOK
+		if stillPending == nil {
+			stillPending = make(map[string]pendingRecord)
+		}
+		stillPending[res.Name] = p
+	}
+
+	return stillPending
+}
+
+// E.g. New best of BenchmarkFoo pending, a record in 1 of 3 runs
+func formatPending(name string, p pendingRecord, runs int) string {
+	return "New best of " + name + " pending, a record in " + strconv.Itoa(p.Runs) + " of " + strconv.Itoa(runs) + " runs"
+}
+
+func sortedPending(pending map[string]pendingRecord) []string {
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfirmPending(t *testing.T) {
+	var pending map[string]pendingRecord
+	for i, speed := range []uint64{50, 60, 55} {
+		results := []benchResult{{Name: "BenchmarkA", Speed: speed, BestSpeed: 100, Status: statusRecord}}
+		best := map[string]uint64{"BenchmarkA": speed}
+		pending = confirmPending(results, best, pending, 3)
+
+		if i < 2 {
+			if results[0].Status != statusOK || best["BenchmarkA"] != 100 {
+				t.Errorf("Set a new best after %d runs: %s, %d", i+1, results[0].Status, best["BenchmarkA"])
+			}
+			if pending["BenchmarkA"].Runs != i+1 {
+				t.Errorf("Kept %+v pending after %d runs", pending["BenchmarkA"], i+1)
+			}
+			continue
+		}
+		if results[0].Status != statusRecord || best["BenchmarkA"] != 60 {
+			t.Errorf("Set the best to %d as %s after 3 runs, expected the slowest of them", best["BenchmarkA"], results[0].Status)
+		}
+		if pending != nil {
+			t.Errorf("Kept %v pending once confirmed", pending)
+		}
+	}
+
+	// A run that isn't a record starts over
+	pending = map[string]pendingRecord{"BenchmarkA": {Speed: 50, Runs: 2}}
+	results := []benchResult{{Name: "BenchmarkA", Speed: 90, BestSpeed: 100, Status: statusOK}}
+	if pending = confirmPending(results, map[string]uint64{"BenchmarkA": 100}, pending, 3); pending != nil {
+		t.Errorf("Kept %v pending after a run that wasn't a record", pending)
+	}
+}
+
+func TestRecordPending(t *testing.T) {
+	rec := benchRecord{benches: map[string]uint64{"BenchmarkA": 100}, pending: map[string]pendingRecord{"BenchmarkA": {Speed: 60, Runs: 1}}}
+	raw, err := marshalRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unmarshalled, err := unmarshalRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unmarshalled, rec) {
+		t.Errorf("Unmarshalled %+v, expected %+v", unmarshalled, rec)
+	}
+}
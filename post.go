@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"text/template"
+)
+
+var (
+	postURL         = flag.String("post", "", "POSTs the output of -postTemplate, executed with the results of the run, to this URL")
+	postTemplate    = flag.String("postTemplate", "", "The file with the text/template for -post")
+	postContentType = flag.String("postContentType", "application/json", "The Content-Type of what -post sends")
+)
+
+// Renders a user-supplied template with the whole run and POSTs it, for review systems and other services rebench
+// has no built-in support for. The Authorization header is taken from $REBENCH_POST_AUTHORIZATION.
+type postReporter struct {
+	url, contentType string
+	tmpl             *template.Template
+}
+
+func newPostReporter(url, templateFile, contentType string) (postReporter, error) {
+	if templateFile == "" {
+		return postReporter{}, errors.New("-post needs a template, set -postTemplate")
+	}
+
+	tmpl, err := parseTemplateFile(templateFile)
+	if err != nil {
+		return postReporter{}, err
+	}
+
+	return postReporter{url: url, contentType: contentType, tmpl: tmpl}, nil
+}
+
+func (p postReporter) report(r runReport) error {
+	var body bytes.Buffer
+	if err := p.tmpl.Execute(&body, r); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", p.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", p.contentType)
+	if auth := os.Getenv("REBENCH_POST_AUTHORIZATION"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	return send(req, nil)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPostReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplFile := filepath.Join(dir, "review.tmpl")
+	tmpl := `{"approved": {{if .Failed}}false{{else}}true{{end}}, "text": {{json .Summary}}, "slow": [` +
+		`{{range .Runs}}{{range .Results}}{{if eq .Status "SLOW"}}{{json (printf "%s %s" .Name (factor .Factor))}}{{end}}{{end}}{{end}}]}`
+	if err := ioutil.WriteFile(tmplFile, []byte(tmpl), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var posted struct {
+		Approved bool
+		Text     string
+		Slow     []string
+	}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Errorf("Template didn't produce valid JSON %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("REBENCH_POST_AUTHORIZATION", "Bearer abc")
+	defer os.Unsetenv("REBENCH_POST_AUTHORIZATION")
+
+	p, err := newPostReporter(srv.URL, tmplFile, "application/json")
+	if err != nil {
+		t.Fatalf("Cannot parse template %v", err)
+	}
+	if err := p.report(testReport()); err != nil {
+		t.Fatalf("Cannot post report %v", err)
+	}
+
+	if posted.Approved || len(posted.Slow) != 1 || posted.Slow[0] != "BenchmarkA 3.00x" || auth != "Bearer abc" {
+		t.Errorf("Wrong post %+v with authorization %q", posted, auth)
+	}
+}
+
+func TestPostReporterNeedsTemplate(t *testing.T) {
+	if _, err := newPostReporter("http://localhost", "", "text/plain"); err == nil {
+		t.Errorf("Post reporter created without a template")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	preCommitFlags     = flag.NewFlagSet("pre-commit", flag.ExitOnError)
+	preCommitBench     = preCommitFlags.String("bench", ".", "The benchmarks to run, as in go test -bench")
+	preCommitBenchtime = preCommitFlags.String("benchtime", "100ms", "The -benchtime to run benchmarks with")
+	preCommitGate      = preCommitFlags.Bool("gate", false, "Fails on regressions and missing benchmarks instead of only reporting them")
+	preCommitHooksYAML = preCommitFlags.Bool("hooks-yaml", false, "Prints the .pre-commit-hooks.yaml entry for rebench and exits")
+)
+
+// The hook definition the pre-commit framework looks for in the root of a hook repository.
+// verbose is set because the report is the whole point, and pre-commit hides the output of passing hooks otherwise.
+const preCommitHooks = `- id: rebench
+  name: rebench
+  description: Benchmarks the Go packages changed by a commit and reports how they compare with their best benchmarks on record.
+  entry: rebench pre-commit
+  language: golang
+  types: [go]
+  require_serial: true
+  verbose: true
+`
+
+func preCommit(args []string, speedTolPercent, recordTolPercent int) int {
+	preCommitFlags.Parse(args)
+	if *preCommitHooksYAML {
+		fmt.Print(preCommitHooks)
+		return exitOK
+	}
+
+	// Hook logs are compared across runs, timestamps only get in the way
+	log.SetFlags(0)
+
+	files := preCommitFlags.Args()
+	if len(files) == 0 {
+		out, err := exec.Command("git", "diff", "--cached", "--name-only", "--diff-filter=ACMR").Output()
+		if err != nil {
+			logError("No files given and cannot list the staged files:", err)
+			return exitError
+		}
+		files = strings.Fields(string(out))
+	}
+
+	packages := changedPackages(files)
+	if len(packages) == 0 {
+		logInfo("No Go packages changed, nothing to benchmark")
+		return exitOK
+	}
+
+	return rebench(runOptions{
+		speedTolPercent:  speedTolPercent,
+		recordTolPercent: recordTolPercent,
+		bench:            *preCommitBench,
+		benchtime:        *preCommitBenchtime,
+		packages:         packages,
+		readOnly:         true,
+		reportOnly:       !*preCommitGate,
+	})
+}
+
+// Maps changed files to the sorted go test patterns of the packages containing them. Files in directories
+// that no longer exist (i.e. deleted packages) are ignored.
+func changedPackages(files []string) []string {
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+
+		dir := filepath.Dir(file)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		if dir != "." && !filepath.IsAbs(dir) {
+			dir = "." + string(filepath.Separator) + dir
+		}
+		seen[dir] = true
+	}
+
+	packages := make([]string, 0, len(seen))
+	for pkg := range seen {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+
+	return packages
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedPackages(t *testing.T) {
+	files := []string{"rebench.go", "testpackage/stuff.go", "testpackage/testpackage_test.go", "README.md", "gone/deleted.go"}
+
+	packages := changedPackages(files)
+	if expected := []string{".", reform(".", "testpackage")}; !reflect.DeepEqual(packages, expected) {
+		t.Errorf("Expected packages %v, got %v", expected, packages)
+	}
+}
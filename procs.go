@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var keepProcs = flag.Bool("keepProcs", false, "Keeps the -N GOMAXPROCS suffix go test adds to benchmark names, so BenchmarkFoo-8 and BenchmarkFoo-4 are different benchmarks")
+
+// Whether benchmark names lose their GOMAXPROCS suffix, both in the output of go test and in the records read.
+// Set from -keepProcs.
+var trimProcs = true
+
+// The GOMAXPROCS go test runs the benchmarks with: those of -cpu, or else that of the environment. Set from -cpu, or
+// from one passed to go test after --.
+var runProcs = []int{runtime.GOMAXPROCS(0)}
+
+// The GOMAXPROCS in a comma-separated list such as that of -cpu, leaving out anything that isn't one
+func parseProcs(list string) []int {
+	var procs []int
+	for _, field := range strings.Split(list, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(field)); err == nil && n > 0 {
+			procs = append(procs, n)
+		}
+	}
+
+	return procs
+}
+
+// The -cpu list among the arguments given to go test after --, in any form go test takes it, the last one winning
+// like it does. Empty if there's none.
+func goTestCPUList(args []string) string {
+	list := ""
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i][1:], "-"), "=")
+		if name != "cpu" && name != "test.cpu" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		list = value
+	}
+
+	return list
+}
+
+// BenchmarkFoo-8 is BenchmarkFoo, as is BenchmarkFoo/size-2-8 BenchmarkFoo/size-2, when go test runs with GOMAXPROCS
+// 8. Only the suffixes of the GOMAXPROCS of the run are trimmed, so with GOMAXPROCS=1, where go test leaves the suffix
+// out, BenchmarkFoo/size-2 stays as it is.
+func trimProcsSuffix(name string) string {
+	return trimProcsOf(name, runProcs)
+}
+
+func trimProcsOf(name string, procs []int) string {
+	if !trimProcs {
+		return name
+	}
+	trimmed, _ := splitProcsSuffix(name, procs)
+
+	return trimmed
+}
+
+// Splits BenchmarkFoo-8 into BenchmarkFoo and 8 if 8 is one of the procs, whether or not suffixes are trimmed. A name
+// without such a suffix has no procs. go test never adds a suffix of 1.
+func splitProcsSuffix(name string, procs []int) (string, string) {
+	for _, n := range procs {
+		if suffix := "-" + strconv.Itoa(n); n > 1 && strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return strings.TrimSuffix(name, suffix), suffix[1:]
+		}
+	}
+
+	return name, ""
+}
+
+// The name go test -bench matches a benchmark of the records by, and the GOMAXPROCS to run it with (for -cpu) when its
+// name kept the suffix with -keepProcs or -cpu. A trimmed name has no procs, and runs with those of the run.
+func benchProcs(name string) (string, string) {
+	if trimProcs {
+		return name, ""
+	}
+
+	return splitProcsSuffix(name, runProcs)
+}
+
+// The suffixes the names of the records written keep, none unless -keepProcs or -cpu keeps them
+func keptProcs() []int {
+	if trimProcs {
+		return nil
+	}
+
+	return runProcs
+}
+
+// The suffixes the names of a record may have. Records from before they said so had them trimmed by nothing, or by
+// rebench as it ran on the machine of their environment, so those of their environment are trimmed, or else those
+// of the run.
+func recordProcs(version int, procs []int, envs ...*environment) []int {
+	if version >= procsVersion {
+		return procs
+	}
+
+	var legacy []int
+	for _, env := range envs {
+		switch {
+		case env == nil:
+		case env.CPUList != "":
+			legacy = append(legacy, parseProcs(env.CPUList)...)
+		case env.GOMAXPROCS > 0:
+			legacy = append(legacy, env.GOMAXPROCS)
+		}
+	}
+	if legacy == nil {
+		return runProcs
+	}
+
+	return legacy
+}
+
+// The entries with the names of their benchmarks trimmed of the procs. Where several names trim to the same one, the
+// entry whose name had no suffix to begin with wins, and otherwise the first in order of name, so it's always the same.
+func trimProcsNames[V any](entries map[string]V, procs []int) map[string]V {
+	if entries == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	trimmed := make(map[string]V, len(entries))
+	for _, name := range names {
+		t := trimProcsOf(name, procs)
+		if _, taken := trimmed[t]; !taken || name == t {
+			trimmed[t] = entries[name]
+		}
+	}
+
+	return trimmed
+}
+
+// The record with the names of its benchmarks trimmed of the procs they kept, so records from before the suffix was
+// trimmed, or from a machine with another number of cores, still match
+func (r benchRecord) withoutProcs(procs []int) benchRecord {
+	if !trimProcs || len(procs) == 0 {
+		return r
+	}
+	r.benches = trimProcsNames(r.benches, procs)
+	r.metrics = trimProcsNames(r.metrics, procs)
+	r.stats = trimProcsNames(r.stats, procs)
+	r.revisions = trimProcsNames(r.revisions, procs)
+	return r
+}
+
+func (r packageRecord) withoutProcs(procs []int) packageRecord {
+	if !trimProcs || len(procs) == 0 {
+		return r
+	}
+	r.Results, r.Best = trimProcsNames(r.Results, procs), trimProcsNames(r.Best, procs)
+	r.Metrics, r.BestMetrics = trimProcsNames(r.Metrics, procs), trimProcsNames(r.BestMetrics, procs)
+	r.Stats, r.BestStats = trimProcsNames(r.Stats, procs), trimProcsNames(r.BestStats, procs)
+	r.BestRevisions = trimProcsNames(r.BestRevisions, procs)
+	for name, baseline := range r.Baselines {
+		r.Baselines[name] = trimProcsNames(baseline, procs)
+	}
+	return r
+}
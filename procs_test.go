@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrimProcsSuffix(t *testing.T) {
+	defer func(procs []int) { runProcs = procs }(runProcs)
+	runProcs = []int{8, 16}
+	for name, expected := range map[string]string{
+		"BenchmarkFoo-8":          "BenchmarkFoo",
+		"BenchmarkFoo":            "BenchmarkFoo",
+		"BenchmarkFoo/size-2-16":  "BenchmarkFoo/size-2",
+		"BenchmarkFoo/a-b":        "BenchmarkFoo/a-b",
+		"BenchmarkFoo-":           "BenchmarkFoo-",
+		"BenchmarkFoo/negative-1": "BenchmarkFoo/negative-1",
+		"BenchmarkFoo/n-100":      "BenchmarkFoo/n-100",
+		"BenchmarkFoo-4":          "BenchmarkFoo-4",
+	} {
+		if trimmed := trimProcsSuffix(name); trimmed != expected {
+			t.Errorf("Trimmed %s to %s, expected %s", name, trimmed, expected)
+		}
+	}
+
+	// go test leaves the suffix out with GOMAXPROCS=1
+	runProcs = []int{1}
+	if trimmed := trimProcsSuffix("BenchmarkFoo/n-10"); trimmed != "BenchmarkFoo/n-10" {
+		t.Errorf("Trimmed BenchmarkFoo/n-10 to %s with GOMAXPROCS=1", trimmed)
+	}
+}
+
+func TestTrimProcs(t *testing.T) {
+	defer func(procs []int) { runProcs = procs }(runProcs)
+	runProcs = []int{8}
+	record, _, err := parseBenchOutput("BenchmarkFoo-8   \t 1000\t 100 ns/op\t 16 B/op\nok  \texample.com/mod\t1s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]uint64{"BenchmarkFoo": 100}; !reflect.DeepEqual(record["example.com/mod"], expected) {
+		t.Errorf("Parsed %v, expected %v", record["example.com/mod"], expected)
+	}
+
+	// Sub-benchmarks that only differ in what looks like a suffix aren't pooled with GOMAXPROCS=1
+	runProcs = []int{1}
+	record, _, err = parseBenchOutput("BenchmarkX/n-10   \t 1000\t 100 ns/op\nBenchmarkX/n-100   \t 1000\t 900 ns/op\nok  \texample.com/mod\t1s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]uint64{"BenchmarkX/n-10": 100, "BenchmarkX/n-100": 900}; !reflect.DeepEqual(record["example.com/mod"], expected) {
+		t.Errorf("Parsed %v with GOMAXPROCS=1, expected %v", record["example.com/mod"], expected)
+	}
+
+	// A record from before the suffixes were listed, from a machine with another number of cores, with a benchmark
+	// that has since lost its suffix
+	rec, err := unmarshalRecord([]byte(`{"version": 2, "benchmarks": {"BenchmarkFoo-4": {"sec/op": 1.2e-07}, "BenchmarkBar-4": {"sec/op": 3e-07}, "BenchmarkBar": {"sec/op": 2e-07}}, "environment": {"gomaxprocs": 4}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]uint64{"BenchmarkFoo": 120, "BenchmarkBar": 200}; !reflect.DeepEqual(rec.benches, expected) {
+		t.Errorf("Read the record as %v, expected %v", rec.benches, expected)
+	}
+
+	// Only the suffixes a record lists are trimmed from it
+	rec, err = unmarshalRecord([]byte(`{"version": 3, "benchmarks": {"BenchmarkFoo-4": {"sec/op": 1.2e-07}, "BenchmarkX/n-10": {"sec/op": 1e-07}}, "procs": [4]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]uint64{"BenchmarkFoo": 120, "BenchmarkX/n-10": 100}; !reflect.DeepEqual(rec.benches, expected) {
+		t.Errorf("Read the record as %v, expected %v", rec.benches, expected)
+	}
+
+	trimProcs = false
+	defer func() { trimProcs = true }()
+	runProcs = []int{8}
+	record, _, err = parseBenchOutput("BenchmarkFoo-8   \t 1000\t 100 ns/op\nok  \texample.com/mod\t1s\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]uint64{"BenchmarkFoo-8": 100}; !reflect.DeepEqual(record["example.com/mod"], expected) {
+		t.Errorf("Parsed %v with -keepProcs, expected %v", record["example.com/mod"], expected)
+	}
+	raw, err := marshalRecord(benchRecord{benches: record["example.com/mod"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := unmarshalStoredRecord(raw); err != nil || !reflect.DeepEqual(stored.Procs, []int{8}) {
+		t.Errorf("Didn't list the suffixes kept in\n%s", raw)
+	}
+}
+
+func TestGoTestCPUList(t *testing.T) {
+	for list, args := range map[string][]string{
+		"":    {"-benchtime=3s", "cpu=4"},
+		"1,4": {"-benchtime=3s", "-cpu=1,4"},
+		"2":   {"--cpu", "2"},
+		"8":   {"-cpu=1,4", "-test.cpu=8"},
+	} {
+		if cpu := goTestCPUList(args); cpu != list {
+			t.Errorf("Found -cpu %q in %v, expected %q", cpu, args, list)
+		}
+	}
+}
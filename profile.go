@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var profileDir = flag.String("profile", "", "Re-runs every benchmark that got too slow with -cpuprofile and -memprofile, saving the profiles in this directory")
+
+// Profiles the slow benchmarks of a package for -profile, so looking into a regression can start right away from
+// what CI kept. Does nothing if dir is empty.
+type profiler struct {
+	pkgPath string
+	pkgDir  string   // The directory of the package, which go test runs in
+	dir     string   // Absolute, since packages are benchmarked in their own directories
+	rev     revision // What the run benchmarks, which names the profiles' directories
+	flags   []string // The go test flags of the run, see goTestFlags
+}
+
+// Re-runs every slow benchmark on its own with profiling, returning the directory of the profiles of each
+// benchmark profiled
+func (p profiler) capture(results []benchResult) map[string]string {
+	if p.dir == "" {
+		return nil
+	}
+
+	dirs := make(map[string]string)
+	for _, res := range results {
+		if res.Status != statusSlow {
+			continue
+		}
+
+		dir := p.profileDir(res.Name)
+		if err := mkdirAll(dir); err != nil {
+			logError("Couldn't create the directory for the profiles of", res.Name+":", err)
+			continue
+		}
+		logInfo("Profiling", res.Name, "of", p.pkgPath, "in", dir)
+		if err := p.run(res.Name, dir); err != nil {
+			logError("Couldn't profile", res.Name, "of", p.pkgPath+":", err)
+			os.RemoveAll(dir)
+			continue
+		}
+		dirs[res.Name] = dir
+	}
+
+	return dirs
+}
+
+// Runs only the benchmark given once, writing its CPU and memory profiles to the directory along with the test
+// binary, which pprof needs to make sense of them. A name with its GOMAXPROCS suffix runs with -cpu set to it.
+func (p profiler) run(name, dir string) error {
+	trimmed, procs := benchProcs(name)
+	args := []string{"test", "-bench=" + rerunPattern([]string{trimmed})}
+	args = append(args, p.flags...)
+	if procs != "" {
+		args = append(args, "-cpu="+procs)
+	}
+	args = append(args,
+		"-cpuprofile="+filepath.Join(dir, "cpu.pprof"),
+		"-memprofile="+filepath.Join(dir, "mem.pprof"),
+		"-o="+filepath.Join(dir, "bench.test"),
+		p.pkgPath)
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = p.pkgDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		logError(strings.TrimSpace(string(out)))
+		return err
+	}
+
+	// The profiles of a run that matched no benchmark are empty
+	ran := false
+	if err := streamBenchResults(bytes.NewReader(out), func(out packageOutput) {
+		_, ok := out.benches[name]
+		ran = ran || ok
+	}); err != nil {
+		return err
+	}
+	if !ran {
+		return errors.New("the profiled run didn't run " + name)
+	}
+
+	return nil
+}
+
+// E.g. <dir>/3f2a9c1d8e7b/example.com/mod/db/BenchmarkQuery_small for the sub-benchmark BenchmarkQuery/small, at
+// uncommitted outside a git repository and with -dirty after a dirty commit
+func (p profiler) profileDir(name string) string {
+	commit := p.rev.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "uncommitted"
+	} else if p.rev.Dirty {
+		commit += "-dirty"
+	}
+
+	return filepath.Join(recordsDir(filepath.Join(p.dir, commit), p.pkgPath), profileName(name))
+}
+
+// The name of a benchmark made fit for a single directory name
+func profileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileDir(t *testing.T) {
+	p := profiler{pkgPath: "example.com/mod/db", dir: "/ci/profiles", rev: revision{Commit: "3f2a9c1d8e7b5a4c", Dirty: true}}
+	if dir := p.profileDir("BenchmarkQuery/small rows"); dir != filepath.Join("/ci/profiles", "3f2a9c1d8e7b-dirty", "example.com", "mod", "db", "BenchmarkQuery_small_rows") {
+		t.Errorf("Profiled into %s", dir)
+	}
+
+	p.rev = revision{}
+	if dir := p.profileDir("BenchmarkQuery"); dir != filepath.Join("/ci/profiles", "uncommitted", "example.com", "mod", "db", "BenchmarkQuery") {
+		t.Errorf("Profiled into %s outside a repository", dir)
+	}
+}
+
+func TestProfileSlow(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+	opts := testOptions
+	opts.profile = dir
+	opts.readOnly = true
+	if code := rebench(opts); code != exitSlow {
+		t.Fatalf("Program returned %d for a dry run, expected %d", code, exitSlow)
+	}
+	if profiles := savedProfiles(dir); len(profiles) != 0 {
+		t.Errorf("Saved the profiles %v in a dry run", profiles)
+	}
+
+	opts.readOnly = false
+	if code := rebench(opts); code != exitSlow {
+		t.Fatalf("Program returned %d, expected %d", code, exitSlow)
+	}
+	if profiles := savedProfiles(dir); len(profiles) == 0 || len(profiles)%2 != 0 {
+		t.Errorf("Saved the profiles %v, expected a CPU and a memory profile of every slow benchmark", profiles)
+	}
+}
+
+func savedProfiles(dir string) []string {
+	var profiles []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".pprof" {
+			profiles = append(profiles, filepath.Base(path))
+		}
+		return nil
+	})
+
+	return profiles
+}
+
+func TestProfileProcs(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	trimProcs = false
+	defer func() { trimProcs = true }()
+	defer func(procs []int) { runProcs = procs }(runProcs)
+	runProcs = []int{2}
+	p := profiler{pkgPath: ".", flags: goTestFlags(runOptions{benchtime: "1x"})}
+	if err := p.run("BenchmarkSleep-2", dir); err != nil {
+		t.Fatalf("Couldn't profile a benchmark named with its GOMAXPROCS: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "cpu.pprof")); err != nil || info.Size() == 0 {
+		t.Errorf("Saved no CPU profile of the benchmark")
+	}
+
+	if err := p.run("BenchmarkNothing-2", dir); err == nil {
+		t.Errorf("Profiled a benchmark that doesn't exist")
+	}
+}
@@ -1,35 +1,110 @@
-//A simple package for re-benchmarking Go packages as you commit, and comparing the benchmarks with previous bests.
+// A simple package for re-benchmarking Go packages as you commit, and comparing the benchmarks with previous bests.
 //
 // This is a command-line tool, not a package. After running `go get github.com/Jragonmiris/rebench` (or cloning and using `go install`), run `rebench -help` for usage information. All output is stores as either .txt or .json.
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	speedTolPercent  = flag.Int("speedTol", 150, "Sets the percentage tolerance for a slower benchmark before returning a non-zero error status")
 	recordTolPercent = flag.Int("recordTol", 70, "Sets the percentage tolerance for a faster benchmark before overwriting previous speed records")
 	help             = flag.Bool("help", false, "Print instructions for the tool instead of running the program")
-	quiet            = flag.Bool("q", false, "Squelches the log output")
-	helpMsg          = `rebench [[-speedTol int -recordTol int -q] | -help]
+	quiet            = flag.Bool("q", false, "Only logs errors")
+	benchFilter      = flag.String("bench", ".", "Only runs and compares the benchmarks matching this regular expression, as in go test -bench")
+	benchtime        = flag.String("benchtime", "", "Passed to go test -benchtime when set")
+	testRun          = flag.String("run", "^$", "Passed to go test -run, which by default runs no tests at all, e.g. to run a test setting up fixtures before the benchmarks")
+	cpuList          = flag.String("cpu", "", "Passed to go test -cpu when set, e.g. 1,4, which implies -keepProcs")
+	testTimeout      = flag.String("timeout", "", "Passed to go test -timeout when set")
+	runTimeout       = flag.Duration("runTimeout", 0, "Stops go test after this long altogether, e.g. 45m, judging only the packages it finished, 0 to let it run")
+	buildTags        = flag.String("tags", "", "Passed to go test -tags when set")
+	count            = flag.Int("count", 1, "Runs every benchmark this many times, only failing on changes that are statistically significant")
+	warmup           = flag.Int("warmup", 0, "Runs the benchmarks this many times before the run that counts, discarding their results")
+	alpha            = flag.Float64("alpha", 0.05, "The p-value below which a change is significant with -count")
+	benchmem         = flag.Bool("benchmem", false, "Passes -benchmem to go test, and fails on B/op and allocs/op regressions like on slow benchmarks")
+	bytesTolPercent  = flag.Int("bytesTol", 0, "Sets the percentage tolerance for more B/op with -benchmem, -speedTol when 0")
+	allocsTolPercent = flag.Int("allocsTol", 0, "Sets the percentage tolerance for more allocs/op with -benchmem, -speedTol when 0")
+	gateChanged      = flag.String("gateChanged", "", "Only fails on benchmarks covering packages changed since this git ref, while still running and recording everything")
+	useCodeowners    = flag.Bool("codeowners", false, "Names the owners of packages with regressions in the report, according to the repository's CODEOWNERS file")
+	fileMode         = flag.String("fileMode", "", "The octal mode bits of every file rebench writes, regardless of the umask, e.g. 0640")
+	dryRun           = flag.Bool("dry-run", false, "Runs and compares the benchmarks without writing any file, printing each package's comparison instead")
+	acceptOnly       = flag.Bool("acceptOnly", false, "Never changes the best on record in a run, only comparing with it, so bests only change with rebench record or rebench accept")
+	durableWrites    = flag.Bool("durable", false, "Flushes every file rebench writes to disk before moving on, so an abrupt termination can't leave a truncated record behind")
+	against          = flag.String("against", againstBest, "What the run is compared with: best (the best on record), last (the previous run) or both")
+	keepHistory      = flag.Bool("history", false, "Appends the results of every package to "+historyFile+" in the directory of invocation, for rebench history")
+	perBranch        = flag.Bool("perBranch", false, "Keeps the best benchmarks of every git branch apart from the main branch's, which a branch is compared with until it has bests of its own")
+	mainBranch       = flag.String("mainBranch", "", "The branch whose best benchmarks are kept in .bench_best.json with -perBranch, the default branch of origin if empty")
+	monorepo         = flag.Bool("monorepo", false, "Keeps every record in a single store in .rebench and processes packages as go test finishes them, for repositories with thousands of packages")
+	scaleUnits       = flag.Bool("scaleUnits", false, "Writes speeds in reports in whichever of ns, µs, ms and s reads best instead of always in ns")
+	sigDigits        = flag.Int("sigDigits", 0, "Rounds speeds and factors in reports to this many significant digits, 0 to leave them be")
+	thousands        = flag.String("thousands", "", "Separates every three digits of the numbers in reports with this, e.g. , or _")
+	emoji            = flag.Bool("emoji", false, "Shows the comparisons in Markdown reports as tables with an emoji for the status of each benchmark")
+	baselineName     = flag.String("baseline", "", "Also saves the benchmarks of the run as the baseline of this name, e.g. a release, for rebench diff")
+	matrixList       = flag.String("matrix", "", "Also compares the run with each of these comma-separated references in a table with a column per reference: best, last, or the name of a baseline")
+	archiveDir       = flag.String("archive", "", "Saves the unmodified go test output of every run in a timestamped file in this directory")
+	keepRaw          = flag.Bool("raw", false, "Keeps the lines of every package's results as go test printed them in "+rawFile+", alongside the parsed results")
+	outDir           = flag.String("outDir", "", "Keeps the records of every package in this directory, under the package's import path, rather than in the package's directory")
+	bestFileName     = flag.String("bestFile", "", "The name of the file keeping the best on record of every package, "+mainBestFile+" by default")
+	reportFile       = flag.String("reportFile", "", "The name of the file every package's comparison is written to, bench_comparison.txt by default, or - to print them on stdout")
+	minNs            = flag.Int("minNs", 0, "Never fails on a benchmark slower than -speedTol allows while it's still faster than this many ns/op, since tiny benchmarks are mostly noise")
+	wallTolPercent   = flag.Int("wallTol", 0, "Sets the percentage tolerance for a package taking longer to benchmark than in its previous run before returning a non-zero error status, 0 to never fail on it")
+	helpMsg          = `rebench [run | record] [[-speedTol int -recordTol int -confirmRecords int -acceptOnly -dry-run -minNs int -rerun int -wallTol int -geomeanTol int -driftTol int -driftRuns int -bench regexp -benchtime duration -run regexp -cpu list -timeout duration -tags tags -count int -warmup int -alpha float -benchmem -bytesTol int -allocsTol int -gateChanged ref -strictEnv -env key -stableOnly -keepProcs -against ref -history -noise -perBranch -mainBranch branch -codeowners -archive dir -raw -profile dir -outDir dir -bestFile name -reportFile name -wait duration -noLock -fileMode mode -durable -monorepo -scaleUnits -sigDigits int -thousands sep -emoji -noColor -sort order -format fmt -baseline name -matrix refs -config file -cmd command -input file -q -v -vv -log-format fmt] [reporting flags] [packages] [-- go test flags] | -help]
+rebench [-speedTol int -recordTol int -q] serve [-addr string -root string]
+rebench [-speedTol int -recordTol int] install-hook [-bench regexp -benchtime duration -gateChanged -force] pre-push
+rebench [-speedTol int -recordTol int] pre-commit [[-bench regexp -benchtime duration -gate] [file ...] | -hooks-yaml]
+rebench [-speedTol int -recordTol int -emoji] diff [-root dir -markdown] old new
+rebench [-speedTol int -recordTol int -emoji] diff -git [-bench regexp -benchtime t -count n -alpha p -markdown] oldRef newRef
+rebench [-speedTol int -recordTol int -emoji] compare [-markdown -package path -o file] old.json new.json
+rebench show [-root dir]
+rebench reset [-root dir -bench regexp]
+rebench prune [-root dir]
+rebench accept [-root dir -bench regexp]
+rebench resign [-root dir]
+rebench import [-root dir -results] file...
+rebench export [-root dir -results]
+rebench merge [-o file -resolve how] [tag=]file...
+rebench [-geomeanTol int] badge [-o file -file file]
+rebench history [-file file -package path] name
+rebench [-speedTol int -recordTol int -noColor] review [-root dir -file file]
 
 The rebench program is used to track benchmarks across development. It may be difficult, unweidly, unwise, or just undesirable to unexport or otherwise move functions just to compare new benchmarks with old ones.
 
 On the first run, this package will backup benchmarks from go test -bench in a hidden json file (hidden in the Unix sense meaning the file name begins with a "."). When run further times, it will compare the benchmark outputs with the previous bests. If the new benchmarks significantly underperform (controllable with the -speedTol flag), this program will exit with status 1. This status is also returned if old benchmarks are missing.
 
+Records are JSON with every value of every benchmark under its unit, e.g. {"version": 3, "benchmarks": {"BenchmarkX": {"sec/op": 1.2e-05, "B/op": 64}}}, indented with sorted keys and a trailing newline so committing them gives small diffs that merge cleanly. Units are scaled to the canonical units of golang.org/x/perf/benchfmt, so ns/op is stored as sec/op and MB/s as B/s; every other unit is stored as reported. With -count, the distribution of each benchmark's runs is stored under "stats" with its unit, e.g. "stats": {"BenchmarkX": {"unit": "sec/op", "n": 10, "mean": 1.21e-05, "median": 1.2e-05, "stddev": 4e-07}}. Every record also keeps the git revision of the run that wrote it under "revision", e.g. "revision": {"commit": "3f2a9c1d...", "branch": "main", "dirty": true, "time": "2016-01-02T15:04:05Z"}, and the best on record keeps the revision each benchmark's best was set on under "revisions". The comparison names the revision of the run, and that of the best of every SLOW benchmark, so a regression can be traced back to the revisions it lies between. Records written by earlier versions of rebench, which map each benchmark straight to its ns/op, are still read, and rewritten in this form on the next run.
+
+Every record ends with the checksum of the rest of it under "checksum", e.g. "checksum": "sha256:9f86d081...", which is verified whenever the record is read, so a .bench_best.json (or -monorepo record) that was cut short or edited by hand fails the run with exit code 1 and is left as it is, rather than making for a bizarre comparison or being replaced by the run. Once it's been looked at, rebench resign checksums it again. Anyone can work a SHA-256 out again after editing a record, so to make sure records only change through rebench, set $REBENCH_CHECKSUM_KEY to a key shared by every machine running rebench: records are then signed with an HMAC-SHA256 of the key, under "checksum": "hmac-sha256:...", and those without one, including records written before the key was set, are rejected until rebench resign signs them. Without the key, the HMAC of a signed record can't be checked and it's read as it is. Records from before checksums are read as they are without a key.
+
 Additionally, if a new benchmark performs significantly better (controllable with -recordTol) it will overwrite the previous best.
 
-It will also output a non-hidden file named bench_comparison.txt which breaks down the new benchmarks, the best benchmarks, and the value of newBench/oldBench.
+A run exits with one of these codes, so CI can tell a broken build from a slow benchmark. When a run fails for several reasons, the lowest code of 3 to 6 is the one returned. Every other command exits with 0 or 1 the same way, and compare with 3 or 4 as well.
+
+	0: The run passed, or it only reports, as pre-commit does without -gate.
+	1: rebench couldn't run, e.g. because of invalid flags, a broken config file or a best on record that doesn't match its checksum.
+	2: go test or go list failed, e.g. because the code doesn't compile or a benchmark panicked. When only some of the packages failed, they're skipped with a warning, and the rest are still judged, recorded and reported first. So are the benchmarks of a failed package that finished before the one that failed or panicked, which is named in its comparison.
+	3: Benchmarks on record were missing from the run.
+	4: Benchmarks regressed beyond -speedTol.
+	5: The bests were set in a different environment, with -strictEnv.
+	6: Packages took longer to benchmark than -wallTol allows.
+
+It will also output a non-hidden file named bench_comparison.txt which breaks down the new benchmarks, the best benchmarks, and the value of newBench/oldBench. The comparison is headed by how many benchmarks there are, how many of them regressed (SLOW), improved (RECORD), are NEW and are MISSING, and their geomean, e.g. "12 benchmarks: 1 regressed, 2 improved, 0 new, 1 missing, geomean 0.98x", so a large report can be skimmed top-down. The same counts added up across packages are logged at the end of the run, and head the comparisons with -monorepo, the Markdown and HTML reports, and the JSON summary under "counts". Each benchmark is led by its status: OK, SLOW (slower than -speedTol allows), RECORD (a new best, faster than -recordTol), NEW (no best on record) or MISSING (a best on record, but no longer run). Sub-benchmarks run with b.Run are laid out as a tree under the benchmarks above them, each level of their names indented by two spaces. Below the comparison is the geomean of the factors between each benchmark that may fail the run (neither ignored nor report only, see -config) and its best, so 1.00x means every benchmark matches its best whichever benchmarks came or went, and the performance index of the package: the geomean of the speeds of those benchmarks against its first run on record, along with that of the previous run. The index is chained from run to run over the benchmarks both runs have, so benchmarks coming and going don't move it and new bests don't reset it, e.g. 0.80x is 20% faster than the first run.
+
+Every run's performance index is kept in .bench_geomean.json, and the index across packages, chained from how much the index of each package moved, weighted by the importance of each package (see "weights" under -config), is kept in .bench_geomean_repo.json in the directory of invocation, so both can be followed over time as a single curve of the library's performance.
 
 A list of flags:
 
@@ -37,179 +112,1036 @@ A list of flags:
 
 -recordTol int: Sets how much faster a benchmark must be before the previous record is overwitten in .bench_record.json (the comparison file). Works like -speedTol. The default is 70 percent.
 
+-confirmRecords int: How many consecutive runs a benchmark must be faster than -recordTol allows before its best is overwritten, so a single lucky run can't lower the bar for every run after it. Until then, the new best is pending: the benchmark is reported as OK, its best on record stays what it was, and the comparison notes how many of the runs it has so far, which are kept under "pending" in .bench_best.json. A run that isn't a record starts over. Once confirmed, the best is the slowest of those runs. With -count, the runs of a single invocation only make a record if the change is significant as well. The default is 1, which sets a new best right away.
+
+-dry-run: Runs the benchmarks and compares them with the records as usual, but writes no file at all: neither .bench_results.json, .bench_best.json nor bench_comparison.txt, nor their backups, the wall times, geomeans, history, baselines or archives. Each package's comparison is printed on stdout instead. For experimenting locally without dirtying the working tree. Reports go wherever their flags send them, as they're only written when asked for.
+
+-acceptOnly: Makes every change to the bests deliberate: runs only compare with the best on record and never change it, not even to record new or faster benchmarks or the first run of a package. The results of every run are still kept in .bench_results.json, and rebench accept makes them the best once they've been looked at, so the change to .bench_best.json can be reviewed like any other. rebench record still records a run as the best outright. Can also be set for the whole project with "acceptOnly": true in the config file.
+
+-minNs int: A noise floor in ns/op. A benchmark slower than -speedTol allows doesn't fail the run while it's still faster than this, since going from 2 ns/op to 4 ns/op is noise rather than a regression, however large a factor it makes. It can also be set in the config file, along with a floor of its own for a package or a benchmark. The default is 0, which judges every benchmark by -speedTol alone.
+
+-rerun int: Re-runs every benchmark slower than -speedTol allows this many times on its own (go test -bench='^BenchmarkName$'), and only fails the run on it if it's slow again in most of its reruns, so one noisy sample doesn't fail a CI build. A benchmark that's slow in a single run out of three is reported as OK. Only the reruns that gave the benchmark a speed count, so it stays SLOW if it didn't run again, and every slow benchmark of the package stays SLOW if a rerun fails, e.g. go test failing or timing out. Benchmarks named with their GOMAXPROCS suffix (with -keepProcs or -cpu) re-run with -cpu set to it. Reruns only confirm regressions, their speeds are never recorded. The default is 0, which fails on the first slow run.
+
+-wallTol int: Sets how much longer go test may take to benchmark a package than in its previous run, in terms of percentages like -speedTol, before exiting with a nonzero status. Every run's time is kept in .bench_walltime.json and shown below the comparison, so a suite that keeps growing doesn't go unnoticed. The default is 0, which never fails because of it.
+
+-geomeanTol int: Sets how far above 1x, in terms of percentages like -speedTol, the geomean of a package's benchmarks against their bests may be before exiting with a nonzero status, and the same for the weighted geomean across packages, e.g. -geomeanTol=105 fails a package 5% slower than its bests on average, even if none of its benchmarks is slower than -speedTol allows. Benchmarks that can't fail the run, being ignored or report only, are left out of the geomean. The performance indexes kept in .bench_geomean.json next to every package's records and in .bench_geomean_repo.json in the directory of invocation, run after run, are the headline number to follow release over release. A geomean beyond it is noted below the comparison, and fails the run like a SLOW benchmark does. The default is 0, which never fails because of it.
+
+-driftTol int, -driftRuns int: Fails the run when a benchmark got slower by more than -driftTol percent over its latest -driftRuns runs (10 by default, the run itself included), as kept in the history with -history, e.g. -driftTol=10 fails a benchmark more than 1.1x slower than it was 10 runs ago. This catches the death by a thousand cuts that -speedTol never does: each run may be within a hair of the best, until the best is long stale. Every drifting benchmark is named below its comparison along with the speeds it drifted between, and fails the run like a SLOW benchmark does, unless it's in a report only group or ignored by the config file. The default is 0, which never fails because of it.
+
+-bench regexp: Only runs the benchmarks matching the regular expression, exactly like go test -bench. Benchmarks on record that don't match it are left alone rather than reported as missing, matching each level of a sub-benchmark's name against its own part of the expression like go test does, so -bench=Parse/large leaves the bests of BenchmarkParse/small alone. The default is ".", every benchmark.
+
+-benchtime duration: Passed along to go test -benchtime when set, so benchmarks can be run for less (or more) than go test's default of 1s.
+
+-run regexp: Passed along to go test -run. The default, ^$, runs no tests at all since no test has an empty name, so only benchmarks run. Set it to run tests before the benchmarks, e.g. -run=^TestSetupFixtures$ for a suite whose benchmarks need fixtures a test sets up. Tests that fail make go test fail, and rebench with it.
+
+-cpu list, -timeout duration, -tags tags: Passed along to go test -cpu, -timeout and -tags when set, e.g. -cpu=1,4 to run every benchmark with GOMAXPROCS 1 and then 4. -cpu implies -keepProcs, since the -N suffix is all that tells its runs apart, as does a -cpu passed to go test after --.
+
+-runTimeout duration: Stops go test once it has run this long altogether, e.g. -runTimeout=45m, so a hung benchmark can't wedge a CI job forever. Unlike -timeout, which panics the test binary of a single package, the run is stopped as a whole, and every package go test finished by then is still judged, recorded and reported before rebench exits with code 2. Interrupting rebench (e.g. with Ctrl-C) stops go test the same way. go test is interrupted first, and killed if it hasn't stopped 10 seconds later. The default 0 lets go test run for as long as it takes.
+
+-- go test flags: Everything after -- is passed along to go test as it is, after rebench's own flags, e.g. rebench -count=5 -- -benchtime=3s -cpu=1,4 -short. rebench parses the output of go test -json, so flags changing what go test prints (like -v) may confuse it.
+
+-cmd command: Runs the command with the shell (sh -c, or cmd /C on Windows) rather than go test to benchmark, for projects whose benchmarks are driven by bazel, make or a wrapper script, e.g. rebench -cmd 'make bench'. Whatever it prints has to be in the Go benchmark format, as printed by go test -bench or a test binary run with -test.bench, and go test -json events are read as well. Results are kept by the package in the pkg: header above them, which recent Go versions print, or in the directory of invocation for results without one. A package ends with go test's ok line, the pkg: header of another package or the end of the output. Packages go list knows are kept in their directories as usual, and any other beneath the directory of invocation by import path (see -outDir). The packages, -bench, -count and go test flags of rebench aren't passed to the command, though -bench still limits which benchmarks are compared, and -rerun and -profile aren't supported, since they run single benchmarks with go test. The config file may set it as "cmd".
+
+-input file: Reads the output of a go test -bench run captured earlier from the file, or stdin for -, rather than running go test, so the benchmarks can run on a locked-down machine and be compared elsewhere, e.g. go test -bench=. ./... > bench.txt there and rebench -input bench.txt here. Plain text output and go test -json events are both read, and packages are kept like those of a -cmd. The packages, -bench and go test flags of rebench don't change what was run, though -bench still limits which benchmarks are compared, and -cmd, -rerun, -profile, -warmup and -changed aren't supported, since nothing is run. The machine the benchmarks ran on is unknown, so it's left out of the environment kept in the records and of the warnings about CPU scaling and load.
+
+The settings benchmarks run with make speeds incomparable just like another machine does, so the -benchtime, -cpu, -count and -tags of a run, and whatever followed --, are kept in the "environment" of its records along with the machine's (see -strictEnv), and a best set with different settings is warned about below the comparison.
+
+-count int: Runs every benchmark this many times (go test -count), so a single noisy run crossing -speedTol doesn't fail the build. Each benchmark's speed is then the median of its runs, and the mean, median and standard deviation of its runs are stored alongside it. A benchmark slower than -speedTol allows only fails the run if the change is also statistically significant, i.e. if Welch's t-test on the runs and those of the best on record gives a p-value under -alpha (default 0.05). The same goes for new records. Benchmarks whose best on record was run only once are judged by -speedTol alone. The default is 1.
+
+-warmup int: Runs the benchmarks this many times before the run that counts, with the same -bench, packages and go test flags but a single -count, and discards whatever they print, so cold caches and a CPU still clocking up don't make the first benchmarks look slow, which is common on CI machines. A failing warmup stops warming up, and the run that counts reports the failure. The default is 0.
+
+-benchmem: Passes -benchmem to go test, so every benchmark also reports the bytes (B/op) and allocations (allocs/op) of each operation, and judges both like speeds: more than -bytesTol and -allocsTol allow fails the run, and fewer than -recordTol allows is a new record. Both tolerances are percentages like -speedTol, which they default to. Memory metrics are kept alongside the speeds in .bench_best.json and compared below them. Units configured in the config file (see -config) take precedence.
+
+-gateChanged ref: Only lets the benchmarks covering code changed since the git ref fail the run. A benchmark covers its own package, everything that package depends on, and everything its tests import. Every benchmark is still run, compared and recorded as usual. If the changes can't be determined, every benchmark is gated on as usual.
+
+-changed: Only benchmarks the packages whose benchmarks cover code changed since the commit of their latest results (in .bench_results.json, or the store with -monorepo), along with those that have no results yet, so a big repository only benchmarks what a commit could have affected. What covers what is worked out like for -gateChanged, and uncommitted changes count as changes. The records of every other package, bests included, are left as they are, and their benchmarks aren't reported missing. Packages whose latest commit can't be diffed against (e.g. after a rebase) are benchmarked anyway.
+
+-codeowners: Looks up the owners of every package with slow or missing benchmarks in the CODEOWNERS file of the git repository (in .github/, the top of the repository, docs/ or .gitlab/), and names them below its comparison. A package's owners are the owners of its Go files.
+
+-archive dir: Saves the unmodified output of go test (the events of go test -json, which rebench runs it with) in dir (created if need be) on every run, in a file named after the time of the run such as go_test_20060102T150405Z.txt, so the parsed results can always be checked against (or reparsed from) the original output. The output is saved even when go test fails.
+
+-raw: Keeps the lines of every package's results as go test printed them, iteration counts and all, in .bench_raw.txt next to its .bench_results.json, backing up those of the previous run in .bench_raw.txt.old, so a suspicious comparison can be checked against exactly what was printed. A benchmark that printed something of its own keeps the line with its name above its results. With -monorepo the lines are kept under "raw" in the package's record in the store, and with -history every entry keeps them under "raw" too.
+
+-profile dir: Re-runs every benchmark that got too slow once more on its own with go test -cpuprofile and -memprofile, and saves the profiles in dir (created if need be), under the commit of the run and the package and benchmark, e.g. dir/3f2a9c1d8e7b/example.com/mod/db/BenchmarkQuery/cpu.pprof and mem.pprof, along with the test binary as bench.test for go tool pprof. Keeping dir as a CI artifact means looking into a regression can start right away. Each slow benchmark's comparison names where its profiles are. Nothing is profiled with record or -dry-run.
+
+-outDir dir, -bestFile name, -reportFile name: Say where the records of every package are kept. With -outDir, the results, best, comparison, their backups, wall times, geomeans and baselines of every package are kept in dir (created if need be) under the package's import path, e.g. dir/example.com/mod/db/.bench_best.json, rather than in the package's directory, which is left untouched; rebench show, reset, accept and prune read them with -root dir unless -bestFile is given. -bestFile names the file of the bests instead of .bench_best.json, and -reportFile the file of the comparison instead of bench_comparison.txt (in .rebench with -monorepo), or prints every package's comparison on stdout with -reportFile -. Neither -outDir nor -bestFile is supported with -monorepo, and -bestFile isn't with -perBranch.
+
+-wait duration, -noLock: A run locks .rebench.lock in the directory of invocation (or -outDir) while it runs, so two runs keeping their records in the same place, such as overlapping CI jobs on the same runner, can't interleave reading and writing them and leave a corrupt .bench_best.json behind. A run that finds the lock taken fails right away, unless -wait gives it that long for the other run to finish, e.g. -wait 10m. -noLock runs without the lock, and dry runs never take it. The lock file is removed when the run is done; the lock is released by the system should the run die, except on Windows, where a run that dies leaves the file behind to be removed by hand.
+
+-fileMode mode: Sets the mode bits, in octal, of every record, comparison and archive rebench writes, e.g. 0640 or 0664. Unless this is given, files are created with 0666 less the umask, like most tools. When it is given the files get exactly these bits whatever the umask, which is what shared filesystems (and security scanners objecting to world-writable files) generally want. Directories rebench creates get the same bits, plus search permission wherever read permission is granted.
+
+-durable: Makes sure every record and comparison is on disk before moving on, at the cost of some speed. Files are written to a temporary file next to them that is flushed with fsync and then renamed over the old file, and the directory holding them is flushed as well. Without it, a CI machine killed at the wrong moment can leave a truncated .bench_best.json behind, which silently resets the best benchmarks on record.
+
+-strictEnv: Fails the run when the best benchmarks of a package were set in a different environment than the run's, rather than only warning. Every record keeps the environment its benchmarks ran in under "environment": the Go version, GOOS and GOARCH of the go command, the CPU model (on Linux and macOS), the number of cores and GOMAXPROCS, e.g. {"goVersion": "go1.22.1", "goos": "linux", "goarch": "amd64", "cpu": "AMD EPYC 7B13", "cores": 8, "gomaxprocs": 8}. The bests keep the environment they were first set in, until rebench record sets them all anew. When the run's environment differs from the bests', comparing speeds is usually meaningless, so the differences are logged and noted below the comparison, and with -strictEnv the run fails as well (the JSON summary gives "environment" as the reason).
+
+-stableOnly: Leaves the best benchmarks alone when the machine is in a state known to make speeds unstable, since bests set on a throttled laptop make every later comparison meaningless. Before every run on Linux, rebench checks for a CPU frequency scaling governor other than performance, turbo boost (intel_pstate or cpufreq boost), a thermal zone above 85°C and a load average above half the cores, and warns about any of them in the log and below every comparison. With -stableOnly, such a run is still compared, but neither it nor rebench record changes the bests.
+
+-keepProcs: Keeps the -N suffix go test adds to the name of every benchmark when GOMAXPROCS isn't 1, e.g. BenchmarkFoo-8 on a machine with 8 cores. By default it's dropped, both from the output of go test and from the records read, so BenchmarkFoo-8 and BenchmarkFoo-4 are compared with the same best BenchmarkFoo rather than both looking missing when the bests were set on another machine. Only the suffix of the GOMAXPROCS go test runs with is dropped from its output, so with GOMAXPROCS=1 BenchmarkFoo/n-10 stays as it is, and records list the suffixes their names kept under "procs", which are dropped when they're read. Records from before that have the suffix of the GOMAXPROCS of their "environment" dropped. -cpu implies -keepProcs, since the suffix is all that tells its runs apart.
+
+-against best|last|both: What every benchmark is compared with. best (the default) is the best on record. last is the previous run (.bench_results.json), for iterating on an optimization when the best on record is out of reach; the bests are still kept up to date, but only getting slower than the previous run fails the run. both compares with both and fails if either comparison does, with the comparison with the previous run below the one with the best. Metrics besides ns/op are always compared with their bests.
+
+-history: Appends the results of every package to .rebench_history.jsonl in the directory of invocation, one JSON object per line with the revision of the run (see the record schema above), the package and its benchmarks. The file is only ever appended to, so it keeps every run whatever happens to the bests. rebench history prints the time series of a benchmark from it.
+
+-noise: Widens the tolerances of every benchmark by its noise across the history kept with -history: the coefficient of variation of its speed (its standard deviation over its mean) over its latest 30 runs, once it has run at least 5 times. A benchmark changing by less than 3 times its noise is OK however far beyond -speedTol or -recordTol the change is, so a benchmark that historically varies by ±40% doesn't fail at 1.5x. The noise of every benchmark that has any is in its result, as .Noise in templates and "noise" in the -json summary, and the noise of those tolerated beyond -speedTol is in a line below the comparison.
+
+-perBranch: Keeps the best benchmarks of every git branch apart, so benchmarking a feature branch doesn't overwrite the bests the main branch is compared with. The main branch and a detached HEAD keep theirs in .bench_best.json as usual, while any other branch keeps its own in a file named after it, every character but letters, digits, '.', '_' and '-' escaped as %XX, e.g. .bench_best.feature%2Fx.json for feature/x. The main branch is the one given with -mainBranch, or else the default branch of origin that origin/HEAD points to; when neither is known, rebench exits with code 1 asking for -mainBranch. A branch without bests of its own yet is compared with the main branch's, and its first run records its own. Not supported with -monorepo, and the show, reset and prune commands only see the main branch's bests, while accept and review take -perBranch and -mainBranch too.
+
+-env key: Keeps the best benchmarks of an environment apart from those of every other, so a laptop run and a CI run are never compared with each other's bests, e.g. -env ci-linux-amd64 keeps them in .bench_best@ci-linux-amd64.json rather than .bench_best.json, and each environment's first run records its own. The key names the environment however suits, as the machine of a run isn't known well enough to tell environments apart on its own (see -strictEnv). The key is escaped like the names of branches, e.g. .bench_best@ci%2Flinux.json for ci/linux. It applies to -bestFile and -perBranch too, e.g. .bench_best.feature%2Fx@ci-linux-amd64.json, and a branch falls back on the bests of the main branch in the same environment only. The latest results are still kept in .bench_results.json, whatever the environment. Not supported with -monorepo, and the show, reset and prune commands only see the bests without a key, while accept and review take -env too.
+
+-bestStore url: Keeps the best on record of every package at the url rather than in .bench_best.json in its directory, for CI machines that are thrown away after every build. The url is either s3://bucket/prefix, authenticating with $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN in $AWS_REGION (and talking to $AWS_ENDPOINT_URL instead of AWS if it's set, e.g. for MinIO), gs://bucket/prefix, authenticating with the OAuth token in $GOOGLE_OAUTH_ACCESS_TOKEN, or an http(s) URL that files are fetched from with GET and saved to with PUT, authenticating with the bearer token in $REBENCH_STORE_TOKEN if it's set. Each package's bests are kept under its import path, e.g. prefix/example.com/mod/db/.bench_best.json, and -perBranch keeps every branch's under its own name. The latest results and comparisons are still written into each package's directory. If the bests of a package can't be fetched, e.g. the store answers 403 or 500 or times out, the package is neither judged nor saved and the run fails with exit code 1, so a flaky store never has its bests replaced. Not supported with -monorepo, and the show, reset, prune and accept commands only see bests in the working tree.
+
+-push url, -pull url: Make the API of a rebench serve at the url the single source of truth of a team's records. -push uploads the results of every package to project -project (the name of the directory of invocation by default) after comparing them, followed by its bests. -pull compares every package with its bests on the server rather than those in its directory, failing the run like -bestStore if they can't be fetched. Both authenticate with the bearer token in $REBENCH_STORE_TOKEN. Neither is supported with -monorepo or -bestStore.
+
+-monorepo: An operating mode for repositories with thousands of packages. Rather than writing records into every package's directory (and entering each of them in turn), every record is kept in a single store in .rebench in the directory of invocation, with one file per package spread over 256 shard directories, so saving one package never rewrites another's records. The packages are listed with go list while go test gets going, and each one is compared and saved as soon as go test is done with it, logging the progress as it goes. The comparisons of every package are written to .rebench/bench_comparison.txt. The serve command doesn't read the store.
+
+-scaleUnits, -sigDigits int and -thousands sep: Change how numbers are written in comparisons and reports, since a slow benchmark's nanoseconds are hard to read. -scaleUnits writes each speed in whichever of ns, µs, ms and s keeps it above 1 (e.g. 1.234567ms rather than 1234567), -sigDigits rounds speeds and factors to that many significant digits (e.g. 1.23ms with 3), and -thousands separates every three digits of their integer parts (e.g. 1,234,567 with ","). Records always keep the exact ns/op.
+
+-format text|markdown: With markdown, prints the verdict and the comparison of every package as GitHub-flavored Markdown on stdout once every package has been compared, with a Markdown table per package and an emoji for the status of each benchmark as with -emoji, so a CI job can paste it straight into a pull request comment. The default, text, prints nothing more; the comparisons are in bench_comparison.txt as always.
+
+-emoji: Lays out each package's comparison in Markdown reports (e.g. -gitea and .Markdown in templates) as a Markdown table, with an emoji for the status of each benchmark: ✅ OK, ❌ SLOW, 🚀 RECORD, 🆕 NEW and ❓ MISSING.
+
+-noColor: Comparisons printed on a terminal (with -dry-run, -reportFile - and by the compare and diff commands) are colored so the rows that matter stand out: SLOW in red, RECORD in green, and MISSING and NEW in yellow. Nothing is colored when stdout isn't a terminal, when $NO_COLOR is set, or with -noColor; files never are.
+
+-sort name|factor|delta: How the rows of every comparison are sorted, in bench_comparison.txt and the Markdown and HTML reports alike: by name (the default, with sub-benchmarks laid out as a tree), by factor with the slowest against its best first, or by delta with the largest change in ns/op first. Missing and new benchmarks come last either way. Whatever the order, a comparison of more than 10 benchmarks is led by its top 10 regressions and top 10 improvements against their bests, so the rows that matter aren't buried among hundreds of unchanged ones.
+
+-baseline name: Also saves the benchmarks of every package as the baseline of this name (in .bench_baselines/<name>.json in the package's directory, or in the store with -monorepo), replacing any earlier baseline of that name. Baselines are never compared with automatically; they're there for rebench diff, e.g. with -baseline=v1.4.0 when benchmarking a release.
+
+-matrix refs: Also compares every benchmark of the run with each of the comma-separated references, in a table below the comparison with a column per reference showing its speed and the factor between the new speed and it. A reference is best (the best on record before the run), last (the previous run) or the name of a baseline saved with -baseline, e.g. -matrix=best,last,v1.4.0. Only the best on record decides whether the run fails.
+
+-config file: The project's config file, .rebench.json in the directory of invocation when there is one. It's a JSON object (YAML isn't supported) with:
+
+	"groups": Groups of benchmarks with policies of their own, giving structure to large suites beyond packages, e.g. {"groups": [{"name": "hotpath", "benchmarks": ["^BenchmarkEncode", "/large$"], "speedTol": 110}, {"name": "experimental", "benchmarks": ["^BenchmarkExp"], "reportOnly": true}]}. Each group has a "name", the regular expressions matching the full "benchmarks" names in it (sub-benchmarks included), and optionally a "speedTol" and "recordTol" in percent overriding -speedTol and -recordTol for it. Slow or missing benchmarks in a "reportOnly" group are reported but never fail the run. A benchmark is in the first group matching it. Each package's comparison lists the benchmarks outside any group first, then every group under a heading of its own giving the tolerances it overrides, e.g. "Group hotpath, speedTol 110%, recordTol 90%", and each result has its .Group in templates.
+
+	"ignore": Benchmarks that never fail the run, e.g. because they're flaky or depend on the environment, as exact names (covering their sub-benchmarks) or regular expressions matching full names, e.g. {"ignore": ["BenchmarkFlaky", "^BenchmarkNet/"]}. They're still run, compared, recorded and reported; only their being slow or missing is logged rather than failing the run. Unlike a "reportOnly" group, they keep their place in the comparison.
+
+	"speedTol", "recordTol" and "minNs": The default -speedTol and -recordTol in percent and -minNs in ns/op, used unless the flags are given on the command line.
+
+	"cmd": The default -cmd, e.g. {"cmd": "bazel run //bench:all"}, used unless -cmd is given on the command line.
+
+	"benchmarks": Tolerances of benchmarks by name in every package, e.g. {"benchmarks": {"BenchmarkHotPath": {"speedTol": 110}, "BenchmarkFlaky": {"speedTol": 300}}}. Each may set a "speedTol" and a "recordTol" in percent, and a "minNs" overriding -minNs. A benchmark is looked up by its full name, then by the name of every benchmark above it, closest first, so the tolerances of a benchmark cover all of its sub-benchmarks too, e.g. BenchmarkParse/large and then BenchmarkParse for BenchmarkParse/large/json. These take precedence over the tolerances of groups.
+
+	"packages": Tolerances of packages, keyed by import path or a pattern ending in /... (the longest match wins), e.g. {"packages": {"example.com/mod/...": {"speedTol": 200}, "example.com/mod/core": {"speedTol": 120, "benchmarks": {"BenchmarkHotPath": {"speedTol": 105}}}}}. Each may set a "speedTol", a "recordTol" and a "minNs" for the package, overriding the run's, and "benchmarks" like the ones above, which take precedence over those for every package. They also apply to rebench compare with -package.
+
+	"renames": The new names of renamed benchmarks, keyed by their old names, e.g. {"renames": {"BenchmarkParseJSON": "BenchmarkDecode"}}. The first run that has the new name and no longer the old one carries the old name's best (with its metrics, distribution and revision), and that of every sub-benchmark it runs, over to the new name, so the renamed benchmark is compared with its old best rather than reported MISSING alongside a NEW benchmark with no best at all. A new name that already has a best keeps it.
+
+	"weights": How much each package weighs in the weighted geomean, keyed by import path or a pattern ending in /... (the longest match wins), e.g. {"weights": {"example.com/mod/...": 1, "example.com/mod/core": 5, "example.com/mod/internal/testutil": 0}}. Packages without a weight weigh 1.
+
+	"units": How the metrics benchmarks report besides ns/op are judged, such as B/op and allocs/op with -benchmem, MB/s with b.SetBytes, or anything given to b.ReportMetric. Keyed by unit, each sets whether "lower" or "higher" is "better", and optionally a "tolerance" and "recordTolerance" in percent that work like -speedTol and -recordTol in the worse and better direction respectively (defaulting to them). For instance {"units": {"allocs/op": {"better": "lower", "tolerance": 110}, "MB/s": {"better": "higher"}}}. A metric that got worse beyond its tolerance fails the run like a slow benchmark. MB/s is judged as {"better": "higher"} unless configured otherwise, so a drop in throughput beyond -speedTol fails the run like a slow benchmark. Metrics in other units that aren't configured are shown as INFO and never fail the run. Best metrics are kept in .bench_best.json alongside the speeds, and compared below them.
+
 -help: Prints this message and then exits.
 
--q: Quiet mode; mutes log output
+-q, -v, -vv: How much is logged. Every line of the log has a level: error (rebench or go test couldn't do something), warn (something fails the run or makes it doubtful, such as a slow or missing benchmark, a different environment or an unstable machine), info (what the run is up to, including every line go test prints), debug (every file read and backed up) and trace (how each benchmark compares as it's judged). By default the log goes down to info; -q only logs errors, -v goes down to debug and -vv to trace. In text, every line but info ones starts with its level, e.g. "WARN: Benchmark BenchmarkQuery reports a speed 2.1 as fast as the old version. This is slower than expected".
+
+-log-format fmt: Writes the log as text (the default) or as json, with one object per line holding its "time", "level" and "msg", e.g. {"time":"2016-01-02T15:04:05Z","level":"warn","msg":"..."}, so CI log scrapers can pick out warnings and regressions reliably.
+
+A list of reporting flags, which send the results elsewhere once every package has been compared:
+
+-json: Prints a JSON summary of the run on stdout once every package has been compared, so wrapper scripts don't have to scrape the logs or the comparisons. It's an object with the "verdict" ("passing" or "failing"), the "reasons" the run fails for ("missing", "slow" and "tooLong", empty when it passes), the weighted "geomean", and the "packages", each with its "package" import path, "geomean", "wallTime" in seconds, "results" and "metrics". Each result has the "name", "status", "speed" and "bestSpeed" in ns/op, "factor" and "group" of a benchmark, leaving out what doesn't apply, e.g. {"name": "BenchmarkA", "status": "SLOW", "speed": 300, "bestSpeed": 100, "factor": 3}. Each metric has the "name", "unit", "status", "value", "best" and "factor" of a metric.
+
+-junit file: Writes the comparisons to the file as a JUnit XML report, for CI systems that show JUnit results (e.g. Jenkins, GitLab and Azure Pipelines). Every package is a test suite and every benchmark a test case, which fails if the benchmark is SLOW or MISSING and that fails the run, with the factor and speeds in its failure message. Those that don't, being in a report only group, ignored by the config file or in a package -gateChanged doesn't gate, pass with their status in their output. The other benchmarks pass, with their comparison as output.
+
+-html file: Writes the comparison of every package to the file as a single self-contained HTML page, for attaching to CI builds. Each benchmark's row has a small line chart of its speed over every run kept with -history, which only shows up once there are two runs of it.
+
+-influx file or url: Writes every benchmark of the run as a point in InfluxDB line protocol, e.g. rebench,package=example.com/mod/db,benchmark=BenchmarkQuery,commit=3f2a9c1d...,host=ci-7 ns_per_op=61234i,best_ns_per_op=60100i,factor=1.0189,status="OK" 1452697445000000000. Benchmarks without a best have no best_ns_per_op and factor, and missing ones are left out. The points are appended to the file, or POSTed to the url if it's an http(s) one, e.g. http://influx:8086/api/v2/write?org=o&bucket=b&precision=ns, authenticating with "Token $INFLUX_TOKEN" if it's set.
+
+-notify url: POSTs a notification to the url when the run fails, e.g. because of regressions or missing benchmarks, and nothing when it passes. With -notifyFormat json (the default) the notification is the JSON summary of -json; with -notifyFormat slack it's a message for a Slack incoming webhook (or any webhook taking the same {"text": ...}), with the summary followed by a line for every regression and missing benchmark.
+
+-promFile file, -pushgateway url: Export the results of the run as Prometheus gauges, the same ones as the /metrics of rebench serve: rebench_ns_per_op{package,benchmark}, rebench_best_ns_per_op{package,benchmark}, rebench_regressions{package} and rebench_missing_benchmarks{package}. -promFile writes them to the file for the textfile collector of the node exporter, replacing it in one go, and -pushgateway pushes them to the Pushgateway at the url under the job rebench, replacing whatever the previous run pushed.
+
+-template file: Renders the results with the Go text/template in the file, on stdout or into the file given by -templateOut, so reports can take whatever shape is wanted without waiting for a built-in format. The template is executed with the whole run:
+
+	.Runs: The packages, each with a .Package import path, a .Table of its aligned comparison, its .Owners with -codeowners, and its .Results. Each result has a .Name, .Speed and .BestSpeed in ns/op, the .Factor between them, and a .Status of "OK", "SLOW", "RECORD", "NEW" or "MISSING".
+	.Runs also have the .Metrics besides ns/op, each with a .Name, .Unit, .Value, .Best, .Factor and .Status (see -config).
+	.Runs also have the .WallTime go test took to benchmark the package, the .PreviousWallTime of the run before (zero if unknown), and the aligned .Matrix with -matrix.
+	.Runs also have the .Geomean of their factors, their performance .Index and the .PreviousIndex of the run before, and the run as a whole has the weighted .Geomean, .Index and .PreviousIndex across packages.
+	.Missing, .TooSlow, .TooLong, .Mismatched and .Failed: Whether the run fails because benchmarks are missing, too slow, a package took too long to benchmark (see -wallTol), the bests were set in a different environment (see -strictEnv), or any of them.
+	.Revision: The git revision the run benchmarked, with its .Commit, .Branch, whether it was .Dirty, and the .Time of the run.
+	.Verdict, .Summary and .Markdown: The verdict ("passing" or "failing"), a one-line summary, and the summary with every comparison as Markdown.
+	.Count status: The number of benchmarks with the status.
+
+Templates can also use {{json value}} to encode any value as JSON (strings included, quotes and all), {{factor .Factor}} to format a factor like 1.52x, and {{speed .Speed}} to format a speed like the comparisons do (see -scaleUnits).
+
+-gerrit url: Reviews a change on the Gerrit server at the url with the verdict and the comparison of every package, voting +1 on -gerritLabel (default "Verified") when the run passes and -1 when it fails. The change and its revision are set with -gerritChange and -gerritRevision, which default to $GERRIT_CHANGE_NUMBER and $GERRIT_PATCHSET_REVISION (or "current") as set by Gerrit triggers in CI. Authenticates with the HTTP credentials in $GERRIT_USERNAME and $GERRIT_PASSWORD.
+
+-bitbucket: Attaches a Code Insights report with the verdict, the counts of slow, missing and record-breaking benchmarks, and an annotation per failing benchmark to a commit on Bitbucket Cloud. With -bitbucketPR, the comparison of every package is also posted as a comment on that pull request, which later runs update rather than adding new ones. The repository, commit and pull request default to $BITBUCKET_REPO_FULL_NAME, $BITBUCKET_COMMIT and $BITBUCKET_PR_ID as set by Bitbucket Pipelines, and can be set with -bitbucketRepo (as workspace/repo), -bitbucketCommit and -bitbucketPR. Authenticates with the access token in $BITBUCKET_TOKEN, or else the app password in $BITBUCKET_USERNAME and $BITBUCKET_APP_PASSWORD. -bitbucketAPI changes the API's base URL (default "https://api.bitbucket.org/2.0").
+
+-gitea url: Comments the verdict and the comparison of every package on pull request -giteaPR of repository -giteaRepo (as owner/repo) on the Gitea or Forgejo server at the url. Later runs update the same comment rather than adding new ones. Authenticates with the access token in $GITEA_TOKEN.
+
+-github-pr owner/repo#123: Comments the verdict and the comparison of every package on the GitHub pull request. Later runs update the same comment rather than adding new ones. Authenticates with the token in $GITHUB_TOKEN, which in GitHub Actions is the job's own token given pull-requests: write permission. -github-api url sets the API to comment through instead of https://api.github.com, e.g. https://github.example.com/api/v3 for GitHub Enterprise Server.
+
+-gitlab-mr group/project!123: Comments the verdict and the comparison of every package on the GitLab merge request, as a note later runs update rather than adding new ones. Authenticates with the access token in $GITLAB_TOKEN, which needs the api scope. -gitlab-api url sets the API to comment through instead of https://gitlab.com/api/v4, e.g. https://gitlab.example.com/api/v4 for a self-managed instance.
+
+-gitlab-metrics file, -gitlab-codequality file: Write artifacts for the merge request widget. -gitlab-metrics writes the ns/op and the factor against its best of every benchmark as a metrics report, e.g. rebench_ns_per_op{package="example.com/mod",benchmark="BenchmarkA"} 1200, along with the weighted geomean, which GitLab compares with those of the target branch. -gitlab-codequality writes every SLOW and MISSING benchmark that fails the run as an issue of a code quality report, located at the import path of its package. Declare them in .gitlab-ci.yml under artifacts:reports:metrics and artifacts:reports:codequality.
+
+-post url: POSTs the output of the Go text/template in the file given by -postTemplate to the url, for review systems and other services without built-in support. The Content-Type is set with -postContentType (default "application/json"), and the Authorization header is set to $REBENCH_POST_AUTHORIZATION if it isn't empty. The template is executed with the same data as with -template.
+
+A list of commands:
+
+history: Prints every run of the benchmark with the given full name kept with -history, oldest first, with the time, revision, package and speed of each. Reads .rebench_history.jsonl in the current directory, or the file given with -file, and only the runs of one package with -package path.
+
+review: Reviews the latest runs of every package beneath -root (default "."), including those in a -monorepo store at the root, at a line-oriented prompt on the terminal. Lists every benchmark with its status, latest speed, best and factor as judged with -speedTol and -recordTol, numbered, then reads one command per line until q or the end of the input: s sorts by factor, worst first (missing benchmarks first of all), or back by package and name; a N accepts the latest speed of benchmark N as its best, like rebench accept for that benchmark alone; r N re-runs benchmark N once and compares it with its best without recording anything; h N shows the runs of benchmark N in its package in the history kept with -history (.rebench_history.jsonl at the root, or -file); l lists the benchmarks again; q quits. For local performance work, between runs. -perBranch, -mainBranch and -env review and accept into the bests of the current branch or of the environment, as with accept.
+
+run: Runs the benchmarks and compares them with the best on record, as rebench does without a command. The flags of a run go after it, e.g. rebench run -bench=Parse.
+
+packages: The packages to benchmark, after every flag of the run, e.g. rebench ./pkg/parser/... ./pkg/lexer or rebench run -bench=Parse all, as given to go test. The default is ./..., every package beneath the directory of invocation. Only the packages benchmarked are compared and have their records written, the others are left as they are. Without run or record, a package must have a . or / in it to tell it apart from a command.
+
+record: Runs the benchmarks like run, but records every one of them as the best however it compares, without failing. Use it to accept a regression on purpose, or after moving to another machine.
+
+compare: Compares two record files without running anything, e.g. a .bench_best.json with one from another machine, treating the first like the best on record with -speedTol and -recordTol. Prints the verdict followed by the comparison, or everything as Markdown with -markdown, and exits with status 3 if the second is missing benchmarks and 4 if it is slower, like a run. The other metrics of the records are compared below the speeds, judged by the units of the config file. The groups and tolerances of the config file apply, those of a package with -package path. For looking into the records archived by CI after the fact, -o file also writes what's printed to the file, and the reporting flags given before compare send the comparison wherever they would a run's, e.g. rebench -junit report.xml compare old.json new.json, with the revision kept in the second record as that of the run.
+
+show: Prints the best on record and the latest results of every package beneath -root (default "."), including those in a -monorepo store at the root.
+
+reset: Forgets the best on record of the benchmarks matching -bench (default ".", i.e. every benchmark) in every package beneath -root (default "."), including those in a -monorepo store at the root, so the next run records them afresh.
+
+accept: Makes the latest run of every package beneath -root (default ".") its best on record, including in a -monorepo store at the root: every benchmark in .bench_results.json matching -bench (default ".") replaces its best, along with its metrics, distribution, revision and environment, and the benchmarks the run didn't have keep theirs. This is how bests change with -acceptOnly, after the run has been looked at. With -perBranch, -mainBranch and -env as given to the run, it accepts into the bests of the current branch or of the environment, starting from the main branch's for a branch without bests of its own yet.
+
+prune: Drops the benchmarks that the latest run of each package beneath -root (default ".") didn't have from its best on record, including in a -monorepo store at the root, so benchmarks that were deleted on purpose stop being reported missing. Only run it after running every benchmark, as benchmarks left out with -bench are pruned too.
+
+resign: Checksums every record beneath -root (default ".") again, including those in a -monorepo store at the root and the backups and baselines, with $REBENCH_CHECKSUM_KEY if it's set, whatever their checksums were. Run it after setting or changing the key, so the records written before are signed with it, or after editing a record by hand on purpose.
+
+import: Makes the benchmarks in the files given (or stdin for -), in the Go benchmark format printed by go test -bench and read by benchstat, the best on record of their packages, e.g. to start from results kept before rebench. Every benchmark in the files replaces its best, and the others keep theirs, as with accept; with -results they're the latest results of their packages instead, replacing them. Benchmarks are kept by the package in the pkg: line above them, in its directory if go list knows it and beneath -root (default ".") by import path otherwise, where benchmarks without a pkg: line are kept too. The files replaced are backed up in .old files first. The -count runs of a benchmark make it their median, with their distribution.
+
+export: Prints the best on record of every package beneath -root (default "."), including those in a -monorepo store at the root, in the Go benchmark format, or their latest results with -results, so benchstat and the rest of golang.org/x/perf can read them, e.g. rebench export > old.txt. Each package starts with the goos, goarch and cpu of its environment, when known, and a pkg: line with its import path, or its path beneath -root if go list doesn't know it. Every metric a benchmark has on record follows its ns/op, and since the iterations go test ran aren't on record, every benchmark is given 1.
+
+merge: Merges record files, e.g. the .bench_results.json of every CI shard that ran part of the suite, into a single record written to -o (stdout by default), which can then be made the best on record or compared with rebench compare. A benchmark in a single record is kept as it is. One in several is resolved with -resolve: min (the default) keeps the fastest with its metrics and distribution, mean keeps the mean of its ns/op and of each of its metrics, and host keeps every record's apart, as a sub-benchmark tagged with the record's file name without extension, e.g. BenchmarkQuery/host=ci-2 from ci-2.json, for which every benchmark is tagged. Records with the same file name in different directories are tagged apart by giving each as tag=file, e.g. rebench merge -resolve host ci-1=shard1/.bench_results.json ci-2=shard2/.bench_results.json, and merging two records with the same tag fails. The revision and environment of the records are kept if they all agree, and left out otherwise.
+
+badge: Writes a shields-style SVG badge of the latest run to -o (stdout by default), e.g. rebench badge -o bench.svg, so a README can show how its benchmarks are doing like it shows whether it builds. The badge reads "bench: OK" when the weighted performance index across packages of the latest run (see -geomeanTol) is no slower than that of the fastest run on record, and "bench: +2.3% vs best" otherwise, in yellow, or in red beyond -geomeanTol when it's given before badge. The indexes are read from .bench_geomean_repo.json in the directory of invocation, or from the file given by -file, e.g. .rebench/geomean.json with -monorepo.
+
+serve: Starts an HTTP server publishing the benchmark status of the packages beneath -root (default "."), listening on -addr (default ":8080"). A project is any directory beneath the root, and its status covers every package inside it that rebench has run in. The latest run of a package is judged by comparing .bench_results.json with the best on record before that run (.bench_best.json.old) using -speedTol. Endpoints:
+
+	/status/<project>: JSON with the verdict of the latest runs ("passing", "failing" or "unknown") and the worst regression among them.
+	/badge/<project>.svg: An SVG badge showing the same verdict, for embedding in READMEs and status pages.
+	/metrics: The latest ns/op and best ns/op of every benchmark, and the number of regressions and missing benchmarks in every package, as Prometheus gauges.
+	/: A web dashboard listing every project with its verdict, linking to the dashboard of each.
+	/dashboard/<project>: The latest run of every package of the project, with the regressions among them first and a chart of each benchmark's runs in the project's history (see -push).
+	/api/results/<project>/<package>: PUT the results of a run of a package (as in .bench_results.json) to make them its latest run and append them to the project's history. Sent by -push.
+	/api/bests/<project>/<package>/<file>: GET or PUT the best on record of a package, in .bench_best.json or the file of a branch with -perBranch. Read by -pull and written by -push.
+	/api/history/<project>: JSON with every run in the project's history, oldest first, or only the runs of a package with ?package=<import path>.
+
+Uploads are kept beneath -root like the records rebench writes itself, and need the bearer token -token (default $REBENCH_STORE_TOKEN). Without a token, every upload is refused, so a server reachable by anyone can't have its bests overwritten.
+
+install-hook: Installs a git hook in the current repository that runs rebench, with the given -speedTol and -recordTol, on a fast subset of the benchmarks. The only hook supported is pre-push, which blocks the push when a benchmark regresses or goes missing. The subset is chosen with -bench (default ".") and -benchtime (default "100ms"). With -gateChanged, the hook only blocks on benchmarks covering code changed since the upstream of the branch being pushed, as in rebench -gateChanged=@{upstream}. An existing hook that wasn't installed by rebench is only replaced with -force. Setting REBENCH_SKIP=1 in the environment (or git push --no-verify) bypasses the hook.
+
+diff: Compares two named baselines (see -baseline) of every package beneath -root (default ".") without running anything, e.g. rebench diff v1.3.0 v1.4.0, treating the older baseline like the best on record with -speedTol and -recordTol. Packages in a -monorepo store at the root are compared too. Prints the verdict followed by each package's comparison, or everything as Markdown with -markdown, for the performance section of release notes.
+
+diff -git: Compares two git refs instead, e.g. rebench diff -git main HEAD. Each ref is checked out in a temporary git worktree, leaving the working tree alone, and the benchmarks matching -bench (default ".") of every package beneath the directory of invocation run there -count times (default 5), with -benchtime if set. The speeds at both refs are printed side by side like benchstat does, with the variation of their runs and the change between them, which is ~ when it isn't significant (see -alpha, default 0.05). Nothing is recorded at either ref. As the worktrees are outside GOPATH, only a Go module can be compared this way, and diff -git fails with exit code 1 elsewhere: a GOPATH project can save a baseline at each ref with -baseline and compare those instead.
+
+pre-commit: A mode for the pre-commit framework (https://pre-commit.com). Only benchmarks the packages containing the given Go files, or the staged Go files when none are given, with -bench (default ".") and -benchtime (default "100ms"). No files are written; each package's comparison is printed on stdout in a stable order instead. The comparison is only reported unless -gate is given, in which case regressions and missing benchmarks fail the hook. -hooks-yaml prints the .pre-commit-hooks.yaml entry pointing the framework at this mode.
 `
 )
 
 func main() {
-	flag.Parse()
+	args, goTestArgs := splitGoTestArgs(os.Args[1:])
+	flag.CommandLine.Parse(args)
+
+	// A plain run is the run command, and record is a run too, so both take the flags of a run after the command.
+	// The packages to benchmark come last.
+	recordAll := false
+	var packages []string
+	if flag.Arg(0) == "run" || flag.Arg(0) == "record" {
+		recordAll = flag.Arg(0) == "record"
+		flag.CommandLine.Parse(flag.Args()[1:])
+		packages = flag.Args()
+	} else if isPackagePattern(flag.Arg(0)) {
+		packages = flag.Args()
+	}
 
 	if *help {
 		fmt.Println(helpMsg)
 		os.Exit(0)
 	}
 
-	if *quiet {
-		log.SetOutput(ioutil.Discard)
+	switch {
+	case *quiet:
+		logThreshold = levelError
+	case *veryVerbose:
+		logThreshold = levelTrace
+	case *verbose:
+		logThreshold = levelDebug
+	}
+	if *logFormat != logText && *logFormat != logJSON {
+		fmt.Fprintln(os.Stderr, "-log-format must be text or json")
+		os.Exit(exitError)
+	}
+	jsonLog = *logFormat == logJSON
+
+	if *fileMode != "" {
+		perm, err := strconv.ParseUint(*fileMode, 8, 32)
+		if err != nil || perm > 0777 {
+			fmt.Fprintln(os.Stderr, "Invalid -fileMode", *fileMode+", expected octal mode bits such as 0640")
+			os.Exit(exitError)
+		}
+		filePerm, exactPerm = os.FileMode(perm), true
+	}
+	durable = *durableWrites
+	// go test -cpu tells its runs apart by the suffix alone, and takes the -cpu after -- over that of rebench
+	cpu := *cpuList
+	if list := goTestCPUList(goTestArgs); list != "" {
+		cpu = list
+	}
+	trimProcs = !*keepProcs && cpu == ""
+	if cpu != "" {
+		runProcs = parseProcs(cpu)
+	}
+	matrixRefs, err := parseReferences(*matrixList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+	if *resultOrder != orderName && *resultOrder != orderFactor && *resultOrder != orderDelta {
+		fmt.Fprintln(os.Stderr, "-sort must be name, factor or delta")
+		os.Exit(exitError)
+	}
+	if *against != againstBest && *against != againstLast && *against != againstBoth {
+		fmt.Fprintln(os.Stderr, "-against must be best, last or both")
+		os.Exit(exitError)
 	}
-	os.Exit(rebench(*speedTolPercent, *recordTolPercent))
+	if (*perBranch || *envKey != "") && *monorepo {
+		fmt.Fprintln(os.Stderr, "-perBranch and -env aren't supported with -monorepo")
+		os.Exit(exitError)
+	}
+	if *driftTolPercent > 0 && *driftRuns < 2 {
+		fmt.Fprintln(os.Stderr, "-driftRuns must be at least 2, the run and one before it")
+		os.Exit(exitError)
+	}
+	if (*outDir != "" || *bestFileName != "") && *monorepo {
+		fmt.Fprintln(os.Stderr, "-outDir and -bestFile aren't supported with -monorepo, which keeps every record in its store")
+		os.Exit(exitError)
+	}
+	if *bestFileName != "" && *perBranch {
+		fmt.Fprintln(os.Stderr, "-bestFile isn't supported with -perBranch, which names the file of each branch")
+		os.Exit(exitError)
+	}
+	if *perBranch {
+		main, err := resolveMainBranch(*mainBranch)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		*mainBranch = main
+	}
+	if strings.ContainsAny(*bestFileName, `/\`) || *reportFile != "-" && strings.ContainsAny(*reportFile, `/\`) {
+		fmt.Fprintln(os.Stderr, "-bestFile and -reportFile must be file names, use -outDir for where they're kept")
+		os.Exit(exitError)
+	}
+	var bestStore remoteStore
+	if *bestStoreURL != "" {
+		if *monorepo {
+			fmt.Fprintln(os.Stderr, "-bestStore isn't supported with -monorepo")
+			os.Exit(exitError)
+		}
+		if bestStore, err = newRemoteStore(*bestStoreURL); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+	var push, pull *apiClient
+	if (*pushURL != "" || *pullURL != "") && (*monorepo || bestStore != nil) {
+		fmt.Fprintln(os.Stderr, "-push and -pull aren't supported with -monorepo or -bestStore")
+		os.Exit(exitError)
+	}
+	if *pushURL != "" {
+		if push, err = newAPIClient(*pushURL, *projectName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+	if *pullURL != "" {
+		if pull, err = newAPIClient(*pullURL, *projectName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		bestStore = pull.bests()
+	}
+	profile, records := *profileDir, *outDir
+	if profile != "" {
+		if profile, err = filepath.Abs(profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+	if records != "" {
+		if records, err = filepath.Abs(records); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+	if *baselineName != "" {
+		if err := validBaselineName(*baselineName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+	if *reportFormat != formatText && *reportFormat != formatMarkdown {
+		fmt.Fprintln(os.Stderr, "-format must be text or markdown")
+		os.Exit(exitError)
+	}
+	// Pull request comments read best as tables
+	markdownEmoji = *emoji || *reportFormat == formatMarkdown
+	numbers = numberFormat{sigDigits: *sigDigits, thousands: *thousands, scale: *scaleUnits}
+	colorOutput = isTerminal(os.Stdout) && !*noColor && os.Getenv("NO_COLOR") == ""
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+	// The command line has the last word
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if cfg.SpeedTol > 0 && !given["speedTol"] {
+		*speedTolPercent = cfg.SpeedTol
+	}
+	if cfg.RecordTol > 0 && !given["recordTol"] {
+		*recordTolPercent = cfg.RecordTol
+	}
+	if cfg.MinNs > 0 && !given["minNs"] {
+		*minNs = cfg.MinNs
+	}
+	if cfg.AcceptOnly && !given["acceptOnly"] {
+		*acceptOnly = true
+	}
+	if cfg.Cmd != "" && !given["cmd"] {
+		*benchCommand = cfg.Cmd
+	}
+	if *benchCommand != "" && (*rerunTimes > 0 || *profileDir != "") {
+		fmt.Fprintln(os.Stderr, "-rerun and -profile aren't supported with -cmd, which can't run a single benchmark")
+		os.Exit(exitError)
+	}
+	if *inputFile != "" && (*benchCommand != "" || *rerunTimes > 0 || *profileDir != "" || *warmup > 0 || *changedOnly) {
+		fmt.Fprintln(os.Stderr, "-cmd, -rerun, -profile, -warmup and -changed aren't supported with -input, which runs nothing")
+		os.Exit(exitError)
+	}
+	if *minNs < 0 {
+		fmt.Fprintln(os.Stderr, "-minNs must not be negative")
+		os.Exit(exitError)
+	}
+
+	if flag.NArg() > 0 && packages == nil {
+		switch flag.Arg(0) {
+		case "serve":
+			os.Exit(serve(flag.Args()[1:], *speedTolPercent, *recordTolPercent))
+		case "install-hook":
+			os.Exit(installHook(flag.Args()[1:], *speedTolPercent, *recordTolPercent))
+		case "pre-commit":
+			os.Exit(preCommit(flag.Args()[1:], *speedTolPercent, *recordTolPercent))
+		case "diff":
+			os.Exit(diff(flag.Args()[1:], *speedTolPercent, *recordTolPercent))
+		case "compare":
+			reporters, err := configuredReporters()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(exitError)
+			}
+			os.Exit(compareFiles(flag.Args()[1:], *speedTolPercent, *recordTolPercent, *minNs, cfg, reporters))
+		case "show":
+			os.Exit(show(flag.Args()[1:]))
+		case "reset":
+			os.Exit(reset(flag.Args()[1:]))
+		case "prune":
+			os.Exit(prune(flag.Args()[1:]))
+		case "accept":
+			os.Exit(accept(flag.Args()[1:]))
+		case "resign":
+			os.Exit(resign(flag.Args()[1:]))
+		case "import":
+			os.Exit(importBenchmarks(flag.Args()[1:]))
+		case "export":
+			os.Exit(exportBenchmarks(flag.Args()[1:]))
+		case "merge":
+			os.Exit(merge(flag.Args()[1:]))
+		case "badge":
+			os.Exit(badge(flag.Args()[1:], float64(*geomeanTolPercent)/100))
+		case "history":
+			os.Exit(history(flag.Args()[1:]))
+		case "review":
+			os.Exit(reviewLatest(flag.Args()[1:], *speedTolPercent, *recordTolPercent))
+		default:
+			fmt.Fprintln(os.Stderr, "Unknown command", flag.Arg(0)+", run rebench -help for usage")
+			os.Exit(exitError)
+		}
+	}
+
+	cfg.Units = withDefaultUnits(cfg.Units)
+	if *benchmem {
+		cfg.Units = withMemoryUnits(cfg.Units, *bytesTolPercent, *allocsTolPercent)
+	}
+
+	reporters, err := configuredReporters()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+
+	// Dry runs write nothing, so they don't get in anyone's way
+	var lock *runLock
+	if !*noLock && !*dryRun {
+		// Packages are benchmarked in their own directories, so the lock is made absolute up front
+		lockDir, err := filepath.Abs(".")
+		if records != "" {
+			lockDir, err = records, mkdirAll(records)
+		}
+		if err == nil {
+			lock, err = acquireLock(lockDir, *lockWait)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+
+	// Whatever machine ran the benchmarks of -input, it needn't be this one
+	var unstable []string
+	if *inputFile == "" {
+		unstable = machineWarnings("/", runtime.NumCPU())
+	}
+	code := rebench(runOptions{
+		speedTolPercent:   *speedTolPercent,
+		recordTolPercent:  *recordTolPercent,
+		minNs:             *minNs,
+		rerun:             *rerunTimes,
+		confirmRecords:    *confirmRecords,
+		acceptOnly:        *acceptOnly,
+		readOnly:          *dryRun,
+		bench:             *benchFilter,
+		benchtime:         *benchtime,
+		cpu:               *cpuList,
+		run:               *testRun,
+		timeout:           *testTimeout,
+		runTimeout:        *runTimeout,
+		tags:              *buildTags,
+		goTestArgs:        goTestArgs,
+		packages:          packages,
+		benchmem:          *benchmem,
+		count:             *count,
+		warmup:            *warmup,
+		command:           *benchCommand,
+		input:             *inputFile,
+		alpha:             *alpha,
+		gateChanged:       *gateChanged,
+		changed:           *changedOnly,
+		codeowners:        *useCodeowners,
+		wallTolPercent:    *wallTolPercent,
+		driftTolPercent:   *driftTolPercent,
+		geomeanTolPercent: *geomeanTolPercent,
+		driftRuns:         *driftRuns,
+		archive:           *archiveDir,
+		raw:               *keepRaw,
+		profile:           profile,
+		outDir:            records,
+		bestFile:          *bestFileName,
+		comparisonFile:    *reportFile,
+		monorepo:          *monorepo,
+		against:           *against,
+		perBranch:         *perBranch,
+		history:           *keepHistory,
+		noise:             *noiseModelling,
+		strictEnv:         *strictEnv,
+		envKey:            *envKey,
+		stableOnly:        *stableOnly,
+		unstable:          unstable,
+		mainBranch:        *mainBranch,
+		bestStore:         bestStore,
+		pulled:            pull != nil,
+		push:              push,
+		record:            recordAll,
+		baseline:          *baselineName,
+		matrix:            matrixRefs,
+		units:             cfg.Units,
+		weights:           cfg.Weights,
+		groups:            cfg.Groups,
+		tolerances:        cfg.toleranceConfig,
+		renames:           cfg.Renames,
+		ignore:            cfg.ignore,
+		reporters:         reporters,
+	})
+	if lock != nil {
+		lock.release()
+	}
+	os.Exit(code)
 }
 
-//
-func rebench(speedTolPercent, recordTolPercent int) int {
-	record, err := runAndStoreBenches()
+// Controls a single run of the benchmarks
+type runOptions struct {
+	speedTolPercent, recordTolPercent int
+	minNs                             int      // The noise floor in ns/op, see -minNs
+	rerun                             int      // How many times slow benchmarks are re-run before failing on them
+	confirmRecords                    int      // How many consecutive runs a new best takes, 1 to set it right away
+	bench                             string   // Passed to go test -bench
+	benchtime                         string   // Passed to go test -benchtime unless empty
+	benchmem                          bool     // Passes -benchmem to go test
+	count                             int      // Passed to go test -count when above 1
+	warmup                            int      // How many times the benchmarks run before the run that counts
+	command                           string   // The shell command run rather than go test unless empty, see -cmd
+	input                             string   // The file of captured go test output read rather than running anything unless empty, see -input
+	alpha                             float64  // The p-value below which changes are significant with -count
+	packages                          []string // The packages to benchmark, ./... when empty
+	gateChanged                       string   // Only gates on packages covering changes since this git ref unless empty
+	codeowners                        bool     // Names the owners of packages with regressions according to CODEOWNERS
+	wallTolPercent                    int      // Fails packages taking this much longer to benchmark than in their previous run, unless 0
+	driftTolPercent, driftRuns        int      // Fails benchmarks this much slower than driftRuns runs ago in the history file, unless 0
+	geomeanTolPercent                 int      // Fails packages, and the run, whose geomean of New/Best is above this, unless 0
+	archive                           string   // Saves the raw go test output in a timestamped file in this directory unless empty
+	raw                               bool     // Keeps the lines of the results of every package as printed, see -raw
+	profile                           string   // Saves CPU and memory profiles of slow benchmarks in this absolute directory unless empty
+	outDir                            string   // Keeps the records of every package beneath this absolute directory rather than in its own unless empty
+	bestFile                          string   // The name of the file of the bests, mainBestFile when empty
+	comparisonFile                    string   // The name of the file of the comparison, bench_comparison.txt when empty, or - for stdout
+
+	// Writes no files at all, printing each package's comparison on stdout instead
+	readOnly bool
+	// Exits with status 0 even when benchmarks are missing or too slow
+	reportOnly bool
+	// Records every benchmark of the run as the best, however it compares
+	record bool
+	// Passed to go test -cpu, -timeout and -tags unless empty
+	cpu, timeout, tags string
+	// Passed to go test -run, no test at all if empty
+	run string
+	// Only benchmarks the packages changed since their latest results, see -changed
+	changed bool
+	// Stops go test after this long unless 0, see errRunStopped
+	runTimeout time.Duration
+	// Passed to go test as they are after every other flag, see --
+	goTestArgs []string
+	// Leaves the best on record as it is unless record is set, see rebench accept
+	acceptOnly bool
+	// Get sent the results once every package has been compared
+	reporters []reporter
+	// Also saves the benchmarks of every package as the baseline of this name unless empty
+	baseline string
+	// Also compares the run with each of these references (best, last, or a baseline) in a matrix
+	matrix []string
+	// How the metrics besides ns/op are judged, keyed by unit
+	units map[string]unitConfig
+	// Groups of benchmarks with tolerances and gating of their own
+	groups []benchGroup
+	// The benchmarks that never fail the run
+	ignore ignoreList
+	// The tolerances of benchmarks and packages set in the config file
+	tolerances toleranceConfig
+	// The new names of renamed benchmarks, keyed by their old names
+	renames map[string]string
+	// How much each package weighs in the weighted geomean, by import path or pattern
+	weights map[string]float64
+	// Keeps every record in a single store and processes packages as go test finishes them, for huge repositories
+	monorepo bool
+	// What the run is compared with, the best on record unless it's againstLast or againstBoth
+	against string
+	// Appends the results of every package to the history file
+	history bool
+	// Widens the tolerances of benchmarks by their noise across the history file
+	noise bool
+	// Fails the run when the bests were set in a different environment
+	strictEnv bool
+	// Keeps the bests of this environment apart from every other's unless empty, see -env
+	envKey string
+	// What about the machine makes speeds unstable, see machineWarnings, and whether the bests are left alone if anything
+	unstable   []string
+	stableOnly bool
+	// Keeps the best of every branch but mainBranch apart, see -perBranch
+	perBranch  bool
+	mainBranch string
+	// Keeps the best of every package there rather than in its directory unless nil, see -bestStore
+	bestStore remoteStore
+	// Whether bestStore is the API of a rebench serve, which bests are only read from, see -pull
+	pulled bool
+	// Uploads the results and bests of every package to the API of a rebench serve unless nil, see -push
+	push *apiClient
+}
+
+func rebench(opts runOptions) int {
+	if opts.changed {
+		lastCommit := resultsCommit
+		if opts.outDir != "" {
+			lastCommit = func(pkgPath, dir string) string {
+				return resultsCommit(pkgPath, recordsDir(opts.outDir, pkgPath))
+			}
+		}
+		if opts.monorepo {
+			store := packageStore{root: monorepoStoreDir}
+			lastCommit = func(pkgPath, dir string) string {
+				if rec, _ := store.load(pkgPath); rec.Revision != nil {
+					return rec.Revision.Commit
+				}
+				return ""
+			}
+		}
+		packages, err := changedSinceRecords(opts.packages, lastCommit)
+		if err != nil {
+			logError("Cannot list the packages with go list:", err, "aborting!")
+			return exitGoTest
+		}
+		if len(packages) == 0 {
+			logInfo("Nothing changed since the latest results of any package, nothing to do!")
+			return exitOK
+		}
+		logInfo("Only benchmarking the", len(packages), "packages changed since their latest results")
+		opts.packages = packages
+	}
+
+	j, err := newJudge(opts)
 	if err != nil {
-		log.Println(err, "aborting!")
-		return -1
+		logError(err)
+		return exitError
+	}
+	if opts.monorepo {
+		return rebenchMonorepo(j)
+	}
+
+	outputs, err := runAndStoreBenches(opts)
+	stopped, failed := err == errRunStopped, err == errPackagesFailed
+	if err != nil && !stopped && !failed {
+		logError(err, "aborting!")
+		return exitGoTest
+	}
+	if len(outputs) == 0 && stopped {
+		logError("go test was stopped before finishing any package, aborting!")
+		return exitGoTest
+	}
+	if len(outputs) == 0 && failed {
+		logError("go test failed in every package with benchmarks, aborting!")
+		return exitGoTest
 	}
-	if len(record) == 0 {
-		log.Println("Nothing to do! No benchmarks!")
+	if len(outputs) == 0 {
+		logInfo("Nothing to do! No benchmarks!")
 		return 0
 	}
-	var gosrc string
 	pwd, err := os.Getwd()
 	if err != nil {
-		log.Fatalln("can't get pwd, exiting:", err.Error())
+		logError("can't get pwd, exiting:", err.Error())
+		return exitError
 	}
 
-	speedTol := float64(speedTolPercent) / 100
-	recordTol := float64(recordTolPercent) / 100
+	pkgPaths := make([]string, 0, len(outputs))
+	for pkgPath := range outputs {
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
 
-	for key, _ := range record {
-		gosrc = findGosrc(pwd, key)
-		if gosrc == "" {
-			log.Fatalln("Cannot isolate go source directory (GOPATH/src) given the directory of invocation and go test -bench output. Perhaps you're using symbolic links? Aborting")
-		}
+	// go list knows where every package is, whatever the layout: GOPATH, a module, or a module nested in another
+	patterns := opts.packages
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dirs, err := discoverPackages(patterns)
+	if err != nil && opts.command == "" && opts.input == "" {
+		logError("Cannot list the directories of the packages with go list:", err, "aborting!")
+		return exitGoTest
+	}
 
-		break
+	bestFile, comparisonFile := mainBestFile, opts.comparisonFile
+	if opts.bestFile != "" {
+		bestFile = opts.bestFile
+	}
+	if comparisonFile == "" {
+		comparisonFile = defaultComparisonFile
+	}
+	if opts.perBranch {
+		bestFile = branchBestFile(j.revision.Branch, opts.mainBranch)
+		logInfo("Keeping the best benchmarks of branch", j.revision.Branch, "in", bestFile)
+	}
+	if opts.envKey != "" {
+		bestFile = envBestFile(bestFile, opts.envKey)
+		logInfo("Keeping the best benchmarks of environment", opts.envKey, "in", bestFile)
 	}
-	log.Println("Found gosrc (GOPATH/src) as", gosrc, "\n")
 
-	var missing, tooSlow bool
-	for pkgPath, benches := range record {
-		log.Println("Working in package", pkgPath)
-		err := os.Chdir(reform(gosrc, pkgPath))
-		if err != nil {
-			log.Println("Cannot enter the directory for the package", pkgPath, "("+gosrc+"/"+pkgPath+"), ignoring")
+	var report runReport
+	untrusted := false
+	repoGeomean := reform(pwd, repoGeomeanFile)
+	for _, pkgPath := range pkgPaths {
+		out := outputs[pkgPath]
+		benches := out.benches
+		logInfo("Working in package", pkgPath)
+		dir, ok := dirs[pkgPath]
+		if !ok && (opts.command != "" || opts.input != "") {
+			// Whatever built the benchmarks of a -cmd or -input knows where they are, but go list needn't
+			dir = recordsDir(pwd, pkgPath)
+			logInfo("go list doesn't know the directory of the package", pkgPath+", keeping its records in", dir)
+			if err := mkdirAll(dir); err != nil {
+				logError("Cannot create the directory for the records of", pkgPath, "("+dir+"), ignoring")
+				continue
+			}
+		} else if !ok {
+			logWarn("go list doesn't know the directory of the package", pkgPath+", ignoring")
+			continue
+		}
+		records := dir
+		if opts.outDir != "" {
+			records = recordsDir(opts.outDir, pkgPath)
+			if err := mkdirAll(records); err != nil {
+				logError("Cannot create the directory for the records of", pkgPath, "("+records+"), ignoring")
+				continue
+			}
+		}
+		if err := os.Chdir(records); err != nil {
+			logError("Cannot enter the directory for the package", pkgPath, "("+records+"), ignoring")
 			continue
 		}
 
-		log.Println("Checking for and loading best benchmarks")
-		// In the future may provide option to compare with the best,
-		// or just the previous run
-		oldBenches := unmarshallAndStoreBench(".bench_best.json")
-		delta, oldBenches, m, ts := compare(oldBenches, benches, pkgPath, speedTol, recordTol)
-		missing = missing || m
-		tooSlow = tooSlow || ts
-		backupMarshallAndStore(tabAlign(delta), benches, oldBenches)
-		log.Println()
+		logDebug("Checking for and loading best benchmarks")
+		refs := dirReferences(opts.matrix, bestFile)
+		var old benchRecord
+		if opts.bestStore != nil {
+			old, err = loadStoredRecord(opts.bestStore, pkgPath, bestFile)
+		} else {
+			old, err = loadBranchRecord(bestFile)
+		}
+		if err != nil {
+			logError("The best benchmarks of", pkgPath, "can't be loaded or trusted, leaving them as they are:", err)
+			untrusted = true
+			continue
+		}
+		history := packageHistory{wallTimes: loadWallTimes(wallTimeFile), geomeans: loadGeomeans(geomeanFile), last: loadRecord(".bench_results.json")}
+		v := j.judgePackage(out, dir, old, history, refs)
+		if !opts.readOnly {
+			results := benchRecord{benches: out.benches, metrics: out.metrics, stats: out.stats, revision: &j.revision, env: &j.env}
+			storedBest := bestFile
+			if j.keepsBests() || opts.bestStore != nil && !opts.pulled {
+				storedBest = ""
+			}
+			storedComparison := comparisonFile
+			if comparisonFile == "-" {
+				storedComparison = ""
+				if len(benches) > 0 || v.hasBest {
+					fmt.Printf("%s\n%s\n", pkgPath, colorize(v.run.Table))
+				}
+			}
+			backupMarshallAndStore(v.run.Table, storedBest, storedComparison, results, v.best)
+			if opts.raw && len(out.raw) > 0 {
+				storeRaw(out.raw)
+			}
+			if opts.bestStore != nil && !opts.pulled && !j.keepsBests() && len(v.best.benches) > 0 {
+				if err := saveStoredRecord(opts.bestStore, pkgPath, bestFile, v.best); err != nil {
+					logError("Couldn't save the best benchmarks of", pkgPath, "in the store:", err)
+				}
+			}
+			if opts.push != nil {
+				pushPackage(opts.push, pkgPath, bestFile, results, v.best, !j.keepsBests())
+			}
+			if v.run.WallTime > 0 && (len(benches) > 0 || v.hasBest) {
+				storeWallTimes(wallTimeFile, appendWallTime(history.wallTimes, v.run.WallTime))
+			}
+			if v.run.Index > 0 {
+				storeGeomeans(geomeanFile, appendIndex(history.geomeans, v.run.Index))
+			}
+			if opts.history && len(benches) > 0 {
+				if err := appendHistory(reform(pwd, historyFile), j.revision, out); err != nil {
+					logError("Couldn't append the results to the history:", err)
+				}
+			}
+			if opts.baseline != "" && len(benches) > 0 {
+				if err := saveBaseline(".", opts.baseline, benches); err != nil {
+					logError("Couldn't save the benchmarks as baseline", opts.baseline+":", err)
+				}
+			}
+		} else if len(benches) > 0 || v.hasBest {
+			fmt.Printf("%s\n%s\n", pkgPath, colorize(v.run.Table))
+		}
+		report.add(v)
+		logInfo()
 	}
 
-	exitCode := 0
-	if missing {
-		log.Println("Old benchmarks were missing, flagging with non-zero return")
-		exitCode = 1
+	code := j.finish(report, repoGeomean)
+	if untrusted {
+		logError("Some best benchmarks couldn't be loaded or don't match their checksums, they weren't judged nor overwritten, flagging with non-zero return")
+		return exitError
 	}
-
-	if tooSlow {
-		log.Println("New benchmarks are too slow, flagging with non-zero return")
-		exitCode = 1
+	if stopped {
+		logWarn("go test was stopped, only", len(outputs), "packages were judged, flagging with non-zero return")
+		return exitGoTest
+	}
+	if failed {
+		logWarn("go test failed in some of the packages, only", len(outputs), "packages were judged, flagging with non-zero return")
+		return exitGoTest
 	}
 
-	return exitCode
+	return code
 }
 
 // Compares old benchmarks and new benchmarks. If any old benchmarks are no longer present, it will return a false bool. Same if any benchmarks became noticeably slower (specified by
 // the argument speedTol). It will also record a new best if the new benchmark is faster than the specified recordTol and write it as the new best.
 //
 // May need to be rewritten to compare more things in the future.
-func compare(oldBenches, benches map[string]uint64, pkgPath string, speedTol, recordTol float64) (delta string, bestBenches map[string]uint64, missing bool, tooSlow bool) {
-	delta = "Benchmark Name\tNew Speed\tBest Speed\tFactor (New/Old)\n"
-	if oldBenches != nil {
-		var firstMissing bool
-		// Missing comparison
-		for key, speed := range oldBenches {
-			if _, ok := benches[key]; !ok {
-				if !firstMissing {
-					log.Print("Old benchmarks appear to be missing, is this intentional? List of missing benchmarks: ")
-					firstMissing = true
-					missing = true
-				}
-				log.Print(key + " ")
-				delta += fmt.Sprintf("%s\tMISSING\t%d\tN/A\n", key, speed)
-			}
+func compare(oldBenches, benches map[string]uint64, pkgPath string, speedTol, recordTol float64, minNs int, groups []benchGroup, ignore ignoreList, tols map[string]benchTolerances, stats statsComparison, reruns rerunner) (results []benchResult, bestBenches map[string]uint64, missing bool, tooSlow bool) {
+	results = classifyGroups(oldBenches, benches, speedTol, recordTol, groups, tols)
+	floorNoise(results, minNs, tols)
+	stats.filterNoise(results)
+	reruns.confirm(results, func(benches map[string]uint64) []benchResult {
+		rerun := classifyGroups(oldBenches, benches, speedTol, recordTol, groups, tols)
+		floorNoise(rerun, minNs, tols)
+		return rerun
+	})
+	if oldBenches == nil {
+		logInfo("No best benchmarks on record for this package, recording all current benchmarks (if any) as new best.")
+		oldBenches = make(map[string]uint64, len(benches))
+		for key, speed := range benches {
+			oldBenches[key] = speed
 		}
-		log.Println()
 
-		// Speed comparison
-		for benchName, speed := range benches {
-			if oldSpeed, ok := oldBenches[benchName]; !ok {
-				delta += fmt.Sprintf("%s\t%d\tMISSING\tN/A\n", benchName, speed)
-				log.Println("Benchmark", benchName, "appears to be new. Not comparing speed, but logging as new best for this benchmark.")
-				oldBenches[benchName] = speed
-				continue
+		return results, oldBenches, false, false
+	}
+
+	// Missing comparison
+	var missingNames []string
+	for i, res := range results {
+		if res.Status != statusMissing {
+			continue
+		}
+		if gates(groups, ignore, res.Name) {
+			missingNames = append(missingNames, res.Name)
+		} else {
+			results[i].Tolerated = true
+		}
+	}
+	if len(missingNames) > 0 {
+		logWarn("Old benchmarks appear to be missing, is this intentional? List of missing benchmarks:", strings.Join(missingNames, " "))
+		missing = true
+	}
+
+	// Speed comparison
+	for i, res := range results {
+		switch res.Status {
+		case statusNew:
+			logTrace("Benchmark", res.Name, "appears to be new. Not comparing speed, but logging as new best for this benchmark.")
+			oldBenches[res.Name] = res.Speed
+		case statusSlow:
+			logWarn("Benchmark", res.Name, "reports a speed", res.Factor, "as fast as the old version. This is slower than expected")
+			if gates(groups, ignore, res.Name) {
+				tooSlow = true
 			} else {
-				factor := float64(speed) / float64(oldSpeed)
-				delta += fmt.Sprintf("%s\t%d\t%d\t%f\n", benchName, speed, oldSpeed, factor)
-				if factor > speedTol {
-					log.Println("Benchmark", benchName, "reports a speed", factor, "as fast as the old version. This is slower than expected")
-					tooSlow = true
-				} else if factor < recordTol {
-					oldBenches[benchName] = speed
-					log.Println("Benchmark", benchName, "reports a speed", factor, "as fast as the old version. This is a new record according to your threshold!")
-				}
+				results[i].Tolerated = true
 			}
-		}
-	} else {
-		log.Println("No best benchmarks on record for this package, recording all current benchmarks (if any) as new best.")
-		oldBenches = make(map[string]uint64, len(benches))
-		for key, speed := range benches {
-			delta += fmt.Sprintf("%s\t%d\tNO FILE\tN/A\n", key, speed)
-			oldBenches[key] = speed
+		case statusRecord:
+			oldBenches[res.Name] = res.Speed
+			logInfo("Benchmark", res.Name, "reports a speed", res.Factor, "as fast as the old version. This is a new record according to your threshold!")
 		}
 	}
 
-	return delta, oldBenches, missing, tooSlow
+	return results, oldBenches, missing, tooSlow
 }
 
-// Goes through the 4-column delta and records the max character word in each column
-// Then it pads each column with exactly len(word in this column)-len(max word in this column)+4 spaces
-// (that is, the next column always starts at 4 spaces after the largest word in that column)
+// Lays out the results of compare as the delta written to bench_comparison.txt. hasBest tells apart new benchmarks
+// in a package with a best benchmarks file from benchmarks in a package without one.
 //
-// Could easily be, and probably will be, generalized for any string with a uniform number of columns
-func tabAlign(delta string) string {
-	rows := strings.Split(delta, "\n")
-
-	max := [4]int{}
-	for _, row := range rows {
-		cols := strings.Split(row, "\t")
-		if len(cols) != 4 {
-			continue
+// With sub-benchmarks, the benchmarks are laid out as a tree, every level of their names indented under the one above.
+func deltaTable(results []benchResult, hasBest bool) *table {
+	delta := newTable("Status", "Benchmark Name", "New Speed", "Best Speed", "Factor (New/Old)")
+	// Sorting by anything but name breaks up the tree of sub-benchmarks
+	results = sortedResults(results, *resultOrder)
+	tree := *resultOrder == orderName && hasSubBenchmarks(results)
+	if tree {
+		results = treeOrder(results)
+	}
+	prev := ""
+	for _, res := range results {
+		name := res.Name
+		if tree {
+			var headings []string
+			headings, name = treeNames(prev, res.Name)
+			for _, heading := range headings {
+				delta.addRow("", heading)
+			}
+			prev = res.Name
 		}
+		speed, best, factor := numbers.speed(res.Speed), numbers.speed(res.BestSpeed), numbers.factor(res.Factor)
+		switch {
+		case res.Status == statusMissing:
+			speed, factor = "MISSING", "N/A"
+		case res.Status == statusNew && !hasBest:
+			best, factor = "NO FILE", "N/A"
+		case res.Status == statusNew:
+			best, factor = "MISSING", "N/A"
+		}
+		delta.addRow(string(res.Status), name, speed, best, factor)
+	}
 
-		for i, str := range cols {
-			max[i] = intMax(max[i], len(str))
+	return delta
+}
+
+// The verdict on a single benchmark once it has been compared with its best on record.
+type benchStatus string
+
+const (
+	statusOK      benchStatus = "OK"
+	statusSlow    benchStatus = "SLOW"
+	statusRecord  benchStatus = "RECORD"
+	statusNew     benchStatus = "NEW"
+	statusMissing benchStatus = "MISSING"
+)
+
+// A single row of a comparison. Speed is zero for a missing benchmark, BestSpeed and Factor are zero for a new one.
+type benchResult struct {
+	Name      string
+	Speed     uint64
+	BestSpeed uint64
+	Factor    float64
+	Status    benchStatus
+	Group     string  // The group of the benchmark in the config file, if any
+	Noise     float64 // The coefficient of variation of its speed across the history, with -noise
+	Tolerated bool    // Slow or missing without failing the run: report only, ignored, or not gated by -gateChanged
+}
+
+// Classifies every benchmark in either set against the tolerances without touching either map or logging anything,
+// so the same verdicts can be reused by anything that needs to judge a run after the fact (e.g. the server).
+//
+// Missing benchmarks come first, then the benchmarks of the new run, each group sorted by name.
+func classify(oldBenches, benches map[string]uint64, speedTol, recordTol float64) []benchResult {
+	return classifyGroups(oldBenches, benches, speedTol, recordTol, nil, nil)
+}
+
+// Classifies like classify, with the tolerances of the group each benchmark is in, unless the benchmark has
+// tolerances of its own
+func classifyGroups(oldBenches, benches map[string]uint64, speedTol, recordTol float64, groups []benchGroup, tols map[string]benchTolerances) []benchResult {
+	results := make([]benchResult, 0, len(benches))
+	for _, name := range sortedNames(oldBenches) {
+		if _, ok := benches[name]; !ok {
+			res := benchResult{Name: name, BestSpeed: oldBenches[name], Status: statusMissing}
+			if g := groupOf(groups, name); g != nil {
+				res.Group = g.Name
+			}
+			results = append(results, res)
 		}
 	}
 
-	aligned := make([]string, len(rows))
-	for r, row := range rows {
-		cols := strings.Split(row, "\t")
-		if len(cols) != 4 {
+	for _, name := range sortedNames(benches) {
+		res := benchResult{Name: name, Speed: benches[name]}
+		g := groupOf(groups, name)
+		if g != nil {
+			res.Group = g.Name
+		}
+		oldSpeed, ok := oldBenches[name]
+		if !ok {
+			res.Status = statusNew
+			results = append(results, res)
 			continue
 		}
 
-		str := cols[0]
-		for i := 0; i < len(cols)-1; i++ {
-			str += strings.Repeat(" ", max[i]-len(cols[i])+4)
-			str += cols[i+1]
+		res.BestSpeed = oldSpeed
+		res.Factor = float64(res.Speed) / float64(oldSpeed)
+		speedTol, recordTol := benchTolerancesOf(tols, name).apply(g.tolerances(speedTol, recordTol))
+		switch {
+		case res.Factor > speedTol:
+			res.Status = statusSlow
+		case res.Factor < recordTol:
+			res.Status = statusRecord
+		default:
+			res.Status = statusOK
 		}
-		aligned[r] = str
+		results = append(results, res)
+	}
+
+	return results
+}
+
+func sortedNames(benches map[string]uint64) []string {
+	names := make([]string, 0, len(benches))
+	for name := range benches {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return strings.Join(aligned, "\n")
+	return names
 }
 
 func intMax(a, b int) int {
@@ -223,148 +1155,383 @@ func intMax(a, b int) int {
 // Just file i/o. Backs up all files it can in <filename>.old (hiding it if not hidden by prepending ".")
 // Then it marshalls the data and writes it in the corresponding file.
 //
-// This should avoid scribbling in directories with no benchmarks
-func backupMarshallAndStore(delta string, benches map[string]uint64, newBest map[string]uint64) {
+// This should avoid scribbling in directories with no benchmarks. The best file is left alone if bestFile is empty,
+// and the comparison if comparisonFile is.
+func backupMarshallAndStore(delta, bestFile, comparisonFile string, results, best benchRecord) {
+	benches, newBest := results.benches, best.benches
 	if _, err := os.Stat(".bench_results.json"); !os.IsNotExist(err) {
-		os.Remove(".bench_results.json.old")
-		log.Println("Backing up .bench_results.json in .bench_results.json.old")
-		err = os.Rename(".bench_results.json", ".bench_results.json.old")
+		logDebug("Backing up .bench_results.json in .bench_results.json.old")
+		err = backupFile(".bench_results.json", ".bench_results.json.old")
 		if err != nil {
-			log.Println("Could not back up benchmarks file, overwriting if possible")
+			logWarn("Could not back up benchmarks file, overwriting if possible")
 		}
 	}
 
-	if _, err := os.Stat(".bench_best.json"); !os.IsNotExist(err) {
-		log.Println("Backing up .bench_best.json in .bench_best.json.old")
-		err = os.Remove(".bench_best.json.old")
-		err = os.Rename(".bench_best.json", ".bench_best.json.old")
+	if _, err := os.Stat(bestFile); bestFile != "" && !os.IsNotExist(err) {
+		logDebug("Backing up", bestFile, "in", bestFile+".old")
+		err = backupFile(bestFile, bestFile+".old")
 		if err != nil {
-			log.Println("Could not back up best benchmarks file, overwriting if possible")
+			logWarn("Could not back up best benchmarks file, overwriting if possible")
 		}
 	}
 
-	if _, err := os.Stat("bench_comparison.txt"); !os.IsNotExist(err) {
-		log.Println("Backing up bench_comparison.txt in .bench_comparison.txt.old")
-		os.Remove(".bench_comparison.txt.old")
-		err = os.Rename("bench_comparison.txt", ".bench_comparison.txt.old")
+	// The comparison isn't hidden, unlike its backup
+	comparisonBackup := "." + strings.TrimPrefix(comparisonFile, ".") + ".old"
+	if _, err := os.Stat(comparisonFile); comparisonFile != "" && !os.IsNotExist(err) {
+		logDebug("Backing up", comparisonFile, "in", comparisonBackup)
+		err = backupFile(comparisonFile, comparisonBackup)
 		if err != nil {
-			log.Println("Could not back up comparison file, overwriting if possible")
+			logWarn("Could not back up comparison file, overwriting if possible")
 		}
 
 	}
 
 	if len(benches) > 0 {
-		out, err := json.Marshal(benches)
+		raw, err := marshalRecord(results)
 		if err != nil {
-			log.Println("Couldn't marshall benchmarks as json")
+			logError("Couldn't marshall benchmarks as json")
 		} else {
-			err = ioutil.WriteFile(".bench_results.json", out, 0666)
+			err = writeFile(".bench_results.json", raw)
 			if err != nil {
-				log.Println("Couldn't write benchmark results in current directory")
+				logError("Couldn't write benchmark results in current directory")
 			}
 		}
+	} else if durable {
+		// Backed up by copying, so it's still there
+		os.Remove(".bench_results.json")
 	}
 
-	if len(newBest) > 0 {
-		out, err := json.Marshal(newBest)
+	switch {
+	case bestFile == "":
+		// Left as it is
+	case len(newBest) > 0:
+		raw, err := marshalRecord(best)
 		if err != nil {
-			log.Println("Couldn't marshall benchmarks as json")
+			logError("Couldn't marshall benchmarks as json")
 		} else {
-			err = ioutil.WriteFile(".bench_best.json", out, 0666)
+			err = writeFile(bestFile, raw)
 			if err != nil {
-				log.Println("Couldn't write benchmark results in current directory")
+				logError("Couldn't write benchmark results in current directory")
 			}
 		}
+	case durable:
+		os.Remove(bestFile)
 	}
 
-	if len(benches) > 0 || len(newBest) > 0 {
-		err := ioutil.WriteFile("bench_comparison.txt", []byte(delta), 0666)
+	switch {
+	case comparisonFile == "":
+		// Left as it is
+	case len(benches) > 0 || len(newBest) > 0:
+		err := writeFile(comparisonFile, []byte(delta))
 		if err != nil {
-			log.Println("Could not write benchmark comparisons file")
+			logError("Could not write benchmark comparisons file")
 		}
+	case durable:
+		os.Remove(comparisonFile)
 	}
 }
 
-func findGosrc(pwd, pkgName string) string {
-	path := convertPath(pkgName)
+// The comparison of a package is written to unless -reportFile says otherwise
+const defaultComparisonFile = "bench_comparison.txt"
 
-	index := strings.LastIndex(pwd, path)
-	if index <= 1 {
-		return ""
+// Where the records of a package are kept with -outDir, e.g. <outDir>/example.com/mod/db. Packages outside of a
+// module and GOPATH are kept under their absolute directory.
+func recordsDir(outDir, pkgPath string) string {
+	return filepath.Join(outDir, filepath.FromSlash(strings.TrimPrefix(pkgPath, "_")))
+}
+
+// Removes the benchmarks on record that the -bench regexp kept from running and returns them, so they're neither
+// reported as missing nor dropped from the best benchmarks. Like go test, each level of a sub-benchmark's name is
+// matched against its own part of the expression.
+func splitUnrun(oldBenches map[string]uint64, bench benchMatcher) map[string]uint64 {
+	unrun := make(map[string]uint64)
+	for name, speed := range oldBenches {
+		if !bench.matches(name) {
+			unrun[name] = speed
+			delete(oldBenches, name)
+		}
 	}
 
-	// index-1 also lops off the terminating / (or \ on Windows)
-	return pwd[:index-1]
+	return unrun
 }
 
-func runAndStoreBenches() (map[string]map[string]uint64, error) {
+// Runs the benchmarks, returning what go test printed about each package keyed by import path
+func runAndStoreBenches(opts runOptions) (map[string]packageOutput, error) {
+	outputs := make(map[string]packageOutput)
+	err := runBenches(opts, func(out packageOutput) {
+		outputs[out.pkgPath] = out
+	})
+	if err != nil && err != errRunStopped && err != errPackagesFailed {
+		return nil, err
+	}
+
+	return outputs, err
+}
 
-	log.Println("Running go test -bench=. -run=^$ ./...")
+// Whether the argument is a package rather than a command, e.g. ./pkg/parser/... or example.com/mod. Packages such
+// as all or std can only follow run or record.
+func isPackagePattern(arg string) bool {
+	return strings.ContainsAny(arg, "./")
+}
 
-	// -run=lksadfjalsdjfalskdfjalskdf makes it... incredibly unlikely that the tool will run any tests
-	// I know of no way to outright inform "go test" to outright not run any TestXxx functions.
-	gotest := exec.Command("go", "test", "-bench=.", "-run=^$", "./...")
-	out, err := gotest.CombinedOutput()
-	log.Println(err)
-	if err != nil {
-		log.Println("go test returned with non-zero return value, aborting")
-		return nil, errors.New("Problem running go test")
+// Splits the command line at --, after which everything goes to go test as it is
+func splitGoTestArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
 	}
 
-	outstr := string(out)
+	return args, nil
+}
 
-	benches := strings.Split(outstr, "\n")
+// The flags of the run passed along to every go test that benchmarks, whichever benchmarks it runs
+func goTestFlags(opts runOptions) []string {
+	// ^$ matches no test at all, as no test has an empty name
+	run := opts.run
+	if run == "" {
+		run = "^$"
+	}
+	flags := []string{"-run=" + run}
+	if opts.benchtime != "" {
+		flags = append(flags, "-benchtime="+opts.benchtime)
+	}
+	if opts.benchmem {
+		flags = append(flags, "-benchmem")
+	}
+	if opts.cpu != "" {
+		flags = append(flags, "-cpu="+opts.cpu)
+	}
+	if opts.timeout != "" {
+		flags = append(flags, "-timeout="+opts.timeout)
+	}
+	if opts.tags != "" {
+		flags = append(flags, "-tags="+opts.tags)
+	}
 
-	record := make(map[string]map[string]uint64)
-	curr := make(map[string]uint64)
-	log.Println("Parsing the results of go test...")
-	for _, line := range benches {
-		result := strings.Split(line, "\t")
+	return append(flags, opts.goTestArgs...)
+}
 
-		for i, word := range result {
-			result[i] = strings.TrimSpace(word)
+// Runs the benchmarks -warmup times, discarding their output, which could be tens of megabytes
+func warmUp(opts runOptions, packages []string) {
+	args := warmupArgs(opts, packages)
+	for i := 1; i <= opts.warmup; i++ {
+		cmd := exec.Command("go", args...)
+		if opts.command != "" {
+			cmd = shellCommand(context.Background(), opts.command)
+			logInfo(fmt.Sprintf("Warming up [%d/%d]: %s", i, opts.warmup, opts.command))
+		} else {
+			logInfo(fmt.Sprintf("Warming up [%d/%d]: go %s", i, opts.warmup, strings.Join(args, " ")))
+		}
+		if err := cmd.Run(); err != nil {
+			logWarn("Warming up failed, running the benchmarks anyway:", err)
+			return
 		}
+	}
+}
 
-		if len(result) < 3 || result[0] == "?" {
-			continue
+func warmupArgs(opts runOptions, packages []string) []string {
+	args := append([]string{"test", "-bench=" + opts.bench}, goTestFlags(opts)...)
+	return append(args, packages...)
+}
+
+// Returned by runBenches when go test was stopped by -runTimeout or an interrupt, after handing over every package it
+// finished
+var errRunStopped = errors.New("go test was stopped before it finished")
+
+// Returned by runBenches when go test failed in some of the packages, e.g. because they didn't compile, after handing
+// over every package that passed
+var errPackagesFailed = errors.New("go test failed in some of the packages")
+
+// How long go test gets to wrap up after being interrupted before it's killed
+const stopGrace = 10 * time.Second
+
+// Runs the benchmarks, handing over each package as soon as go test is done with it
+func runBenches(opts runOptions, onPackage packageFunc) error {
+	if !opts.raw {
+		parsed := onPackage
+		onPackage = func(out packageOutput) {
+			out.raw = nil
+			parsed(out)
 		}
+	}
+	if opts.input != "" {
+		return readInputBenches(opts.input, onPackage)
+	}
 
-		if strings.HasPrefix(result[0], "Benchmark") {
-			time := strings.TrimRight(result[2], " ns/op")
-			t, err := strconv.ParseUint(time, 10, 64)
-			if err != nil {
-				log.Println("could not properly convert benchmark time into uint64: ", err.Error())
-				return nil, errors.New("Couldn't convert benchmark time to uint64")
-			}
+	// The events of -json keep parsing from depending on the exact layout of the output
+	args := []string{"test", "-json", "-bench=" + opts.bench}
+	if opts.count > 1 {
+		args = append(args, "-count="+strconv.Itoa(opts.count))
+	}
+	args = append(args, goTestFlags(opts)...)
+	packages := opts.packages
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	args = append(args, packages...)
+
+	warmUp(opts, packages)
 
-			curr[result[0]] = t
-		} else if result[0] == "ok" {
-			record[result[1]] = curr
-			curr = make(map[string]uint64)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if opts.runTimeout > 0 {
+		timeout, cancelTimeout := context.WithTimeout(ctx, opts.runTimeout)
+		defer cancelTimeout()
+		ctx = timeout
+	}
+	gotest := exec.CommandContext(ctx, "go", args...)
+	if opts.command != "" {
+		logInfo("Running", opts.command)
+		gotest = shellCommand(ctx, opts.command)
+	} else {
+		logInfo("Running go", strings.Join(args, " "))
+	}
+	// Interrupted like on a terminal so the benchmark binaries get to stop too, and killed if they won't
+	gotest.Cancel = func() error {
+		return gotest.Process.Signal(os.Interrupt)
+	}
+	gotest.WaitDelay = stopGrace
+	// Parsed as it comes rather than collected, since a big enough repository has tens of megabytes of output
+	pr, pw := io.Pipe()
+	gotest.Stdout, gotest.Stderr = pw, pw
+
+	var output io.Reader = pr
+	if opts.archive != "" && !opts.readOnly {
+		archive, err := createArchive(opts.archive)
+		if err != nil {
+			logError("Couldn't archive the output of go test:", err)
+		} else {
+			// Archived whatever happens next, a failing run is exactly the one worth looking at later
+			defer func() {
+				if err := finishArchive(archive); err != nil {
+					logError("Couldn't archive the output of go test:", err)
+				} else {
+					logInfo("Archived the output of go test in", archive.Name())
+				}
+			}()
+			output = io.TeeReader(pr, archive)
 		}
 	}
 
-	return record, nil
+	if err := gotest.Start(); err != nil {
+		logError("Couldn't run go test:", err)
+		return errors.New("Problem running go test")
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := gotest.Wait()
+		pw.Close()
+		done <- err
+	}()
+
+	// An interrupt stops go test the same way, so whatever it finished is still judged
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			logWarn("Interrupted, stopping go test")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	logInfo("Parsing the results of go test as it runs...")
+	// A long run shows its progress as it goes rather than nothing until the end
+	p := newBenchParser(onPackage, func(line string) {
+		logInfo(line)
+	})
+	p.command = opts.command != ""
+	// Tells the packages that didn't compile or whose tests failed apart from go test failing altogether, keeping the
+	// benchmarks of a package that finished before one failed or panicked
+	failed := make(map[string]bool)
+	p.onFail = func(out packageOutput) {
+		if failed[out.pkgPath] && len(out.benches) == 0 {
+			return
+		}
+		failed[out.pkgPath] = true
+		switch {
+		case out.crashed != "" && len(out.benches) > 0:
+			logWarn("Benchmark", out.crashed, "failed in", out.pkgPath+", keeping the", len(out.benches), "benchmarks that finished before it")
+		case out.crashed != "":
+			logWarn("Benchmark", out.crashed, "failed in", out.pkgPath+", skipping the package")
+		case len(out.benches) > 0:
+			logWarn("go test failed in", out.pkgPath+", keeping the", len(out.benches), "benchmarks that finished")
+		default:
+			logWarn("go test failed in", out.pkgPath+", skipping it")
+		}
+		if len(out.benches) > 0 {
+			onPackage(out)
+		}
+	}
+	parseErr := p.stream(output)
+	if parseErr == nil && p.command {
+		p.endText()
+	}
+	// Keeps go test from blocking on a full pipe if parsing gave up early
+	io.Copy(ioutil.Discard, output)
+
+	err := <-done
+	logDebug(err)
+	if ctx.Err() == context.DeadlineExceeded {
+		logWarn("go test ran for longer than -runTimeout", opts.runTimeout)
+	}
+	if ctx.Err() != nil {
+		return errRunStopped
+	}
+	if err != nil && parseErr == nil && len(failed) > 0 {
+		return errPackagesFailed
+	}
+	if err != nil {
+		logError("go test returned with non-zero return value, aborting")
+		return errors.New("Problem running go test")
+	}
+	if parseErr != nil {
+		logError(parseErr)
+		return parseErr
+	}
+
+	return nil
 }
 
 func unmarshallAndStoreBench(fileName string) map[string]uint64 {
+	return loadRecord(fileName).benches
+}
+
+// Loads a record file, which is empty if there's no such file or it can't be trusted
+func loadRecord(fileName string) benchRecord {
+	rec, err := readRecord(fileName)
+	if err != nil {
+		logWarn(fmt.Sprintf("ignoring %s because: %v", fileName, err))
+	}
+
+	return rec
+}
+
+// Loads a record file, which is empty if there's no such file or it can't be read. A record that doesn't match its
+// checksum is an error, since writing the run over it would lose the bests on record.
+func readRecord(fileName string) (benchRecord, error) {
 	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		log.Println("previous benchmark file does not exist for current directory")
-		return nil
+		logDebug("previous benchmark file does not exist for current directory")
+		return benchRecord{}, nil
 	}
 
 	raw, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		log.Println("cannot open", fileName, "for current benchmark directory")
-		return nil
+		logWarn("cannot open", fileName, "for current benchmark directory")
+		return benchRecord{}, nil
 	}
 
-	out := make(map[string]uint64)
-	err = json.Unmarshal(raw, &out)
+	rec, err := unmarshalRecord(raw)
+	if isChecksumError(err) {
+		return benchRecord{}, err
+	}
 	if err != nil {
-		log.Printf("cannot unmarshall json for file %s because: %v\n", fileName, err)
-		return nil
+		logWarn(fmt.Sprintf("cannot unmarshall json for file %s because: %v", fileName, err))
+		return benchRecord{}, nil
 	}
 
-	return out
+	return rec, nil
 }
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"io"
-	//"io/ioutil"
+	"io/ioutil"
 	//"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 func init() {
 	//log.SetOutput(ioutil.Discard)
 }
 
+var testOptions = runOptions{speedTolPercent: 150, recordTolPercent: 70, bench: "."}
+
 func cd(t *testing.T) string {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -52,6 +59,9 @@ func cleanup(top string) {
 	os.Remove(".bench_best.json")
 	os.Remove("bench_comparison.txt")
 	os.Remove(".bench_comparison.txt.old")
+	os.Remove(".bench_walltime.json")
+	os.Remove(".bench_geomean.json")
+	os.Remove(repoGeomeanFile)
 
 	if err := os.Chdir(top); err != nil {
 		panic(err)
@@ -62,7 +72,7 @@ func TestEmpty(t *testing.T) {
 	top := cd(t)
 	defer cleanup(top)
 
-	code := rebench(150, 70)
+	code := rebench(testOptions)
 	if code != 0 {
 		t.Errorf("Program returned non-zero exit code for valid invocation")
 	}
@@ -83,7 +93,7 @@ func TestRealBenchIsSlower(t *testing.T) {
 	defer cleanup(top)
 	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
 
-	code := rebench(150, 70)
+	code := rebench(testOptions)
 	if code == 0 {
 		t.Errorf("Program returned good exit code when best benchmark is obviously faster")
 	}
@@ -95,12 +105,83 @@ func TestRealBenchIsSlower(t *testing.T) {
 	}
 }
 
+func TestRecordSlower(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+
+	opts := testOptions
+	opts.record = true
+	if code := rebench(opts); code != 0 {
+		t.Errorf("Program returned bad exit code %d when recording", code)
+	}
+
+	result := unmarshallAndStoreBench(".bench_results.json")
+	best := unmarshallAndStoreBench(".bench_best.json")
+
+	if best["BenchmarkSleep"] != result["BenchmarkSleep"] || best["BenchmarkSleep2"] != result["BenchmarkSleep2"] {
+		t.Errorf("Didn't record the slower benchmarks as the best %v", best)
+	}
+}
+
+func TestAcceptOnly(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "2xslower.json"), t)
+	before, err := ioutil.ReadFile(".bench_best.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions
+	opts.acceptOnly = true
+	if code := rebench(opts); code != 0 {
+		t.Errorf("Program returned bad exit code %d when faster than the best", code)
+	}
+	if after, err := ioutil.ReadFile(".bench_best.json"); err != nil || string(after) != string(before) {
+		t.Errorf("Changed the best benchmarks with -acceptOnly: %v", err)
+	}
+
+	if code := accept([]string{"-root", ".", "-bench", "."}); code != 0 {
+		t.Fatalf("Accept returned %d", code)
+	}
+	result := unmarshallAndStoreBench(".bench_results.json")
+	best := unmarshallAndStoreBench(".bench_best.json")
+	if best["BenchmarkSleep"] != result["BenchmarkSleep"] || best["BenchmarkSleep2"] != result["BenchmarkSleep2"] {
+		t.Errorf("Didn't accept the run as the best %v", best)
+	}
+}
+
+func TestAgainstLast(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+	cp(".bench_results.json", reform(top, "testpackage", ".mockoutputs", "2xslower.json"), t)
+
+	opts := testOptions
+	opts.against = againstLast
+	if code := rebench(opts); code != 0 {
+		t.Errorf("Program returned bad exit code %d when faster than the last run", code)
+	}
+
+	best := unmarshallAndStoreBench(".bench_best.json")
+	if best["BenchmarkSleep"] != 500 || best["BenchmarkSleep2"] != 10000 {
+		t.Errorf("Overwrote the best benchmarks while slower than them %v", best)
+	}
+
+	cp(".bench_results.json", reform(top, "testpackage", ".mockoutputs", "2xslower.json"), t)
+	opts.against = againstBoth
+	if code := rebench(opts); code == 0 {
+		t.Errorf("Program returned good exit code when slower than the best, comparing with both")
+	}
+}
+
 func TestRealBenchIsFaster(t *testing.T) {
 	top := cd(t)
 	defer cleanup(top)
 	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "2xslower.json"), t)
 
-	code := rebench(150, 70)
+	code := rebench(testOptions)
 	if code != 0 {
 		t.Errorf("Program returned bad exit code when real benchmark is obviously faster")
 	}
@@ -119,7 +200,7 @@ func TestRealBenchHasMore(t *testing.T) {
 	defer cleanup(top)
 	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "missing.json"), t)
 
-	code := rebench(150, 70)
+	code := rebench(testOptions)
 	if code != 0 {
 		t.Errorf("Program returned bad exit code when real benchmark has more benchmarks than best")
 	}
@@ -137,7 +218,7 @@ func TestRealBenchMissing(t *testing.T) {
 	defer cleanup(top)
 	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "toomany.json"), t)
 
-	code := rebench(150, 70)
+	code := rebench(testOptions)
 	if code == 0 {
 		t.Errorf("Program returned good exit code when real benchmark is missing benchmarks")
 	}
@@ -152,3 +233,333 @@ func TestRealBenchMissing(t *testing.T) {
 		t.Errorf("Didn't write missing benchmark back out")
 	}
 }
+
+func TestReadOnly(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+
+	opts := testOptions
+	opts.readOnly, opts.reportOnly = true, true
+	code := rebench(opts)
+	if code != 0 {
+		t.Errorf("Program returned bad exit code in report-only mode")
+	}
+
+	for _, file := range []string{".bench_results.json", ".bench_best.json.old", "bench_comparison.txt"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Read-only run wrote %s", file)
+		}
+	}
+
+	best := unmarshallAndStoreBench(".bench_best.json")
+	if best["BenchmarkSleep"] != 500 || best["BenchmarkSleep2"] != 10000 {
+		t.Errorf("Read-only run modified the best benchmarks %v", best)
+	}
+}
+
+func TestGoTestFlags(t *testing.T) {
+	args, goTestArgs := splitGoTestArgs([]string{"-count=5", "run", "--", "-benchtime=3s", "-cpu=1,4"})
+	if !reflect.DeepEqual(args, []string{"-count=5", "run"}) || !reflect.DeepEqual(goTestArgs, []string{"-benchtime=3s", "-cpu=1,4"}) {
+		t.Errorf("Split the arguments into %v and %v", args, goTestArgs)
+	}
+
+	opts := runOptions{benchtime: "1s", benchmem: true, cpu: "2", timeout: "1h", tags: "integration", goTestArgs: goTestArgs}
+	expected := []string{"-run=^$", "-benchtime=1s", "-benchmem", "-cpu=2", "-timeout=1h", "-tags=integration", "-benchtime=3s", "-cpu=1,4"}
+	if flags := goTestFlags(opts); !reflect.DeepEqual(flags, expected) {
+		t.Errorf("Passed %v to go test, expected %v", flags, expected)
+	}
+	if flags := goTestFlags(runOptions{run: "^TestSetup$"}); !reflect.DeepEqual(flags, []string{"-run=^TestSetup$"}) {
+		t.Errorf("Passed %v to go test with -run", flags)
+	}
+}
+
+func TestWarmupArgs(t *testing.T) {
+	opts := runOptions{bench: ".", count: 5, warmup: 2, benchtime: "1s"}
+	expected := []string{"test", "-bench=.", "-run=^$", "-benchtime=1s", "./..."}
+	if args := warmupArgs(opts, []string{"./..."}); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Warmed up with go %v, expected go %v", args, expected)
+	}
+}
+
+func TestPackagePatterns(t *testing.T) {
+	for arg, expected := range map[string]bool{"./pkg/parser/...": true, "example.com/mod": true, ".": true, "serve": false, "history": false} {
+		if isPackagePattern(arg) != expected {
+			t.Errorf("Took %s for a package: %v, expected %v", arg, !expected, expected)
+		}
+	}
+
+	top := cd(t)
+	defer cleanup(top)
+
+	opts := testOptions
+	opts.packages = []string{"."}
+	if code := rebench(opts); code != 0 {
+		t.Errorf("Program returned bad exit code %d benchmarking a single package", code)
+	}
+	if result := unmarshallAndStoreBench(".bench_results.json"); len(result) != 2 {
+		t.Errorf("Benchmarked %v in the package given", result)
+	}
+}
+
+func TestSplitUnrun(t *testing.T) {
+	old := map[string]uint64{"BenchmarkParse": 1, "BenchmarkParse/large": 2, "BenchmarkLex": 3}
+	filter, err := compileBenchMatcher("Parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrun := splitUnrun(old, filter)
+
+	if len(old) != 2 || len(unrun) != 1 || unrun["BenchmarkLex"] != 3 {
+		t.Errorf("Wrong split between run %v and unrun %v benchmarks", old, unrun)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "toomany.json"), t)
+	if code := rebench(testOptions); code != exitMissing {
+		t.Errorf("Program returned %d when benchmarks were missing, expected %d", code, exitMissing)
+	}
+
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+	if code := rebench(testOptions); code != exitSlow {
+		t.Errorf("Program returned %d when too slow, expected %d", code, exitSlow)
+	}
+
+	opts := testOptions
+	opts.speedTolPercent, opts.geomeanTolPercent = 1<<30, 101
+	if code := rebench(opts); code != exitSlow {
+		t.Errorf("Program returned %d when the geomean was too slow, expected %d", code, exitSlow)
+	}
+
+	opts = testOptions
+	opts.bench = "("
+	if code := rebench(opts); code != exitError {
+		t.Errorf("Program returned %d for an invalid -bench, expected %d", code, exitError)
+	}
+
+	opts = testOptions
+	opts.goTestArgs = []string{"-nosuchflag"}
+	if code := rebench(opts); code != exitGoTest {
+		t.Errorf("Program returned %d when go test failed, expected %d", code, exitGoTest)
+	}
+}
+
+func TestUntrustedBest(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	cp(".bench_best.json", reform(top, "testpackage", ".mockoutputs", "obviously_faster.json"), t)
+	before, err := ioutil.ReadFile(".bench_best.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Written before the key was set
+	os.Setenv("REBENCH_CHECKSUM_KEY", "secret")
+	defer os.Unsetenv("REBENCH_CHECKSUM_KEY")
+	if code := rebench(testOptions); code != exitError {
+		t.Errorf("Program returned %d with a best that isn't signed, expected %d", code, exitError)
+	}
+	if after, err := ioutil.ReadFile(".bench_best.json"); err != nil || !bytes.Equal(after, before) {
+		t.Fatalf("Overwrote the best that isn't signed with:\n%s", after)
+	}
+
+	if code := resign(nil); code != 0 {
+		t.Fatalf("Resign returned %d", code)
+	}
+	if code := rebench(testOptions); code != exitSlow {
+		t.Errorf("Program returned %d with the best signed again, expected %d", code, exitSlow)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	opts := testOptions
+	opts.runTimeout = time.Millisecond
+	if code := rebench(opts); code != exitGoTest {
+		t.Errorf("Program returned %d when go test was stopped, expected %d", code, exitGoTest)
+	}
+	if _, err := os.Stat(".bench_best.json"); !os.IsNotExist(err) {
+		t.Errorf("Recorded bests although go test was stopped before finishing the package")
+	}
+}
+
+func TestSomePackagesFailed(t *testing.T) {
+	top, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Chdir(top)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	out := "# example.com/broken\nbroken.go:3:1: syntax error\nFAIL\texample.com/broken [build failed]\n" +
+		"pkg: example.com/fake\nBenchmarkA-8   \t1000\t  1200 ns/op\nPASS\nok  \texample.com/fake\t1.2s\nFAIL\n"
+	if err := ioutil.WriteFile("bench.txt", []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions
+	opts.command = "cat bench.txt; exit 1"
+	if code := rebench(opts); code != exitGoTest {
+		t.Errorf("Program returned %d when a package didn't compile, expected %d", code, exitGoTest)
+	}
+
+	rec := loadRecord(filepath.Join(dir, "example.com", "fake", ".bench_results.json"))
+	if rec.benches["BenchmarkA"] != 1200 {
+		t.Errorf("Kept the results %v of the package that compiled, expected BenchmarkA at 1200 ns/op", rec.benches)
+	}
+}
+
+func TestOutDir(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := testOptions
+	opts.outDir, opts.bestFile, opts.comparisonFile = dir, ".bests.json", "comparison.txt"
+	code := rebench(opts)
+	os.Chdir(reform(top, "testpackage"))
+	if code != exitOK {
+		t.Fatalf("Program returned %d, expected %d", code, exitOK)
+	}
+
+	var written []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			written = append(written, info.Name())
+		}
+		return nil
+	})
+	sort.Strings(written)
+	for _, name := range []string{".bench_results.json", ".bests.json", "comparison.txt"} {
+		if i := sort.SearchStrings(written, name); i == len(written) || written[i] != name {
+			t.Errorf("Wrote %v in -outDir, expected %s among them", written, name)
+		}
+	}
+	for _, name := range []string{".bench_results.json", ".bench_best.json", ".bests.json", "bench_comparison.txt", "comparison.txt"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Wrote %s in the package's directory with -outDir", name)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	top, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Chdir(top)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	out := "goos: linux\npkg: example.com/fake\nBenchmarkA-8   \t1000\t  1200 ns/op\nPASS\n"
+	if err := ioutil.WriteFile("bench.txt", []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions
+	opts.command = "cat bench.txt"
+	if code := rebench(opts); code != exitOK {
+		t.Fatalf("Program returned %d, expected %d", code, exitOK)
+	}
+
+	rec := loadRecord(filepath.Join(dir, "example.com", "fake", ".bench_results.json"))
+	if rec.benches["BenchmarkA"] != 1200 {
+		t.Errorf("Kept the results %v of the -cmd, expected BenchmarkA at 1200 ns/op", rec.benches)
+	}
+}
+
+func TestInput(t *testing.T) {
+	top, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Chdir(top)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	out := "goos: linux\npkg: example.com/fake\nBenchmarkA-8   \t1000\t  1200 ns/op\nPASS\nok  \texample.com/fake\t1.2s\n"
+	if err := ioutil.WriteFile("bench.txt", []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions
+	opts.input, opts.raw = filepath.Join(dir, "bench.txt"), true
+	if code := rebench(opts); code != exitOK {
+		t.Fatalf("Program returned %d, expected %d", code, exitOK)
+	}
+	if raw, err := ioutil.ReadFile(filepath.Join(dir, "example.com", "fake", rawFile)); err != nil || string(raw) != "BenchmarkA-8   \t1000\t  1200 ns/op\n" {
+		t.Errorf("Kept the raw results %q (%v)", raw, err)
+	}
+
+	rec := loadRecord(filepath.Join(dir, "example.com", "fake", ".bench_results.json"))
+	if rec.benches["BenchmarkA"] != 1200 {
+		t.Errorf("Kept the results %v of the -input, expected BenchmarkA at 1200 ns/op", rec.benches)
+	}
+	if rec.env == nil || rec.env.CPU != "" || rec.env.Cores != 0 {
+		t.Errorf("Kept the environment %+v for the -input, expected no machine", rec.env)
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	top, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Chdir(top)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	out := "pkg: example.com/fake\nBenchmarkA-8   \t1000\t  1200 ns/op\nok  \texample.com/fake\t1.2s\n"
+	if err := ioutil.WriteFile("bench.txt", []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkgDir := filepath.Join(dir, "example.com", "fake")
+	writeRecord(t, filepath.Join(pkgDir, mainBestFile), map[string]uint64{"BenchmarkA": 10})
+
+	// The bests of the laptop would make the CI run too slow
+	opts := testOptions
+	opts.input, opts.envKey = filepath.Join(dir, "bench.txt"), "ci"
+	if code := rebench(opts); code != exitOK {
+		t.Fatalf("Program returned %d, expected %d", code, exitOK)
+	}
+	if best := loadRecord(filepath.Join(pkgDir, ".bench_best@ci.json")).benches; best["BenchmarkA"] != 1200 {
+		t.Errorf("Kept the bests %v of the environment, expected BenchmarkA at 1200 ns/op", best)
+	}
+	if best := loadRecord(filepath.Join(pkgDir, mainBestFile)).benches; best["BenchmarkA"] != 10 {
+		t.Errorf("Changed the bests %v without an environment", best)
+	}
+}
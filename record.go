@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The version of the record schema rebench writes, in which every value is kept with an explicit unit in canonical
+// scaling, e.g. {"version": 3, "benchmarks": {"BenchmarkX": {"sec/op": 1.2e-05, "B/op": 64}}}. Records from before
+// it are a bare object of benchmark names and ns/op, which is still read.
+const recordVersion = 3
+
+// The version from which records list the GOMAXPROCS suffixes their names kept under "procs", having none otherwise
+const procsVersion = 3
+
+// The units go test reports that are stored in another unit, as benchfmt tidies them: the canonical unit, and what
+// a value in the reported unit is multiplied and then divided by to get there. Every other unit is stored as it is.
+var canonicalUnits = map[string]canonicalUnit{
+	"ns/op": {"sec/op", 1, 1e9},
+	"MB/s":  {"B/s", 1e6, 1},
+}
+
+// Scaling by exact powers of ten keeps records from picking up rounding errors like 0.010091385000000001
+type canonicalUnit struct {
+	unit     string
+	mul, div float64
+}
+
+func (u canonicalUnit) to(value float64) float64 {
+	return value * u.mul / u.div
+}
+
+func (u canonicalUnit) from(value float64) float64 {
+	return value * u.div / u.mul
+}
+
+// Every value of some benchmarks in the record schema, keyed by benchmark name and then canonical unit. Benchmarks of
+// records from before the schema, which are bare ns/op, are unmarshalled as sec/op.
+type canonicalBenchmarks map[string]map[string]float64
+
+func (c *canonicalBenchmarks) UnmarshalJSON(raw []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return err
+	}
+
+	*c = make(canonicalBenchmarks, len(values))
+	for name, value := range values {
+		if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			var units map[string]float64
+			if err := json.Unmarshal(value, &units); err != nil {
+				return err
+			}
+			(*c)[name] = units
+			continue
+		}
+
+		ns, err := strconv.ParseFloat(string(bytes.TrimSpace(value)), 64)
+		if err != nil {
+			return errors.New("benchmark " + name + " has neither units nor ns/op")
+		}
+		(*c)[name] = map[string]float64{"sec/op": canonicalUnits["ns/op"].to(ns)}
+	}
+
+	return nil
+}
+
+// Brings the ns/op and other metrics of benchmarks into the record schema
+func canonicalize(benches map[string]uint64, metrics benchMetrics) canonicalBenchmarks {
+	c := make(canonicalBenchmarks, len(benches))
+	for name, speed := range benches {
+		c[name] = map[string]float64{"sec/op": canonicalUnits["ns/op"].to(float64(speed))}
+	}
+
+	for name, units := range metrics {
+		if c[name] == nil {
+			c[name] = make(map[string]float64, len(units))
+		}
+		for unit, value := range units {
+			if canonical, ok := canonicalUnits[unit]; ok {
+				unit, value = canonical.unit, canonical.to(value)
+			}
+			c[name][unit] = value
+		}
+	}
+
+	return c
+}
+
+// Takes benchmarks out of the record schema, as the ns/op and the other metrics in the units go test reports (nil if
+// there are none)
+func (c canonicalBenchmarks) split() (map[string]uint64, benchMetrics) {
+	benches := make(map[string]uint64, len(c))
+	var metrics benchMetrics
+	for name, units := range c {
+		for unit, value := range units {
+			if unit == "sec/op" {
+				benches[name] = uint64(math.Floor(canonicalUnits["ns/op"].from(value) + 0.5))
+				continue
+			}
+
+			for reported, canonical := range canonicalUnits {
+				if canonical.unit == unit {
+					unit, value = reported, canonical.from(value)
+				}
+			}
+			if metrics == nil {
+				metrics = make(benchMetrics)
+			}
+			if metrics[name] == nil {
+				metrics[name] = make(map[string]float64)
+			}
+			metrics[name][unit] = value
+		}
+	}
+
+	return benches, metrics
+}
+
+// The ns/op, other metrics and -count distributions of some benchmarks, as kept in a record, with the revisions they
+// were run on
+type benchRecord struct {
+	benches   map[string]uint64
+	metrics   benchMetrics
+	stats     map[string]benchStats    // Only for benchmarks run several times
+	revision  *revision                // The revision of the run that wrote the record
+	revisions map[string]revision      // The revision each best benchmark was set on
+	env       *environment             // The machine the benchmarks ran on, or the bests were first set on
+	pending   map[string]pendingRecord // New bests waiting for more runs to confirm them, see -confirmRecords
+}
+
+// A distribution in the record schema, in its canonical unit
+type storedStats struct {
+	Unit string `json:"unit"`
+	benchStats
+}
+
+func canonicalStats(stats map[string]benchStats) map[string]storedStats {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	ns := canonicalUnits["ns/op"]
+	stored := make(map[string]storedStats, len(stats))
+	for name, s := range stats {
+		stored[name] = storedStats{Unit: ns.unit, benchStats: benchStats{N: s.N, Mean: ns.to(s.Mean), Median: ns.to(s.Median), Stddev: ns.to(s.Stddev)}}
+	}
+
+	return stored
+}
+
+func splitStats(stored map[string]storedStats) map[string]benchStats {
+	if len(stored) == 0 {
+		return nil
+	}
+
+	ns := canonicalUnits["ns/op"]
+	stats := make(map[string]benchStats, len(stored))
+	for name, s := range stored {
+		if s.Unit == ns.unit {
+			stats[name] = benchStats{N: s.N, Mean: ns.from(s.Mean), Median: ns.from(s.Median), Stddev: ns.from(s.Stddev)}
+		}
+	}
+
+	return stats
+}
+
+// A record file, such as .bench_best.json or a baseline
+type storedRecord struct {
+	Version    int                      `json:"version"`
+	Benchmarks canonicalBenchmarks      `json:"benchmarks"`
+	Stats      map[string]storedStats   `json:"stats,omitempty"`
+	Revision   *revision                `json:"revision,omitempty"`
+	Revisions  map[string]revision      `json:"revisions,omitempty"`
+	Env        *environment             `json:"environment,omitempty"`
+	Pending    map[string]pendingRecord `json:"pending,omitempty"`
+	Procs      []int                    `json:"procs,omitempty"` // The GOMAXPROCS suffixes the names kept, see -keepProcs
+	// The checksum of everything else, e.g. "sha256:9f86d0...", or "hmac-sha256:..." with $REBENCH_CHECKSUM_KEY
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func marshalRecord(rec benchRecord) ([]byte, error) {
+	stored := storedRecord{
+		Version:    recordVersion,
+		Benchmarks: canonicalize(rec.benches, rec.metrics),
+		Stats:      canonicalStats(rec.stats),
+		Revision:   rec.revision,
+		Revisions:  rec.revisions,
+		Env:        rec.env,
+		Pending:    rec.pending,
+		Procs:      keptProcs(),
+	}
+	var err error
+	if stored.Checksum, err = checksum(stored, checksumKey()); err != nil {
+		return nil, err
+	}
+
+	return marshalFile(stored)
+}
+
+// The shared key records are signed with rather than only checksummed, if $REBENCH_CHECKSUM_KEY has one
+func checksumKey() []byte {
+	return []byte(os.Getenv("REBENCH_CHECKSUM_KEY"))
+}
+
+const (
+	checksumSHA256 = "sha256:"
+	checksumHMAC   = "hmac-sha256:"
+)
+
+// A record that isn't what rebench wrote, which a run must leave as it is rather than replace with its own results
+type checksumError string
+
+func (e checksumError) Error() string {
+	return string(e)
+}
+
+// Whether the record was rejected by its checksum, rather than being unreadable
+func isChecksumError(err error) bool {
+	var c checksumError
+	return errors.As(err, &c)
+}
+
+// Sums a stored record as it's written, which must be without its checksum. Anyone can work out a plain SHA-256 again
+// after editing the record, so it only catches accidents; an HMAC takes the key to forge.
+func checksum(unsummed interface{}, key []byte) (string, error) {
+	raw, err := marshalFile(unsummed)
+	if err != nil {
+		return "", err
+	}
+
+	if len(key) == 0 {
+		sum := sha256.Sum256(raw)
+		return checksumSHA256 + hex.EncodeToString(sum[:]), nil
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(raw)
+	return checksumHMAC + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Makes sure a stored record, with its checksum taken out as sum, is what rebench wrote. Records from before checksums have
+// none, and are only accepted without a key, since with one anybody could otherwise edit a record and drop its
+// checksum. Without the key, the HMAC of a record can't be checked and is taken on trust.
+func verifyChecksum(sum string, unsummed interface{}, key []byte) error {
+	switch {
+	case len(key) > 0 && !strings.HasPrefix(sum, checksumHMAC):
+		return checksumError("the record isn't signed with $REBENCH_CHECKSUM_KEY, run rebench resign if it was written before the key was set")
+	case len(key) == 0 && (sum == "" || strings.HasPrefix(sum, checksumHMAC)):
+		return nil
+	}
+
+	expected, err := checksum(unsummed, key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(sum)) {
+		return checksumError("the record doesn't match its checksum, it was edited by hand or cut short")
+	}
+
+	return nil
+}
+
+// Marshals the contents of a file meant to be committed: indented, with sorted keys and a trailing newline, so
+// committing it gives small diffs that merge cleanly
+func marshalFile(v interface{}) ([]byte, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+// Reads a record file in either schema
+func unmarshalRecord(raw []byte) (benchRecord, error) {
+	stored, err := unmarshalStoredRecord(raw)
+	if err != nil {
+		return benchRecord{}, err
+	}
+	sum := stored.Checksum
+	stored.Checksum = ""
+	if err := verifyChecksum(sum, stored, checksumKey()); err != nil {
+		return benchRecord{}, err
+	}
+
+	var rec benchRecord
+	rec.benches, rec.metrics = stored.Benchmarks.split()
+	rec.stats = splitStats(stored.Stats)
+	rec.revision, rec.revisions, rec.env = stored.Revision, stored.Revisions, stored.Env
+	rec.pending = stored.Pending
+	return rec.withoutProcs(recordProcs(stored.Version, stored.Procs, stored.Env)), nil
+}
+
+// Reads a record file as it's stored, whatever its checksum, with the benchmarks of the schema before versions in
+// the current one
+func unmarshalStoredRecord(raw []byte) (storedRecord, error) {
+	var stored storedRecord
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return storedRecord{}, err
+	}
+
+	switch {
+	case stored.Version > recordVersion:
+		return storedRecord{}, errors.New("the record is version " + strconv.Itoa(stored.Version) + ", newer than this rebench knows")
+	case stored.Version == 0:
+		// Bare ns/op
+		if err := json.Unmarshal(raw, &stored.Benchmarks); err != nil {
+			return storedRecord{}, err
+		}
+	}
+
+	return stored, nil
+}
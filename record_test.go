@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	benches := map[string]uint64{"BenchmarkA": 10091385, "BenchmarkB": 1}
+	metrics := benchMetrics{"BenchmarkA": {"B/op": 64, "MB/s": 681.98, "queries/op": 3}}
+
+	stats := map[string]benchStats{"BenchmarkA": {N: 3, Mean: 10091385, Median: 10091385, Stddev: 1000}}
+	raw, err := marshalRecord(benchRecord{benches: benches, metrics: metrics, stats: stats})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "version": 3,
+  "benchmarks": {
+    "BenchmarkA": {
+      "B/op": 64,
+      "B/s": 681980000,
+      "queries/op": 3,
+      "sec/op": 0.010091385
+    },
+    "BenchmarkB": {
+      "sec/op": 1e-9
+    }
+  },
+  "stats": {
+    "BenchmarkA": {
+      "unit": "sec/op",
+      "n": 3,
+      "mean": 0.010091385,
+      "median": 0.010091385,
+      "stddev": 0.000001
+    }
+  },
+  "checksum": "sha256:e87721c7853cc3cf8e3b33d422c6645792f2dfc3235a8aa42ce234e7c7611b4f"
+}
+`
+	if string(raw) != expected {
+		t.Errorf("Marshalled the record as\n%s\nexpected\n%s", raw, expected)
+	}
+
+	rec, err := unmarshalRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rec, benchRecord{benches: benches, metrics: metrics, stats: stats}) {
+		t.Errorf("Unmarshalled %v, expected %v %v %v", rec, benches, metrics, stats)
+	}
+}
+
+func TestRecordLegacy(t *testing.T) {
+	rec, err := unmarshalRecord([]byte(`{"BenchmarkSleep":10091385,"BenchmarkSleep2":5063012}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]uint64{"BenchmarkSleep": 10091385, "BenchmarkSleep2": 5063012}
+	if !reflect.DeepEqual(rec.benches, expected) || rec.metrics != nil || rec.stats != nil {
+		t.Errorf("Unmarshalled the bare ns/op as %v, expected %v", rec, expected)
+	}
+
+	// The next write migrates it to the current schema
+	raw, err := marshalRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"version":3,"benchmarks":{"BenchmarkSleep":{"sec/op":0.010091385},"BenchmarkSleep2":{"sec/op":0.005063012}},"checksum":"sha256:b2fd8174d161433dba008ba3c376dec5c6f7619c7f951573d7b144926a0c3493"}`; compact.String() != expected {
+		t.Errorf("Migrated the bare ns/op to\n%s\nexpected\n%s", compact.String(), expected)
+	}
+
+	if _, err := unmarshalRecord([]byte(`{"version":4,"benchmarks":{}}`)); err == nil {
+		t.Errorf("Unmarshalled a record from a newer rebench without complaint")
+	}
+}
+
+func TestRecordChecksum(t *testing.T) {
+	raw, err := marshalRecord(benchRecord{benches: map[string]uint64{"BenchmarkA": 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unmarshalRecord(raw); err != nil {
+		t.Fatalf("Rejected the record as written: %v", err)
+	}
+	// Edited by hand, however the file is laid out
+	edited := strings.Replace(string(raw), "1e-7", "2e-7", 1)
+	if _, err := unmarshalRecord([]byte(edited)); err == nil {
+		t.Errorf("Accepted a record edited by hand:\n%s", edited)
+	}
+
+	os.Setenv("REBENCH_CHECKSUM_KEY", "secret")
+	defer os.Unsetenv("REBENCH_CHECKSUM_KEY")
+	if _, err := unmarshalRecord(raw); err == nil {
+		t.Errorf("Accepted a record without an HMAC despite the key")
+	}
+	signed, err := marshalRecord(benchRecord{benches: map[string]uint64{"BenchmarkA": 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(signed), `"checksum": "hmac-sha256:`) {
+		t.Fatalf("Didn't sign the record with the key:\n%s", signed)
+	}
+	if _, err := unmarshalRecord(signed); err != nil {
+		t.Errorf("Rejected the record as signed: %v", err)
+	}
+
+	os.Setenv("REBENCH_CHECKSUM_KEY", "other")
+	if _, err := unmarshalRecord(signed); err == nil {
+		t.Errorf("Accepted a record signed with another key")
+	}
+	// Without the key, a signature can't be checked
+	os.Unsetenv("REBENCH_CHECKSUM_KEY")
+	if _, err := unmarshalRecord(signed); err != nil {
+		t.Errorf("Rejected a signed record without the key: %v", err)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The commands working on the records beneath a directory without running anything
+var (
+	compareFlags    = flag.NewFlagSet("compare", flag.ExitOnError)
+	compareMarkdown = compareFlags.Bool("markdown", false, "Prints the comparison as Markdown")
+	comparePackage  = compareFlags.String("package", "", "The import path of the package the records are of, for its tolerances in the config file")
+	compareOut      = compareFlags.String("o", "", "Also writes the comparison to this file, as it's printed")
+
+	showFlags = flag.NewFlagSet("show", flag.ExitOnError)
+	showRoot  = showFlags.String("root", ".", "The directory containing the packages to show")
+
+	resetFlags = flag.NewFlagSet("reset", flag.ExitOnError)
+	resetRoot  = resetFlags.String("root", ".", "The directory containing the packages to reset")
+	resetBench = resetFlags.String("bench", ".", "Only forgets the best of the benchmarks matching this regular expression, as in go test -bench")
+
+	pruneFlags = flag.NewFlagSet("prune", flag.ExitOnError)
+	pruneRoot  = pruneFlags.String("root", ".", "The directory containing the packages to prune")
+
+	acceptFlags = flag.NewFlagSet("accept", flag.ExitOnError)
+	acceptRoot  = acceptFlags.String("root", ".", "The directory containing the packages whose latest run to accept")
+	acceptBench = acceptFlags.String("bench", ".", "Only accepts the benchmarks matching this regular expression, as in go test -bench")
+	acceptBests = bestFileFlags(acceptFlags)
+
+	resignFlags = flag.NewFlagSet("resign", flag.ExitOnError)
+	resignRoot  = resignFlags.String("root", ".", "The directory containing the packages whose records to checksum again")
+)
+
+// Compares two record files, e.g. a .bench_best.json with another machine's, treating the first as the best on record
+// with the tolerances of the config file, and sends the comparison to the reporters like a run would
+func compareFiles(args []string, speedTolPercent, recordTolPercent, minNs int, cfg config, reporters []reporter) int {
+	compareFlags.Parse(args)
+	if compareFlags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "rebench compare needs exactly two record files, e.g. rebench compare old.json new.json")
+		return exitError
+	}
+
+	var recs [2]benchRecord
+	for i, file := range compareFlags.Args() {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			logError("Cannot read", file+":", err)
+			return exitError
+		}
+		if recs[i], err = unmarshalRecord(raw); err != nil {
+			logError("Cannot unmarshall", file+":", err)
+			return exitError
+		}
+	}
+
+	speedTol, recordTol, tols := cfg.forPackage(*comparePackage, float64(speedTolPercent)/100, float64(recordTolPercent)/100)
+	results := classifyGroups(recs[0].benches, recs[1].benches, speedTol, recordTol, cfg.Groups, tols)
+	floorNoise(results, cfg.minNsFor(*comparePackage, minNs), tols)
+	metrics := classifyMetrics(recs[0].metrics, recs[1].metrics, withDefaultUnits(cfg.Units), speedTol, recordTol)
+	run := packageRun{Package: compareFlags.Arg(1), Results: results, Metrics: metrics, Table: deltaTable(results, true).String()}
+	if len(metrics) > 0 {
+		run.Table += "\n" + metricsTable(metrics).String()
+	}
+	report := runReport{
+		Runs:    []packageRun{run},
+		Missing: countStatus(results, statusMissing) > 0,
+		TooSlow: countStatus(results, statusSlow) > 0 || metricsRegressed(metrics, cfg.Groups, cfg.ignore),
+	}
+	if recs[1].revision != nil {
+		report.Revision = *recs[1].revision
+	}
+
+	out := report.Summary() + "\n\n" + report.Runs[0].Table
+	if *compareMarkdown {
+		out = report.Markdown()
+		fmt.Print(out)
+	} else {
+		fmt.Println(report.Summary())
+		fmt.Print("\n" + colorize(report.Runs[0].Table))
+	}
+	if *compareOut != "" {
+		if err := writeFile(*compareOut, []byte(out)); err != nil {
+			logError("Cannot write the comparison to", *compareOut+":", err)
+			return exitError
+		}
+	}
+	for _, r := range reporters {
+		if err := r.report(report); err != nil {
+			logError("Could not report the comparison:", err)
+		}
+	}
+
+	switch {
+	case report.Missing:
+		return exitMissing
+	case report.TooSlow:
+		return exitSlow
+	}
+	return exitOK
+}
+
+// The directory of every package beneath the root with a best on record or the results of a run, keyed by its
+// slash-separated path relative to the root
+func recordDirs(root string) (map[string]string, error) {
+	dirs := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == monorepoStoreDir && path != root {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != ".bench_best.json" && info.Name() != ".bench_results.json" {
+			return nil
+		}
+
+		pkg, _ := filepath.Rel(root, filepath.Dir(path))
+		dirs[filepath.ToSlash(pkg)] = filepath.Dir(path)
+
+		return nil
+	})
+
+	return dirs, err
+}
+
+func sortedKeys(dirs map[string]string) []string {
+	keys := make([]string, 0, len(dirs))
+	for key := range dirs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Prints the best on record and the latest results of every package beneath -root, including the -monorepo store
+func show(args []string) int {
+	showFlags.Parse(args)
+	dirs, err := recordDirs(*showRoot)
+	if err != nil {
+		logError("Cannot look for records:", err)
+		return exitError
+	}
+
+	for _, pkg := range sortedKeys(dirs) {
+		best := loadRecord(filepath.Join(dirs[pkg], ".bench_best.json"))
+		last := loadRecord(filepath.Join(dirs[pkg], ".bench_results.json"))
+		fmt.Printf("%s\n%s\n", pkg, recordTable(best.benches, last.benches))
+	}
+
+	records, err := packageStore{root: filepath.Join(*showRoot, monorepoStoreDir)}.all()
+	if err != nil {
+		logError("Cannot read the monorepo store:", err)
+		return exitError
+	}
+	sort.Slice(records, func(a, b int) bool { return records[a].Package < records[b].Package })
+	for _, rec := range records {
+		fmt.Printf("%s\n%s\n", rec.Package, recordTable(rec.Best, rec.Results))
+	}
+
+	return exitOK
+}
+
+func recordTable(best, last map[string]uint64) string {
+	names := sortedNames(best)
+	for _, name := range sortedNames(last) {
+		if _, ok := best[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	tbl := newTable("Benchmark Name", "Best Speed", "Last Speed")
+	for _, name := range names {
+		bestSpeed, lastSpeed := "NONE", "NONE"
+		if speed, ok := best[name]; ok {
+			bestSpeed = numbers.speed(speed)
+		}
+		if speed, ok := last[name]; ok {
+			lastSpeed = numbers.speed(speed)
+		}
+		tbl.addRow(name, bestSpeed, lastSpeed)
+	}
+
+	return tbl.String()
+}
+
+// Rewrites the best on record of every package beneath the root, kept in the named file, including the -monorepo
+// store, with what keep leaves of it. A branch without a file of its own yet starts from the main branch's. A package
+// left without any best is left without a best file, so its next run starts afresh.
+func rewriteBests(root, name string, keep func(pkg string, best, last benchRecord) benchRecord) error {
+	dirs, err := recordDirs(root)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range sortedKeys(dirs) {
+		file := filepath.Join(dirs[pkg], name)
+		old, err := readBranchRecord(dirs[pkg], name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		best := keep(pkg, old, loadRecord(filepath.Join(dirs[pkg], ".bench_results.json")))
+		if len(best.benches) == 0 {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		raw, err := marshalRecord(best)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(file, raw); err != nil {
+			return err
+		}
+	}
+
+	store := packageStore{root: filepath.Join(root, monorepoStoreDir)}
+	records, err := store.all()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		best := keep(rec.Package, rec.best(), benchRecord{benches: rec.Results, metrics: rec.Metrics, stats: rec.Stats, revision: rec.Revision, env: rec.Env})
+		rec.Best, rec.BestMetrics, rec.BestStats, rec.BestRevisions, rec.BestEnv = best.benches, best.metrics, best.stats, best.revisions, best.env
+		rec.Pending = best.pending
+		if err := store.save(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Only keeps the benchmarks of the record that keep says to
+func filterRecord(rec benchRecord, keep func(name string) bool) benchRecord {
+	filtered := benchRecord{benches: make(map[string]uint64), revision: rec.revision, env: rec.env}
+	for name, speed := range rec.benches {
+		if !keep(name) {
+			continue
+		}
+		filtered.benches[name] = speed
+		if units, ok := rec.metrics[name]; ok {
+			if filtered.metrics == nil {
+				filtered.metrics = make(benchMetrics)
+			}
+			filtered.metrics[name] = units
+		}
+		if s, ok := rec.stats[name]; ok {
+			if filtered.stats == nil {
+				filtered.stats = make(map[string]benchStats)
+			}
+			filtered.stats[name] = s
+		}
+		if r, ok := rec.revisions[name]; ok {
+			if filtered.revisions == nil {
+				filtered.revisions = make(map[string]revision)
+			}
+			filtered.revisions[name] = r
+		}
+		if p, ok := rec.pending[name]; ok {
+			if filtered.pending == nil {
+				filtered.pending = make(map[string]pendingRecord)
+			}
+			filtered.pending[name] = p
+		}
+	}
+
+	return filtered
+}
+
+// Forgets the best on record of the benchmarks matching -bench beneath -root, e.g. after a change making them slower
+// for good
+func reset(args []string) int {
+	resetFlags.Parse(args)
+	bench, err := compileBenchMatcher(*resetBench)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -bench regular expression:", err)
+		return exitError
+	}
+
+	err = rewriteBests(*resetRoot, mainBestFile, func(pkg string, best, last benchRecord) benchRecord {
+		return filterRecord(best, func(name string) bool {
+			if bench.matches(name) {
+				logInfo("Forgetting the best of", pkg, name)
+				return false
+			}
+			return true
+		})
+	})
+	if err != nil {
+		logError("Cannot reset the records:", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// Drops the benchmarks that the latest run of each package beneath -root didn't have from its best on record, so
+// benchmarks that were deleted on purpose stop being reported missing
+func prune(args []string) int {
+	pruneFlags.Parse(args)
+	err := rewriteBests(*pruneRoot, mainBestFile, func(pkg string, best, last benchRecord) benchRecord {
+		// Without results there's nothing to tell deleted benchmarks by
+		if last.benches == nil {
+			return best
+		}
+
+		return filterRecord(best, func(name string) bool {
+			if _, ok := last.benches[name]; !ok {
+				logInfo("Pruning", pkg, name)
+				return false
+			}
+			return true
+		})
+	})
+	if err != nil {
+		logError("Cannot prune the records:", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// Makes the latest run of every package beneath -root its best on record, for -acceptOnly where runs never change the
+// bests themselves. The benchmarks the run didn't have keep their best.
+func accept(args []string) int {
+	acceptFlags.Parse(args)
+	bench, err := compileBenchMatcher(*acceptBench)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -bench regular expression:", err)
+		return exitError
+	}
+
+	file, err := acceptBests()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if file != mainBestFile {
+		logInfo("Accepting into", file)
+	}
+	err = rewriteBests(*acceptRoot, file, func(pkg string, best, last benchRecord) benchRecord {
+		return acceptLatest(pkg, best, last, bench.matches)
+	})
+	if err != nil {
+		logError("Cannot accept the latest runs:", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// The best on record, with each benchmark of the latest run that matches accepted as its best
+func acceptLatest(pkg string, best, last benchRecord, matches func(name string) bool) benchRecord {
+	accepted := func(name string) bool {
+		_, ok := last.benches[name]
+		return ok && matches(name)
+	}
+	kept := filterRecord(best, func(name string) bool { return !accepted(name) })
+	for _, name := range sortedNames(last.benches) {
+		if !accepted(name) {
+			continue
+		}
+		logInfo("Accepting", pkg, name, "at", last.benches[name], "ns/op")
+		kept.benches[name] = last.benches[name]
+		if units, ok := last.metrics[name]; ok {
+			if kept.metrics == nil {
+				kept.metrics = make(benchMetrics)
+			}
+			kept.metrics[name] = units
+		}
+		if s, ok := last.stats[name]; ok {
+			if kept.stats == nil {
+				kept.stats = make(map[string]benchStats)
+			}
+			kept.stats[name] = s
+		}
+		if last.revision != nil {
+			if kept.revisions == nil {
+				kept.revisions = make(map[string]revision)
+			}
+			kept.revisions[name] = *last.revision
+		}
+	}
+	if last.env != nil && len(last.benches) > 0 {
+		kept.env = last.env
+	}
+	if last.revision != nil {
+		kept.revision = last.revision
+	}
+
+	return kept
+}
+
+// Checksums every record beneath -root again, including the -monorepo store, with $REBENCH_CHECKSUM_KEY if it's set,
+// whatever their checksums were: after setting or changing the key, or to vouch for records edited by hand
+func resign(args []string) int {
+	resignFlags.Parse(args)
+	if resignFlags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "rebench resign takes no arguments, e.g. rebench resign -root .")
+		return exitError
+	}
+
+	key := checksumKey()
+	err := filepath.Walk(*resignRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == monorepoStoreDir {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !isRecordFile(path) {
+			return nil
+		}
+
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		stored, err := unmarshalStoredRecord(raw)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshall %s: %v", path, err)
+		}
+		// Names are kept as they would be trimmed
+		stored.Procs = recordProcs(stored.Version, stored.Procs, stored.Env)
+		stored.Version, stored.Checksum = recordVersion, ""
+		if stored.Checksum, err = checksum(stored, key); err != nil {
+			return err
+		}
+		out, err := marshalFile(stored)
+		if err != nil {
+			return err
+		}
+
+		logInfo("Signing", path)
+		return writeFile(path, out)
+	})
+	if err == nil {
+		err = packageStore{root: filepath.Join(*resignRoot, monorepoStoreDir)}.resign(key)
+	}
+	if err != nil {
+		logError("Cannot checksum the records again:", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// Whether rebench keeps a record in the file: the bests, the results, a baseline, or the backup of any of them
+func isRecordFile(path string) bool {
+	name := strings.TrimSuffix(filepath.Base(path), ".old")
+	if filepath.Base(filepath.Dir(path)) == baselineDir {
+		return filepath.Ext(name) == ".json"
+	}
+
+	return isBestFile(name) || name == ".bench_results.json"
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	old, faster, slower := filepath.Join(root, "old.json"), filepath.Join(root, "faster.json"), filepath.Join(root, "slower.json")
+	writeRecord(t, old, map[string]uint64{"BenchmarkA": 100})
+	writeRecord(t, faster, map[string]uint64{"BenchmarkA": 50})
+	writeRecord(t, slower, map[string]uint64{"BenchmarkA": 300})
+	other := filepath.Join(root, "other.json")
+	writeRecord(t, other, map[string]uint64{"BenchmarkB": 300})
+
+	if code := compareFiles([]string{old, faster}, 50, 70, 0, config{}, nil); code != 0 {
+		t.Errorf("Comparing with a faster record returned %d", code)
+	}
+	if code := compareFiles([]string{old, slower}, 50, 70, 0, config{}, nil); code != exitSlow {
+		t.Errorf("Comparing with a slower record returned %d", code)
+	}
+	if code := compareFiles([]string{old, other}, 50, 70, 0, config{}, nil); code != exitMissing {
+		t.Errorf("Comparing with a record missing a benchmark returned %d", code)
+	}
+	if code := compareFiles([]string{old}, 50, 70, 0, config{}, nil); code != exitError {
+		t.Errorf("Comparing a single record returned %d", code)
+	}
+
+	// Archived records are reported like a run, and the comparison kept
+	out := filepath.Join(root, "comparison.txt")
+	defer func() { *compareOut = "" }()
+	var buf bytes.Buffer
+	if code := compareFiles([]string{"-o", out, old, slower}, 50, 70, 0, config{}, []reporter{jsonReporter{w: &buf}}); code != exitSlow {
+		t.Errorf("Comparing with a slower record returned %d", code)
+	}
+	if !strings.Contains(buf.String(), `"BenchmarkA"`) {
+		t.Errorf("Reported %s, expected BenchmarkA", buf.String())
+	}
+	if raw, err := ioutil.ReadFile(out); err != nil || !strings.Contains(string(raw), "SLOW") {
+		t.Errorf("Wrote the comparison %q (%v), expected BenchmarkA to be SLOW", raw, err)
+	}
+}
+
+func TestResetAndPrune(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeRecord(t, filepath.Join(root, "a", ".bench_best.json"), map[string]uint64{"BenchmarkA": 100, "BenchmarkA/sub": 10, "BenchmarkB": 20, "BenchmarkGone": 5})
+	writeRecord(t, filepath.Join(root, "a", ".bench_results.json"), map[string]uint64{"BenchmarkA": 110, "BenchmarkA/sub": 11, "BenchmarkB": 21})
+	writeRecord(t, filepath.Join(root, "b", ".bench_best.json"), map[string]uint64{"BenchmarkA": 1})
+	store := packageStore{root: filepath.Join(root, monorepoStoreDir)}
+	store.save(packageRecord{Package: "example.com/mono", Best: map[string]uint64{"BenchmarkA": 1, "BenchmarkC": 2}, Results: map[string]uint64{"BenchmarkA": 1}})
+
+	if code := reset([]string{"-root", root, "-bench", "^BenchmarkA$"}); code != 0 {
+		t.Fatalf("Reset returned %d", code)
+	}
+
+	best := loadRecord(filepath.Join(root, "a", ".bench_best.json")).benches
+	if len(best) != 2 || best["BenchmarkB"] != 20 || best["BenchmarkGone"] != 5 {
+		t.Errorf("Reset left the wrong bests %v", best)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b", ".bench_best.json")); !os.IsNotExist(err) {
+		t.Errorf("Reset left the best file of a package without any best")
+	}
+
+	if code := prune([]string{"-root", root}); code != 0 {
+		t.Fatalf("Prune returned %d", code)
+	}
+
+	best = loadRecord(filepath.Join(root, "a", ".bench_best.json")).benches
+	if len(best) != 1 || best["BenchmarkB"] != 20 {
+		t.Errorf("Prune left the wrong bests %v", best)
+	}
+
+	if rec, _ := store.load("example.com/mono"); len(rec.Best) != 0 {
+		t.Errorf("Reset and prune left the wrong bests in the store %v", rec.Best)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeRecord(t, filepath.Join(root, "a", ".bench_best.json"), map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 20, "BenchmarkGone": 5})
+	writeRecord(t, filepath.Join(root, "a", ".bench_results.json"), map[string]uint64{"BenchmarkA": 150, "BenchmarkB": 30})
+	writeRecord(t, filepath.Join(root, "new", ".bench_results.json"), map[string]uint64{"BenchmarkN": 7})
+	store := packageStore{root: filepath.Join(root, monorepoStoreDir)}
+	store.save(packageRecord{Package: "example.com/mono", Best: map[string]uint64{"BenchmarkA": 1}, Results: map[string]uint64{"BenchmarkA": 2}})
+
+	if code := accept([]string{"-root", root, "-bench", "^BenchmarkA$"}); code != 0 {
+		t.Fatalf("Accept returned %d", code)
+	}
+
+	best := loadRecord(filepath.Join(root, "a", ".bench_best.json")).benches
+	if expected := map[string]uint64{"BenchmarkA": 150, "BenchmarkB": 20, "BenchmarkGone": 5}; !reflect.DeepEqual(best, expected) {
+		t.Errorf("Accepted the bests %v, expected %v", best, expected)
+	}
+	if _, err := os.Stat(filepath.Join(root, "new", ".bench_best.json")); !os.IsNotExist(err) {
+		t.Errorf("Accepted benchmarks -bench doesn't match")
+	}
+	if rec, _ := store.load("example.com/mono"); rec.Best["BenchmarkA"] != 2 {
+		t.Errorf("Accepted the bests %v in the store", rec.Best)
+	}
+
+	if code := accept([]string{"-root", root, "-bench", "."}); code != 0 {
+		t.Fatalf("Accept returned %d", code)
+	}
+	if best := loadRecord(filepath.Join(root, "new", ".bench_best.json")).benches; best["BenchmarkN"] != 7 {
+		t.Errorf("Accepted %v for a package without a best", best)
+	}
+
+	// The bests of an environment are kept apart from those without a key, which are left as they are
+	defer acceptFlags.Set("env", "")
+	writeRecord(t, filepath.Join(root, "a", ".bench_results.json"), map[string]uint64{"BenchmarkA": 90})
+	if code := accept([]string{"-root", root, "-bench", ".", "-env", "ci"}); code != 0 {
+		t.Fatalf("Accept returned %d", code)
+	}
+	if best := loadRecord(filepath.Join(root, "a", ".bench_best@ci.json")).benches; !reflect.DeepEqual(best, map[string]uint64{"BenchmarkA": 90}) {
+		t.Errorf("Accepted %v into the bests of the environment", best)
+	}
+	if best := loadRecord(filepath.Join(root, "a", ".bench_best.json")).benches; best["BenchmarkA"] != 150 {
+		t.Errorf("Accepted %v into the bests of the main branch with -env", best)
+	}
+}
+
+func TestResign(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	file := filepath.Join(root, "a", ".bench_best.json")
+	writeRecord(t, file, map[string]uint64{"BenchmarkA": 100})
+	store := packageStore{root: filepath.Join(root, monorepoStoreDir)}
+	store.save(packageRecord{Package: "example.com/mono", Best: map[string]uint64{"BenchmarkA": 1}})
+
+	os.Setenv("REBENCH_CHECKSUM_KEY", "secret")
+	defer os.Unsetenv("REBENCH_CHECKSUM_KEY")
+	if _, err := readRecord(file); !isChecksumError(err) {
+		t.Errorf("Read a record that isn't signed with %v", err)
+	}
+	if _, err := store.load("example.com/mono"); !isChecksumError(err) {
+		t.Errorf("Loaded a store record that isn't signed with %v", err)
+	}
+	if code := reset([]string{"-root", root}); code == 0 {
+		t.Errorf("Reset records that aren't signed")
+	}
+
+	if code := resign([]string{"-root", root}); code != 0 {
+		t.Fatalf("Resign returned %d", code)
+	}
+	if rec, err := readRecord(file); err != nil || rec.benches["BenchmarkA"] != 100 {
+		t.Errorf("Read %v, %v once signed", rec.benches, err)
+	}
+	if rec, err := store.load("example.com/mono"); err != nil || rec.Best["BenchmarkA"] != 1 {
+		t.Errorf("Loaded %v, %v from the store once signed", rec.Best, err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var bestStoreURL = flag.String("bestStore", "", "Keeps the best on record of every package at this URL rather than in its directory: s3://bucket/prefix, gs://bucket/prefix, or an http(s) URL taking GET and PUT")
+
+// Where the bests are kept with -bestStore, out of the working tree, since CI machines are thrown away after every
+// build. Files are keyed by the import path of their package and their name, e.g. example.com/mod/db/.bench_best.json.
+type remoteStore interface {
+	// Returns errNotStored if there's no such file
+	get(key string) ([]byte, error)
+	put(key string, data []byte) error
+}
+
+var errNotStored = errors.New("not stored")
+
+// The store at the URL. S3 authenticates with the usual $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and
+// $AWS_SESSION_TOKEN in $AWS_REGION, Google Cloud Storage with the OAuth token in $GOOGLE_OAUTH_ACCESS_TOKEN, and
+// plain HTTP with the bearer token in $REBENCH_STORE_TOKEN if there is one.
+func newRemoteStore(rawURL string) (remoteStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, errors.New("-bestStore " + rawURL + " has no bucket")
+		}
+		return s3Store{bucket: u.Host, prefix: prefix, region: envOr("AWS_REGION", "us-east-1"), endpoint: os.Getenv("AWS_ENDPOINT_URL")}, nil
+	case "gs":
+		if u.Host == "" {
+			return nil, errors.New("-bestStore " + rawURL + " has no bucket")
+		}
+		// The XML API of Cloud Storage reads and writes objects like any HTTP server
+		return httpStore{base: "https://storage.googleapis.com/" + path.Join(u.Host, prefix), token: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")}, nil
+	case "http", "https":
+		return httpStore{base: strings.TrimRight(rawURL, "/"), token: os.Getenv("REBENCH_STORE_TOKEN")}, nil
+	}
+
+	return nil, errors.New("-bestStore must be an s3://, gs://, http:// or https:// URL, not " + rawURL)
+}
+
+// The key of a file of a package in a store
+func storeKey(pkgPath, file string) string {
+	return pkgPath + "/" + file
+}
+
+// Loads the best on record of the package from the store, falling back on the main branch's like loadBranchRecord.
+// Only a missing file means there are no bests: any other failure is returned, so the bests aren't replaced.
+func loadStoredRecord(store remoteStore, pkgPath, file string) (benchRecord, error) {
+	raw, err := store.get(storeKey(pkgPath, file))
+	if main := mainBranchFile(file); err == errNotStored && file != main {
+		logInfo("No", file, "in the store yet, comparing with the best of the main branch in", main)
+		raw, err = store.get(storeKey(pkgPath, main))
+	}
+	if err == errNotStored {
+		logInfo("No best benchmarks in the store for", pkgPath)
+		return benchRecord{}, nil
+	}
+	if err != nil {
+		return benchRecord{}, fmt.Errorf("cannot load them from the store: %v", err)
+	}
+
+	return unmarshalRecord(raw)
+}
+
+func saveStoredRecord(store remoteStore, pkgPath, file string, rec benchRecord) error {
+	raw, err := marshalRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	return store.put(storeKey(pkgPath, file), raw)
+}
+
+// A plain HTTP server, or anything that reads and writes files with GET and PUT like one
+type httpStore struct {
+	base, token string
+}
+
+func (s httpStore) get(key string) ([]byte, error) {
+	return s.do("GET", key, nil)
+}
+
+func (s httpStore) put(key string, data []byte) error {
+	_, err := s.do("PUT", key, data)
+	return err
+}
+
+func (s httpStore) do(method, key string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.base+"/"+escapeKey(key), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	return doStoreRequest(req)
+}
+
+// An S3 bucket, or anything speaking its API at $AWS_ENDPOINT_URL such as MinIO, which is addressed by path
+type s3Store struct {
+	bucket, prefix, region string
+	endpoint               string // The bucket's own virtual host on AWS when empty
+}
+
+func (s s3Store) get(key string) ([]byte, error) {
+	return s.do("GET", key, nil)
+}
+
+func (s s3Store) put(key string, data []byte) error {
+	_, err := s.do("PUT", key, data)
+	return err
+}
+
+func (s s3Store) do(method, key string, data []byte) ([]byte, error) {
+	objectPath := "/" + escapeKey(path.Join(s.prefix, key))
+	base := "https://" + s.bucket + ".s3." + s.region + ".amazonaws.com"
+	if s.endpoint != "" {
+		base = strings.TrimRight(s.endpoint, "/")
+		objectPath = "/" + s.bucket + objectPath
+	}
+
+	req, err := http.NewRequest(method, base+objectPath, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := signS3(req, objectPath, data, s.region, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return doStoreRequest(req)
+}
+
+// Signs the request with AWS Signature Version 4, with the credentials in the environment
+func signS3(req *http.Request, objectPath string, data []byte, region string, now time.Time) error {
+	keyID, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if keyID == "" || secret == "" {
+		return errors.New("$AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY must be set to use an S3 -bestStore")
+	}
+
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	payload := sha256.Sum256(data)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+		signed = append(signed, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, h := range signed {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(h + ":" + value + "\n")
+	}
+	canonical := strings.Join([]string{req.Method, objectPath, "", headers.String(), strings.Join(signed, ";"), hex.EncodeToString(payload[:])}, "\n")
+	hashed := sha256.Sum256([]byte(canonical))
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{day, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keyID, scope, strings.Join(signed, ";"), hex.EncodeToString(hmacSHA256(key, toSign))))
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Escapes everything in the key but the characters URIs leave alone and slashes, as S3 signatures expect
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// Sends a request to a store, returning the body of a 2xx response and errNotStored for a 404
+func doStoreRequest(req *http.Request) ([]byte, error) {
+	resp, err := reportClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotStored
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A fake store keeping the files PUT to it in memory, and only answering requests that pass the check
+func fakeStore(t *testing.T, files map[string][]byte, check func(r *http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !check(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			data, ok := files[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case "PUT":
+			data, _ := ioutil.ReadAll(r.Body)
+			files[r.URL.Path] = data
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func TestHTTPStore(t *testing.T) {
+	files := make(map[string][]byte)
+	srv := fakeStore(t, files, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	})
+	defer srv.Close()
+
+	os.Setenv("REBENCH_STORE_TOKEN", "secret")
+	defer os.Unsetenv("REBENCH_STORE_TOKEN")
+	store, err := newRemoteStore(srv.URL + "/bests/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec, _ := loadStoredRecord(store, "example.com/mod/db", mainBestFile); rec.benches != nil {
+		t.Errorf("Loaded %v from an empty store", rec.benches)
+	}
+
+	best := benchRecord{benches: map[string]uint64{"BenchmarkQuery": 61234}}
+	if err := saveStoredRecord(store, "example.com/mod/db", mainBestFile, best); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["/bests/example.com/mod/db/.bench_best.json"]; !ok {
+		t.Fatalf("Saved the best as %v, expected it under the import path of the package", files)
+	}
+
+	// A branch without bests of its own is compared with the main branch's
+	if rec, _ := loadStoredRecord(store, "example.com/mod/db", branchBestFile("feature/x", "main")); !reflect.DeepEqual(rec.benches, best.benches) {
+		t.Errorf("Loaded %v for the branch, expected the main branch's %v", rec.benches, best.benches)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	files := make(map[string][]byte)
+	srv := fakeStore(t, files, func(r *http.Request) bool {
+		return strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") &&
+			strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") &&
+			r.Header.Get("X-Amz-Content-Sha256") != ""
+	})
+	defer srv.Close()
+
+	for name, value := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_REGION": "eu-west-1", "AWS_ENDPOINT_URL": srv.URL} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	store, err := newRemoteStore("s3://bucket/ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.put("example.com/mod/db/.bench_best.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.get("example.com/mod/db/.bench_best.json")
+	if err != nil || string(data) != "{}" {
+		t.Errorf("Got %q (%v) back from the bucket, expected {}", data, err)
+	}
+	if _, ok := files["/bucket/ci/example.com/mod/db/.bench_best.json"]; !ok {
+		t.Errorf("Saved the file as %v, expected it under the prefix in the bucket", files)
+	}
+}
+
+func TestRemoteStoreURLs(t *testing.T) {
+	if store, err := newRemoteStore("gs://bucket/ci/"); err != nil || store != (httpStore{base: "https://storage.googleapis.com/bucket/ci"}) {
+		t.Errorf("Made %#v (%v) of a gs:// URL", store, err)
+	}
+	for _, u := range []string{"s3:///ci", "ftp://host/ci", "bests"} {
+		if _, err := newRemoteStore(u); err == nil {
+			t.Errorf("Accepted %s as a store", u)
+		}
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	if key := escapeKey("example.com/mod/db/.bench_best.fix~1 a+b.json"); key != "example.com/mod/db/.bench_best.fix~1%20a%2Bb.json" {
+		t.Errorf("Escaped the key as %s", key)
+	}
+}
+
+// A store that fails to answer must fail the run rather than have the bests it couldn't load replaced
+func TestFailingBestStore(t *testing.T) {
+	puts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			puts++
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store, err := newRemoteStore(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStoredRecord(store, "example.com/mod/db", mainBestFile); err == nil {
+		t.Errorf("Loaded the bests from a store answering 500")
+	}
+
+	top := cd(t)
+	defer cleanup(top)
+
+	opts := testOptions
+	opts.bestStore = store
+	if code := rebench(opts); code != exitError {
+		t.Errorf("Program returned %d with a store answering 500, expected %d", code, exitError)
+	}
+	if puts != 0 {
+		t.Errorf("Saved the bests %d times in a store they couldn't be loaded from", puts)
+	}
+}
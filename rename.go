@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Moves the records of renamed benchmarks (and of the sub-benchmarks they run) over to their new names, as the
+// "renames" of the config file say, so a renamed benchmark keeps its best rather than going missing and starting
+// afresh. Records only move once the run has the new name and not the old one, and never over a record the new name
+// already has.
+func renameRecord(rec benchRecord, renames map[string]string, run map[string]uint64, pkgPath string) benchRecord {
+	if len(renames) == 0 || len(rec.benches) == 0 {
+		return rec
+	}
+
+	renamed := make(map[string]string)
+	for name := range rec.benches {
+		newName, ok := renamedTo(name, renames)
+		if !ok {
+			continue
+		}
+		_, oldRan := run[name]
+		_, newRan := run[newName]
+		_, taken := rec.benches[newName]
+		if oldRan || !newRan || taken {
+			continue
+		}
+		renamed[name] = newName
+	}
+	if len(renamed) == 0 {
+		return rec
+	}
+
+	out := rec
+	out.benches = make(map[string]uint64, len(rec.benches))
+	for name, speed := range rec.benches {
+		out.benches[renameOf(name, renamed)] = speed
+	}
+	if rec.metrics != nil {
+		out.metrics = make(benchMetrics, len(rec.metrics))
+		for name, units := range rec.metrics {
+			out.metrics[renameOf(name, renamed)] = units
+		}
+	}
+	if rec.stats != nil {
+		out.stats = make(map[string]benchStats, len(rec.stats))
+		for name, s := range rec.stats {
+			out.stats[renameOf(name, renamed)] = s
+		}
+	}
+	if rec.revisions != nil {
+		out.revisions = make(map[string]revision, len(rec.revisions))
+		for name, r := range rec.revisions {
+			out.revisions[renameOf(name, renamed)] = r
+		}
+	}
+	if rec.pending != nil {
+		out.pending = make(map[string]pendingRecord, len(rec.pending))
+		for name, p := range rec.pending {
+			out.pending[renameOf(name, renamed)] = p
+		}
+	}
+	for _, name := range sortedNames(rec.benches) {
+		if newName, ok := renamed[name]; ok {
+			logInfo("Carrying the record of", pkgPath, name, "over to", newName+", which the config file renames it to")
+		}
+	}
+
+	return out
+}
+
+func renameOf(name string, renamed map[string]string) string {
+	if newName, ok := renamed[name]; ok {
+		return newName
+	}
+
+	return name
+}
+
+// The new name of a benchmark renamed itself, or run by a renamed benchmark, e.g. BenchmarkNew/large for
+// BenchmarkOld/large when BenchmarkOld is renamed BenchmarkNew
+func renamedTo(name string, renames map[string]string) (string, bool) {
+	if newName, ok := renames[name]; ok {
+		return newName, true
+	}
+	for _, parent := range benchParents(name) {
+		if newName, ok := renames[parent]; ok {
+			return newName + strings.TrimPrefix(name, parent), true
+		}
+	}
+
+	return "", false
+}
+
+// Renames must each go somewhere new, and only once
+func validateRenames(renames map[string]string) error {
+	for oldName, newName := range renames {
+		if oldName == "" || newName == "" || oldName == newName {
+			return errors.New("rename " + oldName + " -> " + newName + " must be between two different names")
+		}
+		if _, ok := renames[newName]; ok {
+			return errors.New(oldName + " is renamed " + newName + ", which is renamed in turn; rename it to the final name")
+		}
+	}
+
+	return nil
+}
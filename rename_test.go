@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenameRecord(t *testing.T) {
+	renames := map[string]string{"BenchmarkOld": "BenchmarkNew", "BenchmarkGone": "BenchmarkNotRunYet"}
+	rec := benchRecord{
+		benches: map[string]uint64{"BenchmarkOld": 100, "BenchmarkOld/large": 1000, "BenchmarkGone": 10, "BenchmarkKept": 5},
+		stats:   map[string]benchStats{"BenchmarkOld": {N: 3, Mean: 100, Median: 100, Stddev: 1}},
+	}
+	run := map[string]uint64{"BenchmarkNew": 105, "BenchmarkNew/large": 990, "BenchmarkKept": 5}
+
+	renamed := renameRecord(rec, renames, run, "example.com/mod")
+	expected := map[string]uint64{"BenchmarkNew": 100, "BenchmarkNew/large": 1000, "BenchmarkGone": 10, "BenchmarkKept": 5}
+	if !reflect.DeepEqual(renamed.benches, expected) {
+		t.Errorf("Renamed the bests to %v, expected %v", renamed.benches, expected)
+	}
+	if _, ok := renamed.stats["BenchmarkNew"]; !ok {
+		t.Errorf("Left the distribution of BenchmarkOld behind: %v", renamed.stats)
+	}
+	if _, ok := rec.benches["BenchmarkOld"]; !ok {
+		t.Errorf("Renamed the record in place")
+	}
+
+	// Until the old name is gone from the run, it keeps its record
+	run["BenchmarkOld"] = 100
+	if renamed := renameRecord(rec, renames, run, "example.com/mod"); renamed.benches["BenchmarkOld"] != 100 || renamed.benches["BenchmarkNew"] != 0 {
+		t.Errorf("Renamed a benchmark that still ran: %v", renamed.benches)
+	}
+}
+
+func TestValidateRenames(t *testing.T) {
+	if err := validateRenames(map[string]string{"BenchmarkA": "BenchmarkB"}); err != nil {
+		t.Error(err)
+	}
+	for _, renames := range []map[string]string{{"BenchmarkA": "BenchmarkA"}, {"BenchmarkA": "BenchmarkB", "BenchmarkB": "BenchmarkC"}, {"BenchmarkA": ""}} {
+		if err := validateRenames(renames); err == nil {
+			t.Errorf("Accepted the renames %v", renames)
+		}
+	}
+}
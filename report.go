@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	verdictPassing = "passing"
+	verdictFailing = "failing"
+	verdictUnknown = "unknown"
+)
+
+// The classified run of a single package. The server keys packages by their slash-separated path relative to the
+// served directory, everything else by import path.
+type packageRun struct {
+	Package string
+	Results []benchResult
+	Metrics []metricResult // Every metric reported besides ns/op, see the config file's units
+	Table   string         // The aligned comparison, as written to bench_comparison.txt. Empty on the server.
+	Owners  []string       // The owners of the package according to CODEOWNERS, only looked up when it has regressions
+	Crashed string         // The benchmark go test failed in, e.g. because it panicked, with the results of those before it
+
+	WallTime         time.Duration // How long go test took to benchmark the package, zero on the server
+	PreviousWallTime time.Duration // The wall time of the run before, zero if there's none on record
+
+	Matrix string // The aligned comparison with every -matrix reference, also at the end of the Table
+
+	Geomean       float64 // The geomean of the factors between the benchmarks that may fail the run and their best, zero if none were compared
+	Index         float64 // The performance index against the first run on record, zero if no benchmark ran
+	PreviousIndex float64 // The index of the run before, zero if there's none on record
+}
+
+// Everything there is to report about a finished run. Its exported methods are there for user-supplied templates.
+type runReport struct {
+	Runs                      []packageRun
+	Missing, TooSlow, TooLong bool // Whether the run fails because of missing or too slow benchmarks, or packages taking too long to benchmark
+	Mismatched                bool // Whether the run fails because bests were set in a different environment, with -strictEnv
+
+	Geomean       float64 // The geomean of every package's geomean, weighted as the config file says
+	Index         float64 // The performance index across packages, weighted as the config file says
+	PreviousIndex float64 // The weighted index of the run before, zero if there's none on record
+
+	Revision revision // What the run benchmarked
+}
+
+// Sends the results of a run somewhere once every package has been compared
+type reporter interface {
+	report(r runReport) error
+}
+
+var reportClient = &http.Client{Timeout: 30 * time.Second}
+
+// Starts every comment rebench leaves on a pull request, so later runs can find it and update it instead of piling up comments
+const commentMarker = "<!-- rebench -->"
+
+// Builds the reporters enabled on the command line
+func configuredReporters() ([]reporter, error) {
+	var reporters []reporter
+	if *gerritURL != "" {
+		reporters = append(reporters, gerritReporter{baseURL: *gerritURL, change: *gerritChange, revision: *gerritRevision, label: *gerritLabel})
+	}
+	if *bitbucket {
+		reporters = append(reporters, bitbucketReporter{apiURL: *bitbucketAPI, repo: *bitbucketRepo, commit: *bitbucketCommit, pullRequest: *bitbucketPR})
+	}
+	if *giteaURL != "" {
+		reporters = append(reporters, giteaReporter{baseURL: *giteaURL, repo: *giteaRepo, pullRequest: *giteaPR})
+	}
+	if *githubPR != "" {
+		github, err := newGitHubReporter(*githubAPI, *githubPR)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, github)
+	}
+	if *gitlabMR != "" {
+		gitlab, err := newGitLabReporter(*gitlabAPI, *gitlabMR)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, gitlab)
+	}
+	if *gitlabMetrics != "" || *gitlabCodeQuality != "" {
+		artifacts, err := newGitLabArtifactsReporter(*gitlabMetrics, *gitlabCodeQuality)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, artifacts)
+	}
+	if *templateFile != "" {
+		tmpl, err := newTemplateReporter(*templateFile, *templateOut)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, tmpl)
+	}
+	if *reportFormat == formatMarkdown {
+		reporters = append(reporters, markdownReporter{w: os.Stdout})
+	}
+	if *jsonSummary {
+		reporters = append(reporters, jsonReporter{w: os.Stdout})
+	}
+	if *junitOut != "" {
+		junit, err := newJUnitReporter(*junitOut)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, junit)
+	}
+	if *htmlOut != "" {
+		html, err := newHTMLReporter(*htmlOut)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, html)
+	}
+	if *promFile != "" || *pushgateway != "" {
+		prom, err := newPrometheusReporter(*promFile, *pushgateway)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, prom)
+	}
+	if *influxOut != "" {
+		influx, err := newInfluxReporter(*influxOut)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, influx)
+	}
+	if *notifyURL != "" {
+		notify, err := newNotifyReporter(*notifyURL, *notifyFormat)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, notify)
+	}
+	if *postURL != "" {
+		post, err := newPostReporter(*postURL, *postTemplate, *postContentType)
+		if err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, post)
+	}
+
+	return reporters, nil
+}
+
+// Whether the run fails because of missing or too slow benchmarks, or packages taking too long to benchmark
+func (r runReport) Failed() bool {
+	return r.Missing || r.TooSlow || r.TooLong || r.Mismatched
+}
+
+// The number of benchmarks with the status across every package, including those that didn't fail the run (e.g. because of -gateChanged).
+func (r runReport) Count(status benchStatus) int {
+	count := 0
+	for _, run := range r.Runs {
+		count += countStatus(run.Results, status)
+	}
+
+	return count
+}
+
+// How many benchmarks a comparison has of each kind, for the line heading it
+type resultCounts struct {
+	Total     int `json:"total"`
+	Regressed int `json:"regressed"` // Too slow
+	Improved  int `json:"improved"`  // New records
+	New       int `json:"new"`
+	Missing   int `json:"missing"`
+}
+
+func countResults(results []benchResult) resultCounts {
+	return resultCounts{
+		Total:     len(results),
+		Regressed: countStatus(results, statusSlow),
+		Improved:  countStatus(results, statusRecord),
+		New:       countStatus(results, statusNew),
+		Missing:   countStatus(results, statusMissing),
+	}
+}
+
+// e.g. "12 benchmarks: 1 regressed, 2 improved, 0 new, 1 missing"
+func (c resultCounts) String() string {
+	return fmt.Sprintf("%d benchmarks: %d regressed, %d improved, %d new, %d missing", c.Total, c.Regressed, c.Improved, c.New, c.Missing)
+}
+
+// The counts of the package's benchmarks and their geomean, heading its comparison
+func (run packageRun) Heading() string {
+	return formatHeading(countResults(run.Results), run.Geomean)
+}
+
+func formatHeading(counts resultCounts, geomean float64) string {
+	if geomean == 0 {
+		return counts.String()
+	}
+
+	return counts.String() + ", geomean " + formatFactor(geomean)
+}
+
+// The counts of every package's benchmarks added up
+func (r runReport) Counts() resultCounts {
+	var total resultCounts
+	for _, run := range r.Runs {
+		c := countResults(run.Results)
+		total.Total += c.Total
+		total.Regressed += c.Regressed
+		total.Improved += c.Improved
+		total.New += c.New
+		total.Missing += c.Missing
+	}
+
+	return total
+}
+
+// The overall counts heading the comparisons of every package, e.g. "3 packages, 40 benchmarks: 2 regressed, ..."
+func (r runReport) Overview() string {
+	return fmt.Sprintf("%d packages, %s", len(r.Runs), r.Counts())
+}
+
+// The verdict of the run as a whole, either "passing" or "failing"
+func (r runReport) Verdict() string {
+	if r.Failed() {
+		return verdictFailing
+	}
+
+	return verdictPassing
+}
+
+// A one-line verdict for reporters to lead with
+func (r runReport) Summary() string {
+	return fmt.Sprintf("rebench %s: %d benchmarks too slow, %d missing", r.Verdict(), r.Count(statusSlow), r.Count(statusMissing))
+}
+
+// Factors read better as multipliers
+func formatFactor(factor float64) string {
+	return strconv.FormatFloat(factor, 'f', 2, 64) + "x"
+}
+
+// Whether Markdown lays comparisons out as Markdown tables with emoji (-emoji)
+var markdownEmoji bool
+
+var reportFormat = flag.String("format", formatText, "The format of the report printed on stdout once every package has been compared: text (none, the comparisons are in bench_comparison.txt) or markdown, for pull request comments")
+
+const (
+	formatText     = "text"
+	formatMarkdown = "markdown"
+)
+
+// Prints the Markdown report, e.g. for a CI job to paste into a pull request comment
+type markdownReporter struct {
+	w io.Writer
+}
+
+func (m markdownReporter) report(r runReport) error {
+	_, err := io.WriteString(m.w, r.Markdown())
+	return err
+}
+
+var statusEmoji = map[benchStatus]string{
+	statusOK:      "✅",
+	statusSlow:    "❌",
+	statusRecord:  "🚀",
+	statusNew:     "🆕",
+	statusMissing: "❓",
+}
+
+// The summary followed by the comparison of every package in a code block, or a Markdown table with -emoji, for
+// anything that renders Markdown
+func (r runReport) Markdown() string {
+	md := "**" + r.Summary() + "**\n\n" + r.Overview() + "\n"
+	if r.Geomean > 0 {
+		md += "\n" + formatGeomean("Weighted geomean across packages", r.Geomean) + "\n"
+	}
+	if r.Index > 0 {
+		md += "\n" + formatIndex("Weighted performance index across packages", r.Index, r.PreviousIndex) + "\n"
+	}
+	for _, run := range r.Runs {
+		if markdownEmoji {
+			md += "\n`" + run.Package + "`\n\n" + run.Heading() + "\n\n" + run.markdownTable()
+		} else {
+			md += "\n`" + run.Package + "`\n```\n" + strings.TrimRight(run.Table, "\n") + "\n```\n"
+		}
+	}
+
+	return md
+}
+
+// The comparison as a Markdown table, followed by what's below the table in bench_comparison.txt
+func (run packageRun) markdownTable() string {
+	md := "| | Benchmark | New Speed | Best Speed | Factor |\n|---|---|--:|--:|--:|\n"
+	for _, res := range sortedResults(run.Results, *resultOrder) {
+		speed, best, factor := numbers.speed(res.Speed), numbers.speed(res.BestSpeed), formatFactor(res.Factor)
+		switch res.Status {
+		case statusMissing:
+			speed, factor = "", ""
+		case statusNew:
+			best, factor = "", ""
+		}
+		md += "| " + statusEmoji[res.Status] + " | " + strings.Replace(res.Name, "|", `\|`, -1) + " | " + speed + " | " + best + " | " + factor + " |\n"
+	}
+
+	if run.WallTime > 0 {
+		md += "\n" + formatWallTime(run.WallTime, run.PreviousWallTime) + "\n"
+	}
+	if run.Geomean > 0 {
+		md += "\n" + formatGeomean("Geomean", run.Geomean) + "\n"
+	}
+	if run.Index > 0 {
+		md += "\n" + formatIndex("Performance index", run.Index, run.PreviousIndex) + "\n"
+	}
+	if len(run.Owners) > 0 {
+		md += "\nOwned by " + strings.Join(run.Owners, " ") + "\n"
+	}
+	if len(run.Metrics) > 0 {
+		md += "\n```\n" + metricsTable(run.Metrics).String() + "```\n"
+	}
+	if run.Matrix != "" {
+		md += "\n```\n" + run.Matrix + "```\n"
+	}
+
+	return md
+}
+
+// Builds a request with the JSON encoding of the body, or no body at all if it's nil
+func jsonRequest(method, url string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		out, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(out)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// Sends the request, failing on anything but a 2xx response. The JSON response is decoded into the value unless it's nil.
+func send(req *http.Request, into interface{}) error {
+	resp, err := reportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	if into != nil {
+		return json.NewDecoder(resp.Body).Decode(into)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdown(t *testing.T) {
+	r := testReport()
+	md := r.Markdown()
+	if !strings.HasPrefix(md, "**rebench failing: 1 benchmarks too slow, 0 missing**\n") || !strings.Contains(md, "```\n"+strings.TrimRight(r.Runs[0].Table, "\n")+"\n```\n") {
+		t.Errorf("Markdown is missing the summary or the comparison:\n%s", md)
+	}
+}
+
+func TestMarkdownEmoji(t *testing.T) {
+	defer func(e bool) { markdownEmoji = e }(markdownEmoji)
+	markdownEmoji = true
+
+	r := testReport()
+	r.Runs[0].WallTime = 2 * time.Second
+	r.Runs[0].Owners = []string{"@perf"}
+
+	expected := "**rebench failing: 1 benchmarks too slow, 0 missing**\n" +
+		"\n1 packages, 2 benchmarks: 1 regressed, 0 improved, 0 new, 0 missing\n" +
+		"\n`example.com/pkg`\n\n" +
+		"2 benchmarks: 1 regressed, 0 improved, 0 new, 0 missing\n\n" +
+		"| | Benchmark | New Speed | Best Speed | Factor |\n" +
+		"|---|---|--:|--:|--:|\n" +
+		"| ❌ | BenchmarkA | 300 | 100 | 3.00x |\n" +
+		"| ✅ | BenchmarkB | 100 | 100 | 1.00x |\n" +
+		"\nBenchmarking took 2s\n" +
+		"\nOwned by @perf\n"
+	if md := r.Markdown(); md != expected {
+		t.Errorf("Rendered\n%s\nexpected\n%s", md, expected)
+	}
+}
+
+func TestMarkdownReporter(t *testing.T) {
+	var out strings.Builder
+	r := testReport()
+	if err := (markdownReporter{w: &out}).report(r); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != r.Markdown() {
+		t.Errorf("Printed\n%s\nexpected\n%s", out.String(), r.Markdown())
+	}
+}
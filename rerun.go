@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var rerunTimes = flag.Int("rerun", 0, "Re-runs every benchmark slower than -speedTol allows this many times before failing on it, and only fails if it's slow again in most of them")
+
+// Re-runs the slow benchmarks of a package to make sure they really regressed, so a single noisy run doesn't fail
+// the build. Does nothing if times is 0.
+type rerunner struct {
+	pkgPath string
+	dir     string // The directory of the package, which go test runs in
+	times   int
+	flags   []string // The go test flags of the run, see goTestFlags
+}
+
+// Judges what the benchmarks of a package ran in, the way the run itself was judged
+type rerunJudge func(benches map[string]uint64) []benchResult
+
+// Turns every slow benchmark that isn't slow again in most of the reruns it ran in into an OK one. Only reruns that
+// gave the benchmark a speed count: one it's missing from says nothing, and a benchmark that didn't run again, or any
+// rerun that failed, leaves it slow.
+func (r rerunner) confirm(results []benchResult, judge rerunJudge) {
+	var slow []string
+	for _, res := range results {
+		if res.Status == statusSlow {
+			slow = append(slow, res.Name)
+		}
+	}
+	if r.times <= 0 || len(slow) == 0 {
+		return
+	}
+
+	logInfo("Re-running", len(slow), "slow benchmarks of", r.pkgPath, r.times, "times to make sure they regressed")
+	ran, reproduced := make(map[string]int, len(slow)), make(map[string]int, len(slow))
+	failed := false
+	for i := 0; i < r.times; i++ {
+		benches, err := r.run(slow)
+		if err != nil {
+			logError("Couldn't re-run the slow benchmarks of", r.pkgPath+", leaving them slow:", err)
+			failed = true
+			break
+		}
+		statuses := make(map[string]benchStatus, len(benches))
+		for _, res := range judge(benches) {
+			statuses[res.Name] = res.Status
+		}
+		for _, name := range slow {
+			if _, ok := benches[name]; !ok {
+				logWarn("Benchmark", name, "of", r.pkgPath, "didn't run again in rerun", i+1)
+				continue
+			}
+			ran[name]++
+			if statuses[name] == statusSlow {
+				reproduced[name]++
+			}
+		}
+	}
+	if failed {
+		return
+	}
+
+	for i, res := range results {
+		if res.Status != statusSlow {
+			continue
+		}
+		switch n, m := reproduced[res.Name], ran[res.Name]; {
+		case m == 0:
+			logWarn("Benchmark", res.Name, "didn't run again in any rerun, leaving it slow")
+		case 2*n <= m:
+			logInfo("Benchmark", res.Name, "was only slow again in", n, "of", m, "reruns, not failing because of it")
+			results[i].Status = statusOK
+		default:
+			logWarn("Benchmark", res.Name, "was slow again in", n, "of", m, "reruns")
+		}
+	}
+}
+
+// Runs only the benchmarks given once, returning their ns/op. Benchmarks whose names kept their GOMAXPROCS suffix run
+// with -cpu set to it, in a go test of their own for every GOMAXPROCS.
+func (r rerunner) run(names []string) (map[string]uint64, error) {
+	byProcs := make(map[string][]string)
+	var allProcs []string
+	for _, name := range names {
+		trimmed, procs := benchProcs(name)
+		if _, ok := byProcs[procs]; !ok {
+			allProcs = append(allProcs, procs)
+		}
+		byProcs[procs] = append(byProcs[procs], trimmed)
+	}
+	sort.Strings(allProcs)
+
+	benches := make(map[string]uint64)
+	for _, procs := range allProcs {
+		// The last -cpu wins, over that of the run
+		args := []string{"test", "-json", "-bench=" + rerunPattern(byProcs[procs])}
+		args = append(args, r.flags...)
+		if procs != "" {
+			args = append(args, "-cpu="+procs)
+		}
+		args = append(args, r.pkgPath)
+
+		cmd := exec.Command("go", args...)
+		cmd.Dir = r.dir
+		out, runErr := cmd.CombinedOutput()
+		err := streamBenchResults(bytes.NewReader(out), func(out packageOutput) {
+			for name, speed := range out.benches {
+				benches[name] = speed
+			}
+		})
+		if runErr != nil {
+			return benches, runErr
+		}
+		if err != nil {
+			return benches, err
+		}
+	}
+
+	return benches, nil
+}
+
+// A -bench pattern matching the benchmarks. go test matches each level of a sub-benchmark's name on its own, so the
+// pattern has a level for each level of the names, which may run a few benchmarks more than asked for but never
+// fewer.
+func rerunPattern(names []string) string {
+	var levels []map[string]bool
+	for _, name := range names {
+		for i, part := range benchPath(name) {
+			if i == len(levels) {
+				levels = append(levels, make(map[string]bool))
+			}
+			levels[i][part] = true
+		}
+	}
+
+	patterns := make([]string, len(levels))
+	for i, parts := range levels {
+		quoted := make([]string, 0, len(parts))
+		for part := range parts {
+			quoted = append(quoted, regexp.QuoteMeta(part))
+		}
+		sort.Strings(quoted)
+		patterns[i] = "^(" + strings.Join(quoted, "|") + ")$"
+	}
+
+	return strings.Join(patterns, "/")
+}
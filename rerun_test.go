@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRerunPattern(t *testing.T) {
+	expected := "^(BenchmarkA|BenchmarkParse)$/^(json|large)$/^(xml)$"
+	if pattern := rerunPattern([]string{"BenchmarkParse/large/xml", "BenchmarkParse/json", "BenchmarkA"}); pattern != expected {
+		t.Errorf("Matched the benchmarks with %s, expected %s", pattern, expected)
+	}
+	if pattern := rerunPattern([]string{"BenchmarkA.B"}); pattern != `^(BenchmarkA\.B)$` {
+		t.Errorf("Didn't quote the name in %s", pattern)
+	}
+}
+
+func TestRerunConfirm(t *testing.T) {
+	top := cd(t)
+	defer os.Chdir(top)
+
+	results := []benchResult{{Name: "BenchmarkSleep", Status: statusSlow}, {Name: "BenchmarkSleep2", Status: statusOK}}
+	var rerun map[string]uint64
+	r := rerunner{pkgPath: ".", times: 1, flags: goTestFlags(runOptions{benchtime: "1x"})}
+	r.confirm(results, func(benches map[string]uint64) []benchResult {
+		rerun = benches
+		return []benchResult{{Name: "BenchmarkSleep", Status: statusOK}}
+	})
+	if _, ok := rerun["BenchmarkSleep"]; !ok || len(rerun) != 1 {
+		t.Errorf("Re-ran %v, expected only BenchmarkSleep", rerun)
+	}
+	if results[0].Status != statusOK {
+		t.Errorf("Kept a benchmark that wasn't slow again as %s", results[0].Status)
+	}
+
+	// Names with the suffix of -keepProcs run with their GOMAXPROCS, and a benchmark that didn't run again stays slow
+	trimProcs = false
+	defer func() { trimProcs = true }()
+	defer func(procs []int) { runProcs = procs }(runProcs)
+	runProcs = []int{2}
+	results = []benchResult{{Name: "BenchmarkSleep-2", Status: statusSlow}, {Name: "BenchmarkGone-2", Status: statusSlow}}
+	r.confirm(results, func(benches map[string]uint64) []benchResult {
+		rerun = benches
+		return []benchResult{{Name: "BenchmarkSleep-2", Status: statusSlow}, {Name: "BenchmarkGone-2", Status: statusMissing}}
+	})
+	if _, ok := rerun["BenchmarkSleep-2"]; !ok || len(rerun) != 1 {
+		t.Errorf("Re-ran %v, expected only BenchmarkSleep-2", rerun)
+	}
+	if results[0].Status != statusSlow || results[1].Status != statusSlow {
+		t.Errorf("Judged the reruns as %s and %s, expected both slow", results[0].Status, results[1].Status)
+	}
+	trimProcs = true
+
+	// A rerun that fails leaves every benchmark slow
+	results = []benchResult{{Name: "BenchmarkSleep", Status: statusSlow}}
+	failing := rerunner{pkgPath: "./nonexistent", times: 1}
+	failing.confirm(results, func(benches map[string]uint64) []benchResult {
+		t.Errorf("Judged the failed rerun %v", benches)
+		return nil
+	})
+	if results[0].Status != statusSlow {
+		t.Errorf("Judged a benchmark whose rerun failed as %s", results[0].Status)
+	}
+
+	results[0].Status = statusSlow
+	r.times = 0
+	r.confirm(results, func(benches map[string]uint64) []benchResult {
+		t.Errorf("Re-ran the benchmarks without -rerun")
+		return nil
+	})
+	if results[0].Status != statusSlow {
+		t.Errorf("Changed the status of a slow benchmark without -rerun")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	reviewFlags   = flag.NewFlagSet("review", flag.ExitOnError)
+	reviewRoot    = reviewFlags.String("root", ".", "The directory containing the packages to review")
+	reviewHistory = reviewFlags.String("file", historyFile, "The history file to show the runs of a benchmark from")
+	reviewBests   = bestFileFlags(reviewFlags)
+)
+
+const reviewHelp = `Commands:
+  l        Lists the benchmarks again
+  s        Sorts by factor, worst first, or back by package and name
+  a N      Accepts the latest speed of benchmark N as its best
+  r N      Re-runs benchmark N once and compares it with its best
+  h N      Shows the runs of benchmark N in the history
+  q        Quits`
+
+// A benchmark under review, as the latest run of its package compares with its best
+type reviewRow struct {
+	pkg        string // As rebench show names it
+	pkgGo      string // What go test runs the package as from the root
+	importPath string // As the history names it, only known up front for the records of a -monorepo store
+	benchResult
+}
+
+// A review of the latest runs beneath a directory, prompting for one command per line read from in and written to out
+type review struct {
+	root                string
+	bestFile            string // The name of the files of the bests, see bestFileFlags
+	speedTol, recordTol float64
+	history             string
+	rows                []reviewRow
+	byFactor            bool
+	out                 io.Writer
+}
+
+// Reviews the latest runs of the packages beneath -root at a line-oriented prompt, one command at a time: listing how
+// each benchmark compares with its best, sorting them by factor, accepting single benchmarks, re-running them and
+// showing their history
+func reviewLatest(args []string, speedTolPercent, recordTolPercent int) int {
+	reviewFlags.Parse(args)
+	bestFile, err := reviewBests()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	r := &review{root: *reviewRoot, bestFile: bestFile, speedTol: float64(speedTolPercent) / 100, recordTol: float64(recordTolPercent) / 100, history: *reviewHistory, out: os.Stdout}
+	if err := r.load(); err != nil {
+		logError("Cannot load the records:", err)
+		return exitError
+	}
+	if len(r.rows) == 0 {
+		fmt.Fprintln(os.Stderr, "No package beneath", r.root, "has been benchmarked yet")
+		return exitError
+	}
+
+	r.list()
+	fmt.Fprintln(r.out, reviewHelp)
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(r.out, "> ")
+		if !in.Scan() || !r.handle(in.Text()) {
+			break
+		}
+	}
+
+	return exitOK
+}
+
+// Compares the latest run of every package beneath the root, including the -monorepo store, with its best
+func (r *review) load() error {
+	dirs, err := recordDirs(r.root)
+	if err != nil {
+		return err
+	}
+	r.rows = nil
+	for _, pkg := range sortedKeys(dirs) {
+		best, err := readBranchRecord(dirs[pkg], r.bestFile)
+		if err != nil {
+			return err
+		}
+		last := loadRecord(filepath.Join(dirs[pkg], ".bench_results.json"))
+		pkgGo := "./" + pkg
+		if pkg == "." {
+			pkgGo = "."
+		}
+		r.add(pkg, pkgGo, "", best.benches, last.benches)
+	}
+
+	records, err := packageStore{root: filepath.Join(r.root, monorepoStoreDir)}.all()
+	if err != nil {
+		return err
+	}
+	sort.Slice(records, func(a, b int) bool { return records[a].Package < records[b].Package })
+	for _, rec := range records {
+		r.add(rec.Package, rec.Package, rec.Package, rec.Best, rec.Results)
+	}
+
+	r.sort()
+	return nil
+}
+
+func (r *review) add(pkg, pkgGo, importPath string, best, last map[string]uint64) {
+	for _, res := range classify(best, last, r.speedTol, r.recordTol) {
+		r.rows = append(r.rows, reviewRow{pkg: pkg, pkgGo: pkgGo, importPath: importPath, benchResult: res})
+	}
+}
+
+func (r *review) sort() {
+	sort.SliceStable(r.rows, func(a, b int) bool {
+		if r.byFactor {
+			return reviewFactor(r.rows[a].benchResult) > reviewFactor(r.rows[b].benchResult)
+		}
+		if r.rows[a].pkg != r.rows[b].pkg {
+			return r.rows[a].pkg < r.rows[b].pkg
+		}
+		return r.rows[a].Name < r.rows[b].Name
+	})
+}
+
+// How much slower a benchmark got, infinitely for a missing one, which is worse than any
+func reviewFactor(res benchResult) float64 {
+	switch res.Status {
+	case statusMissing:
+		return math.Inf(1)
+	case statusNew:
+		return 0
+	}
+
+	return res.Factor
+}
+
+func (r *review) list() {
+	tbl := newTable("Status", "#", "Package", "Benchmark Name", "New Speed", "Best Speed", "Factor (New/Old)")
+	tbl.align = []alignment{alignLeft, alignRight, alignLeft, alignLeft, alignRight, alignRight, alignRight}
+	for i, row := range r.rows {
+		speed, best, factor := numbers.speed(row.Speed), numbers.speed(row.BestSpeed), formatFactor(row.Factor)
+		switch row.Status {
+		case statusNew:
+			best, factor = "", ""
+		case statusMissing:
+			speed, factor = "", ""
+		}
+		tbl.addRow(string(row.Status), strconv.Itoa(i+1), row.pkg, row.Name, speed, best, factor)
+	}
+	fmt.Fprint(r.out, colorize(tbl.String()))
+}
+
+// Carries out a command, returning false once the review is over
+func (r *review) handle(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "q", "quit":
+		return false
+	case "l":
+		r.list()
+	case "s":
+		r.byFactor = !r.byFactor
+		r.sort()
+		r.list()
+	case "a", "r", "h":
+		if len(fields) != 2 {
+			fmt.Fprintln(r.out, "Which benchmark? E.g.", fields[0], "1")
+			return true
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > len(r.rows) {
+			fmt.Fprintln(r.out, "There's no benchmark", fields[1])
+			return true
+		}
+		row := r.rows[n-1]
+		switch fields[0] {
+		case "a":
+			r.accept(row)
+		case "r":
+			r.rerun(row)
+		case "h":
+			r.showHistory(row)
+		}
+	default:
+		fmt.Fprintln(r.out, reviewHelp)
+	}
+
+	return true
+}
+
+// Makes the latest speed of the benchmark its best, like rebench accept does
+func (r *review) accept(row reviewRow) {
+	if row.Status == statusMissing {
+		fmt.Fprintln(r.out, row.Name, "wasn't in the latest run, there's nothing to accept")
+		return
+	}
+
+	err := rewriteBests(r.root, r.bestFile, func(pkg string, best, last benchRecord) benchRecord {
+		if pkg != row.pkg {
+			return best
+		}
+		return acceptLatest(pkg, best, last, func(name string) bool { return name == row.Name })
+	})
+	if err != nil {
+		fmt.Fprintln(r.out, "Cannot accept", row.Name+":", err)
+		return
+	}
+	fmt.Fprintln(r.out, "Accepted", row.Name, "of", row.pkg, "at", numbers.speedPerOp(row.Speed))
+
+	if err := r.load(); err != nil {
+		fmt.Fprintln(r.out, "Cannot reload the records:", err)
+		return
+	}
+	r.list()
+}
+
+// Runs the benchmark once more, without recording anything
+func (r *review) rerun(row reviewRow) {
+	fmt.Fprintln(r.out, "Running", row.Name, "of", row.pkg+"...")
+	benches, err := rerunner{pkgPath: row.pkgGo, dir: r.root, flags: goTestFlags(runOptions{})}.run([]string{row.Name})
+	if err != nil {
+		fmt.Fprintln(r.out, "Cannot run", row.Name+":", err)
+		return
+	}
+	speed, ok := benches[row.Name]
+	if !ok {
+		fmt.Fprintln(r.out, row.Name, "didn't run")
+		return
+	}
+
+	if row.Status == statusNew {
+		fmt.Fprintln(r.out, row.Name, "ran at", numbers.speedPerOp(speed)+", with no best to compare with")
+		return
+	}
+	res := classify(map[string]uint64{row.Name: row.BestSpeed}, map[string]uint64{row.Name: speed}, r.speedTol, r.recordTol)[0]
+	fmt.Fprintln(r.out, row.Name, "ran at", numbers.speedPerOp(speed)+",", formatFactor(res.Factor), "its best:", res.Status)
+}
+
+// Shows the runs of the benchmark of that package alone, as other packages may have benchmarks of the same name
+func (r *review) showHistory(row reviewRow) {
+	pkgPath := row.importPath
+	if pkgPath == "" {
+		cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}", row.pkgGo)
+		cmd.Dir = r.root
+		out, err := cmd.Output()
+		if err != nil {
+			fmt.Fprintln(r.out, "Cannot tell the import path of", row.pkg+":", err)
+			return
+		}
+		pkgPath = strings.TrimSpace(string(out))
+	}
+
+	f, err := os.Open(filepath.Join(r.root, r.history))
+	if err != nil {
+		fmt.Fprintln(r.out, "Cannot open the history, which is only kept with -history:", err)
+		return
+	}
+	defer f.Close()
+
+	entries, err := readHistory(f)
+	if err != nil {
+		fmt.Fprintln(r.out, "Cannot read the history:", err)
+		return
+	}
+	fmt.Fprint(r.out, historyTable(entries, row.Name, pkgPath).String())
+}
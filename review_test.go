@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReview(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "db")
+	writeRecord(t, filepath.Join(dir, ".bench_best.json"), map[string]uint64{"BenchmarkA": 100, "BenchmarkB": 100, "BenchmarkC": 100})
+	writeRecord(t, filepath.Join(dir, ".bench_results.json"), map[string]uint64{"BenchmarkA": 300, "BenchmarkB": 110, "BenchmarkD": 50})
+
+	var out bytes.Buffer
+	r := &review{root: root, bestFile: mainBestFile, speedTol: 1.5, recordTol: 0.7, history: historyFile, out: &out}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.rows) != 4 {
+		t.Fatalf("Loaded %v, expected a row for every benchmark", r.rows)
+	}
+
+	r.handle("s")
+	var order []string
+	for _, row := range r.rows {
+		order = append(order, row.Name)
+	}
+	if strings.Join(order, " ") != "BenchmarkC BenchmarkA BenchmarkB BenchmarkD" {
+		t.Errorf("Sorted by factor as %v, expected the missing benchmark, then the slowest first", order)
+	}
+
+	out.Reset()
+	if !r.handle("a 2") {
+		t.Fatal("Quit on accepting a benchmark")
+	}
+	if best := loadRecord(filepath.Join(dir, ".bench_best.json")).benches; best["BenchmarkA"] != 300 || best["BenchmarkB"] != 100 {
+		t.Errorf("Accepted BenchmarkA as %v, expected only it at its latest speed", best)
+	}
+	if !strings.Contains(out.String(), "Accepted BenchmarkA of db") {
+		t.Errorf("Printed\n%s\nafter accepting BenchmarkA", out.String())
+	}
+
+	out.Reset()
+	r.handle("a 9")
+	if !strings.Contains(out.String(), "There's no benchmark 9") {
+		t.Errorf("Printed\n%s\nfor a benchmark that doesn't exist", out.String())
+	}
+	if r.handle("q") {
+		t.Errorf("Didn't quit on q")
+	}
+
+	// Only the runs of the benchmark in its own package are shown
+	for _, pkgPath := range []string{"example.com/a", "example.com/b"} {
+		if err := appendHistory(filepath.Join(root, historyFile), revision{}, packageOutput{pkgPath: pkgPath, benches: map[string]uint64{"BenchmarkA": 100}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out.Reset()
+	r.showHistory(reviewRow{pkg: "example.com/a", pkgGo: "example.com/a", importPath: "example.com/a", benchResult: benchResult{Name: "BenchmarkA"}})
+	if !strings.Contains(out.String(), "example.com/a") || strings.Contains(out.String(), "example.com/b") {
+		t.Errorf("Printed\n%s\nas the history of BenchmarkA of example.com/a", out.String())
+	}
+}
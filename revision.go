@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The revision of the code a run benchmarked, so a record can be traced back to it
+type revision struct {
+	Commit string    `json:"commit,omitempty"`
+	Branch string    `json:"branch,omitempty"` // Empty on a detached HEAD
+	Dirty  bool      `json:"dirty,omitempty"`  // Whether there were uncommitted changes
+	Time   time.Time `json:"time"`
+}
+
+// The revision checked out in the directory of invocation. Outside a git repository, it's only the time.
+func currentRevision() revision {
+	rev := revision{Time: time.Now().UTC()}
+
+	commit, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return rev
+	}
+	rev.Commit = strings.TrimSpace(string(commit))
+
+	if branch, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output(); err == nil {
+		if b := strings.TrimSpace(string(branch)); b != "HEAD" {
+			rev.Branch = b
+		}
+	}
+	if status, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output(); err == nil {
+		rev.Dirty = len(strings.TrimSpace(string(status))) > 0
+	}
+
+	return rev
+}
+
+// E.g. 3f2a9c1d8e7b on main (dirty) at 2016-01-02 15:04:05 UTC
+func (r revision) String() string {
+	s := ""
+	if r.Commit != "" {
+		commit := r.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		s = commit + " "
+		if r.Branch != "" {
+			s += "on " + r.Branch + " "
+		}
+		if r.Dirty {
+			s += "(dirty) "
+		}
+	}
+
+	return s + "at " + r.Time.Format("2006-01-02 15:04:05 MST")
+}
+
+// The revisions each best benchmark was set on: the old ones, with the run's revision wherever a benchmark got a new
+// best, and without the benchmarks no longer on record
+func bestRevisions(old map[string]revision, rev revision, results []benchResult, best map[string]uint64) map[string]revision {
+	revisions := make(map[string]revision, len(best))
+	for name := range best {
+		if r, ok := old[name]; ok {
+			revisions[name] = r
+		}
+	}
+	for _, res := range results {
+		if _, ok := best[res.Name]; ok && (res.Status == statusNew || res.Status == statusRecord) {
+			revisions[res.Name] = rev
+		}
+	}
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	return revisions
+}
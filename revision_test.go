@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRevisionString(t *testing.T) {
+	at := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, c := range []struct {
+		rev      revision
+		expected string
+	}{
+		{revision{Commit: "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39", Branch: "main", Dirty: true, Time: at}, "3f2a9c1d8e7b on main (dirty) at 2016-01-02 15:04:05 UTC"},
+		{revision{Commit: "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39", Time: at}, "3f2a9c1d8e7b at 2016-01-02 15:04:05 UTC"},
+		{revision{Time: at}, "at 2016-01-02 15:04:05 UTC"},
+	} {
+		if s := c.rev.String(); s != c.expected {
+			t.Errorf("Wrote %+v as %q, expected %q", c.rev, s, c.expected)
+		}
+	}
+}
+
+func TestBestRevisions(t *testing.T) {
+	old := map[string]revision{"BenchmarkA": {Commit: "a"}, "BenchmarkB": {Commit: "a"}, "BenchmarkGone": {Commit: "a"}}
+	rev := revision{Commit: "b"}
+	results := []benchResult{{Name: "BenchmarkA", Status: statusRecord}, {Name: "BenchmarkB", Status: statusSlow}, {Name: "BenchmarkC", Status: statusNew}}
+	best := map[string]uint64{"BenchmarkA": 1, "BenchmarkB": 1, "BenchmarkC": 1}
+
+	expected := map[string]revision{"BenchmarkA": rev, "BenchmarkB": {Commit: "a"}, "BenchmarkC": rev}
+	if revisions := bestRevisions(old, rev, results, best); !reflect.DeepEqual(revisions, expected) {
+		t.Errorf("Kept the revisions %v, expected %v", revisions, expected)
+	}
+}
+
+func TestRecordRevisions(t *testing.T) {
+	rev := revision{Commit: "b", Branch: "main", Time: time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)}
+	rec := benchRecord{benches: map[string]uint64{"BenchmarkA": 1}, revision: &rev, revisions: map[string]revision{"BenchmarkA": rev}}
+	raw, err := marshalRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unmarshalled, err := unmarshalRecord(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unmarshalled, rec) {
+		t.Errorf("Unmarshalled %+v, expected %+v", unmarshalled, rec)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	serveFlags = flag.NewFlagSet("serve", flag.ExitOnError)
+	serveAddr  = serveFlags.String("addr", ":8080", "The address to listen on")
+	serveRoot  = serveFlags.String("root", ".", "The directory containing the projects to serve")
+	serveToken = serveFlags.String("token", os.Getenv("REBENCH_STORE_TOKEN"), "The bearer token clients must send to upload to the API, which refuses every upload if it's empty")
+)
+
+// The state of the latest runs in every package of a project, as served by /status/<project>
+type projectStatus struct {
+	Project         string      `json:"project"`
+	Verdict         string      `json:"verdict"`
+	Packages        int         `json:"packages"`
+	WorstRegression *regression `json:"worstRegression,omitempty"`
+}
+
+// The benchmark that got the most slower relative to its best, whether or not it crossed speedTol
+type regression struct {
+	Package   string  `json:"package"`
+	Benchmark string  `json:"benchmark"`
+	Factor    float64 `json:"factor"`
+}
+
+type server struct {
+	root                string
+	speedTol, recordTol float64
+	token               string     // The bearer token uploads to the API must have, none being allowed without one
+	mu                  sync.Mutex // Held while uploads to the API are written
+}
+
+// Runs the server until it fails. Like rebench, it returns the exit code.
+func serve(args []string, speedTolPercent, recordTolPercent int) int {
+	serveFlags.Parse(args)
+
+	root, err := filepath.Abs(*serveRoot)
+	if err != nil {
+		logError("Cannot resolve the directory to serve:", err)
+		return exitError
+	}
+
+	logInfo("Serving the benchmark status of", root, "on", *serveAddr)
+	err = http.ListenAndServe(*serveAddr, newServer(root, float64(speedTolPercent)/100, float64(recordTolPercent)/100, *serveToken))
+	logError("Server stopped:", err)
+
+	return exitError
+}
+
+func newServer(root string, speedTol, recordTol float64, token string) http.Handler {
+	s := &server{root: root, speedTol: speedTol, recordTol: recordTol, token: token}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status/", s.serveStatus)
+	mux.HandleFunc("/badge/", s.serveBadge)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	mux.HandleFunc("/dashboard/", s.serveDashboard)
+	mux.HandleFunc("/", s.serveIndex)
+	mux.HandleFunc("/api/results/", s.serveResults)
+	mux.HandleFunc("/api/bests/", s.serveBests)
+	mux.HandleFunc("/api/history/", s.serveHistory)
+
+	return mux
+}
+
+func (s *server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.projectStatus(strings.TrimPrefix(r.URL.Path, "/status/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (s *server) serveBadge(w http.ResponseWriter, r *http.Request) {
+	project := strings.TrimPrefix(r.URL.Path, "/badge/")
+	if !strings.HasSuffix(project, ".svg") {
+		http.NotFound(w, r)
+		return
+	}
+
+	status, err := s.projectStatus(strings.TrimSuffix(project, ".svg"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	color := "#9f9f9f"
+	switch status.Verdict {
+	case verdictPassing:
+		color = "#4c1"
+	case verdictFailing:
+		color = "#e05d44"
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// Image proxies (e.g. GitHub's) cache aggressively, which defeats the point of a status badge
+	w.Header().Set("Cache-Control", "no-cache")
+	writeBadge(w, "bench", status.Verdict, color)
+}
+
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.latestRuns("")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, runs)
+}
+
+// Judges the latest run of every package beneath the project directory.
+func (s *server) projectStatus(project string) (projectStatus, error) {
+	project = strings.Trim(project, "/")
+	status := projectStatus{Project: project, Verdict: verdictUnknown}
+
+	runs, err := s.latestRuns(project)
+	if err != nil {
+		return status, err
+	}
+
+	status.Packages = len(runs)
+	for _, run := range runs {
+		if status.Verdict == verdictUnknown {
+			status.Verdict = verdictPassing
+		}
+
+		for _, res := range run.Results {
+			if res.Status == statusSlow || res.Status == statusMissing {
+				status.Verdict = verdictFailing
+			}
+
+			if res.Factor > 1 && (status.WorstRegression == nil || res.Factor > status.WorstRegression.Factor) {
+				status.WorstRegression = &regression{Package: run.Package, Benchmark: res.Name, Factor: res.Factor}
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// Finds and classifies the latest run of every package beneath the project directory. A package's latest run is the .bench_results.json
+// in its directory, and the best it was compared against is the .bench_best.json.old backed up during that run.
+func (s *server) latestRuns(project string) ([]packageRun, error) {
+	dir, err := s.dir(project)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("no such project %q", project)
+	}
+
+	var runs []packageRun
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != ".bench_results.json" {
+			return nil
+		}
+
+		pkgDir := filepath.Dir(path)
+		pkg, _ := filepath.Rel(s.root, pkgDir)
+		benches := unmarshallAndStoreBench(path)
+		oldBenches := unmarshallAndStoreBench(filepath.Join(pkgDir, ".bench_best.json.old"))
+		runs = append(runs, packageRun{Package: filepath.ToSlash(pkg), Results: classify(oldBenches, benches, s.speedTol, s.recordTol)})
+
+		return nil
+	})
+
+	return runs, err
+}
+
+// The directory of the slash-separated path beneath the root, which mustn't be outside of it
+func (s *server) dir(path string) (string, error) {
+	dir := filepath.Join(s.root, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(s.root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is outside of the served directory", path)
+	}
+
+	return dir, nil
+}
+
+// Writes a flat, shields.io-style SVG badge. Text widths are estimated since there's no font to measure with.
+func writeBadge(w io.Writer, label, message, color string) {
+	labelWidth := 7*len(label) + 10
+	messageWidth := 7*len(message) + 10
+	width := labelWidth + messageWidth
+
+	label, message = html.EscapeString(label), html.EscapeString(message)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, width, label, message)
+	fmt.Fprint(w, `<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(w, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, width)
+	fmt.Fprintf(w, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`,
+		labelWidth, labelWidth, messageWidth, color, width)
+	fmt.Fprintf(w, `<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11"><text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g>`,
+		labelWidth/2, label, labelWidth+messageWidth/2, message)
+	fmt.Fprint(w, "</svg>\n")
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeRecord(t *testing.T, path string, benches map[string]uint64) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(benches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, out, 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Lays out a project with one healthy package and one whose latest run regressed
+func serveTestRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeRecord(t, filepath.Join(root, "proj", "fast", ".bench_results.json"), map[string]uint64{"BenchmarkA": 100})
+	writeRecord(t, filepath.Join(root, "proj", "fast", ".bench_best.json.old"), map[string]uint64{"BenchmarkA": 110})
+	writeRecord(t, filepath.Join(root, "proj", "slow", ".bench_results.json"), map[string]uint64{"BenchmarkB": 300, "BenchmarkC": 120})
+	writeRecord(t, filepath.Join(root, "proj", "slow", ".bench_best.json.old"), map[string]uint64{"BenchmarkB": 100, "BenchmarkC": 100})
+
+	return root
+}
+
+func getStatus(t *testing.T, handler http.Handler, path string) projectStatus {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status request for %s failed with %d: %s", path, rec.Code, rec.Body.String())
+	}
+
+	var status projectStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Cannot decode status %v", err)
+	}
+
+	return status
+}
+
+func TestServeStatus(t *testing.T) {
+	root := serveTestRoot(t)
+	defer os.RemoveAll(root)
+	handler := newServer(root, 1.5, 0.7, "")
+
+	status := getStatus(t, handler, "/status/proj")
+	if status.Verdict != verdictFailing || status.Packages != 2 {
+		t.Errorf("Project with a regressed package should fail, got %+v", status)
+	}
+	if status.WorstRegression == nil || status.WorstRegression.Benchmark != "BenchmarkB" || status.WorstRegression.Package != "proj/slow" {
+		t.Errorf("Wrong worst regression %+v", status.WorstRegression)
+	}
+
+	status = getStatus(t, handler, "/status/proj/fast")
+	if status.Verdict != verdictPassing || status.WorstRegression != nil {
+		t.Errorf("Package that got faster should pass without regressions, got %+v", status)
+	}
+}
+
+func TestServeBadge(t *testing.T) {
+	root := serveTestRoot(t)
+	defer os.RemoveAll(root)
+	handler := newServer(root, 1.5, 0.7, "")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/badge/proj/slow.svg", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("Badge request failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), verdictFailing) {
+		t.Errorf("Badge doesn't show the verdict %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/badge/nope.svg", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Badge for unknown project returned %d", rec.Code)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	root := serveTestRoot(t)
+	defer os.RemoveAll(root)
+	handler := newServer(root, 1.5, 0.7, "")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Metrics request failed with %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	for _, sample := range []string{
+		`rebench_ns_per_op{package="proj/slow",benchmark="BenchmarkB"} 300`,
+		`rebench_best_ns_per_op{package="proj/fast",benchmark="BenchmarkA"} 110`,
+		`rebench_regressions{package="proj/slow"} 1`,
+		`rebench_regressions{package="proj/fast"} 0`,
+		`rebench_missing_benchmarks{package="proj/slow"} 0`,
+	} {
+		if !strings.Contains(body, sample+"\n") {
+			t.Errorf("Metrics are missing sample %s:\n%s", sample, body)
+		}
+	}
+}
+
+func TestServeAPI(t *testing.T) {
+	root, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	srv := httptest.NewServer(newServer(root, 1.5, 0.7, "secret"))
+	defer srv.Close()
+
+	client := &apiClient{base: srv.URL, project: "proj", token: "secret"}
+	rev := revision{Commit: "a"}
+	best := benchRecord{benches: map[string]uint64{"BenchmarkA": 100}}
+	pushPackage(client, "example.com/mod/db", mainBestFile, benchRecord{benches: map[string]uint64{"BenchmarkA": 100}, revision: &rev}, best, true)
+	pushPackage(client, "example.com/mod/db", mainBestFile, benchRecord{benches: map[string]uint64{"BenchmarkA": 300}, revision: &rev}, best, true)
+
+	if rec, _ := loadStoredRecord(client.bests(), "example.com/mod/db", mainBestFile); !reflect.DeepEqual(rec.benches, best.benches) {
+		t.Errorf("Pulled the bests %v, expected %v", rec.benches, best.benches)
+	}
+	// The second run was judged against the best pushed by the first
+	if status := getStatus(t, srv.Config.Handler, "/status/proj"); status.Verdict != verdictFailing {
+		t.Errorf("Got verdict %s for the pushed runs, expected %s", status.Verdict, verdictFailing)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/history/proj?package=example.com/mod/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var entries []historyEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Revision.Commit != "a" {
+		t.Errorf("Got the history %+v, expected both runs", entries)
+	}
+
+	client.token = "wrong"
+	if err := client.pushResults("example.com/mod/db", best); err == nil {
+		t.Error("Pushed results without the token")
+	}
+
+	// A server without a token takes no uploads at all
+	open := httptest.NewServer(newServer(root, 1.5, 0.7, ""))
+	defer open.Close()
+	client = &apiClient{base: open.URL, project: "proj"}
+	if err := client.pushResults("example.com/mod/db", best); err == nil {
+		t.Error("Pushed results to a server without a token")
+	}
+	if err := saveStoredRecord(client.bests(), "example.com/mod/db", mainBestFile, best); err == nil {
+		t.Error("Pushed bests to a server without a token")
+	}
+}
+
+func TestServeDashboard(t *testing.T) {
+	root := serveTestRoot(t)
+	defer os.RemoveAll(root)
+	for _, speed := range []uint64{100, 300} {
+		if err := appendHistory(filepath.Join(root, "proj", historyFile), revision{}, packageOutput{pkgPath: "slow", benches: map[string]uint64{"BenchmarkB": speed}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := newServer(root, 1.5, 0.7, "")
+
+	for path, expected := range map[string][]string{
+		"/": {`<td><a href="/dashboard/proj">proj</a></td><td class="failing">failing</td><td class="num">2</td><td>BenchmarkB in proj/slow (3.00x)</td>`},
+		"/dashboard/proj": {
+			"<title>rebench: proj</title>",
+			`<td class="SLOW">SLOW</td><td>slow</td><td>BenchmarkB</td><td class="num">300</td><td class="num">100</td><td class="num">3.000000</td><td><svg`,
+			"<h2>fast</h2>",
+			`<td class="OK">OK</td><td>BenchmarkC</td><td class="num">120</td><td class="num">100</td><td class="num">1.200000</td><td></td>`,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request for %s failed with %d: %s", path, rec.Code, rec.Body.String())
+		}
+		for _, e := range expected {
+			if !strings.Contains(rec.Body.String(), e) {
+				t.Errorf("The page at %s lacks %s:\n%s", path, e, rec.Body.String())
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/nothing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Served %s with %d, expected 404", "/nothing", rec.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The distribution of the ns/op of a benchmark run several times with -count
+type benchStats struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Stddev float64 `json:"stddev"` // The sample standard deviation
+}
+
+func summarize(samples []float64) benchStats {
+	s := benchStats{N: len(samples)}
+	if s.N == 0 {
+		return s
+	}
+
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	if s.N%2 == 1 {
+		s.Median = sorted[s.N/2]
+	} else {
+		s.Median = (sorted[s.N/2-1] + sorted[s.N/2]) / 2
+	}
+
+	for _, v := range samples {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+
+	if s.N > 1 {
+		for _, v := range samples {
+			s.Stddev += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(s.Stddev / float64(s.N-1))
+	}
+
+	return s
+}
+
+// The two-sided p-value of Welch's t-test on the means of the distributions, i.e. how likely a difference at least
+// this large is if both came from the same benchmark. Summaries are all the baseline keeps, which rules out the
+// rank tests benchstat uses on raw samples.
+func welchPValue(a, b benchStats) float64 {
+	va, vb := a.Stddev*a.Stddev/float64(a.N), b.Stddev*b.Stddev/float64(b.N)
+	if va+vb == 0 {
+		if a.Mean == b.Mean {
+			return 1
+		}
+		return 0
+	}
+
+	t := (a.Mean - b.Mean) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/float64(a.N-1) + vb*vb/float64(b.N-1))
+
+	return incompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// The regularized incomplete beta function I_x(a, b), by its continued fraction (Numerical Recipes 6.4)
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+func betaFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
+
+// The distributions of a package's benchmarks with -count, to tell real changes from noise
+type statsComparison struct {
+	old, new map[string]benchStats
+	alpha    float64    // The p-value below which a change is real
+	history  noiseModel // The noise of the benchmarks across the history, with -noise
+}
+
+// Whether there's enough to say the change in the benchmark isn't significant, which takes several runs on both sides
+func (s statsComparison) noise(name string) (bool, float64) {
+	old, ok := s.old[name]
+	new, newOK := s.new[name]
+	if !ok || !newOK || old.N < 2 || new.N < 2 {
+		return false, 0
+	}
+
+	p := welchPValue(old, new)
+	return p >= s.alpha, p
+}
+
+// Turns slow benchmarks and records that are within the noise of their distributions into OK ones
+func (s statsComparison) filterNoise(results []benchResult) {
+	for i, res := range results {
+		if res.Status != statusSlow && res.Status != statusRecord {
+			continue
+		}
+		if noise, p := s.noise(res.Name); noise {
+			logTrace(fmt.Sprintf("Benchmark %s changed by %s, but not significantly (p=%.3f), treating it as OK", res.Name, formatFactor(res.Factor), p))
+			results[i].Status = statusOK
+		}
+	}
+	s.history.filter(results)
+}
+
+// The distributions to keep with the best benchmarks: the old ones, replaced wherever the best was
+func bestStats(oldStats, stats map[string]benchStats, results []benchResult) map[string]benchStats {
+	best := make(map[string]benchStats, len(oldStats))
+	for name, s := range oldStats {
+		best[name] = s
+	}
+
+	for _, res := range results {
+		if res.Status != statusNew && res.Status != statusRecord {
+			continue
+		}
+		if s, ok := stats[res.Name]; ok {
+			best[res.Name] = s
+		} else {
+			delete(best, res.Name)
+		}
+	}
+
+	return best
+}
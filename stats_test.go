@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	s := summarize([]float64{5, 1, 4, 2, 3})
+	if s.N != 5 || s.Mean != 3 || s.Median != 3 || math.Abs(s.Stddev-math.Sqrt(2.5)) > 1e-12 {
+		t.Errorf("Summarized as %+v", s)
+	}
+	if s := summarize([]float64{4, 1, 3, 2}); s.Median != 2.5 {
+		t.Errorf("Took the median of an even number of samples as %v", s.Median)
+	}
+}
+
+func TestWelchPValue(t *testing.T) {
+	// t = -2 with 8 degrees of freedom
+	a, b := summarize([]float64{1, 2, 3, 4, 5}), summarize([]float64{3, 4, 5, 6, 7})
+	if p := welchPValue(a, b); math.Abs(p-0.08051) > 1e-4 {
+		t.Errorf("Computed the p-value %v, expected 0.0805", p)
+	}
+	if p := welchPValue(a, a); p != 1 {
+		t.Errorf("Computed the p-value %v of identical distributions, expected 1", p)
+	}
+}
+
+func TestFilterNoise(t *testing.T) {
+	stats := statsComparison{
+		old: map[string]benchStats{
+			"BenchmarkNoisy":  summarize([]float64{100, 160, 90, 200, 110}),
+			"BenchmarkSteady": summarize([]float64{100, 101, 99, 100, 100}),
+		},
+		new: map[string]benchStats{
+			"BenchmarkNoisy":  summarize([]float64{300, 100, 250, 90, 280}),
+			"BenchmarkSteady": summarize([]float64{300, 301, 299, 300, 300}),
+		},
+		alpha: 0.05,
+	}
+	results := []benchResult{
+		{Name: "BenchmarkNoisy", Speed: 250, BestSpeed: 110, Factor: 2.27, Status: statusSlow},
+		{Name: "BenchmarkSteady", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+	}
+
+	stats.filterNoise(results)
+	if results[0].Status != statusOK || results[1].Status != statusSlow {
+		t.Errorf("Filtered the noise as %v", results)
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	out := "BenchmarkA-8   \t 1000\t 100 ns/op\n" +
+		"BenchmarkA-8   \t 1000\t 130 ns/op\n" +
+		"BenchmarkA-8   \t 1000\t 110 ns/op\n" +
+		"BenchmarkB-8   \t 1000\t 42 ns/op\n" +
+		"ok  \texample.com/mod\t1s\n"
+
+	var got packageOutput
+	if err := streamBenchResults(strings.NewReader(out), func(out packageOutput) { got = out }); err != nil {
+		t.Fatal(err)
+	}
+	if got.benches["BenchmarkA"] != 110 || got.benches["BenchmarkB"] != 42 {
+		t.Errorf("Took the speeds %v, expected the medians", got.benches)
+	}
+	if s, ok := got.stats["BenchmarkA"]; !ok || s.N != 3 || len(got.stats) != 1 {
+		t.Errorf("Summarized the runs as %v", got.stats)
+	}
+}
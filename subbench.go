@@ -0,0 +1,134 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The levels of a benchmark's name, one per b.Run, e.g. BenchmarkParse, large and json for BenchmarkParse/large/json
+func benchPath(name string) []string {
+	return strings.Split(name, "/")
+}
+
+// The names of the benchmarks the benchmark was run by with b.Run, closest first, e.g. BenchmarkParse/large and then
+// BenchmarkParse for BenchmarkParse/large/json
+func benchParents(name string) []string {
+	var parents []string
+	for i := strings.LastIndexByte(name, '/'); i > 0; i = strings.LastIndexByte(name, '/') {
+		name = name[:i]
+		parents = append(parents, name)
+	}
+
+	return parents
+}
+
+func hasSubBenchmarks(results []benchResult) bool {
+	for _, res := range results {
+		if strings.Contains(res.Name, "/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The results ordered as a tree, every benchmark right after its parent and its siblings. Results are compared level
+// by level, so BenchmarkParse/large/json comes before BenchmarkParse/large-x.
+func treeOrder(results []benchResult) []benchResult {
+	sorted := append([]benchResult(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := benchPath(sorted[i].Name), benchPath(sorted[j].Name)
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	return sorted
+}
+
+// The names laying out the benchmark in a tree after the benchmark before it: a heading for every level above it that
+// isn't laid out yet, then its own level, each indented by its depth
+func treeNames(prev, name string) (headings []string, leaf string) {
+	prevPath, path := benchPath(prev), benchPath(name)
+	common := 0
+	for common < len(prevPath) && common < len(path)-1 && prevPath[common] == path[common] {
+		common++
+	}
+	for i := common; i < len(path)-1; i++ {
+		headings = append(headings, treeIndent(i)+path[i])
+	}
+
+	return headings, treeIndent(len(path)-1) + path[len(path)-1]
+}
+
+func treeIndent(depth int) string {
+	return strings.Repeat("  ", depth)
+}
+
+// The -bench regular expression split into one per level of a benchmark's name, since go test matches each level of
+// the name against its own part of the expression: -bench=Parse/large runs BenchmarkParse/large/json, but not
+// BenchmarkParse/small/json
+type benchMatcher []*regexp.Regexp
+
+func compileBenchMatcher(pattern string) (benchMatcher, error) {
+	parts := splitBenchPattern(pattern)
+	filter := make(benchMatcher, len(parts))
+	for i, part := range parts {
+		re, err := regexp.Compile(part)
+		if err != nil {
+			return nil, err
+		}
+		filter[i] = re
+	}
+
+	return filter, nil
+}
+
+// Whether go test runs the benchmark: every level of its name matches the part of the expression for that level, if
+// there's one
+func (f benchMatcher) matches(name string) bool {
+	for i, level := range benchPath(name) {
+		if i < len(f) && !f[i].MatchString(level) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Splits the pattern at every slash outside brackets and parentheses, like go test
+func splitBenchPattern(pattern string) []string {
+	var parts []string
+	brackets, parens := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '[':
+			brackets++
+		case ']':
+			if brackets > 0 {
+				brackets--
+			}
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case '/':
+			if brackets == 0 && parens == 0 {
+				parts = append(parts, pattern[:i])
+				pattern, i = pattern[i+1:], -1
+			}
+		}
+	}
+
+	return append(parts, pattern)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBenchParents(t *testing.T) {
+	expected := []string{"BenchmarkParse/large", "BenchmarkParse"}
+	if parents := benchParents("BenchmarkParse/large/json"); !reflect.DeepEqual(parents, expected) {
+		t.Errorf("Got the parents %v, expected %v", parents, expected)
+	}
+	if parents := benchParents("BenchmarkParse"); parents != nil {
+		t.Errorf("Got the parents %v of a top-level benchmark", parents)
+	}
+}
+
+func TestDeltaTree(t *testing.T) {
+	results := []benchResult{
+		{Name: "BenchmarkParse/small/json", BestSpeed: 10, Status: statusMissing},
+		{Name: "BenchmarkEncode", Speed: 100, BestSpeed: 100, Factor: 1, Status: statusOK},
+		{Name: "BenchmarkParse/large-x", Speed: 500, BestSpeed: 500, Factor: 1, Status: statusOK},
+		{Name: "BenchmarkParse/large/json", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+		{Name: "BenchmarkParse/large/xml", Speed: 200, BestSpeed: 200, Factor: 1, Status: statusOK},
+	}
+
+	expected := `Status     Benchmark Name     New Speed    Best Speed    Factor (New/Old)
+OK         BenchmarkEncode    100          100           1.000000
+           BenchmarkParse
+             large
+SLOW           json           300          100           3.000000
+OK             xml            200          200           1.000000
+OK           large-x          500          500           1.000000
+             small
+MISSING        json           MISSING      10            N/A
+`
+	if delta := deltaTable(results, true).String(); delta != expected {
+		t.Errorf("Laid out the sub-benchmarks as\n%s\nexpected\n%s", delta, expected)
+	}
+}
+
+func TestParentTolerances(t *testing.T) {
+	tols := map[string]benchTolerances{"BenchmarkParse": {SpeedTol: 300}, "BenchmarkParse/large": {SpeedTol: 110}}
+	oldBenches := map[string]uint64{"BenchmarkParse/large/json": 100, "BenchmarkParse/small/json": 100, "BenchmarkOther/json": 100}
+	benches := map[string]uint64{"BenchmarkParse/large/json": 120, "BenchmarkParse/small/json": 250, "BenchmarkOther/json": 250}
+	expected := map[string]benchStatus{"BenchmarkParse/large/json": statusSlow, "BenchmarkParse/small/json": statusOK, "BenchmarkOther/json": statusSlow}
+	for _, res := range classifyGroups(oldBenches, benches, 1.5, 0.7, nil, tols) {
+		if res.Status != expected[res.Name] {
+			t.Errorf("Classified %s as %s, expected %s", res.Name, res.Status, expected[res.Name])
+		}
+	}
+}
+
+func TestBenchMatcher(t *testing.T) {
+	matcher, err := compileBenchMatcher("Parse/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"BenchmarkParse":            true,
+		"BenchmarkParse/large":      true,
+		"BenchmarkParse/large/json": true,
+		"BenchmarkParse/small/json": false,
+		"BenchmarkLex/large":        false,
+	} {
+		if matcher.matches(name) != expected {
+			t.Errorf("Matched %s: %v, expected %v", name, !expected, expected)
+		}
+	}
+
+	expected := []string{"A(x/y)", "[/]", `b\/c`}
+	if parts := splitBenchPattern(`A(x/y)/[/]/b\/c`); !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Split the pattern into %q, expected %q", parts, expected)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+)
+
+var jsonSummary = flag.Bool("json", false, "Prints a JSON summary of the run on stdout once every package has been compared, for wrapper scripts")
+
+// Why a run fails, as given in the JSON summary
+const (
+	reasonMissing = "missing"
+	reasonSlow    = "slow"
+	reasonTooLong = "tooLong"
+	reasonEnv     = "environment"
+)
+
+// The JSON summary of a run
+type runSummary struct {
+	Verdict  string           `json:"verdict"`
+	Reasons  []string         `json:"reasons"` // Why the run fails, empty when it passes
+	Geomean  float64          `json:"geomean,omitempty"`
+	Counts   resultCounts     `json:"counts"` // Of every package's benchmarks added up
+	Packages []packageSummary `json:"packages"`
+}
+
+type packageSummary struct {
+	Package  string          `json:"package"`
+	Geomean  float64         `json:"geomean,omitempty"`
+	Counts   resultCounts    `json:"counts"`
+	WallTime float64         `json:"wallTime,omitempty"` // In seconds
+	Results  []resultSummary `json:"results"`
+	Metrics  []metricSummary `json:"metrics,omitempty"`
+}
+
+type resultSummary struct {
+	Name      string      `json:"name"`
+	Status    benchStatus `json:"status"`
+	Speed     uint64      `json:"speed,omitempty"`     // In ns/op, absent when missing
+	BestSpeed uint64      `json:"bestSpeed,omitempty"` // In ns/op, absent when new
+	Factor    float64     `json:"factor,omitempty"`
+	Group     string      `json:"group,omitempty"`
+	Noise     float64     `json:"noise,omitempty"` // The coefficient of variation across the history, with -noise
+}
+
+type metricSummary struct {
+	Name   string      `json:"name"`
+	Unit   string      `json:"unit"`
+	Status benchStatus `json:"status"`
+	Value  float64     `json:"value"`
+	Best   float64     `json:"best,omitempty"`
+	Factor float64     `json:"factor,omitempty"`
+}
+
+func summarizeRun(r runReport) runSummary {
+	s := runSummary{Verdict: r.Verdict(), Reasons: []string{}, Geomean: r.Geomean, Counts: r.Counts(), Packages: []packageSummary{}}
+	if r.Missing {
+		s.Reasons = append(s.Reasons, reasonMissing)
+	}
+	if r.TooSlow {
+		s.Reasons = append(s.Reasons, reasonSlow)
+	}
+	if r.TooLong {
+		s.Reasons = append(s.Reasons, reasonTooLong)
+	}
+	if r.Mismatched {
+		s.Reasons = append(s.Reasons, reasonEnv)
+	}
+
+	for _, run := range r.Runs {
+		pkg := packageSummary{Package: run.Package, Geomean: run.Geomean, Counts: countResults(run.Results), WallTime: run.WallTime.Seconds(), Results: []resultSummary{}}
+		for _, res := range run.Results {
+			pkg.Results = append(pkg.Results, resultSummary{Name: res.Name, Status: res.Status, Speed: res.Speed, BestSpeed: res.BestSpeed, Factor: res.Factor, Group: res.Group, Noise: res.Noise})
+		}
+		for _, m := range run.Metrics {
+			pkg.Metrics = append(pkg.Metrics, metricSummary{Name: m.Name, Unit: m.Unit, Status: m.Status, Value: m.Value, Best: m.Best, Factor: m.Factor})
+		}
+		s.Packages = append(s.Packages, pkg)
+	}
+
+	return s
+}
+
+// Prints the JSON summary of the run
+type jsonReporter struct {
+	w io.Writer
+}
+
+func (j jsonReporter) report(r runReport) error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(summarizeRun(r))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONReporter(t *testing.T) {
+	var out strings.Builder
+	r := testReport()
+	r.Runs[0].Results = append(r.Runs[0].Results, benchResult{Name: "BenchmarkNew", Speed: 5, Status: statusNew})
+	if err := (jsonReporter{w: &out}).report(r); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+  "verdict": "failing",
+  "reasons": [
+    "slow"
+  ],
+  "counts": {
+    "total": 3,
+    "regressed": 1,
+    "improved": 0,
+    "new": 1,
+    "missing": 0
+  },
+  "packages": [
+    {
+      "package": "example.com/pkg",
+      "counts": {
+        "total": 3,
+        "regressed": 1,
+        "improved": 0,
+        "new": 1,
+        "missing": 0
+      },
+      "results": [
+        {
+          "name": "BenchmarkA",
+          "status": "SLOW",
+          "speed": 300,
+          "bestSpeed": 100,
+          "factor": 3
+        },
+        {
+          "name": "BenchmarkB",
+          "status": "OK",
+          "speed": 100,
+          "bestSpeed": 100,
+          "factor": 1
+        },
+        {
+          "name": "BenchmarkNew",
+          "status": "NEW",
+          "speed": 5
+        }
+      ]
+    }
+  ]
+}
+`
+	if out.String() != expected {
+		t.Errorf("Printed\n%s\nexpected\n%s", out.String(), expected)
+	}
+}
+
+// A metric coming from zero has no factor, which must neither break the JSON nor be printed as one
+func TestJSONReporterFromZero(t *testing.T) {
+	r := testReport()
+	r.Runs[0].Metrics = classifyMetrics(benchMetrics{"BenchmarkA": {"allocs/op": 0}}, benchMetrics{"BenchmarkA": {"allocs/op": 1}}, withMemoryUnits(nil, 0, 0), 1.5, 0.7)
+	var out strings.Builder
+	if err := (jsonReporter{w: &out}).report(r); err != nil {
+		t.Fatal(err)
+	}
+
+	var s runSummary
+	if err := json.Unmarshal([]byte(out.String()), &s); err != nil {
+		t.Fatalf("Cannot read the summary back %v:\n%s", err, out.String())
+	}
+	if m := s.Packages[0].Metrics; len(m) != 1 || m[0].Status != statusSlow || m[0].Factor != 0 {
+		t.Errorf("Summarized the metric as %+v, expected it slow without a factor", m)
+	}
+	if tbl := metricsTable(r.Runs[0].Metrics).String(); strings.Contains(tbl, "Inf") || !strings.Contains(tbl, "N/A") {
+		t.Errorf("Laid the metric out as\n%s", tbl)
+	}
+}
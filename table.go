@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type alignment int
+
+const (
+	alignLeft alignment = iota
+	alignRight
+)
+
+// The space between one column and the next, after the widest cell of the column
+const columnGap = 4
+
+// A plain text table with any number of columns. Every column is as wide as its widest cell, and the next column
+// starts columnGap spaces after it.
+type table struct {
+	header []string
+	align  []alignment // The alignment of each column, left for any column without one
+	rows   [][]string
+	title  []string // Lines printed as they are above the table
+	footer []string // Lines printed as they are below the table
+
+	// Tables laid out below the rows and above the footer, each with columns of its own and an empty line between
+	// one and the next
+	sections []*table
+}
+
+func newTable(header ...string) *table {
+	return &table{header: header}
+}
+
+func (t *table) addRow(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+func (t *table) addTitle(line string) {
+	t.title = append(t.title, line)
+}
+
+func (t *table) addFooter(line string) {
+	t.footer = append(t.footer, line)
+}
+
+func (t *table) addSection(section *table) {
+	t.sections = append(t.sections, section)
+}
+
+// Renders the table with each row on its own line, including the last one. Rows with fewer cells than others are
+// padded with empty ones.
+func (t *table) String() string {
+	rows := t.rows
+	if len(t.header) > 0 {
+		rows = append([][]string{t.header}, rows...)
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = intMax(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	out := ""
+	for _, line := range t.title {
+		out += line + "\n"
+	}
+	for _, row := range rows {
+		line := ""
+		for i, width := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			pad := strings.Repeat(" ", width-utf8.RuneCountInString(cell))
+
+			if i > 0 {
+				line += strings.Repeat(" ", columnGap)
+			}
+			if i < len(t.align) && t.align[i] == alignRight {
+				line += pad + cell
+			} else {
+				line += cell + pad
+			}
+		}
+		out += strings.TrimRight(line, " ") + "\n"
+	}
+
+	for i, section := range t.sections {
+		if i > 0 || len(rows) > 0 {
+			out += "\n"
+		}
+		out += section.String()
+	}
+
+	for _, line := range t.footer {
+		out += line + "\n"
+	}
+
+	return out
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	tbl := newTable("Name", "Speed", "Note")
+	tbl.align = []alignment{alignLeft, alignRight}
+	tbl.addRow("BenchmarkLonger", "5", "µs are one rune")
+	tbl.addRow("BenchmarkB", "12345")
+	tbl.addFooter("Benchmarking took 1s")
+	tbl.addTitle("2 benchmarks")
+
+	expected := "" +
+		"2 benchmarks\n" +
+		"Name               Speed    Note\n" +
+		"BenchmarkLonger        5    µs are one rune\n" +
+		"BenchmarkB         12345\n" +
+		"Benchmarking took 1s\n"
+	if out := tbl.String(); out != expected {
+		t.Errorf("Rendered\n%s\nexpected\n%s", out, expected)
+	}
+
+	// Every section has columns of its own, between the rows and the footer
+	section := newTable("Name", "Speed")
+	section.addTitle("Group hotpath")
+	section.addRow("BenchmarkHot", "1")
+	tbl.addSection(section)
+	expected = "" +
+		"2 benchmarks\n" +
+		"Name               Speed    Note\n" +
+		"BenchmarkLonger        5    µs are one rune\n" +
+		"BenchmarkB         12345\n" +
+		"\n" +
+		"Group hotpath\n" +
+		"Name            Speed\n" +
+		"BenchmarkHot    1\n" +
+		"Benchmarking took 1s\n"
+	if out := tbl.String(); out != expected {
+		t.Errorf("Rendered\n%s\nexpected\n%s", out, expected)
+	}
+}
+
+func TestDeltaTable(t *testing.T) {
+	results := []benchResult{
+		{Name: "BenchmarkGone", BestSpeed: 10, Status: statusMissing},
+		{Name: "BenchmarkA", Speed: 300, BestSpeed: 100, Factor: 3, Status: statusSlow},
+		{Name: "BenchmarkNew", Speed: 7, Status: statusNew},
+	}
+
+	expected := "" +
+		"Status     Benchmark Name    New Speed    Best Speed    Factor (New/Old)\n" +
+		"MISSING    BenchmarkGone     MISSING      10            N/A\n" +
+		"SLOW       BenchmarkA        300          100           3.000000\n" +
+		"NEW        BenchmarkNew      7            MISSING       N/A\n"
+	if out := deltaTable(results, true).String(); out != expected {
+		t.Errorf("Rendered\n%s\nexpected\n%s", out, expected)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+var (
+	templateFile = flag.String("template", "", "Renders the results of the run with the text/template in this file, on stdout unless -templateOut is set")
+	templateOut  = flag.String("templateOut", "", "The file -template renders the results into instead of stdout")
+)
+
+// The functions templates get on top of the data
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	"factor": formatFactor,
+	"speed":  func(ns uint64) string { return numbers.speed(ns) },
+}
+
+// Parses a user-supplied template up front, so a broken one is caught before benchmarking rather than after
+func parseTemplateFile(file string) (*template.Template, error) {
+	return template.New(filepath.Base(file)).Funcs(templateFuncs).ParseFiles(file)
+}
+
+// Renders the whole run with a user-supplied template, for reports shaped exactly the way somebody wants them
+type templateReporter struct {
+	tmpl *template.Template
+	out  string // The file to render into, stdout if empty
+}
+
+func newTemplateReporter(file, out string) (templateReporter, error) {
+	tmpl, err := parseTemplateFile(file)
+	if err != nil {
+		return templateReporter{}, err
+	}
+
+	return templateReporter{tmpl: tmpl, out: out}, nil
+}
+
+func (t templateReporter) report(r runReport) error {
+	if t.out == "" {
+		return t.render(os.Stdout, r)
+	}
+
+	f, err := os.OpenFile(t.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	if err := t.render(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := writeAndClose(f, nil); err != nil {
+		return err
+	}
+
+	return applyPerm(t.out, filePerm)
+}
+
+func (t templateReporter) render(w io.Writer, r runReport) error {
+	return t.tmpl.Execute(w, r)
+}
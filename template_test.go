@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplFile := filepath.Join(dir, "report.tmpl")
+	tmpl := `{{.Verdict}}{{range .Runs}}{{range .Results}} {{.Name}}={{.Status}}({{factor .Factor}}){{end}}{{end}}` + "\n"
+	if err := ioutil.WriteFile(tmplFile, []byte(tmpl), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "report.txt")
+	r, err := newTemplateReporter(tmplFile, out)
+	if err != nil {
+		t.Fatalf("Cannot parse template %v", err)
+	}
+	if err := r.report(testReport()); err != nil {
+		t.Fatalf("Cannot render report %v", err)
+	}
+
+	expected := "failing BenchmarkA=SLOW(3.00x) BenchmarkB=OK(1.00x)\n"
+	if raw, err := ioutil.ReadFile(out); err != nil || string(raw) != expected {
+		t.Errorf("Rendered %q, expected %q (%v)", raw, expected, err)
+	}
+}
+
+func TestTemplateReporterInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmplFile := filepath.Join(dir, "broken.tmpl")
+	if err := ioutil.WriteFile(tmplFile, []byte("{{.Verdict"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTemplateReporter(tmplFile, ""); err == nil {
+		t.Errorf("Parsed a broken template without complaint")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Tolerances in percent set in the config file, overriding -speedTol and -recordTol wherever they aren't 0, and the
+// noise floor overriding -minNs
+type benchTolerances struct {
+	SpeedTol  int `json:"speedTol,omitempty"`
+	RecordTol int `json:"recordTol,omitempty"`
+	MinNs     int `json:"minNs,omitempty"`
+}
+
+func (t benchTolerances) apply(speedTol, recordTol float64) (float64, float64) {
+	if t.SpeedTol > 0 {
+		speedTol = float64(t.SpeedTol) / 100
+	}
+	if t.RecordTol > 0 {
+		recordTol = float64(t.RecordTol) / 100
+	}
+
+	return speedTol, recordTol
+}
+
+func (t benchTolerances) validate() error {
+	if t.SpeedTol < 0 || t.RecordTol < 0 || t.MinNs < 0 {
+		return errors.New("tolerances must not be negative")
+	}
+
+	return nil
+}
+
+// The tolerances of a package, and of its benchmarks by name
+type packageTolerances struct {
+	benchTolerances
+	Benchmarks map[string]benchTolerances `json:"benchmarks,omitempty"`
+}
+
+// The tolerances of benchmarks by name in every package, and of packages by import path or a pattern ending in /...
+type toleranceConfig struct {
+	Benchmarks map[string]benchTolerances   `json:"benchmarks,omitempty"`
+	Packages   map[string]packageTolerances `json:"packages,omitempty"`
+}
+
+func (t toleranceConfig) validate() error {
+	for name, tol := range t.Benchmarks {
+		if err := tol.validate(); err != nil {
+			return errors.New("benchmark " + name + ": " + err.Error())
+		}
+	}
+	for pattern, pkg := range t.Packages {
+		if err := pkg.validate(); err != nil {
+			return errors.New("package " + pattern + ": " + err.Error())
+		}
+		for name, tol := range pkg.Benchmarks {
+			if err := tol.validate(); err != nil {
+				return errors.New("package " + pattern + ", benchmark " + name + ": " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// The tolerances of the package given the run's, and those of its benchmarks. The longest pattern matching the
+// package wins, and its benchmarks' tolerances take precedence over those set for every package.
+func (t toleranceConfig) forPackage(pkgPath string, speedTol, recordTol float64) (float64, float64, map[string]benchTolerances) {
+	pkg := t.packageOf(pkgPath)
+	benches := make(map[string]benchTolerances, len(t.Benchmarks)+len(pkg.Benchmarks))
+	for name, tol := range t.Benchmarks {
+		benches[name] = tol
+	}
+	for name, tol := range pkg.Benchmarks {
+		benches[name] = tol
+	}
+
+	speedTol, recordTol = pkg.apply(speedTol, recordTol)
+	return speedTol, recordTol, benches
+}
+
+// The noise floor of the package given the run's
+func (t toleranceConfig) minNsFor(pkgPath string, minNs int) int {
+	if pkg := t.packageOf(pkgPath); pkg.MinNs > 0 {
+		return pkg.MinNs
+	}
+
+	return minNs
+}
+
+// The tolerances of the longest pattern matching the package
+func (t toleranceConfig) packageOf(pkgPath string) packageTolerances {
+	var pkg packageTolerances
+	longest := -1
+	for pattern, p := range t.Packages {
+		if matchesPackage(pattern, pkgPath) && len(pattern) > longest {
+			pkg, longest = p, len(pattern)
+		}
+	}
+
+	return pkg
+}
+
+// Turns slow benchmarks still faster than their noise floor into OK ones, since a change of a few nanoseconds is
+// noise however large a factor it makes. The floor of a benchmark is its own minNs, or else the package's.
+func floorNoise(results []benchResult, minNs int, tols map[string]benchTolerances) {
+	for i, res := range results {
+		floor := minNs
+		if tol := benchTolerancesOf(tols, res.Name); tol.MinNs > 0 {
+			floor = tol.MinNs
+		}
+		if res.Status == statusSlow && res.Speed < uint64(floor) {
+			logTrace("Benchmark", res.Name, "reports a speed", res.Factor, "as fast as the old version, but at", res.Speed, "ns/op it's under the noise floor of", floor, "ns/op")
+			results[i].Status = statusOK
+		}
+	}
+}
+
+// The tolerances set for the benchmark by its full name, or else by the name of its closest parent that has any, so
+// the tolerances of a benchmark cover all of its sub-benchmarks
+func benchTolerancesOf(benches map[string]benchTolerances, name string) benchTolerances {
+	if tol, ok := benches[name]; ok {
+		return tol
+	}
+	for _, parent := range benchParents(name) {
+		if tol, ok := benches[parent]; ok {
+			return tol
+		}
+	}
+
+	return benchTolerances{}
+}
+
+// Whether the pattern is the import path, or ends in /... and covers it
+func matchesPackage(pattern, pkgPath string) bool {
+	prefix := strings.TrimSuffix(pattern, "/...")
+	return pattern == pkgPath || prefix != pattern && (pkgPath == prefix || strings.HasPrefix(pkgPath, prefix+"/"))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTolerancesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.json")
+	raw := `{
+		"speedTol": 120,
+		"benchmarks": {"BenchmarkHotPath": {"speedTol": 110}, "BenchmarkFlaky": {"speedTol": 300}},
+		"packages": {
+			"example.com/mod/...": {"speedTol": 200, "recordTol": 50},
+			"example.com/mod/core": {"benchmarks": {"BenchmarkHotPath": {"speedTol": 105}}}
+		}
+	}`
+	if err := ioutil.WriteFile(file, []byte(raw), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SpeedTol != 120 || cfg.RecordTol != 0 {
+		t.Errorf("Loaded the default tolerances as %+v", cfg.benchTolerances)
+	}
+
+	speedTol, recordTol, tols := cfg.forPackage("example.com/mod/util", 1.5, 0.7)
+	if speedTol != 2 || recordTol != 0.5 {
+		t.Errorf("Got the tolerances %v and %v for a package matching a pattern", speedTol, recordTol)
+	}
+	if tol := benchTolerancesOf(tols, "BenchmarkHotPath/large"); tol.SpeedTol != 110 {
+		t.Errorf("Got %+v for a sub-benchmark of a benchmark with tolerances", tol)
+	}
+
+	speedTol, recordTol, tols = cfg.forPackage("example.com/mod/core", 1.5, 0.7)
+	if speedTol != 1.5 || recordTol != 0.7 {
+		t.Errorf("Got the tolerances %v and %v for a package without any, expected the run's", speedTol, recordTol)
+	}
+	if tol := benchTolerancesOf(tols, "BenchmarkHotPath"); tol.SpeedTol != 105 {
+		t.Errorf("Got %+v for a benchmark with tolerances in its package", tol)
+	}
+	if tol := benchTolerancesOf(tols, "BenchmarkFlaky"); tol.SpeedTol != 300 {
+		t.Errorf("Got %+v for a benchmark with tolerances in every package", tol)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(`{"packages": {"example.com/mod": {"benchmarks": {"BenchmarkX": {"speedTol": -1}}}}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(file); err == nil {
+		t.Errorf("Loaded a negative tolerance without complaint")
+	}
+}
+
+func TestClassifyWithTolerances(t *testing.T) {
+	groups := []benchGroup{{Name: "hotpath", Benchmarks: []string{"^BenchmarkHot"}, SpeedTol: 120}}
+	if err := compileGroups(groups); err != nil {
+		t.Fatal(err)
+	}
+	tols := map[string]benchTolerances{"BenchmarkHotFlaky": {SpeedTol: 300}, "BenchmarkTight": {SpeedTol: 110}}
+
+	oldBenches := map[string]uint64{"BenchmarkHot": 100, "BenchmarkHotFlaky": 100, "BenchmarkTight": 100, "BenchmarkLoose": 100}
+	benches := map[string]uint64{"BenchmarkHot": 130, "BenchmarkHotFlaky": 250, "BenchmarkTight": 115, "BenchmarkLoose": 140}
+	expected := map[string]benchStatus{"BenchmarkHot": statusSlow, "BenchmarkHotFlaky": statusOK, "BenchmarkTight": statusSlow, "BenchmarkLoose": statusOK}
+	for _, res := range classifyGroups(oldBenches, benches, 1.5, 0.7, groups, tols) {
+		if res.Status != expected[res.Name] {
+			t.Errorf("Classified %s as %s, expected %s", res.Name, res.Status, expected[res.Name])
+		}
+	}
+}
+
+func TestNoiseFloor(t *testing.T) {
+	cfg := toleranceConfig{
+		Benchmarks: map[string]benchTolerances{"BenchmarkTight": {MinNs: 1}},
+		Packages:   map[string]packageTolerances{"example.com/mod/...": {benchTolerances: benchTolerances{MinNs: 100}}},
+	}
+	if minNs := cfg.minNsFor("example.com/other", 50); minNs != 50 {
+		t.Errorf("Got the noise floor %d for a package without one, expected the run's", minNs)
+	}
+	minNs := cfg.minNsFor("example.com/mod/util", 50)
+	if minNs != 100 {
+		t.Errorf("Got the noise floor %d for a package with one", minNs)
+	}
+
+	oldBenches := map[string]uint64{"BenchmarkTiny": 2, "BenchmarkTight": 2, "BenchmarkBig": 20}
+	benches := map[string]uint64{"BenchmarkTiny": 4, "BenchmarkTight": 4, "BenchmarkBig": 120}
+	results, _, _, tooSlow := compare(oldBenches, benches, "example.com/mod/util", 1.5, 0.7, minNs, nil, nil, cfg.Benchmarks, statsComparison{}, rerunner{})
+	expected := map[string]benchStatus{"BenchmarkTiny": statusOK, "BenchmarkTight": statusSlow, "BenchmarkBig": statusSlow}
+	for _, res := range results {
+		if res.Status != expected[res.Name] {
+			t.Errorf("Classified %s as %s, expected %s", res.Name, res.Status, expected[res.Name])
+		}
+	}
+	if !tooSlow {
+		t.Errorf("Didn't fail on the benchmarks over the noise floor")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import "sort"
+
+// The metrics every benchmark reported besides ns/op (e.g. B/op with -benchmem, or anything given to b.ReportMetric),
+// keyed by benchmark name and then unit
+type benchMetrics map[string]map[string]float64
+
+// Which way a unit is better
+const (
+	betterLower  = "lower"
+	betterHigher = "higher"
+)
+
+// How a unit is judged, as set in the config file
+type unitConfig struct {
+	Better          string `json:"better"`                    // Either "lower" or "higher"
+	Tolerance       int    `json:"tolerance,omitempty"`       // Like -speedTol, in the worse direction. -speedTol when 0.
+	RecordTolerance int    `json:"recordTolerance,omitempty"` // Like -recordTol, in the better direction. -recordTol when 0.
+}
+
+// Adds the units -benchmem reports to the units, with the given tolerances, unless they're configured already
+func withMemoryUnits(units map[string]unitConfig, bytesTol, allocsTol int) map[string]unitConfig {
+	withMemory := map[string]unitConfig{
+		"B/op":      {Better: betterLower, Tolerance: bytesTol},
+		"allocs/op": {Better: betterLower, Tolerance: allocsTol},
+	}
+	for unit, u := range units {
+		withMemory[unit] = u
+	}
+
+	return withMemory
+}
+
+// The units judged without being configured: throughput from b.SetBytes, where a drop is the regression. The config
+// file takes precedence.
+func withDefaultUnits(units map[string]unitConfig) map[string]unitConfig {
+	withDefaults := map[string]unitConfig{
+		"MB/s": {Better: betterHigher},
+	}
+	for unit, u := range units {
+		withDefaults[unit] = u
+	}
+
+	return withDefaults
+}
+
+// The status of metrics in units the config file doesn't mention, which are recorded and reported but never judged
+const statusInfo benchStatus = "INFO"
+
+// A single metric of a benchmark compared with its best on record. Best and Factor are zero for a new one.
+type metricResult struct {
+	Name   string
+	Unit   string
+	Value  float64
+	Best   float64
+	Factor float64 // Value/Best, whichever way the unit is better. Zero when Best is, there being no factor against zero.
+	Status benchStatus
+
+	hasBest bool
+}
+
+// Classifies every metric of the new run like classify does speeds, except that the direction and tolerances of each
+// unit come from the config. Units without any are INFO. Metrics that went missing aren't reported, the benchmark
+// they belong to already is.
+//
+// Sorted by benchmark name, then unit.
+func classifyMetrics(oldMetrics, metrics benchMetrics, units map[string]unitConfig, speedTol, recordTol float64) []metricResult {
+	var results []metricResult
+	for _, name := range sortedMetricNames(metrics) {
+		for _, unit := range sortedUnits(metrics[name]) {
+			res := metricResult{Name: name, Unit: unit, Value: metrics[name][unit]}
+			best, ok := oldMetrics[name][unit]
+			if ok {
+				res.Best, res.hasBest = best, true
+				res.Factor, _ = ratio(res.Value, best)
+			}
+
+			u, configured := units[unit]
+			switch {
+			case !configured:
+				res.Status = statusInfo
+			case !ok:
+				res.Status = statusNew
+			default:
+				tol, recTol := speedTol, recordTol
+				if u.Tolerance > 0 {
+					tol = float64(u.Tolerance) / 100
+				}
+				if u.RecordTolerance > 0 {
+					recTol = float64(u.RecordTolerance) / 100
+				}
+
+				// How many times worse the metric got, whichever way is better. Getting worse from zero is
+				// infinitely worse, and getting better from it is a record.
+				worse, finite := ratio(res.Value, best)
+				if u.Better == betterHigher {
+					worse, finite = ratio(best, res.Value)
+				}
+				switch {
+				case !finite || worse > tol:
+					res.Status = statusSlow
+				case worse < recTol:
+					res.Status = statusRecord
+				default:
+					res.Status = statusOK
+				}
+			}
+			results = append(results, res)
+		}
+	}
+
+	return results
+}
+
+// a/b, where nothing changing is a factor of 1. There's no factor of anything else against zero, so it's 0 and false
+// then rather than an infinity, which JSON can't encode.
+func ratio(a, b float64) (float64, bool) {
+	if a == b {
+		return 1, true
+	}
+	if b == 0 {
+		return 0, false
+	}
+
+	return a / b, true
+}
+
+// Logs the metrics that regressed, returning whether any did outside report only groups
+func metricsRegressed(results []metricResult, groups []benchGroup, ignore ignoreList) bool {
+	regressed := false
+	for _, res := range results {
+		if res.Status == statusSlow {
+			logWarn("Benchmark", res.Name, "reports", res.Value, res.Unit, "where the best is", res.Best, "which is worse than expected")
+			regressed = gates(groups, ignore, res.Name) || regressed
+		}
+	}
+
+	return regressed
+}
+
+// The best metrics to store: the old ones, with new metrics and records taken from the run. Units the config doesn't
+// judge keep their latest value.
+func bestMetrics(oldMetrics benchMetrics, results []metricResult) benchMetrics {
+	best := make(benchMetrics, len(oldMetrics))
+	for name, units := range oldMetrics {
+		best[name] = make(map[string]float64, len(units))
+		for unit, value := range units {
+			best[name][unit] = value
+		}
+	}
+
+	for _, res := range results {
+		if res.Status != statusNew && res.Status != statusRecord && res.Status != statusInfo {
+			continue
+		}
+		if best[res.Name] == nil {
+			best[res.Name] = make(map[string]float64)
+		}
+		best[res.Name][res.Unit] = res.Value
+	}
+
+	return best
+}
+
+// Lays out the metrics below the comparison of speeds
+func metricsTable(results []metricResult) *table {
+	tbl := newTable("Status", "Benchmark Name", "Unit", "New", "Best", "Factor (New/Old)")
+	for _, res := range results {
+		value, best, factor := numbers.format(res.Value, -1), numbers.format(res.Best, -1), numbers.factor(res.Factor)
+		switch {
+		case res.Status == statusNew || (res.Status == statusInfo && !res.hasBest):
+			best, factor = "MISSING", "N/A"
+		case res.Factor == 0:
+			// Coming from zero
+			factor = "N/A"
+		}
+		tbl.addRow(string(res.Status), res.Name, res.Unit, value, best, factor)
+	}
+
+	return tbl
+}
+
+func sortedMetricNames(metrics benchMetrics) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func sortedUnits(units map[string]float64) []string {
+	names := make([]string, 0, len(units))
+	for unit := range units {
+		names = append(names, unit)
+	}
+	sort.Strings(names)
+
+	return names
+}
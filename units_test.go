@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyMetrics(t *testing.T) {
+	units := map[string]unitConfig{
+		"allocs/op": {Better: betterLower, Tolerance: 110},
+		"MB/s":      {Better: betterHigher},
+	}
+	oldMetrics := benchMetrics{
+		"BenchmarkA": {"allocs/op": 10, "MB/s": 100, "B/op": 64},
+		"BenchmarkB": {"allocs/op": 0, "MB/s": 100},
+		"BenchmarkD": {"allocs/op": 0, "MB/s": 0},
+	}
+	metrics := benchMetrics{
+		"BenchmarkA": {"allocs/op": 12, "MB/s": 300, "B/op": 128},
+		"BenchmarkB": {"allocs/op": 0, "MB/s": 50},
+		"BenchmarkC": {"allocs/op": 3},
+		"BenchmarkD": {"allocs/op": 1, "MB/s": 10},
+	}
+
+	expected := []metricResult{
+		{Name: "BenchmarkA", Unit: "B/op", Value: 128, Best: 64, Factor: 2, Status: statusInfo, hasBest: true},
+		{Name: "BenchmarkA", Unit: "MB/s", Value: 300, Best: 100, Factor: 3, Status: statusRecord, hasBest: true},
+		{Name: "BenchmarkA", Unit: "allocs/op", Value: 12, Best: 10, Factor: 1.2, Status: statusSlow, hasBest: true},
+		{Name: "BenchmarkB", Unit: "MB/s", Value: 50, Best: 100, Factor: 0.5, Status: statusSlow, hasBest: true},
+		{Name: "BenchmarkB", Unit: "allocs/op", Value: 0, Best: 0, Factor: 1, Status: statusOK, hasBest: true},
+		{Name: "BenchmarkC", Unit: "allocs/op", Value: 3, Status: statusNew},
+		// Nothing is a factor of zero
+		{Name: "BenchmarkD", Unit: "MB/s", Value: 10, Best: 0, Factor: 0, Status: statusRecord, hasBest: true},
+		{Name: "BenchmarkD", Unit: "allocs/op", Value: 1, Best: 0, Factor: 0, Status: statusSlow, hasBest: true},
+	}
+	results := classifyMetrics(oldMetrics, metrics, units, 1.5, 0.7)
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Classified the metrics as\n%v\nexpected\n%v", results, expected)
+	}
+
+	best := bestMetrics(oldMetrics, results)
+	expectedBest := benchMetrics{
+		"BenchmarkA": {"allocs/op": 10, "MB/s": 300, "B/op": 128},
+		"BenchmarkB": {"allocs/op": 0, "MB/s": 100},
+		"BenchmarkC": {"allocs/op": 3},
+		"BenchmarkD": {"allocs/op": 0, "MB/s": 10},
+	}
+	if !reflect.DeepEqual(best, expectedBest) {
+		t.Errorf("Kept the best metrics %v, expected %v", best, expectedBest)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rebench-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte(`{"units": {"allocs/op": {"better": "lower", "tolerance": 110}}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := cfg.Units["allocs/op"]; u.Better != betterLower || u.Tolerance != 110 {
+		t.Errorf("Loaded the unit as %+v", u)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(`{"units": {"allocs/op": {"better": "fewer"}}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(file); err == nil {
+		t.Errorf("Loaded a unit that's neither lower nor higher is better without complaint")
+	}
+
+	if _, err := loadConfig(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Loaded a missing config file given explicitly without complaint")
+	}
+}
+
+func TestWithMemoryUnits(t *testing.T) {
+	units := withMemoryUnits(map[string]unitConfig{"B/op": {Better: betterLower, Tolerance: 300}}, 120, 110)
+	expected := map[string]unitConfig{
+		"B/op":      {Better: betterLower, Tolerance: 300},
+		"allocs/op": {Better: betterLower, Tolerance: 110},
+	}
+	if !reflect.DeepEqual(units, expected) {
+		t.Errorf("Judged memory with %v, expected %v", units, expected)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	units := withDefaultUnits(nil)
+	old := benchMetrics{"BenchmarkCopy": {"MB/s": 600}, "BenchmarkFast": {"MB/s": 600}}
+	metrics := benchMetrics{"BenchmarkCopy": {"MB/s": 300}, "BenchmarkFast": {"MB/s": 1000}}
+	expected := map[string]benchStatus{"BenchmarkCopy": statusSlow, "BenchmarkFast": statusRecord}
+	for _, res := range classifyMetrics(old, metrics, units, 1.5, 0.7) {
+		if res.Status != expected[res.Name] {
+			t.Errorf("Classified %s %s as %s, expected %s", res.Name, res.Unit, res.Status, expected[res.Name])
+		}
+	}
+
+	if units := withDefaultUnits(map[string]unitConfig{"MB/s": {Better: betterHigher, Tolerance: 300}}); units["MB/s"].Tolerance != 300 {
+		t.Errorf("Judged MB/s with %+v rather than as configured", units["MB/s"])
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Every run's total benchmarking time for the package, oldest first
+const wallTimeFile = ".bench_walltime.json"
+
+// The time go test took to benchmark a package in one run, as reported on its "ok" line
+type wallTime struct {
+	Time    time.Time `json:"time"`
+	Seconds float64   `json:"seconds"`
+}
+
+func (w wallTime) duration() time.Duration {
+	return time.Duration(w.Seconds * float64(time.Second))
+}
+
+// Compares the wall time of this run with the previous run in the history. The package took too long if the factor
+// between them exceeds wallTol, unless wallTol is 0. Returns the previous wall time, zero if there's none.
+func compareWallTime(history []wallTime, wall time.Duration, wallTol float64) (previous time.Duration, tooLong bool) {
+	if wall == 0 || len(history) == 0 {
+		return 0, false
+	}
+
+	previous = history[len(history)-1].duration()
+	if previous == 0 {
+		return 0, false
+	}
+
+	factor := float64(wall) / float64(previous)
+	if wallTol > 0 && factor > wallTol {
+		logWarn(fmt.Sprintf("Benchmarking took %v, %s as long as the previous run (%v), flagging", wall, formatFactor(factor), previous))
+		tooLong = true
+	}
+
+	return previous, tooLong
+}
+
+// The line below a package's comparison saying how long it took to benchmark
+func formatWallTime(wall, previous time.Duration) string {
+	if previous == 0 {
+		return fmt.Sprintf("Benchmarking took %v", wall)
+	}
+
+	return fmt.Sprintf("Benchmarking took %v (previously %v, %s)", wall, previous, formatFactor(float64(wall)/float64(previous)))
+}
+
+// Adds the wall time of a run that just finished to the history
+func appendWallTime(history []wallTime, wall time.Duration) []wallTime {
+	return append(history, wallTime{Time: time.Now().UTC(), Seconds: wall.Seconds()})
+}
+
+func loadWallTimes(fileName string) []wallTime {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logWarn("cannot open", fileName, "for current benchmark directory")
+		}
+		return nil
+	}
+
+	var history []wallTime
+	if err := json.Unmarshal(raw, &history); err != nil {
+		logWarn(fmt.Sprintf("cannot unmarshall json for file %s because: %v", fileName, err))
+		return nil
+	}
+
+	return history
+}
+
+func storeWallTimes(fileName string, history []wallTime) {
+	out, err := marshalFile(history)
+	if err != nil {
+		logError("Couldn't marshall wall times as json")
+		return
+	}
+
+	if err := writeFile(fileName, out); err != nil {
+		logError("Couldn't write wall times in current directory")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareWallTime(t *testing.T) {
+	history := []wallTime{{Seconds: 4}, {Seconds: 2}}
+
+	previous, tooLong := compareWallTime(history, 3*time.Second, 1.5)
+	if previous != 2*time.Second || tooLong {
+		t.Errorf("Compared 3s with the previous 2s wrong, got %v %v", previous, tooLong)
+	}
+
+	if _, tooLong = compareWallTime(history, 4*time.Second, 1.5); !tooLong {
+		t.Errorf("Taking twice as long as the previous run with a tolerance of 1.5 wasn't too long")
+	}
+
+	if _, tooLong = compareWallTime(history, 4*time.Second, 0); tooLong {
+		t.Errorf("Taking longer was too long without a tolerance")
+	}
+
+	if previous, tooLong = compareWallTime(nil, 4*time.Second, 1.5); previous != 0 || tooLong {
+		t.Errorf("Compared with a run without history, got %v %v", previous, tooLong)
+	}
+}
+
+func TestWallTimeHistory(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+
+	for i := 0; i < 2; i++ {
+		if code := rebench(testOptions); code != 0 {
+			t.Fatalf("Program returned non-zero exit code %d for valid invocation", code)
+		}
+	}
+
+	history := loadWallTimes(wallTimeFile)
+	if len(history) != 2 {
+		t.Fatalf("Expected a wall time for each of the two runs, got %v", history)
+	}
+	for _, w := range history {
+		if w.Seconds <= 0 || w.Time.IsZero() {
+			t.Errorf("Recorded a nonsensical wall time %v", w)
+		}
+	}
+}
+
+func TestWallTimeTooLong(t *testing.T) {
+	top := cd(t)
+	defer cleanup(top)
+	storeWallTimes(wallTimeFile, []wallTime{{Time: time.Now(), Seconds: 0.001}})
+
+	opts := testOptions
+	opts.wallTolPercent = 150
+	if code := rebench(opts); code == 0 {
+		t.Errorf("Program returned good exit code when benchmarking took far longer than the previous run")
+	}
+
+	opts.wallTolPercent = 0
+	if code := rebench(opts); code != 0 {
+		t.Errorf("Program failed on wall time without -wallTol")
+	}
+}